@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/flokli/theme-switcher/pkg/control"
+	"github.com/flokli/theme-switcher/pkg/switcher"
+	log "github.com/sirupsen/logrus"
+)
+
+// setMode writes mode to the source, if it supports it, and applies it to all backends.
+// This is used if no daemon is running.
+func setMode(ctx context.Context, g *Globals, mode switcher.Mode) error {
+	s, err := g.switcher()
+	if err != nil {
+		return err
+	}
+
+	source, err := g.source(ctx)
+	if err != nil {
+		return err
+	}
+	if setter, ok := source.(switcher.Setter); ok {
+		if err := setter.Set(ctx, mode); err != nil {
+			return fmt.Errorf("unable to set %s: %w", source.Name(), err)
+		}
+	} else {
+		log.WithField("source", source.Name()).Debug("source can't be written to, only applying to backends")
+	}
+
+	s.Apply(switcher.WithAppearance(ctx, switcher.ReadAppearance(ctx, source)), mode)
+	return nil
+}
+
+// SetCmd sets the mode.
+type SetCmd struct {
+	Mode string        `arg:"" help:"The mode to switch to (light, dark, no-preference, or one defined with --modes), or auto to clear an override"`
+	For  time.Duration `help:"Override the mode for the given duration, ignoring changes of the color scheme (needs a running daemon)"`
+}
+
+func (c *SetCmd) Run(ctx context.Context, g *Globals) error {
+	req := control.Request{Command: "set", Mode: c.Mode}
+	if c.For > 0 {
+		req.For = c.For.String()
+	}
+
+	// don't let a running daemon actually switch in dry-run mode.
+	err := fmt.Errorf("%w: dry run", control.ErrNotRunning)
+	if !switcher.IsDryRun(ctx) {
+		_, err = g.callDaemon(ctx, req)
+	}
+	if !errors.Is(err, control.ErrNotRunning) {
+		return err
+	}
+
+	if c.Mode == "auto" || c.For > 0 {
+		return fmt.Errorf("unable to override mode: %w", err)
+	}
+
+	log.WithError(err).Debug("switching without daemon")
+	mode, err := switcher.ParseMode(c.Mode)
+	if err != nil {
+		return err
+	}
+	return setMode(ctx, g, mode)
+}
+
+// ToggleCmd switches to the opposite of the current mode.
+type ToggleCmd struct{}
+
+func (c *ToggleCmd) Run(ctx context.Context, g *Globals) error {
+	err := fmt.Errorf("%w: dry run", control.ErrNotRunning)
+	if !switcher.IsDryRun(ctx) {
+		_, err = g.callDaemon(ctx, control.Request{Command: "toggle"})
+	}
+	if !errors.Is(err, control.ErrNotRunning) {
+		return err
+	}
+
+	log.WithError(err).Debug("switching without daemon")
+	source, err := g.source(ctx)
+	if err != nil {
+		return err
+	}
+	mode, err := source.Get(ctx)
+	if err != nil {
+		return fmt.Errorf("unable to get current mode: %w", err)
+	}
+	return setMode(ctx, g, mode.Toggled())
+}
+
+// GetCmd prints the current mode.
+type GetCmd struct{}
+
+func (c *GetCmd) Run(ctx context.Context, g *Globals) error {
+	// prefer asking the daemon, as the mode might be overridden.
+	if resp, err := g.callDaemon(ctx, control.Request{Command: "status"}); err == nil && resp.Mode != "" {
+		fmt.Println(resp.Mode)
+		return nil
+	}
+
+	source, err := g.source(ctx)
+	if err != nil {
+		return err
+	}
+	mode, err := source.Get(ctx)
+	if err != nil {
+		return fmt.Errorf("unable to get current mode: %w", err)
+	}
+	fmt.Println(mode)
+	return nil
+}
+
+// StatusCmd prints the current mode and the state of all backends.
+type StatusCmd struct{}
+
+func (c *StatusCmd) Run(ctx context.Context, g *Globals) error {
+	source, err := g.source(ctx)
+	if err != nil {
+		return err
+	}
+	s, err := g.switcher()
+	if err != nil {
+		return err
+	}
+
+	if resp, err := g.callDaemon(ctx, control.Request{Command: "status"}); err != nil {
+		fmt.Printf("daemon: not running (%v)\n", err)
+	} else {
+		fmt.Printf("daemon: running\ndaemon mode: %s\n", resp.Mode)
+		if resp.OverrideUntil != nil {
+			fmt.Printf("overridden until: %s\n", resp.OverrideUntil.Format(time.RFC3339))
+		}
+	}
+
+	mode, err := source.Get(ctx)
+	if err != nil {
+		fmt.Printf("source: %s (error: %v)\n", source.Name(), err)
+	} else {
+		fmt.Printf("source: %s\nmode: %s\n", source.Name(), mode)
+	}
+
+	state, err := switcher.LoadState(s.StatePath)
+	if err != nil {
+		fmt.Printf("last applied: unknown (%v)\n", err)
+	} else if state != nil {
+		fmt.Printf("last applied: %s at %s\n", state.Mode, state.AppliedAt.Format(time.RFC3339))
+		if state.RolledBack {
+			fmt.Println("rolled back, as switching to another mode failed")
+		}
+	}
+
+	fmt.Println("backends:")
+	for _, b := range s.Backends {
+		if err := b.Detect(ctx); err != nil {
+			fmt.Printf("  %s: unavailable (%v)\n", b.Name(), err)
+		} else {
+			fmt.Printf("  %s: available\n", b.Name())
+		}
+
+		if state == nil {
+			continue
+		}
+		if backendState, ok := state.Backends[b.Name()]; !ok {
+			fmt.Printf("    last applied: never\n")
+		} else if backendState.Error != "" {
+			fmt.Printf("    last applied: failed (%s)\n", backendState.Error)
+		} else if backendState.Missing != "" {
+			fmt.Printf("    last applied: skipped (%s)\n", backendState.Missing)
+		} else if backendState.Skipped != "" {
+			fmt.Printf("    last applied: skipped by %s\n", backendState.Skipped)
+		} else if backendState.Theme != "" {
+			fmt.Printf("    last applied: %s\n", backendState.Theme)
+		} else {
+			fmt.Printf("    last applied: ok\n")
+		}
+	}
+	return nil
+}
+
+// RestoreCmd rolls the files backends modified back to their backups.
+type RestoreCmd struct{}
+
+func (c *RestoreCmd) Run(ctx context.Context, g *Globals) error {
+	backups, err := g.backups()
+	if err != nil {
+		return err
+	}
+	if backups == nil {
+		return errors.New("backups are disabled")
+	}
+	if err := backups.Restore(ctx); err != nil {
+		return err
+	}
+	if switcher.IsDryRun(ctx) {
+		return nil
+	}
+
+	// forget the mode applied last, so the daemon applies it again on startup.
+	statePath, err := g.statePath()
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(statePath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("unable to remove state file: %w", err)
+	}
+	return nil
+}
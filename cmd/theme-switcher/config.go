@@ -0,0 +1,490 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/alecthomas/kong"
+	"github.com/flokli/theme-switcher/pkg/switcher"
+	"github.com/fsnotify/fsnotify"
+	log "github.com/sirupsen/logrus"
+)
+
+// configDebounce is how long changes of the configuration file need to
+// settle before it's reloaded, as editors tend to write files in steps.
+const configDebounce = 200 * time.Millisecond
+
+// configPath returns the path of the configuration file,
+// $THEME_SWITCHER_CONFIG, or ~/.config/theme-switcher/config.toml.
+func configPath() (string, error) {
+	if path := os.Getenv("THEME_SWITCHER_CONFIG"); path != "" {
+		return path, nil
+	}
+	confDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("unable to determine user config dir: %w", err)
+	}
+	return filepath.Join(confDir, "theme-switcher", "config.toml"), nil
+}
+
+// newParser returns the parser of the command line into c, resolving flags
+// not passed from the configuration file at path.
+func newParser(c *CLI, path string) (*kong.Kong, error) {
+	options := []kong.Option{platformDefaults(), kong.NamedMapper("path", kong.MapperFunc(pathMapper))}
+	config, err := loadTOMLConfig(path)
+	if err != nil {
+		return nil, err
+	}
+	if config != nil {
+		options = append(options, kong.Resolvers(config))
+	}
+	return kong.New(c, options...)
+}
+
+// expandPath expands environment variables, like $XDG_CONFIG_HOME, and a
+// leading ~ in path, and makes it absolute.
+func expandPath(path string) string {
+	if path == "" {
+		return ""
+	}
+	return kong.ExpandPath(os.ExpandEnv(path))
+}
+
+// pathMapper decodes flags of type path with expandPath, as the
+// configuration file isn't expanded by a shell.
+func pathMapper(ctx *kong.DecodeContext, target reflect.Value) error {
+	var path string
+	if err := ctx.Scan.PopValueInto("path", &path); err != nil {
+		return err
+	}
+	target.SetString(expandPath(path))
+	return nil
+}
+
+// tomlConfig resolves flags not passed on the command line from a TOML file.
+//
+// Keys are flag names, and tables group flags sharing a prefix, so
+// kitty-themes can be set as `themes` in a `[kitty]` table. Flags of a command
+// can also be set in a table named after it, like `[daemon]`. Map flags take
+// a table, like `[command]`. Tables in `[host.NAME]` take precedence on the
+// machine of that hostname, and ones in `[profile.NAME]` over both with
+// --profile NAME.
+//
+// Files matching the globs in `include`, relative to the including file, are
+// merged in first, so the including file takes precedence, and later
+// includes over earlier ones.
+type tomlConfig struct {
+	values map[string]interface{}
+	// files are the configuration file and the ones it includes, in the
+	// order they were read.
+	files []string
+	// includes are the absolute globs of the included files.
+	includes []string
+}
+
+// fileError is an error reading the configuration file at path, or one it
+// includes.
+type fileError struct {
+	path string
+	err  error
+}
+
+func (e *fileError) Error() string { return fmt.Sprintf("%s: %v", e.path, e.err) }
+
+func (e *fileError) Unwrap() error { return e.err }
+
+// loadTOMLConfig reads the configuration file at path, and the ones it
+// includes. It returns nil if there's no file at path.
+func loadTOMLConfig(path string) (*tomlConfig, error) {
+	if path == "" {
+		return nil, nil
+	}
+	path = expandPath(path)
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	c := &tomlConfig{}
+	values, err := c.read(path, map[string]bool{})
+	if err != nil {
+		return nil, err
+	}
+	c.values = values
+	return c, nil
+}
+
+// read returns the values of the file at path, merged over the ones of the
+// files it includes. Including a file that's still being read, as it
+// includes this one, is rejected.
+func (c *tomlConfig) read(path string, reading map[string]bool) (map[string]interface{}, error) {
+	if reading[path] {
+		return nil, &fileError{path: path, err: errors.New("included recursively")}
+	}
+	reading[path] = true
+	defer delete(reading, path)
+	c.files = append(c.files, path)
+
+	values := map[string]interface{}{}
+	if _, err := toml.DecodeFile(path, &values); err != nil {
+		return nil, &fileError{path: path, err: err}
+	}
+	hoistConditions(values)
+	var patterns []string
+	switch include := values["include"].(type) {
+	case nil:
+	case string:
+		patterns = []string{include}
+	case []interface{}:
+		for _, pattern := range include {
+			pattern, ok := pattern.(string)
+			if !ok {
+				return nil, &fileError{path: path, err: errors.New("include needs to be a list of globs")}
+			}
+			patterns = append(patterns, pattern)
+		}
+	default:
+		return nil, &fileError{path: path, err: errors.New("include needs to be a list of globs")}
+	}
+	delete(values, "include")
+
+	merged := map[string]interface{}{}
+	for _, pattern := range patterns {
+		pattern = os.ExpandEnv(pattern)
+		if !filepath.IsAbs(pattern) && !strings.HasPrefix(pattern, "~") {
+			pattern = filepath.Join(filepath.Dir(path), pattern)
+		}
+		pattern = kong.ExpandPath(pattern)
+		c.includes = append(c.includes, pattern)
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, &fileError{path: path, err: fmt.Errorf("invalid include %s: %w", pattern, err)}
+		}
+		// globs matching nothing are fine, missing files are likely typos.
+		if len(matches) == 0 && !strings.ContainsAny(pattern, "*?[") {
+			return nil, &fileError{path: path, err: fmt.Errorf("included file %s doesn't exist", pattern)}
+		}
+		for _, match := range matches {
+			included, err := c.read(match, reading)
+			if err != nil {
+				return nil, err
+			}
+			mergeTables(merged, included)
+		}
+	}
+	mergeTables(merged, values)
+	return merged, nil
+}
+
+// mergeTables merges the values of src into dst, merging tables present in
+// both, and replacing everything else.
+func mergeTables(dst, src map[string]interface{}) {
+	for key, value := range src {
+		if table, ok := value.(map[string]interface{}); ok {
+			if existing, ok := dst[key].(map[string]interface{}); ok {
+				mergeTables(existing, table)
+				continue
+			}
+		}
+		dst[key] = value
+	}
+}
+
+// lookup finds the value of the flag name in table, trying all ways of
+// splitting it into nested tables.
+func lookup(table map[string]interface{}, name string) (interface{}, bool) {
+	for key, value := range table {
+		key = strings.ReplaceAll(key, "_", "-")
+		if key == name {
+			return value, true
+		}
+		if rest := strings.TrimPrefix(name, key+"-"); rest != name {
+			if t, ok := value.(map[string]interface{}); ok {
+				if v, ok := lookup(t, rest); ok {
+					return v, true
+				}
+			}
+		}
+	}
+	return nil, false
+}
+
+// lookupFlag finds the value of flag in table, looking up flags of commands
+// in their tables first.
+func lookupFlag(table map[string]interface{}, parent *kong.Path, flag *kong.Flag) (interface{}, bool) {
+	if parent.Command != nil {
+		if t, isTable := table[parent.Command.Name].(map[string]interface{}); isTable {
+			if v, ok := lookup(t, flag.Name); ok {
+				return v, true
+			}
+		}
+	}
+	return lookup(table, flag.Name)
+}
+
+// profile returns the table of the profile selected with --profile, or nil if
+// there's none. Unknown profiles are rejected by checkProfile.
+func (c *tomlConfig) profile(kctx *kong.Context) map[string]interface{} {
+	for _, flag := range kctx.Flags() {
+		if flag.Name == "profile" {
+			name, _ := kctx.FlagValue(flag).(string)
+			profiles, _ := c.values["profile"].(map[string]interface{})
+			profile, _ := profiles[name].(map[string]interface{})
+			return profile
+		}
+	}
+	return nil
+}
+
+// host returns the table of this machine in the host table, by its hostname,
+// or the first label of it, or nil if there's none.
+func (c *tomlConfig) host() map[string]interface{} {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil
+	}
+	hosts, _ := c.values["host"].(map[string]interface{})
+	short, _, _ := strings.Cut(hostname, ".")
+	for _, name := range []string{hostname, short} {
+		if host, ok := hosts[name].(map[string]interface{}); ok {
+			return host
+		}
+	}
+	return nil
+}
+
+// checkProfile returns an error if profile is set, but not defined in the
+// configuration file at path.
+func checkProfile(path, profile string) error {
+	if profile == "" {
+		return nil
+	}
+	config, err := loadTOMLConfig(path)
+	if err != nil {
+		return fmt.Errorf("unable to read configuration: %w", err)
+	}
+	var profiles map[string]interface{}
+	if config != nil {
+		profiles, _ = config.values["profile"].(map[string]interface{})
+	}
+	if _, ok := profiles[profile]; !ok {
+		return fmt.Errorf("unknown profile: %s", profile)
+	}
+	return nil
+}
+
+func (c *tomlConfig) Resolve(kctx *kong.Context, parent *kong.Path, flag *kong.Flag) (interface{}, error) {
+	// the profile table holds the profiles, not the one to use.
+	if flag.Name == "profile" {
+		return nil, nil
+	}
+	v, ok := interface{}(nil), false
+	for _, table := range []map[string]interface{}{c.profile(kctx), c.host(), c.values} {
+		if table == nil {
+			continue
+		}
+		if v, ok = lookupFlag(table, parent, flag); ok {
+			break
+		}
+	}
+	if !ok {
+		return nil, nil
+	}
+	// kong doesn't convert integers to floats.
+	if i, isInt := v.(int64); isInt && flag.Target.Kind() == reflect.Float64 {
+		return float64(i), nil
+	}
+	return v, nil
+}
+
+// unknownKeys returns the keys not belonging to any flag of app, dotted like
+// kitty.themes, sorted.
+func (c *tomlConfig) unknownKeys(app *kong.Application) []string {
+	flags := map[string]bool{}
+	commands := map[string]bool{}
+	var walk func(node *kong.Node)
+	walk = func(node *kong.Node) {
+		for _, flag := range node.Flags {
+			flags[flag.Name] = true
+		}
+		for _, child := range node.Children {
+			commands[child.Name] = true
+			walk(child)
+		}
+	}
+	walk(app.Node)
+
+	var unknown []string
+	// prefix is prepended to the keys of table to get flag names, and where
+	// to get their dotted keys.
+	var check func(table map[string]interface{}, prefix, where string)
+	check = func(table map[string]interface{}, prefix, where string) {
+		for key, value := range table {
+			name := prefix + strings.ReplaceAll(key, "_", "-")
+			if t, ok := value.(map[string]interface{}); ok && where == "" && (name == "profile" || name == "host") {
+				for overrides, o := range t {
+					if o, ok := o.(map[string]interface{}); ok {
+						check(o, "", name+"."+overrides+".")
+					} else {
+						unknown = append(unknown, name+"."+overrides)
+					}
+				}
+				continue
+			}
+			if flags[name] {
+				continue
+			}
+			if t, ok := value.(map[string]interface{}); ok {
+				if prefix == "" && commands[name] {
+					check(t, "", where+key+".")
+				} else {
+					check(t, name+"-", where+key+".")
+				}
+				continue
+			}
+			unknown = append(unknown, where+key)
+		}
+	}
+	check(c.values, "", "")
+
+	sort.Strings(unknown)
+	return unknown
+}
+
+// Validate returns an error for keys not belonging to any flag.
+func (c *tomlConfig) Validate(app *kong.Application) error {
+	if unknown := c.unknownKeys(app); len(unknown) > 0 {
+		return fmt.Errorf("unknown configuration keys: %s", strings.Join(unknown, ", "))
+	}
+	return nil
+}
+
+// reparse parses the command line again, with the configuration file at
+// path as it is now, and the pack in use.
+func reparse(path string) (*CLI, error) {
+	var c CLI
+	parser, err := newParser(&c, path)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := parser.Parse(os.Args[1:]); err != nil {
+		return nil, err
+	}
+	if err := checkProfile(path, c.Profile); err != nil {
+		return nil, err
+	}
+	if err := c.defineModes(); err != nil {
+		return nil, err
+	}
+	if err := c.usePack(); err != nil {
+		log.WithError(err).Warn("unable to use theme pack")
+	}
+	return &c, nil
+}
+
+// reloadSwitcher parses the command line again, with the configuration file
+// at path as it is now, and returns the switcher for the backends it configures.
+func reloadSwitcher(path string) (*switcher.Switcher, error) {
+	c, err := reparse(path)
+	if err != nil {
+		return nil, err
+	}
+	if logLevel, err := log.ParseLevel(c.LogLevel); err == nil {
+		log.SetLevel(logLevel)
+	}
+	return c.Globals.switcher()
+}
+
+// watchConfig watches the configuration file at path, the files it
+// includes, and the file recording the pack in use, at packPath, and
+// replaces the switcher of daemon whenever they change, until ctx is done.
+// Invalid configurations are logged, and the previous one is kept.
+func watchConfig(ctx context.Context, path, packPath string, daemon *switcher.Daemon) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("unable to create file watcher: %w", err)
+	}
+	defer watcher.Close()
+
+	// editors often replace the file instead of writing to it, so watch the directory.
+	path, packPath = filepath.Clean(path), filepath.Clean(packPath)
+	watched := make(map[string]bool)
+	for _, dir := range []string{filepath.Dir(path), filepath.Dir(packPath)} {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return fmt.Errorf("unable to create %s: %w", dir, err)
+		}
+		if err := watcher.Add(dir); err != nil {
+			return fmt.Errorf("unable to watch %s: %w", dir, err)
+		}
+		watched[dir] = true
+	}
+
+	// the directories of included files are watched as well, as far as
+	// their globs don't span directories.
+	var includes []string
+	watchIncludes := func() {
+		config, err := loadTOMLConfig(path)
+		if err != nil || config == nil {
+			return
+		}
+		includes = config.includes
+		for _, include := range includes {
+			dir := filepath.Dir(include)
+			if watched[dir] || strings.ContainsAny(dir, "*?[") {
+				continue
+			}
+			if err := watcher.Add(dir); err != nil {
+				log.WithError(err).Warnf("unable to watch %s", dir)
+				continue
+			}
+			watched[dir] = true
+		}
+	}
+	watchIncludes()
+	isIncluded := func(name string) bool {
+		for _, include := range includes {
+			if ok, _ := filepath.Match(include, name); ok {
+				return true
+			}
+		}
+		return false
+	}
+
+	var debounced <-chan time.Time
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if name := filepath.Clean(event.Name); name == path || name == packPath || isIncluded(name) {
+				debounced = time.After(configDebounce)
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			return fmt.Errorf("unable to watch configuration file: %w", err)
+		case <-debounced:
+			debounced = nil
+			watchIncludes()
+			s, err := reloadSwitcher(path)
+			if err != nil {
+				log.WithError(err).Warn("unable to reload configuration, keeping the previous one")
+				continue
+			}
+			log.Infof("reloaded %s", path)
+			if err := daemon.Replace(ctx, s); err != nil {
+				return nil
+			}
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"text/template"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ConfigInitCmd writes a starter configuration file, with the applications
+// found on PATH set up to switch between Catppuccin themes.
+type ConfigInitCmd struct {
+	Force  bool `help:"Overwrite an existing configuration file"`
+	Stdout bool `help:"Print the configuration instead of writing it"`
+}
+
+// starterConfig is the data starterConfigTemplate is executed with.
+type starterConfig struct {
+	// Backends are the backends of the applications found.
+	Backends []string
+	// KittyConfig and HelixConfig are where kitty and helix read their
+	// config from, if they were found.
+	// Paths are absolute, and shortened with ~ in the configuration.
+	KittyConfig string
+	HelixConfig string
+	// Alacritty is the alacritty template, if alacritty was found.
+	Alacritty *starterTemplate
+}
+
+// starterTemplate is a template the starter configuration renders.
+type starterTemplate struct {
+	Source string
+	Target string
+	// Config is the config file of the application, importing Target.
+	Config string
+}
+
+var starterConfigTemplate = template.Must(template.New("config.toml").Funcs(template.FuncMap{
+	"quote": strconv.Quote,
+	"tilde": tildePath,
+	"list": func(l []string) string {
+		quoted := make([]string, len(l))
+		for i, s := range l {
+			quoted[i] = strconv.Quote(s)
+		}
+		return "[" + strings.Join(quoted, ", ") + "]"
+	},
+}).Parse(`# theme-switcher configuration, see
+# https://github.com/flokli/theme-switcher#configuration-file
+# Check it with: theme-switcher config validate
+
+# Where to read the color scheme from, auto picks the one of the desktop.
+# source = ["auto"]
+
+{{if .Backends -}}
+backends = {{list .Backends}}
+{{- else -}}
+# None of kitty and helix were found, enable them once installed.
+# backends = ["kitty", "helix"]
+{{- end}}
+{{- if .Alacritty}}
+
+# The colors passed to templates, defined in [palettes.catppuccin].
+palette = "catppuccin"
+{{- end}}
+{{if .KittyConfig}}
+# The themes kitten includes current-theme.conf from {{tilde .KittyConfig}}.
+[kitty]
+themes = ["Catppuccin-Latte", "Catppuccin-Mocha"]
+{{end}}
+{{- if .HelixConfig}}
+# The theme is set in {{tilde .HelixConfig}}.
+[helix]
+themes = ["catppuccin_latte", "catppuccin_macchiato"]
+{{end}}
+{{- if .Alacritty}}
+# alacritty reloads the colors by itself, if {{tilde .Alacritty.Config}} imports them:
+# [general]
+# import = [{{quote (tilde .Alacritty.Target)}}]
+[template]
+alacritty = {{quote (printf "%s,%s" (tilde .Alacritty.Source) (tilde .Alacritty.Target))}}
+
+# Catppuccin Latte and Mocha.
+[palettes.catppuccin.light]
+background = "#eff1f5"
+foreground = "#4c4f69"
+cursor = "#dc8a78"
+black = "#5c5f77"
+red = "#d20f39"
+green = "#40a02b"
+yellow = "#df8e1d"
+blue = "#1e66f5"
+magenta = "#ea76cb"
+cyan = "#179299"
+white = "#acb0be"
+bright_black = "#6c6f85"
+bright_white = "#bcc0cc"
+
+[palettes.catppuccin.dark]
+background = "#1e1e2e"
+foreground = "#cdd6f4"
+cursor = "#f5e0dc"
+black = "#45475a"
+red = "#f38ba8"
+green = "#a6e3a1"
+yellow = "#f9e2af"
+blue = "#89b4fa"
+magenta = "#f5c2e7"
+cyan = "#94e2d5"
+white = "#bac2de"
+bright_black = "#585b70"
+bright_white = "#a6adc8"
+{{end -}}
+`))
+
+// alacrittyTemplate renders the colors of the palette for alacritty.
+const alacrittyTemplate = `# Written by theme-switcher in {{.Mode}} mode, edit the template instead.
+[colors.primary]
+background = "{{.Colors.background}}"
+foreground = "{{.Colors.foreground}}"
+
+[colors.cursor]
+cursor = "{{.Colors.cursor}}"
+text = "{{.Colors.background}}"
+
+[colors.normal]
+black = "{{.Colors.black}}"
+red = "{{.Colors.red}}"
+green = "{{.Colors.green}}"
+yellow = "{{.Colors.yellow}}"
+blue = "{{.Colors.blue}}"
+magenta = "{{.Colors.magenta}}"
+cyan = "{{.Colors.cyan}}"
+white = "{{.Colors.white}}"
+
+[colors.bright]
+black = "{{.Colors.bright_black}}"
+red = "{{.Colors.red}}"
+green = "{{.Colors.green}}"
+yellow = "{{.Colors.yellow}}"
+blue = "{{.Colors.blue}}"
+magenta = "{{.Colors.magenta}}"
+cyan = "{{.Colors.cyan}}"
+white = "{{.Colors.bright_white}}"
+`
+
+// appConfigDir returns the directory applications following the XDG layout,
+// like kitty, helix and alacritty, keep their config in. On macOS, that's
+// ~/.config too, not ~/Library/Application Support.
+func appConfigDir() (string, error) {
+	if runtime.GOOS == "darwin" {
+		if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+			return dir, nil
+		}
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("unable to determine home dir: %w", err)
+		}
+		return filepath.Join(homeDir, ".config"), nil
+	}
+	confDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("unable to determine user config dir: %w", err)
+	}
+	return confDir, nil
+}
+
+// tildePath replaces the home directory at the start of path with ~, so the
+// configuration works for other users too.
+func tildePath(path string) string {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	if rel, err := filepath.Rel(homeDir, path); err == nil && !strings.HasPrefix(rel, "..") {
+		return filepath.ToSlash(filepath.Join("~", rel))
+	}
+	return path
+}
+
+// detectStarterConfig returns the starter configuration for the applications
+// found on PATH. Templates are placed next to the configuration file at path.
+func detectStarterConfig(path string) (*starterConfig, error) {
+	appDir, err := appConfigDir()
+	if err != nil {
+		return nil, err
+	}
+	found := func(executable string) bool {
+		_, err := exec.LookPath(executable)
+		log.WithField("executable", executable).Debugf("found: %v", err == nil)
+		return err == nil
+	}
+
+	var c starterConfig
+	if found("kitty") {
+		c.Backends = append(c.Backends, "kitty")
+		kittyDir := os.Getenv("KITTY_CONFIG_DIRECTORY")
+		if kittyDir == "" {
+			kittyDir = filepath.Join(appDir, "kitty")
+		}
+		c.KittyConfig = filepath.Join(kittyDir, "kitty.conf")
+	}
+	if found("hx") {
+		c.Backends = append(c.Backends, "helix")
+		c.HelixConfig = filepath.Join(appDir, "helix", "config.toml")
+	}
+	if found("alacritty") {
+		c.Alacritty = &starterTemplate{
+			Source: filepath.Join(filepath.Dir(path), "templates", "alacritty.toml"),
+			Target: filepath.Join(appDir, "alacritty", "theme.toml"),
+			Config: filepath.Join(appDir, "alacritty", "alacritty.toml"),
+		}
+	}
+	return &c, nil
+}
+
+func (c *ConfigInitCmd) Run(ctx context.Context) error {
+	path, err := configPath()
+	if err != nil {
+		return err
+	}
+	starter, err := detectStarterConfig(path)
+	if err != nil {
+		return err
+	}
+	var config strings.Builder
+	if err := starterConfigTemplate.Execute(&config, starter); err != nil {
+		return fmt.Errorf("unable to render configuration: %w", err)
+	}
+	if c.Stdout {
+		fmt.Print(config.String())
+		return nil
+	}
+
+	if _, err := os.Stat(path); err == nil && !c.Force {
+		return fmt.Errorf("%s already exists, pass --force to overwrite it", path)
+	} else if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("unable to stat %s: %w", path, err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("unable to create config dir: %w", err)
+	}
+	if err := os.WriteFile(path, []byte(config.String()), 0o644); err != nil {
+		return fmt.Errorf("unable to write configuration: %w", err)
+	}
+	log.Infof("wrote %s", path)
+
+	// keep templates the user already edited.
+	if starter.Alacritty != nil {
+		source := starter.Alacritty.Source
+		if _, err := os.Stat(source); errors.Is(err, os.ErrNotExist) {
+			if err := os.MkdirAll(filepath.Dir(source), 0o755); err != nil {
+				return fmt.Errorf("unable to create template dir: %w", err)
+			}
+			if err := os.WriteFile(source, []byte(alacrittyTemplate), 0o644); err != nil {
+				return fmt.Errorf("unable to write template: %w", err)
+			}
+			log.Infof("wrote %s", source)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/flokli/theme-switcher/internal/lock"
+	"github.com/flokli/theme-switcher/internal/sdnotify"
+	"github.com/flokli/theme-switcher/pkg/control"
+	"github.com/flokli/theme-switcher/pkg/sources"
+	"github.com/flokli/theme-switcher/pkg/switcher"
+	log "github.com/sirupsen/logrus"
+)
+
+// DaemonCmd watches the source for changes, and applies them.
+type DaemonCmd struct {
+	DBus            bool          `name:"dbus" help:"Expose the org.flokli.ThemeSwitcher control service on the session bus" default:"true" negatable:""`
+	Debounce        time.Duration `help:"How long color scheme changes need to settle before switching" default:"200ms"`
+	GlobalShortcut  bool          `help:"Register a global shortcut toggling the mode through the GlobalShortcuts portal"`
+	ShortcutTrigger string        `placeholder:"TRIGGER" help:"Trigger to suggest for the global shortcut (like CTRL+ALT+t), the desktop lets the user choose otherwise"`
+	HTTPListen      string        `name:"http-listen" placeholder:"ADDR" help:"Serve a REST API on ADDR (like localhost:8377, or unix:PATH)"`
+	HTTPToken       string        `name:"http-token" env:"THEME_SWITCHER_HTTP_TOKEN" help:"Token clients of the REST API need to send as Authorization: Bearer TOKEN, required to listen on other than loopback addresses"`
+	MQTTBroker      string        `name:"mqtt-broker" placeholder:"URL" help:"Connect to the MQTT broker at URL (like tcp://localhost:1883, or tls://host:8883)"`
+	MQTTTopic       string        `name:"mqtt-topic" help:"Prefix of the MQTT topics to use" default:"theme-switcher"`
+	MQTTUsername    string        `name:"mqtt-username" help:"User name to authenticate to the MQTT broker with"`
+	MQTTPassword    string        `name:"mqtt-password" env:"THEME_SWITCHER_MQTT_PASSWORD" help:"Password to authenticate to the MQTT broker with, along with --mqtt-username"`
+	PullInterval    time.Duration `help:"Update the configurations fetched with config pull this often, like 1h (default: never)"`
+	PauseWhen       []string      `help:"Defer switching while presenting: while the screen is shared, or a window is fullscreen, or while away: while the session is locked, or idle (screencast, fullscreen, locked, idle)"`
+	ReloadConfig    bool          `help:"Reload the configuration file whenever it changes, switching the backends it configures" default:"true" negatable:""`
+	ShutdownTimeout time.Duration `help:"How long to wait for backends still switching on shutdown" default:"10s"`
+	Tray            bool          `help:"Show a tray icon (StatusNotifierItem) for the current mode, with a menu to set it"`
+}
+
+// lock takes the lock held by the running daemon, next to the state file, so
+// a second one, like one started manually besides the systemd unit, doesn't
+// switch the same files.
+func (g *Globals) lock() (*lock.Lock, error) {
+	statePath, err := g.statePath()
+	if err != nil {
+		return nil, err
+	}
+	l, err := lock.Acquire(filepath.Join(filepath.Dir(statePath), "daemon.lock"))
+	if errors.Is(err, lock.ErrLocked) {
+		return nil, fmt.Errorf("another daemon is already running: %w", err)
+	}
+	return l, err
+}
+
+func (d *DaemonCmd) Run(ctx context.Context, g *Globals) error {
+	// dry runs don't modify anything, so they can run besides a daemon.
+	if !switcher.IsDryRun(ctx) {
+		l, err := g.lock()
+		if err != nil {
+			return err
+		}
+		defer l.Release()
+	}
+
+	s, err := g.switcher()
+	if err != nil {
+		return err
+	}
+
+	source, err := g.source(ctx)
+	if err != nil {
+		return err
+	}
+
+	daemon := switcher.NewDaemon(s, source)
+	daemon.Debounce = d.Debounce
+	daemon.ShutdownTimeout = d.ShutdownTimeout
+
+	if len(d.PauseWhen) > 0 {
+		presenting := &sources.Presenting{}
+		away := &sources.Away{}
+		for _, when := range d.PauseWhen {
+			switch when {
+			case "screencast":
+				presenting.ScreenCast = true
+			case "fullscreen":
+				presenting.Fullscreen = true
+			case "locked":
+				away.Locked = true
+			case "idle":
+				away.Idle = true
+			default:
+				return fmt.Errorf("unknown pause condition: %s", when)
+			}
+		}
+		var pausers sources.Pausers
+		if presenting.ScreenCast || presenting.Fullscreen {
+			pausers = append(pausers, presenting)
+		}
+		if away.Locked || away.Idle {
+			pausers = append(pausers, away)
+		}
+		daemon.Pauser = pausers
+	}
+
+	// tell systemd we're ready once the source is watched, and keep the watchdog happy.
+	daemon.OnReady = func() { sdNotify(sdnotify.Ready) }
+	watchdogInterval, err := sdnotify.WatchdogInterval()
+	if err != nil {
+		log.WithError(err).Warn("unable to determine watchdog interval")
+	}
+	if watchdogInterval > 0 {
+		daemon.OnHeartbeat = func() { sdNotify(sdnotify.Watchdog) }
+		daemon.HeartbeatInterval = watchdogInterval / 2
+	}
+
+	go handleSignals(ctx, daemon)
+
+	if d.DBus {
+		go func() {
+			if err := control.ServeDBus(ctx, daemon); err != nil {
+				log.WithError(err).Warn("unable to serve D-Bus control service")
+			}
+		}()
+	}
+
+	if socketPath, err := g.socketPath(); err != nil {
+		log.WithError(err).Warn("unable to determine control socket path")
+	} else if socketPath != "" {
+		go func() {
+			if err := control.ServeSocket(ctx, daemon, socketPath); err != nil {
+				log.WithError(err).Warn("unable to serve control socket")
+			}
+		}()
+	}
+
+	if d.GlobalShortcut {
+		go func() {
+			if err := control.ServeShortcuts(ctx, daemon, d.ShortcutTrigger); err != nil {
+				log.WithError(err).Warn("unable to register global shortcut")
+			}
+		}()
+	}
+
+	if d.ReloadConfig {
+		path, err := configPath()
+		var packPath string
+		if err == nil {
+			packPath, err = g.packPath()
+		}
+		if err != nil {
+			log.WithError(err).Warn("unable to determine configuration file path, not reloading it")
+		} else {
+			go func() {
+				if err := watchConfig(ctx, path, packPath, daemon); err != nil {
+					log.WithError(err).Warn("unable to watch configuration file, not reloading it")
+				}
+			}()
+		}
+	}
+
+	if d.PullInterval > 0 {
+		// changed includes are reloaded like the configuration file.
+		go func() {
+			ticker := time.NewTicker(d.PullInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+					if err := pullAll(ctx); err != nil {
+						log.WithError(err).Warn("unable to update fetched configurations")
+					}
+				}
+			}
+		}()
+	}
+
+	if d.Tray {
+		go func() {
+			if err := control.ServeTray(ctx, daemon); err != nil {
+				log.WithError(err).Warn("unable to show tray icon")
+			}
+		}()
+	}
+
+	if d.HTTPListen != "" {
+		go func() {
+			if err := control.ServeHTTP(ctx, daemon, d.HTTPListen, d.HTTPToken); err != nil {
+				log.WithError(err).Warn("unable to serve HTTP API")
+			}
+		}()
+	}
+
+	if d.MQTTBroker != "" {
+		go func() {
+			if err := control.ServeMQTT(ctx, daemon, control.MQTTOptions{
+				Broker:   d.MQTTBroker,
+				Username: d.MQTTUsername,
+				Password: d.MQTTPassword,
+				Topic:    d.MQTTTopic,
+			}); err != nil {
+				log.WithError(err).Warn("unable to connect to MQTT broker")
+			}
+		}()
+	}
+
+	if err := daemon.Run(ctx); err != nil {
+		return err
+	}
+
+	log.Info("received interrput, stopping")
+	sdNotify(sdnotify.Stopping)
+	return nil
+}
+
+// sdNotify sends state to systemd, if we're running as a notify service.
+func sdNotify(state string) {
+	if _, err := sdnotify.Notify(state); err != nil {
+		log.WithError(err).Warn("unable to notify systemd")
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/alecthomas/kong"
+	"github.com/flokli/theme-switcher/pkg/backends"
+	"github.com/flokli/theme-switcher/pkg/palette"
+	"github.com/flokli/theme-switcher/pkg/switcher"
+)
+
+// derivedThemes maps the names of themes defined in the configuration to the
+// theme they inherit from, as "inherits", and the colors they override.
+type derivedThemes map[string]map[string]string
+
+// Decode decodes a field of a theme passed on the command line as
+// NAME.inherits=THEME or NAME.COLOR=#RRGGBB, or the themes table of the
+// configuration file.
+func (t *derivedThemes) Decode(ctx *kong.DecodeContext) error {
+	if *t == nil {
+		*t = derivedThemes{}
+	}
+	token := ctx.Scan.Pop()
+	switch value := token.Value.(type) {
+	case string:
+		key, field, ok := strings.Cut(value, "=")
+		name, key, dotted := strings.Cut(key, ".")
+		if !ok || !dotted {
+			return fmt.Errorf("expected NAME.inherits=THEME or NAME.COLOR=#RRGGBB, got %q", value)
+		}
+		t.add(name, key, field)
+	case map[string]interface{}:
+		for name, fields := range value {
+			fields, ok := fields.(map[string]interface{})
+			if !ok {
+				return fmt.Errorf("theme %s needs to be a table", name)
+			}
+			for key, field := range fields {
+				t.add(name, key, fmt.Sprint(field))
+			}
+		}
+	default:
+		return fmt.Errorf("unexpected themes %v", token)
+	}
+	return nil
+}
+
+func (t derivedThemes) add(name, key, value string) {
+	if t[name] == nil {
+		t[name] = map[string]string{}
+	}
+	t[name][key] = value
+}
+
+// resolve follows the themes each theme inherits from, up to one of the
+// application, and merges their colors, the ones closer to the theme taking
+// precedence.
+func (t derivedThemes) resolve() (backends.DerivedThemes, error) {
+	resolved := make(backends.DerivedThemes, len(t))
+	for name := range t {
+		var chain []map[string]string
+		seen := map[string]bool{}
+		base := name
+		for fields, ok := t[base]; ok; fields, ok = t[base] {
+			if seen[base] {
+				return nil, fmt.Errorf("theme %s inherits from itself", name)
+			}
+			seen[base] = true
+			chain = append(chain, fields)
+			if base = fields["inherits"]; base == "" {
+				return nil, fmt.Errorf("theme %s needs to inherit from another", name)
+			}
+		}
+		colors := map[string]string{}
+		for i := len(chain) - 1; i >= 0; i-- {
+			for key, value := range chain[i] {
+				if key != "inherits" {
+					colors[key] = value
+				}
+			}
+		}
+		parsed, err := palette.Parse(colors)
+		if err != nil {
+			return nil, fmt.Errorf("theme %s: %w", name, err)
+		}
+		resolved[name] = backends.DerivedTheme{Base: base, Colors: parsed}
+	}
+	return resolved, nil
+}
+
+// derivesThemes returns whether backend writes derived themes itself, others
+// get the themes they're derived from.
+func derivesThemes(backend string) bool {
+	return backend == "kitty" || backend == "helix"
+}
+
+// resolveThemes replaces the derived themes of backend with the themes they
+// inherit from, unless it writes them itself.
+func (g *Globals) resolveThemes(backend string, themes switcher.Themes) error {
+	derived, err := g.Themes.resolve()
+	if err != nil || derivesThemes(backend) {
+		return err
+	}
+	for mode, theme := range themes {
+		themes[mode] = derived.Base(theme)
+	}
+	return nil
+}
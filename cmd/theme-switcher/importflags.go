@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/alecthomas/kong"
+)
+
+// ConfigImportFlagsCmd prints the configuration file equivalent to flags,
+// to move them from the command line, like in a systemd unit, into the file.
+type ConfigImportFlagsCmd struct {
+	Args []string `arg:"" optional:"" passthrough:"" help:"Command line to convert, without the executable, like the one of a systemd unit (default: the flags passed before config)"`
+}
+
+// flagsConfig returns the configuration file values of the flags passed on
+// the command line parsed into kctx: global flags at the top, and the ones of
+// commands in a table named after them.
+func flagsConfig(kctx *kong.Context) map[string]interface{} {
+	owners := make(map[*kong.Flag]*kong.Node)
+	var walk func(node *kong.Node)
+	walk = func(node *kong.Node) {
+		for _, flag := range node.Flags {
+			owners[flag] = node
+		}
+		for _, child := range node.Children {
+			walk(child)
+		}
+	}
+	walk(kctx.Model.Node)
+
+	values := make(map[string]interface{})
+	for _, p := range kctx.Path {
+		// profiles are picked on the command line, not in the file.
+		if p.Flag == nil || p.Resolved || p.Flag.Name == "help" || p.Flag.Name == "profile" {
+			continue
+		}
+		table := values
+		if owner := owners[p.Flag]; owner != nil && owner.Type == kong.CommandNode {
+			name := strings.ReplaceAll(owner.Name, "-", "_")
+			if _, ok := values[name]; !ok {
+				values[name] = make(map[string]interface{})
+			}
+			table = values[name].(map[string]interface{})
+		}
+		value := p.Flag.Target.Interface()
+		switch v := value.(type) {
+		case time.Duration:
+			value = v.String()
+		case namedPalettes:
+			value = v.table()
+		}
+		table[strings.ReplaceAll(p.Flag.Name, "-", "_")] = value
+	}
+	return values
+}
+
+func (c *ConfigImportFlagsCmd) Run(kctx *kong.Context) error {
+	if len(c.Args) > 0 {
+		// parse the command line alone, without the configuration file.
+		var cli CLI
+		parser, err := kong.New(&cli, platformDefaults(), kong.NamedMapper("path", kong.MapperFunc(pathMapper)))
+		if err != nil {
+			return err
+		}
+		if kctx, err = parser.Parse(c.Args); err != nil {
+			return fmt.Errorf("unable to parse command line: %w", err)
+		}
+	}
+	if err := toml.NewEncoder(os.Stdout).Encode(flagsConfig(kctx)); err != nil {
+		return fmt.Errorf("unable to write configuration: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/alecthomas/kong"
+	"github.com/flokli/theme-switcher/internal/diff"
+	"github.com/flokli/theme-switcher/pkg/switcher"
+	log "github.com/sirupsen/logrus"
+)
+
+// InstallCmd installs integrations with other software.
+type InstallCmd struct {
+	SystemdUnit InstallSystemdUnitCmd `cmd:"" help:"Install a systemd user unit running the daemon"`
+}
+
+// InstallSystemdUnitCmd writes a systemd user unit running the daemon with
+// the currently passed global flags.
+type InstallSystemdUnitCmd struct {
+	Enable bool `help:"Reload systemd, and enable and start the unit"`
+	Force  bool `help:"Overwrite an existing unit file"`
+}
+
+const systemdUnitName = "theme-switcher.service"
+
+const systemdUnitTemplate = `[Unit]
+Description=Switch application themes with the desktop color scheme
+
+[Service]
+Type=notify
+ExecStart=%s
+# should be well above --backend-timeout, times --retries + 1
+WatchdogSec=3min
+Restart=on-failure
+
+[Install]
+WantedBy=default.target
+`
+
+// systemdQuote quotes s for use as a single argument in a systemd command line.
+func systemdQuote(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, `%`, `%%`, `$`, `$$`)
+	return `"` + r.Replace(s) + `"`
+}
+
+// execStart returns the command line running the daemon with args, for ExecStart.
+func execStart(executable string, args []string) string {
+	quoted := []string{systemdQuote(executable)}
+	for _, arg := range args {
+		quoted = append(quoted, systemdQuote(arg))
+	}
+	return strings.Join(append(quoted, "daemon"), " ")
+}
+
+// globalFlagArgs returns the global flags explicitly passed on the command line,
+// as --name=value arguments. Flags set in the configuration file are left out,
+// and so is --dry-run, which the daemon isn't meant to run with. Slices and
+// maps are passed an element or entry per argument, repeating the flag.
+func globalFlagArgs(kctx *kong.Context) []string {
+	globalFlags := make(map[*kong.Flag]bool)
+	for _, f := range kctx.Model.Flags {
+		globalFlags[f] = true
+	}
+
+	var args []string
+	// a flag repeated on the command line is in the path once per
+	// occurrence, but its target holds all of them.
+	seen := make(map[*kong.Flag]bool)
+	for _, p := range kctx.Path {
+		// the daemon reads the configuration file itself.
+		if p.Flag == nil || !globalFlags[p.Flag] || p.Resolved || seen[p.Flag] || p.Flag.Name == "dry-run" {
+			continue
+		}
+		seen[p.Flag] = true
+
+		name := "--" + p.Flag.Name
+		v := p.Flag.Target
+		switch v.Kind() {
+		case reflect.Bool:
+			if v.Bool() {
+				args = append(args, name)
+			} else {
+				args = append(args, "--no-"+p.Flag.Name)
+			}
+		case reflect.Slice:
+			for i := 0; i < v.Len(); i++ {
+				args = append(args, name+"="+escapeSep(fmt.Sprint(v.Index(i).Interface()), p.Flag.Tag.Sep))
+			}
+		case reflect.Map:
+			entries := make([]string, 0, v.Len())
+			iter := v.MapRange()
+			for iter.Next() {
+				entries = append(entries, fmt.Sprintf("%v=%v", iter.Key().Interface(), iter.Value().Interface()))
+			}
+			sort.Strings(entries)
+			for _, entry := range entries {
+				args = append(args, name+"="+escapeSep(entry, p.Flag.Tag.MapSep))
+			}
+		default:
+			args = append(args, fmt.Sprintf("%s=%v", name, v.Interface()))
+		}
+	}
+	return args
+}
+
+// escapeSep escapes sep in s, so kong doesn't split it there. A sep of -1
+// stands for sep:"none", which kong doesn't split on.
+func escapeSep(s string, sep rune) string {
+	if sep == -1 {
+		return s
+	}
+	return strings.ReplaceAll(s, string(sep), `\`+string(sep))
+}
+
+func (c *InstallSystemdUnitCmd) Run(ctx context.Context, kctx *kong.Context) error {
+	executable, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("unable to determine path to executable: %w", err)
+	}
+
+	confDir, err := os.UserConfigDir()
+	if err != nil {
+		return fmt.Errorf("unable to determine user config dir: %w", err)
+	}
+	unitPath := filepath.Join(confDir, "systemd", "user", systemdUnitName)
+
+	if _, err := os.Stat(unitPath); err == nil && !c.Force {
+		return fmt.Errorf("%s already exists, pass --force to overwrite it", unitPath)
+	} else if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("unable to stat %s: %w", unitPath, err)
+	}
+
+	unit := fmt.Sprintf(systemdUnitTemplate, execStart(executable, globalFlagArgs(kctx)))
+	if switcher.IsDryRun(ctx) {
+		// old is empty if there's none yet, so it's all shown as added.
+		old, _ := os.ReadFile(unitPath)
+		log.Infof("would write %s", unitPath)
+		fmt.Print(diff.Unified(unitPath, string(old), unit))
+		if c.Enable {
+			log.Infof("would run systemctl --user daemon-reload and systemctl --user enable --now %s", systemdUnitName)
+		}
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(unitPath), 0o755); err != nil {
+		return fmt.Errorf("unable to create unit dir: %w", err)
+	}
+	if err := os.WriteFile(unitPath, []byte(unit), 0o644); err != nil {
+		return fmt.Errorf("unable to write unit file: %w", err)
+	}
+	log.Infof("wrote %s", unitPath)
+
+	if !c.Enable {
+		return nil
+	}
+
+	for _, args := range [][]string{
+		{"--user", "daemon-reload"},
+		{"--user", "enable", "--now", systemdUnitName},
+	} {
+		cmd := exec.CommandContext(ctx, "systemctl", args...)
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("unable to run systemctl %s: %w", strings.Join(args, " "), err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/kong"
+)
+
+// systemdUnquote splits an ExecStart command line quoted with systemdQuote
+// into its arguments, like systemd does.
+func systemdUnquote(t *testing.T, line string) []string {
+	var args []string
+	for line != "" {
+		if line[0] == ' ' {
+			line = line[1:]
+			continue
+		}
+		if line[0] != '"' {
+			end := strings.IndexByte(line, ' ')
+			if end < 0 {
+				end = len(line)
+			}
+			args = append(args, line[:end])
+			line = line[end:]
+			continue
+		}
+		var arg strings.Builder
+		i := 1
+		for ; i < len(line) && line[i] != '"'; i++ {
+			switch c := line[i]; {
+			case c == '\\' || ((c == '%' || c == '$') && i+1 < len(line) && line[i+1] == c):
+				i++
+				arg.WriteByte(line[i])
+			default:
+				arg.WriteByte(c)
+			}
+		}
+		if i == len(line) {
+			t.Fatalf("unterminated argument in %s", line)
+		}
+		args = append(args, arg.String())
+		line = line[i+1:]
+	}
+	return args
+}
+
+func TestExecStartParses(t *testing.T) {
+	newParser := func(c *CLI) *kong.Kong {
+		parser, err := kong.New(c, platformDefaults(), kong.NamedMapper("path", kong.MapperFunc(pathMapper)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return parser
+	}
+
+	var installed CLI
+	kctx, err := newParser(&installed).Parse([]string{
+		"--dry-run",
+		"--command", "foo=echo {mode}",
+		"--command", "bar=echo x",
+		"--weekday-schedule", "sat=09:00-21:00",
+		"--weekday-schedule", "sun=10:00-20:00",
+		"--template", "gtk=~/gtk.tmpl,~/.config/gtk.css,pkill -HUP x",
+		"--when", `kitty=env.TERM != "" && running('kitty')`,
+		"--light-colors", "bg=#ffffff;fg=#000000",
+		"--delay", "gtk=200ms",
+		"--backends", "kitty,helix",
+		"--kitty-themes", "Catppuccin-Latte", "--kitty-themes", "Catppuccin-Mocha",
+		"--schedule", "08:00-20:00",
+		"--light-offset", "45m",
+		"--log-level", "debug",
+		"install", "systemd-unit",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	args := systemdUnquote(t, execStart("/usr/bin/theme switcher", globalFlagArgs(kctx)))
+	if args[0] != "/usr/bin/theme switcher" || args[len(args)-1] != "daemon" {
+		t.Fatalf("got %q, want the executable and daemon command", args)
+	}
+	for _, arg := range args {
+		if arg == "--dry-run" {
+			t.Error("--dry-run passed to the daemon")
+		}
+	}
+
+	var daemon CLI
+	if _, err := newParser(&daemon).Parse(args[1:]); err != nil {
+		t.Fatalf("parsing %q: %v", args, err)
+	}
+	installed.DryRun = false
+	if !reflect.DeepEqual(daemon.Globals, installed.Globals) {
+		t.Errorf("daemon runs with\n%+v\nwant\n%+v\nfrom %q", daemon.Globals, installed.Globals, args)
+	}
+}
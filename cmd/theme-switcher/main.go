@@ -0,0 +1,744 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"runtime"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/alecthomas/kong"
+	"github.com/flokli/theme-switcher/pkg/backends"
+	"github.com/flokli/theme-switcher/pkg/control"
+	"github.com/flokli/theme-switcher/pkg/hooks"
+	"github.com/flokli/theme-switcher/pkg/palette"
+	"github.com/flokli/theme-switcher/pkg/sources"
+	"github.com/flokli/theme-switcher/pkg/switcher"
+	log "github.com/sirupsen/logrus"
+)
+
+// Globals contains the flags shared by all commands.
+type Globals struct {
+	LogLevel              string            `enum:"trace,debug,info,warn,error,fatal,panic" help:"The log level to log with" default:"info"`
+	Profile               string            `env:"THEME_SWITCHER_PROFILE" help:"Profile of the configuration file to use, overriding its flags with the ones in [profile.NAME]"`
+	DryRun                bool              `help:"Only log the commands that would run, and print diffs of the files that would be modified"`
+	Source                []string          `enum:"auto,gsettings,portal,kde,macos,windows,sun,schedule,ambient-light,night-light,xfce,cinnamon,mate,file,darkman,follow,manual" help:"Where to read the color scheme from (${enum}). auto picks the one of the current desktop, falling back to the schedule. With multiple, the first one available is followed, and manual lets modes set with the set command hold against the sources after it" default:"auto"`
+	Follow                string            `placeholder:"URL" help:"HTTP API of another theme-switcher instance to mirror the mode of with the follow source, like http://desktop:8377, or unix:PATH"`
+	FollowToken           string            `env:"THEME_SWITCHER_FOLLOW_TOKEN" help:"Token the HTTP API followed requires (its --http-token)"`
+	Location              string            `placeholder:"LATITUDE,LONGITUDE" help:"Where to calculate sunrise and sunset for, with the sun source (default: ask geoclue)"`
+	LightOffset           time.Duration     `help:"Switch to light mode this long after sunrise with the sun source, or before if negative, like 45m"`
+	DarkOffset            time.Duration     `help:"Switch to dark mode this long after sunset with the sun source, or before if negative, like -30m"`
+	Schedule              string            `placeholder:"HH:MM-HH:MM" help:"When to use light mode with the schedule source, dark mode is used the rest of the day" default:"07:00-19:00"`
+	WeekdaySchedules      []string          `name:"weekday-schedule" sep:"none" placeholder:"DAYS=HH:MM-HH:MM" help:"Use another --schedule on some days of the week, like sat,sun=09:00-21:00 or mon-fri=07:00-18:00. Can be repeated, later ones take precedence"`
+	DarkBelowLux          float64           `name:"dark-below-lux" help:"Ambient light level below which the ambient-light source switches to dark mode" default:"50"`
+	LightAboveLux         float64           `name:"light-above-lux" help:"Ambient light level above which the ambient-light source switches to light mode" default:"200"`
+	KDEColorSchemes       []string          `name:"kde-color-schemes" help:"KDE color schemes to apply in light and dark mode, and optionally with no preference, when setting the mode with the kde source" default:"BreezeLight,BreezeDark"`
+	XfceThemes            []string          `help:"GTK themes to use in light and dark mode, and optionally with no preference, with the xfce backend, or when setting the mode with the xfce source" default:"Adwaita,Adwaita-dark"`
+	CinnamonThemes        []string          `help:"GTK themes to apply in light and dark mode, and optionally with no preference, when setting the mode with the cinnamon source" default:"Mint-Y,Mint-Y-Dark"`
+	MATEThemes            []string          `name:"mate-themes" help:"GTK themes to apply in light and dark mode, and optionally with no preference, when setting the mode with the mate source" default:"Menta,BlackMATE"`
+	ModeFile              string            `help:"File to read the mode from with the file source (default: $XDG_STATE_HOME/theme-mode)" type:"path"`
+	PowerSaveMode         string            `help:"Mode to use while saving power (light, dark, no-preference, or one defined with --modes), instead of the one of the source"`
+	PowerSaveWhen         []string          `help:"When power is saved for --power-save-mode: on battery, in the power-saver profile, or both (battery, power-saver)" default:"battery,power-saver"`
+	WriteGsettings        bool              `name:"write-gsettings" help:"Also write the mode to the GNOME color-scheme setting, if the source is another one"`
+	Backends              []string          `help:"Backends to enable (kitty, helix, iterm2, windows-terminal, neovim, xfce)" default:"${default_backends}"`
+	Commands              map[string]string `name:"command" mapsep:"none" placeholder:"NAME=COMMAND" help:"Run a command on switching, with {mode} and {theme} substituted in its (space-separated) arguments. Can be repeated"`
+	Templates             map[string]string `name:"template" mapsep:"none" placeholder:"NAME=TEMPLATE,TARGET[,RELOAD COMMAND]" help:"Render a Go template into a file on switching, and run a (space-separated) command after it changed. Can be repeated"`
+	Palette               string            `help:"Named palette (see --palettes) to derive the colors passed to templates and hooks from"`
+	Palettes              namedPalettes     `placeholder:"NAME.MODE.COLOR=#RRGGBB" help:"Define a color of a named palette in light or dark mode, to select with --palette. Can be repeated"`
+	LightColors           map[string]string `placeholder:"NAME=COLOR;..." help:"Palette colors passed to templates and hooks in light mode"`
+	DarkColors            map[string]string `placeholder:"NAME=COLOR;..." help:"Palette colors passed to templates and hooks in dark mode"`
+	WallpaperColors       string            `enum:",pywal,wallust" help:"Derive palette colors from the wallpaper of the mode before switching, with pywal or wallust" default:""`
+	Wallpaper             string            `help:"Wallpaper to derive colors from with --wallpaper-colors or --material-colors, if the source doesn't report one" type:"path"`
+	MaterialColors        string            `enum:",wallpaper,accent" help:"Generate colors like Material You's, like primary or surface_container, from the wallpaper or accent color before switching. They approximate Material's tonal palettes, so they're close to, but not the same as, the ones of matugen or Android" default:""`
+	LightScheme           string            `placeholder:"PATH" help:"base16 or base24 scheme (YAML) to add the colors of to the light mode palette" type:"path"`
+	DarkScheme            string            `placeholder:"PATH" help:"base16 or base24 scheme (YAML) to add the colors of to the dark mode palette" type:"path"`
+	Packs                 themePacks        `placeholder:"NAME.BACKEND=LIGHT,DARK[,NO-PREFERENCE]" help:"Define a pack of themes to use in light and dark mode, and optionally with no preference, for each backend, to switch to with the pack command. Can be repeated"`
+	Modes                 map[string]string `placeholder:"NAME=LIGHT|DARK;..." help:"Define modes in addition to light and dark, like oled=dark, to switch to with the set command or the file source. Backends use the themes of the light or dark mode a mode is based on, unless set with --mode-themes"`
+	ModeThemes            modeThemes        `placeholder:"MODE.BACKEND=THEME" help:"Theme a backend uses in a mode, like one defined with --modes. Can be repeated"`
+	Themes                derivedThemes     `placeholder:"NAME.inherits=THEME|NAME.COLOR=#RRGGBB" help:"Define a theme inheriting from another and overriding some of its colors, to use like the themes of the applications. kitty and helix get a theme file written for it, other backends use the theme it inherits from. Can be repeated"`
+	After                 map[string]string `placeholder:"BACKEND=BACKEND,..." help:"Apply a backend only after the (comma-separated) backends it depends on. Can be repeated"`
+	Barriers              []string          `placeholder:"BACKEND,..." help:"Backends to apply before all others, except the ones they're applied after"`
+	Delay                 map[string]string `placeholder:"BACKEND=DURATION" help:"How long to wait after applying a backend, before the ones after it are applied and hooks run, like gtk=200ms, for applications reading the state of others when they reload. Can be repeated"`
+	When                  map[string]string `mapsep:"none" placeholder:"BACKEND=CONDITION" help:"Only switch a backend while the condition holds, like env.XDG_SESSION_TYPE == 'wayland' && running('sway'). Can be repeated"`
+	KittyThemes           []string          `help:"Kitty theme to use in light and dark mode, and optionally with no preference" default:"Catppuccin-Latte,Catppuccin-Mocha"`
+	HelixThemes           []string          `help:"Helix themes to use in light and dark mode, and optionally with no preference" default:"catppuccin_latte,catppuccin_macchiato"`
+	ITerm2Themes          []string          `name:"iterm2-themes" help:"iTerm2 color presets to use in light and dark mode, and optionally with no preference" default:"Light Background,Dark Background"`
+	WindowsTerminalThemes []string          `help:"Windows Terminal color schemes to use in light and dark mode, and optionally with no preference" default:"One Half Light,One Half Dark"`
+	NeovimThemes          []string          `help:"Neovim colorschemes to use in light and dark mode, and optionally with no preference" default:"default,default"`
+	HighContrastThemes    map[string]string `mapsep:"none" placeholder:"BACKEND=LIGHT,DARK[,NO-PREFERENCE]" help:"Themes a backend uses in light and dark mode, and optionally with no preference, while high contrast is enabled. Can be repeated"`
+	ReloadCommands        map[string]string `name:"reload-cmd" mapsep:"none" placeholder:"BACKEND=COMMAND" help:"Run a command to have kitty or helix reload, instead of signalling them, with {mode} and {theme} substituted in its (space-separated) arguments. Can be repeated"`
+	BackendConfigs        map[string]string `name:"backend-config" mapsep:"none" placeholder:"BACKEND=PATH" help:"Where the configuration of a backend is, instead of its default location: helix's config.toml, kitty's config directory, or Windows Terminal's settings.json. Can be repeated"`
+	KittySocket           string            `placeholder:"ADDRESS" help:"Remote control address (see listen_on) to have kitty reload through, instead of signalling it, like unix:/tmp/kitty-* to reach all instances"`
+	Dotfiles              string            `enum:",chezmoi" help:"Dotfile manager to write the files it manages through, instead of modifying them in place, so they don't show a diff after every switch: chezmoi" default:""`
+	ChezmoiArgs           string            `placeholder:"ARGS" help:"Arguments to pass to chezmoi before every command, like --source ~/dotfiles"`
+	BackendTimeout        time.Duration     `help:"How long each backend may take to switch its theme" default:"30s"`
+	CommandTimeout        time.Duration     `help:"How long each command run by a backend, like kitty's themes kitten, may take before it's killed" default:"10s"`
+	MaxParallel           int               `help:"How many backends to switch at the same time, 0 for no limit" default:"0"`
+	Retries               int               `help:"How often to retry switching a backend that failed" default:"2"`
+	RetryDelay            time.Duration     `help:"How long to wait before the first retry, doubling for every further one" default:"1s"`
+	Rollback              bool              `help:"Switch all backends back to the previous mode if any of them fails"`
+	MissingBackends       string            `enum:"skip,warn,error" help:"What to do with backends whose application isn't installed or configured, like kitty not being on PATH: skip them, skip them with a warning, or count them as failed (${enum})" default:"skip"`
+	HooksDir              string            `help:"Directory of executables to run before and after switching (default: ~/.config/theme-switcher/hooks.d)" type:"path"`
+	Scripts               []string          `name:"script" placeholder:"PATH" help:"Starlark script deciding which backends to switch, and running before and after switching. Can be repeated"`
+	PluginsDir            string            `help:"Directory of external backend executables (default: ~/.config/theme-switcher/backends)" type:"path"`
+	DarkmanScripts        bool              `help:"Run darkman's dark-mode.d and light-mode.d scripts after switching" default:"true" negatable:""`
+	StateFile             string            `help:"Where to record the mode applied last (default: $XDG_STATE_HOME/theme-switcher/state.json)" type:"path"`
+	BackupDir             string            `help:"Where to save a copy of each file backends modify before modifying it the first time, for restore, or \"-\" to disable it (default: $XDG_STATE_HOME/theme-switcher/backups)"`
+	Socket                string            `help:"Path of the daemon control socket, or \"-\" to disable it (default: $XDG_RUNTIME_DIR/theme-switcher.sock)"`
+}
+
+// statePath returns the path of the state file.
+func (g *Globals) statePath() (string, error) {
+	if g.StateFile != "" {
+		return g.StateFile, nil
+	}
+	return switcher.DefaultStatePath()
+}
+
+// backups returns where copies of the files backends modify are saved, or nil
+// if it's disabled.
+func (g *Globals) backups() (*backends.Backups, error) {
+	switch g.BackupDir {
+	case "-":
+		return nil, nil
+	case "":
+		dir, err := backends.DefaultBackupDir()
+		if err != nil {
+			return nil, err
+		}
+		return &backends.Backups{Dir: dir}, nil
+	default:
+		return &backends.Backups{Dir: expandPath(g.BackupDir)}, nil
+	}
+}
+
+// socketPath returns the path of the control socket, or an empty string if it's disabled.
+func (g *Globals) socketPath() (string, error) {
+	switch g.Socket {
+	case "-":
+		return "", nil
+	case "":
+		return control.SocketPath()
+	default:
+		return expandPath(g.Socket), nil
+	}
+}
+
+// callDaemon sends a request to the running daemon.
+// It returns an error wrapping control.ErrNotRunning if there is none.
+func (g *Globals) callDaemon(ctx context.Context, req control.Request) (*control.Response, error) {
+	socketPath, err := g.socketPath()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", control.ErrNotRunning, err)
+	}
+	if socketPath == "" {
+		return nil, fmt.Errorf("%w: control socket disabled", control.ErrNotRunning)
+	}
+	return control.Call(ctx, socketPath, req)
+}
+
+// source returns the configured source, detecting it with "auto".
+// Multiple sources are followed by precedence.
+func (g *Globals) source(ctx context.Context) (switcher.Source, error) {
+	var all []switcher.Source
+	for _, name := range g.Source {
+		var source switcher.Source
+		switch name {
+		case "auto":
+			desktops := make(map[string]switcher.Source)
+			for desktop, name := range map[string]string{"KDE": "kde", "XFCE": "xfce", "X-CINNAMON": "cinnamon", "MATE": "mate"} {
+				source, err := g.namedSource(name)
+				if err != nil {
+					return nil, err
+				}
+				desktops[desktop] = source
+			}
+			schedule, err := g.namedSource("schedule")
+			if err != nil {
+				return nil, err
+			}
+			if source, err = sources.Detect(ctx, sources.Candidates(desktops, schedule)...); err != nil {
+				return nil, err
+			}
+		case "gsettings":
+			var err error
+			if source, err = g.gsettingsSource(ctx); err != nil {
+				return nil, err
+			}
+		default:
+			var err error
+			if source, err = g.namedSource(name); err != nil {
+				return nil, err
+			}
+		}
+		all = append(all, source)
+	}
+
+	var source switcher.Source
+	switch len(all) {
+	case 0:
+		return nil, errors.New("no source configured")
+	case 1:
+		source = all[0]
+	default:
+		source = &sources.Precedence{Sources: all}
+	}
+
+	if g.PowerSaveMode != "" {
+		mode, err := switcher.ParseMode(g.PowerSaveMode)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --power-save-mode: %w", err)
+		}
+		powerSaving := &sources.PowerSaving{Source: source, Mode: mode}
+		for _, when := range g.PowerSaveWhen {
+			switch when {
+			case "battery":
+				powerSaving.OnBattery = true
+			case "power-saver":
+				powerSaving.PowerSaver = true
+			default:
+				return nil, fmt.Errorf("unknown power saving condition: %s", when)
+			}
+		}
+		source = powerSaving
+	}
+
+	if _, isGSettings := source.(*sources.GSettings); g.WriteGsettings && !isGSettings {
+		source = &sources.Synced{Source: source, To: &sources.GSettings{}}
+	}
+	return source, nil
+}
+
+// gsettingsSource returns the gsettings source, or, if it isn't usable, like
+// without GNOME's schemas, the portal or the schedule, whichever works first.
+func (g *Globals) gsettingsSource(ctx context.Context) (switcher.Source, error) {
+	gsettings := &sources.GSettings{}
+	err := gsettings.Detect(ctx)
+	if err == nil {
+		return gsettings, nil
+	}
+	schedule, scheduleErr := g.namedSource("schedule")
+	if scheduleErr != nil {
+		return nil, scheduleErr
+	}
+	source, detectErr := sources.Detect(ctx, &sources.Portal{}, schedule)
+	if detectErr != nil {
+		return nil, fmt.Errorf("gsettings source not usable: %w, and neither is any fallback: %v", err, detectErr)
+	}
+	log.WithError(err).Warnf("gsettings source not usable, falling back to the %s source", source.Name())
+	return source, nil
+}
+
+// usesSource returns true if the source of the given name is configured.
+func (g *Globals) usesSource(name string) bool {
+	for _, source := range g.Source {
+		if source == name {
+			return true
+		}
+	}
+	return false
+}
+
+// namedSource returns the source of the given name, configured from the flags.
+func (g *Globals) namedSource(name string) (switcher.Source, error) {
+	switch name {
+	case "portal":
+		return &sources.Portal{}, nil
+	case "macos":
+		return &sources.MacOS{}, nil
+	case "windows":
+		return &sources.Windows{}, nil
+	case "sun":
+		sun := &sources.Sun{LightOffset: g.LightOffset, DarkOffset: g.DarkOffset}
+		if g.Location != "" {
+			location, err := sources.ParseLocation(g.Location)
+			if err != nil {
+				return nil, err
+			}
+			sun.Location = &location
+		}
+		return sun, nil
+	case "schedule":
+		schedule, err := sources.ParseSchedule(g.Schedule)
+		if err != nil {
+			return nil, err
+		}
+		for _, weekdays := range g.WeekdaySchedules {
+			days, times, ok := strings.Cut(weekdays, "=")
+			if !ok {
+				return nil, fmt.Errorf("invalid weekday schedule %s, expected DAYS=HH:MM-HH:MM", weekdays)
+			}
+			if err := schedule.SetWeekdays(days, times); err != nil {
+				return nil, err
+			}
+		}
+		return schedule, nil
+	case "ambient-light":
+		if g.DarkBelowLux > g.LightAboveLux {
+			return nil, fmt.Errorf("--dark-below-lux must not be above --light-above-lux")
+		}
+		return &sources.AmbientLight{DarkBelow: g.DarkBelowLux, LightAbove: g.LightAboveLux}, nil
+	case "kde":
+		themes, err := g.themes("kde", "KDE color schemes", g.KDEColorSchemes)
+		if err != nil {
+			return nil, err
+		}
+		return &sources.KDE{Themes: themes}, nil
+	case "xfce":
+		themes, err := g.themes("xfce", "Xfce themes", g.XfceThemes)
+		if err != nil {
+			return nil, err
+		}
+		return &sources.Xfce{Themes: themes}, nil
+	case "cinnamon":
+		themes, err := g.themes("cinnamon", "Cinnamon themes", g.CinnamonThemes)
+		if err != nil {
+			return nil, err
+		}
+		return sources.NewCinnamon(themes), nil
+	case "mate":
+		themes, err := g.themes("mate", "MATE themes", g.MATEThemes)
+		if err != nil {
+			return nil, err
+		}
+		return sources.NewMATE(themes), nil
+	case "night-light":
+		return &sources.NightLight{}, nil
+	case "darkman":
+		return &sources.Darkman{}, nil
+	case "follow":
+		if g.Follow == "" {
+			return nil, errors.New("--follow needs to be set for the follow source")
+		}
+		return &sources.Remote{URL: g.Follow, Token: g.FollowToken}, nil
+	case "manual":
+		return &sources.Manual{}, nil
+	case "file":
+		path := g.ModeFile
+		if path == "" {
+			var err error
+			if path, err = sources.DefaultModeFile(); err != nil {
+				return nil, err
+			}
+		}
+		return &sources.File{Path: path}, nil
+	default:
+		return &sources.GSettings{}, nil
+	}
+}
+
+// parseThemes maps a list of themes passed on the command line to modes.
+// It contains the themes for light and dark mode, and optionally one for no
+// preference, which otherwise uses the light one.
+func parseThemes(what string, list []string) (switcher.Themes, error) {
+	if len(list) != 2 && len(list) != 3 {
+		return nil, fmt.Errorf("need 2 or 3 %s to be set", what)
+	}
+	themes := switcher.Themes{switcher.Light: list[0], switcher.Dark: list[1]}
+	if len(list) == 3 {
+		themes[switcher.NoPreference] = list[2]
+	}
+	return themes, nil
+}
+
+// highContrastThemes returns the high contrast themes configured for the
+// backend name, or nil if there are none.
+func (g *Globals) highContrastThemes(name string) (switcher.Themes, error) {
+	list, ok := g.HighContrastThemes[name]
+	if !ok {
+		return nil, nil
+	}
+	themes, err := parseThemes(name+" high contrast themes", strings.Split(list, ","))
+	if err != nil {
+		return nil, err
+	}
+	if err := g.resolveThemes(name, themes); err != nil {
+		return nil, err
+	}
+	return themes, backends.ValidateThemes(name, themes)
+}
+
+// palettes returns the palettes of light and dark mode, with the colors of
+// the named palette, if set, those of the schemes, and the ones set
+// explicitly taking precedence.
+func (g *Globals) palettes() (palette.Palettes, error) {
+	if err := g.Palettes.check(); err != nil {
+		return nil, err
+	}
+	named, ok := g.Palettes[g.Palette]
+	if g.Palette != "" && !ok {
+		return nil, fmt.Errorf("unknown palette: %s", g.Palette)
+	}
+	palettes := palette.Palettes{}
+	for _, mode := range []struct {
+		mode   switcher.Mode
+		scheme string
+		colors map[string]string
+	}{{switcher.Light, g.LightScheme, g.LightColors}, {switcher.Dark, g.DarkScheme, g.DarkColors}} {
+		p := named[mode.mode]
+		if mode.scheme != "" {
+			scheme, err := palette.LoadScheme(mode.scheme)
+			if err != nil {
+				return nil, err
+			}
+			p = p.Merge(scheme.Colors)
+		}
+		palettes[mode.mode] = p.Merge(mode.colors)
+	}
+	// defined modes get the colors of the mode they're based on, with the
+	// ones of the named palette for them taking precedence.
+	for mode, colors := range named {
+		if _, ok := palettes[mode]; !ok {
+			palettes[mode] = palettes[mode.Appearance()].Merge(colors)
+		}
+	}
+	return palettes, nil
+}
+
+// switcher returns a switcher for the configured backends.
+func (g *Globals) switcher() (*switcher.Switcher, error) {
+	s := switcher.New()
+	derived, err := g.Themes.resolve()
+	if err != nil {
+		return nil, err
+	}
+	var chezmoi *backends.Chezmoi
+	if g.Dotfiles == "chezmoi" {
+		chezmoi = &backends.Chezmoi{Args: strings.Fields(g.ChezmoiArgs)}
+	}
+	backups, err := g.backups()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, name := range g.Backends {
+		switch name {
+		case "kitty":
+			themes, err := g.themes("kitty", "kitty themes", g.KittyThemes)
+			if err != nil {
+				return nil, err
+			}
+			highContrast, err := g.highContrastThemes("kitty")
+			if err != nil {
+				return nil, err
+			}
+			s.Backends = append(s.Backends, &backends.Kitty{
+				Themes:        themes,
+				HighContrast:  highContrast,
+				ReloadCommand: strings.Fields(g.ReloadCommands["kitty"]),
+				ConfigDir:     expandPath(g.BackendConfigs["kitty"]),
+				Socket:        g.KittySocket,
+				Derived:       derived,
+				Chezmoi:       chezmoi,
+				Backups:       backups,
+			})
+		case "helix":
+			themes, err := g.themes("helix", "helix themes", g.HelixThemes)
+			if err != nil {
+				return nil, err
+			}
+			highContrast, err := g.highContrastThemes("helix")
+			if err != nil {
+				return nil, err
+			}
+			s.Backends = append(s.Backends, &backends.Helix{
+				Themes:        themes,
+				HighContrast:  highContrast,
+				ReloadCommand: strings.Fields(g.ReloadCommands["helix"]),
+				ConfigPath:    expandPath(g.BackendConfigs["helix"]),
+				Derived:       derived,
+				Chezmoi:       chezmoi,
+				Backups:       backups,
+			})
+		case "iterm2":
+			themes, err := g.themes("iterm2", "iTerm2 color presets", g.ITerm2Themes)
+			if err != nil {
+				return nil, err
+			}
+			highContrast, err := g.highContrastThemes("iterm2")
+			if err != nil {
+				return nil, err
+			}
+			s.Backends = append(s.Backends, &backends.ITerm2{Themes: themes, HighContrast: highContrast})
+		case "windows-terminal":
+			themes, err := g.themes("windows-terminal", "Windows Terminal color schemes", g.WindowsTerminalThemes)
+			if err != nil {
+				return nil, err
+			}
+			highContrast, err := g.highContrastThemes("windows-terminal")
+			if err != nil {
+				return nil, err
+			}
+			s.Backends = append(s.Backends, &backends.WindowsTerminal{Themes: themes, HighContrast: highContrast, SettingsPath: expandPath(g.BackendConfigs["windows-terminal"]), Chezmoi: chezmoi, Backups: backups})
+		case "neovim":
+			themes, err := g.themes("neovim", "neovim colorschemes", g.NeovimThemes)
+			if err != nil {
+				return nil, err
+			}
+			highContrast, err := g.highContrastThemes("neovim")
+			if err != nil {
+				return nil, err
+			}
+			s.Backends = append(s.Backends, &backends.Neovim{Themes: themes, HighContrast: highContrast})
+		case "xfce":
+			themes, err := g.themes("xfce", "Xfce themes", g.XfceThemes)
+			if err != nil {
+				return nil, err
+			}
+			highContrast, err := g.highContrastThemes("xfce")
+			if err != nil {
+				return nil, err
+			}
+			s.Backends = append(s.Backends, &backends.Xfce{Themes: themes, HighContrast: highContrast})
+		default:
+			return nil, fmt.Errorf("unknown backend: %s", name)
+		}
+	}
+
+	for name := range g.HighContrastThemes {
+		enabled := false
+		for _, b := range s.Backends {
+			enabled = enabled || b.Name() == name
+		}
+		if !enabled {
+			return nil, fmt.Errorf("high contrast themes set for %s, which is not an enabled backend", name)
+		}
+	}
+
+	for name := range g.ReloadCommands {
+		if name != "kitty" && name != "helix" {
+			return nil, fmt.Errorf("reload command set for %s, only kitty and helix are reloaded", name)
+		}
+	}
+
+	for name := range g.BackendConfigs {
+		if name != "kitty" && name != "helix" && name != "windows-terminal" {
+			return nil, fmt.Errorf("configuration set for %s, only the one of kitty, helix and windows-terminal can be", name)
+		}
+	}
+
+	// commands are always enabled, sort them for a stable order.
+	commandNames := make([]string, 0, len(g.Commands))
+	for name := range g.Commands {
+		commandNames = append(commandNames, name)
+	}
+	sort.Strings(commandNames)
+	for _, name := range commandNames {
+		for _, b := range s.Backends {
+			if b.Name() == name {
+				return nil, fmt.Errorf("command %s conflicts with backend of the same name", name)
+			}
+		}
+		s.Backends = append(s.Backends, &backends.Command{BackendName: name, Command: strings.Fields(g.Commands[name])})
+	}
+
+	// templates see the themes of all backends before them.
+	themed := make(map[string]switcher.Themed)
+	for _, b := range s.Backends {
+		if t, ok := b.(switcher.Themed); ok {
+			themed[b.Name()] = t
+		}
+	}
+	palettes, err := g.palettes()
+	if err != nil {
+		return nil, err
+	}
+	templateNames := make([]string, 0, len(g.Templates))
+	for name := range g.Templates {
+		templateNames = append(templateNames, name)
+	}
+	sort.Strings(templateNames)
+	for _, name := range templateNames {
+		for _, b := range s.Backends {
+			if b.Name() == name {
+				return nil, fmt.Errorf("template %s conflicts with backend of the same name", name)
+			}
+		}
+		parts := strings.SplitN(g.Templates[name], ",", 3)
+		if len(parts) < 2 {
+			return nil, fmt.Errorf("template %s needs a template and a target", name)
+		}
+		t := &backends.Template{BackendName: name, Source: expandPath(parts[0]), Target: expandPath(parts[1]), Palettes: palettes, PaletteName: g.Palette, Named: g.Palettes, Themed: themed, Chezmoi: chezmoi, Backups: backups}
+		if len(parts) == 3 {
+			t.Reload = strings.Fields(parts[2])
+		}
+		s.Backends = append(s.Backends, t)
+	}
+
+	// plugins are always enabled, too.
+	pluginsDir := g.PluginsDir
+	if pluginsDir == "" {
+		if pluginsDir, err = backends.DefaultPluginDir(); err != nil {
+			return nil, err
+		}
+	}
+	plugins, err := backends.Plugins(pluginsDir)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range plugins {
+		for _, b := range s.Backends {
+			if b.Name() == p.Name() {
+				return nil, fmt.Errorf("plugin %s conflicts with backend of the same name", p.Path)
+			}
+		}
+		s.Backends = append(s.Backends, p)
+	}
+
+	s.After = make(map[string][]string, len(g.After))
+	for name, deps := range g.After {
+		s.After[name] = strings.Split(deps, ",")
+	}
+	s.Barriers = g.Barriers
+	s.Delay = make(map[string]time.Duration, len(g.Delay))
+	for name, delay := range g.Delay {
+		if s.Delay[name], err = time.ParseDuration(delay); err != nil {
+			return nil, fmt.Errorf("invalid delay of %s: %w", name, err)
+		}
+	}
+	if err := s.CheckOrder(); err != nil {
+		return nil, fmt.Errorf("invalid backend order: %w", err)
+	}
+	when, err := g.conditions(s.Backends)
+	if err != nil {
+		return nil, err
+	}
+
+	s.Timeout = g.BackendTimeout
+	s.CommandTimeout = g.CommandTimeout
+	s.MaxParallel = g.MaxParallel
+	s.Retries = g.Retries
+	s.Rollback = g.Rollback
+	s.Missing = switcher.MissingPolicy(g.MissingBackends)
+	s.RetryDelay = g.RetryDelay
+
+	statePath, err := g.statePath()
+	if err != nil {
+		return nil, err
+	}
+	s.StatePath = statePath
+
+	hooksDir := g.HooksDir
+	if hooksDir == "" {
+		if hooksDir, err = hooks.DefaultDir(); err != nil {
+			return nil, err
+		}
+	}
+	if len(when.Conditions) > 0 {
+		s.Hooks = append(s.Hooks, when)
+	}
+	// the colors of the wallpaper need to be there before templates and hooks use them.
+	base := make(palette.Palettes, len(palettes))
+	for mode, p := range palettes {
+		base[mode] = p
+	}
+	if g.WallpaperColors != "" {
+		s.Hooks = append(s.Hooks, &hooks.Wallpaper{Tool: g.WallpaperColors, Path: g.Wallpaper, Base: base, Palettes: palettes})
+	}
+	if g.MaterialColors != "" {
+		s.Hooks = append(s.Hooks, &hooks.Material{From: g.MaterialColors, Path: g.Wallpaper, Base: base, Palettes: palettes})
+	}
+	s.Hooks = append(s.Hooks, &hooks.Dir{Path: hooksDir, Palettes: palettes, PaletteName: g.Palette})
+	for _, script := range g.Scripts {
+		s.Hooks = append(s.Hooks, &hooks.Script{Path: expandPath(script)})
+	}
+	// darkman runs its scripts itself, if it decides the mode.
+	if g.DarkmanScripts && !g.usesSource("darkman") {
+		s.Hooks = append(s.Hooks, &hooks.Darkman{})
+	}
+
+	return s, nil
+}
+
+// CLI are all commands, and the flags shared by them.
+type CLI struct {
+	Globals
+
+	Daemon DaemonCmd `cmd:"" default:"1" help:"Watch the color scheme, and switch themes whenever it changes (default)"`
+	Set    SetCmd    `cmd:"" help:"Set the color scheme, and switch themes accordingly"`
+	Get    GetCmd    `cmd:"" help:"Print the current color scheme"`
+	Toggle ToggleCmd `cmd:"" help:"Toggle between light and dark color scheme"`
+	Status StatusCmd `cmd:"" help:"Print the current color scheme and the state of all backends"`
+	Pack   PackCmd   `cmd:"" help:"Switch between packs of themes for all backends"`
+	Config ConfigCmd `cmd:"" help:"Work with the configuration file"`
+
+	Restore RestoreCmd `cmd:"" help:"Restore the files backends modified to how they were before theme-switcher first modified them"`
+
+	Install InstallCmd `cmd:"" help:"Install integrations with other software"`
+}
+
+var cli CLI
+
+// platformDefaults returns the default backends for the current platform.
+func platformDefaults() kong.Vars {
+	switch runtime.GOOS {
+	case "darwin":
+		return kong.Vars{"default_backends": "kitty,helix,iterm2"}
+	case "windows":
+		return kong.Vars{"default_backends": "windows-terminal,helix,neovim"}
+	default:
+		return kong.Vars{"default_backends": "kitty,helix"}
+	}
+}
+
+func main() {
+	path, err := configPath()
+	if err != nil {
+		log.WithError(err).Warn("unable to determine configuration file path")
+	}
+	parser, err := newParser(&cli, path)
+	if err != nil {
+		if ran, err := configCmdIfAsked(context.Background()); ran {
+			if err != nil {
+				log.Fatal(err)
+			}
+			return
+		}
+		log.WithError(err).Fatal("unable to load configuration")
+	}
+	kctx, err := parser.Parse(os.Args[1:])
+	if err != nil {
+		if ran, err := configCmdIfAsked(context.Background()); ran {
+			if err != nil {
+				log.Fatal(err)
+			}
+			return
+		}
+	}
+	parser.FatalIfErrorf(err)
+	parser.FatalIfErrorf(checkProfile(path, cli.Profile))
+	parser.FatalIfErrorf(cli.defineModes())
+	if err := cli.usePack(); err != nil {
+		log.WithError(err).Warn("unable to use theme pack")
+	}
+
+	logLevel, err := log.ParseLevel(cli.LogLevel)
+	if err != nil {
+		log.Fatal("invalid log level")
+	}
+	log.SetLevel(logLevel)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// restore the default signal handling after the first signal,
+	// so a second one terminates immediately.
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	if cli.DryRun {
+		ctx = switcher.WithDryRun(ctx)
+	}
+
+	kctx.BindTo(ctx, (*context.Context)(nil))
+	if err := kctx.Run(&cli.Globals); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/alecthomas/kong"
+	"github.com/flokli/theme-switcher/pkg/backends"
+	"github.com/flokli/theme-switcher/pkg/switcher"
+)
+
+// modeThemes maps modes to the theme of each backend in them.
+type modeThemes map[string]map[string]string
+
+// Decode decodes a theme passed on the command line as MODE.BACKEND=THEME,
+// or the mode_themes table of the configuration file.
+func (t *modeThemes) Decode(ctx *kong.DecodeContext) error {
+	if *t == nil {
+		*t = modeThemes{}
+	}
+	token := ctx.Scan.Pop()
+	switch value := token.Value.(type) {
+	case string:
+		key, theme, ok := strings.Cut(value, "=")
+		mode, backend, dotted := strings.Cut(key, ".")
+		if !ok || !dotted {
+			return fmt.Errorf("expected MODE.BACKEND=THEME, got %q", value)
+		}
+		t.add(mode, backend, theme)
+	case map[string]interface{}:
+		for mode, backends := range value {
+			backends, ok := backends.(map[string]interface{})
+			if !ok {
+				return fmt.Errorf("themes of mode %s need to be a table", mode)
+			}
+			for backend, theme := range backends {
+				t.add(mode, backend, fmt.Sprint(theme))
+			}
+		}
+	default:
+		return fmt.Errorf("unexpected mode themes %v", token)
+	}
+	return nil
+}
+
+func (t modeThemes) add(mode, backend, theme string) {
+	if t[mode] == nil {
+		t[mode] = map[string]string{}
+	}
+	t[mode][backend] = theme
+}
+
+// defineModes makes the modes defined with --modes available, and checks the
+// ones themes are set for with --mode-themes.
+func (g *Globals) defineModes() error {
+	modes := make(map[switcher.Mode]switcher.Mode, len(g.Modes))
+	for name, base := range g.Modes {
+		modes[switcher.Mode(name)] = switcher.Mode(base)
+	}
+	if err := switcher.DefineModes(modes); err != nil {
+		return err
+	}
+	packed := g.packed()
+	for mode, themes := range g.ModeThemes {
+		if _, err := switcher.ParseMode(mode); err != nil {
+			return fmt.Errorf("themes set for %w", err)
+		}
+		for backend := range themes {
+			if _, ok := packed[backend]; !ok {
+				return fmt.Errorf("%s theme set for %s, which has none", mode, backend)
+			}
+		}
+	}
+	return nil
+}
+
+// themes maps the list of themes of backend passed on the command line to
+// modes, like parseThemes, adding the ones set with --mode-themes, resolving
+// derived ones, and validating their names.
+func (g *Globals) themes(backend, what string, list []string) (switcher.Themes, error) {
+	themes, err := parseThemes(what, list)
+	if err != nil {
+		return nil, err
+	}
+	for mode, backends := range g.ModeThemes {
+		if theme, ok := backends[backend]; ok {
+			themes[switcher.Mode(mode)] = theme
+		}
+	}
+	if err := g.resolveThemes(backend, themes); err != nil {
+		return nil, err
+	}
+	return themes, backends.ValidateThemes(backend, themes)
+}
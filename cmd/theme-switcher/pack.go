@@ -0,0 +1,230 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/alecthomas/kong"
+	"github.com/flokli/theme-switcher/pkg/control"
+	"github.com/flokli/theme-switcher/pkg/switcher"
+	log "github.com/sirupsen/logrus"
+)
+
+// themePacks maps pack names to the themes of each backend in them.
+type themePacks map[string]map[string][]string
+
+// Decode decodes a pack passed on the command line as
+// NAME.BACKEND=LIGHT,DARK[,NO-PREFERENCE], or the packs table of the
+// configuration file.
+func (p *themePacks) Decode(ctx *kong.DecodeContext) error {
+	if *p == nil {
+		*p = themePacks{}
+	}
+	token := ctx.Scan.Pop()
+	switch value := token.Value.(type) {
+	case string:
+		key, list, ok := strings.Cut(value, "=")
+		name, backend, dotted := strings.Cut(key, ".")
+		if !ok || !dotted {
+			return fmt.Errorf("expected NAME.BACKEND=LIGHT,DARK[,NO-PREFERENCE], got %q", value)
+		}
+		p.add(name, backend, strings.Split(list, ","))
+	case map[string]interface{}:
+		for name, pack := range value {
+			backends, ok := pack.(map[string]interface{})
+			if !ok {
+				return fmt.Errorf("pack %s needs to be a table", name)
+			}
+			for backend, themes := range backends {
+				list, ok := themes.([]interface{})
+				if !ok {
+					return fmt.Errorf("themes of %s in pack %s need to be a list", backend, name)
+				}
+				var names []string
+				for _, theme := range list {
+					names = append(names, fmt.Sprint(theme))
+				}
+				p.add(name, backend, names)
+			}
+		}
+	default:
+		return fmt.Errorf("unexpected packs %v", token)
+	}
+	return nil
+}
+
+func (p themePacks) add(name, backend string, themes []string) {
+	if p[name] == nil {
+		p[name] = map[string][]string{}
+	}
+	p[name][backend] = themes
+}
+
+// packed returns the flags holding the themes of each backend a pack can set.
+func (g *Globals) packed() map[string]*[]string {
+	return map[string]*[]string{
+		"kitty":            &g.KittyThemes,
+		"helix":            &g.HelixThemes,
+		"iterm2":           &g.ITerm2Themes,
+		"windows-terminal": &g.WindowsTerminalThemes,
+		"neovim":           &g.NeovimThemes,
+		"xfce":             &g.XfceThemes,
+		"kde":              &g.KDEColorSchemes,
+		"cinnamon":         &g.CinnamonThemes,
+		"mate":             &g.MATEThemes,
+	}
+}
+
+// packPath returns the path of the file recording the pack in use, next to
+// the state file.
+func (g *Globals) packPath() (string, error) {
+	statePath, err := g.statePath()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(statePath), "pack"), nil
+}
+
+// currentPack returns the name of the pack in use, or an empty string if
+// there's none.
+func (g *Globals) currentPack() (string, error) {
+	path, err := g.packPath()
+	if err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	} else if err != nil {
+		return "", fmt.Errorf("unable to read pack in use: %w", err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// usePack replaces the themes of the backends with the ones of the pack in
+// use, if any.
+func (g *Globals) usePack() error {
+	name, err := g.currentPack()
+	if err != nil || name == "" {
+		return err
+	}
+	pack, ok := g.Packs[name]
+	if !ok {
+		return fmt.Errorf("pack %s in use is not configured", name)
+	}
+	packed := g.packed()
+	for backend, themes := range pack {
+		flag, ok := packed[backend]
+		if !ok {
+			return fmt.Errorf("pack %s sets themes of %s, which has none", name, backend)
+		}
+		*flag = themes
+	}
+	return nil
+}
+
+// PackCmd manages theme packs.
+type PackCmd struct {
+	Use   PackUseCmd   `cmd:"" help:"Use the themes of a pack"`
+	Clear PackClearCmd `cmd:"" help:"Stop using a pack, and use the configured themes again"`
+	List  PackListCmd  `cmd:"" help:"List the configured packs"`
+}
+
+// PackUseCmd switches to the themes of a pack.
+type PackUseCmd struct {
+	Name string `arg:"" help:"The pack to use"`
+}
+
+// writePack records the pack in use, and switches to its themes.
+// A running daemon picks it up like changes of the configuration file.
+func writePack(ctx context.Context, g *Globals, name string) error {
+	path, err := g.packPath()
+	if err != nil {
+		return err
+	}
+	if switcher.IsDryRun(ctx) {
+		log.Infof("would record pack %q in %s", name, path)
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("unable to create state dir: %w", err)
+	}
+	if name == "" {
+		err = os.Remove(path)
+		if errors.Is(err, os.ErrNotExist) {
+			err = nil
+		}
+	} else {
+		err = os.WriteFile(path, []byte(name+"\n"), 0o644)
+	}
+	if err != nil {
+		return fmt.Errorf("unable to record pack in use: %w", err)
+	}
+
+	if _, err := g.callDaemon(ctx, control.Request{Command: "status"}); err == nil {
+		return nil
+	} else if !errors.Is(err, control.ErrNotRunning) {
+		return err
+	}
+	log.Debug("no daemon running, applying the themes right away")
+	configPath, err := configPath()
+	if err != nil {
+		return err
+	}
+	c, err := reparse(configPath)
+	if err != nil {
+		return err
+	}
+	g = &c.Globals
+	source, err := g.source(ctx)
+	if err != nil {
+		return err
+	}
+	mode, err := source.Get(ctx)
+	if err != nil {
+		return fmt.Errorf("unable to get current mode: %w", err)
+	}
+	return setMode(ctx, g, mode)
+}
+
+func (c *PackUseCmd) Run(ctx context.Context, g *Globals) error {
+	if _, ok := g.Packs[c.Name]; !ok {
+		return fmt.Errorf("unknown pack: %s", c.Name)
+	}
+	return writePack(ctx, g, c.Name)
+}
+
+// PackClearCmd stops using a pack.
+type PackClearCmd struct{}
+
+func (c *PackClearCmd) Run(ctx context.Context, g *Globals) error {
+	return writePack(ctx, g, "")
+}
+
+// PackListCmd prints the configured packs, marking the one in use.
+type PackListCmd struct{}
+
+func (c *PackListCmd) Run(g *Globals) error {
+	current, err := g.currentPack()
+	if err != nil {
+		return err
+	}
+	names := make([]string, 0, len(g.Packs))
+	for name := range g.Packs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		marker := " "
+		if name == current {
+			marker = "*"
+		}
+		fmt.Printf("%s %s\n", marker, name)
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/alecthomas/kong"
+	"github.com/flokli/theme-switcher/pkg/palette"
+	"github.com/flokli/theme-switcher/pkg/switcher"
+)
+
+// namedPalettes maps palette names to their colors in light and dark mode.
+type namedPalettes map[string]palette.Palettes
+
+// Decode decodes a color of a palette passed on the command line as
+// NAME.MODE.COLOR=#RRGGBB, or the palettes table of the configuration file.
+func (p *namedPalettes) Decode(ctx *kong.DecodeContext) error {
+	if *p == nil {
+		*p = namedPalettes{}
+	}
+	token := ctx.Scan.Pop()
+	switch value := token.Value.(type) {
+	case string:
+		key, color, ok := strings.Cut(value, "=")
+		parts := strings.SplitN(key, ".", 3)
+		if !ok || len(parts) != 3 {
+			return fmt.Errorf("expected NAME.MODE.COLOR=#RRGGBB, got %q", value)
+		}
+		return p.add(parts[0], parts[1], map[string]string{parts[2]: color})
+	case map[string]interface{}:
+		for name, modes := range value {
+			modes, ok := modes.(map[string]interface{})
+			if !ok {
+				return fmt.Errorf("palette %s needs to be a table", name)
+			}
+			for mode, colors := range modes {
+				colors, ok := colors.(map[string]interface{})
+				if !ok {
+					return fmt.Errorf("%s colors of palette %s need to be a table", mode, name)
+				}
+				strs := make(map[string]string, len(colors))
+				for color, value := range colors {
+					strs[color] = fmt.Sprint(value)
+				}
+				if err := p.add(name, mode, strs); err != nil {
+					return err
+				}
+			}
+		}
+	default:
+		return fmt.Errorf("unexpected palettes %v", token)
+	}
+	return nil
+}
+
+func (p namedPalettes) add(name, mode string, colors map[string]string) error {
+	// modes defined with --modes are checked once they are.
+	m := switcher.Mode(mode)
+	if m == switcher.NoPreference {
+		return fmt.Errorf("palette %s can't have colors with no preference, it uses the light ones", name)
+	}
+	parsed, err := palette.Parse(colors)
+	if err != nil {
+		return fmt.Errorf("palette %s: %w", name, err)
+	}
+	if p[name] == nil {
+		p[name] = palette.Palettes{}
+	}
+	p[name][m] = p[name][m].Merge(parsed)
+	return nil
+}
+
+// check returns an error if a palette lacks the colors of light or dark mode,
+// or has colors of an unknown mode.
+func (p namedPalettes) check() error {
+	for name, palettes := range p {
+		for mode := range palettes {
+			if _, err := switcher.ParseMode(string(mode)); err != nil {
+				return fmt.Errorf("palette %s: %w", name, err)
+			}
+		}
+		for _, mode := range []switcher.Mode{switcher.Light, switcher.Dark} {
+			if len(palettes[mode]) == 0 {
+				return fmt.Errorf("palette %s has no %s colors", name, mode)
+			}
+		}
+	}
+	return nil
+}
+
+// table returns the palettes as they're set in the configuration file.
+func (p namedPalettes) table() map[string]map[string]palette.Palette {
+	table := make(map[string]map[string]palette.Palette, len(p))
+	for name, palettes := range p {
+		table[name] = make(map[string]palette.Palette, len(palettes))
+		for mode, colors := range palettes {
+			table[name][string(mode)] = colors
+		}
+	}
+	return table
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/flokli/theme-switcher/pkg/switcher"
+	log "github.com/sirupsen/logrus"
+)
+
+// urlFile records the URL a remote fetched over HTTP(S) is downloaded from,
+// in its directory.
+const urlFile = ".theme-switcher-url"
+
+// ConfigPullCmd fetches a shared configuration, like the theme packs of a
+// team, from a git repository or a file served over HTTPS, or updates the
+// ones fetched before.
+type ConfigPullCmd struct {
+	URL  string `arg:"" optional:"" help:"git repository (like https://example.com/themes.git, or git@example.com:themes) or HTTPS URL of a file to fetch (default: update all fetched before)"`
+	Name string `help:"Name of the directory to fetch into (default: derived from the URL)"`
+}
+
+// remotesDir returns the directory remote configurations are fetched into,
+// $XDG_DATA_HOME/theme-switcher/remotes.
+func remotesDir() (string, error) {
+	dataDir := os.Getenv("XDG_DATA_HOME")
+	if dataDir == "" {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("unable to determine home dir: %w", err)
+		}
+		dataDir = filepath.Join(homeDir, ".local", "share")
+	}
+	return filepath.Join(dataDir, "theme-switcher", "remotes"), nil
+}
+
+// gitURL returns the URL to clone if rawURL is a git repository, like
+// git@host:repo, ssh://, git://, git+https:// or https://….git URLs.
+func gitURL(rawURL string) (string, bool) {
+	switch {
+	case strings.HasPrefix(rawURL, "git+"):
+		return strings.TrimPrefix(rawURL, "git+"), true
+	case strings.HasPrefix(rawURL, "git@"), strings.HasPrefix(rawURL, "ssh://"), strings.HasPrefix(rawURL, "git://"):
+		return rawURL, true
+	default:
+		return rawURL, strings.HasSuffix(rawURL, ".git")
+	}
+}
+
+// remoteName returns the directory name of a remote fetched from rawURL: the
+// last element of its path, without extension.
+func remoteName(rawURL string) string {
+	p := rawURL
+	if u, err := url.Parse(rawURL); err == nil && u.Path != "" {
+		p = u.Path
+	} else if _, after, ok := strings.Cut(rawURL, ":"); ok {
+		// scp-like git@host:path
+		p = after
+	}
+	name := path.Base(strings.TrimSuffix(p, "/"))
+	return strings.TrimSuffix(name, path.Ext(name))
+}
+
+// pullGit clones the repository at rawURL into dir, or pulls it if it's
+// there already.
+func pullGit(ctx context.Context, rawURL, dir string) error {
+	var cmd *exec.Cmd
+	if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+		cmd = exec.CommandContext(ctx, "git", "-C", dir, "pull", "--ff-only", "--quiet")
+	} else {
+		cmd = exec.CommandContext(ctx, "git", "clone", "--quiet", "--depth=1", rawURL, dir)
+	}
+	if switcher.IsDryRun(ctx) {
+		log.Infof("would run %s", strings.Join(cmd.Args, " "))
+		return nil
+	}
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("unable to fetch %s: %w: %s", rawURL, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// pullHTTP downloads the file at rawURL into dir, recording the URL to update
+// it from later.
+func pullHTTP(ctx context.Context, rawURL, dir string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") {
+		return fmt.Errorf("unsupported URL %s, expected a git repository or an HTTPS URL", rawURL)
+	}
+	name := path.Base(u.Path)
+	if name == "/" || name == "." {
+		name = "config.toml"
+	}
+	target := filepath.Join(dir, name)
+	if switcher.IsDryRun(ctx) {
+		log.Infof("would download %s to %s", rawURL, target)
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("unable to fetch %s: %w", rawURL, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unable to fetch %s: %s", rawURL, resp.Status)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("unable to fetch %s: %w", rawURL, err)
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("unable to create %s: %w", dir, err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, urlFile), []byte(rawURL+"\n"), 0o644); err != nil {
+		return fmt.Errorf("unable to record URL of %s: %w", dir, err)
+	}
+	// leave the file alone if it didn't change, not to reload for nothing.
+	if old, err := os.ReadFile(target); err == nil && string(old) == string(data) {
+		return nil
+	}
+	// write it next to the target and rename it, so a daemon never reads
+	// half of it.
+	tmp := target + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("unable to write %s: %w", target, err)
+	}
+	return os.Rename(tmp, target)
+}
+
+// pullRemote fetches rawURL into dir.
+func pullRemote(ctx context.Context, rawURL, dir string) error {
+	if cloneURL, ok := gitURL(rawURL); ok {
+		return pullGit(ctx, cloneURL, dir)
+	}
+	return pullHTTP(ctx, rawURL, dir)
+}
+
+// pullAll updates the remotes fetched before, and returns the first error,
+// after trying all of them.
+func pullAll(ctx context.Context) error {
+	dir, err := remotesDir()
+	if err != nil {
+		return err
+	}
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("unable to list remotes: %w", err)
+	}
+	var firstErr error
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		remote := filepath.Join(dir, entry.Name())
+		if _, statErr := os.Stat(filepath.Join(remote, ".git")); statErr == nil {
+			err = pullGit(ctx, entry.Name(), remote)
+		} else if data, readErr := os.ReadFile(filepath.Join(remote, urlFile)); readErr == nil {
+			err = pullHTTP(ctx, strings.TrimSpace(string(data)), remote)
+		} else {
+			log.WithField("remote", entry.Name()).Debug("not a fetched remote, skipping")
+			continue
+		}
+		if err != nil {
+			log.WithError(err).WithField("remote", entry.Name()).Warn("unable to update remote")
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return firstErr
+}
+
+func (c *ConfigPullCmd) Run(ctx context.Context) error {
+	if c.URL == "" {
+		return pullAll(ctx)
+	}
+	name := c.Name
+	if name == "" {
+		name = remoteName(c.URL)
+	}
+	if name == "" || name == "." || name == ".." || strings.ContainsRune(name, filepath.Separator) {
+		return fmt.Errorf("invalid remote name %q, pass --name", name)
+	}
+	dir, err := remotesDir()
+	if err != nil {
+		return err
+	}
+	dir = filepath.Join(dir, name)
+	if err := pullRemote(ctx, c.URL, dir); err != nil {
+		return err
+	}
+	fmt.Printf("Fetched %s into %s. To use it, add it to the configuration file:\n\ninclude = [%q]\n", c.URL, dir, filepath.Join(tildePath(dir), "*.toml"))
+	return nil
+}
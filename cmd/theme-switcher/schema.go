@@ -0,0 +1,205 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alecthomas/kong"
+)
+
+// ConfigSchemaCmd prints a JSON schema of the configuration file.
+type ConfigSchemaCmd struct{}
+
+// schema is a JSON schema, encoded as it is.
+type schema map[string]interface{}
+
+var (
+	durationType      = reflect.TypeOf(time.Duration(0))
+	themePacksType    = reflect.TypeOf(themePacks{})
+	namedPalettesType = reflect.TypeOf(namedPalettes{})
+	modeThemesType    = reflect.TypeOf(modeThemes{})
+	derivedThemesType = reflect.TypeOf(derivedThemes{})
+)
+
+// flagSchema returns the schema of the value of flag in the configuration
+// file, or nil if it can't be set there.
+func flagSchema(flag *kong.Flag) schema {
+	stringMap := schema{"type": "object", "additionalProperties": schema{"type": "string"}}
+	var s schema
+	switch t := flag.Target.Type(); {
+	case t == durationType:
+		s = schema{"type": "string", "pattern": `^-?([0-9.]+(ns|us|µs|ms|s|m|h))+$`}
+	case t == themePacksType:
+		s = schema{"type": "object", "additionalProperties": schema{
+			"type":                 "object",
+			"additionalProperties": schema{"type": "array", "items": schema{"type": "string"}, "minItems": 2, "maxItems": 3},
+		}}
+	case t == namedPalettesType:
+		s = schema{"type": "object", "additionalProperties": schema{
+			"type":                 "object",
+			"properties":           schema{"light": stringMap, "dark": stringMap},
+			"required":             []string{"light", "dark"},
+			"additionalProperties": stringMap,
+		}}
+	case t == modeThemesType || t == derivedThemesType:
+		s = schema{"type": "object", "additionalProperties": stringMap}
+	case t.Kind() == reflect.Bool:
+		s = schema{"type": "boolean"}
+	case t.Kind() == reflect.String:
+		s = schema{"type": "string"}
+	case t.Kind() == reflect.Int:
+		s = schema{"type": "integer"}
+	case t.Kind() == reflect.Float64:
+		s = schema{"type": "number"}
+	case t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.String:
+		items := schema{"type": "string"}
+		if flag.Enum != "" {
+			items["enum"] = flag.EnumSlice()
+		}
+		s = schema{"type": "array", "items": items}
+	case t.Kind() == reflect.Map && t.Elem().Kind() == reflect.String:
+		s = stringMap
+	default:
+		return nil
+	}
+	s["description"] = flag.Help
+	if flag.Enum != "" && s["type"] == "string" {
+		s["enum"] = flag.EnumSlice()
+	}
+	if !flag.HasDefault {
+		return s
+	}
+	switch s["type"] {
+	case "string":
+		s["default"] = flag.Default
+	case "boolean":
+		s["default"], _ = strconv.ParseBool(flag.Default)
+	case "integer", "number":
+		s["default"], _ = strconv.ParseFloat(flag.Default, 64)
+	case "array":
+		if flag.Default != "" {
+			s["default"] = strings.Split(flag.Default, string(flag.Tag.Sep))
+		}
+	}
+	return s
+}
+
+// addFlag adds the schema of flag to properties, under every key it can be
+// set with: its name, and all ways of grouping its prefixes into tables, like
+// kitty_themes and themes in a kitty table.
+func addFlag(properties schema, words []string, s schema) {
+	key := strings.Join(words, "_")
+	if _, ok := properties[key]; !ok {
+		properties[key] = s
+	}
+	for i := 1; i < len(words); i++ {
+		prefix := strings.Join(words[:i], "_")
+		table, ok := properties[prefix].(schema)
+		if !ok {
+			table = schema{"type": "object", "properties": schema{}, "additionalProperties": false}
+			properties[prefix] = table
+		}
+		nested, ok := table["properties"].(schema)
+		if !ok {
+			// a flag of that name, which tables can't extend.
+			continue
+		}
+		addFlag(nested, words[i:], s)
+	}
+}
+
+// flagsSchema returns the schema of a table setting flags.
+func flagsSchema(flags []*kong.Flag) schema {
+	// shorter flags first, so tables of prefixes don't shadow them.
+	flags = append([]*kong.Flag(nil), flags...)
+	sort.SliceStable(flags, func(i, j int) bool { return len(flags[i].Name) < len(flags[j].Name) })
+	properties := schema{}
+	for _, flag := range flags {
+		// the profile table holds the profiles, not the one to use.
+		if flag.Name == "help" || flag.Name == "profile" {
+			continue
+		}
+		if s := flagSchema(flag); s != nil {
+			addFlag(properties, strings.Split(flag.Name, "-"), s)
+		}
+	}
+	// conditions can be set in the tables of backends, see hoistConditions.
+	if _, ok := properties["when"]; ok {
+		for name := range (&Globals{}).packed() {
+			if table, ok := properties[strings.ReplaceAll(name, "-", "_")].(schema); ok {
+				if nested, ok := table["properties"].(schema); ok {
+					nested["when"] = schema{"description": "Only switch " + name + " while the condition holds", "type": "string"}
+				}
+			}
+		}
+	}
+	return schema{"type": "object", "properties": properties, "additionalProperties": false}
+}
+
+// configSchema returns the JSON schema of the configuration file for app.
+func configSchema(app *kong.Application) schema {
+	var all []*kong.Flag
+	commands := schema{}
+	var walk func(node *kong.Node)
+	walk = func(node *kong.Node) {
+		all = append(all, node.Flags...)
+		for _, child := range node.Children {
+			if len(child.Flags) > 0 {
+				commands[strings.ReplaceAll(child.Name, "-", "_")] = flagsSchema(child.Flags)
+			}
+			walk(child)
+		}
+	}
+	walk(app.Node)
+
+	// flags of commands can be set at the top, too.
+	flags := flagsSchema(all)
+	properties := flags["properties"].(schema)
+	for key, s := range commands {
+		if _, ok := properties[key]; !ok {
+			properties[key] = s
+		}
+	}
+	top := schema{}
+	for key, s := range properties {
+		top[key] = s
+	}
+	top["include"] = schema{
+		"description": "Globs of configuration files to include, relative to this one",
+		"type":        "array",
+		"items":       schema{"type": "string"},
+	}
+	top["profile"] = schema{
+		"description":          "Flags to use with --profile NAME, by NAME",
+		"type":                 "object",
+		"additionalProperties": schema{"$ref": "#/definitions/flags"},
+	}
+	top["host"] = schema{
+		"description":          "Flags to use on the machine of the hostname NAME, by NAME",
+		"type":                 "object",
+		"additionalProperties": schema{"$ref": "#/definitions/flags"},
+	}
+	return schema{
+		"$schema":              "http://json-schema.org/draft-07/schema#",
+		"title":                "theme-switcher configuration",
+		"type":                 "object",
+		"properties":           top,
+		"additionalProperties": false,
+		"definitions":          schema{"flags": flags},
+	}
+}
+
+func (c *ConfigSchemaCmd) Run(kctx *kong.Context) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(configSchema(kctx.Model)); err != nil {
+		return fmt.Errorf("unable to write schema: %w", err)
+	}
+	return nil
+}
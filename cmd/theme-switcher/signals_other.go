@@ -0,0 +1,12 @@
+//go:build !unix
+
+package main
+
+import (
+	"context"
+
+	"github.com/flokli/theme-switcher/pkg/switcher"
+)
+
+// handleSignals does nothing, as there are no SIGUSR1 and SIGUSR2 on this platform.
+func handleSignals(ctx context.Context, daemon *switcher.Daemon) {}
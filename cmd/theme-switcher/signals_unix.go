@@ -0,0 +1,41 @@
+//go:build unix
+
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/flokli/theme-switcher/pkg/switcher"
+	log "github.com/sirupsen/logrus"
+)
+
+// handleSignals toggles the mode on SIGUSR1, and re-applies it on SIGUSR2,
+// until ctx is done.
+func handleSignals(ctx context.Context, daemon *switcher.Daemon) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGUSR1, syscall.SIGUSR2)
+	defer signal.Stop(ch)
+
+	for {
+		select {
+		case sig := <-ch:
+			var err error
+			switch sig {
+			case syscall.SIGUSR1:
+				log.Info("received SIGUSR1, toggling")
+				_, err = daemon.Toggle(ctx)
+			case syscall.SIGUSR2:
+				log.Info("received SIGUSR2, reapplying")
+				err = daemon.Reapply(ctx)
+			}
+			if err != nil {
+				log.WithError(err).Warnf("unable to handle %s", sig)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/alecthomas/kong"
+	"github.com/flokli/theme-switcher/pkg/backends"
+	log "github.com/sirupsen/logrus"
+)
+
+// ConfigCmd works with the configuration file.
+type ConfigCmd struct {
+	Init        ConfigInitCmd        `cmd:"" help:"Write a starter configuration file for the applications found"`
+	Validate    ConfigValidateCmd    `cmd:"" help:"Check the configuration file, the themes it refers to, and the files it writes"`
+	Schema      ConfigSchemaCmd      `cmd:"" help:"Print a JSON schema of the configuration file, for editors to complete and check it"`
+	ImportFlags ConfigImportFlagsCmd `cmd:"" help:"Print the configuration file equivalent to the flags passed on the command line"`
+	Pull        ConfigPullCmd        `cmd:"" help:"Fetch a shared configuration from a git repository or HTTPS URL to include, or update the ones fetched before"`
+}
+
+// ConfigValidateCmd checks the configuration file for problems.
+type ConfigValidateCmd struct{}
+
+func (c *ConfigValidateCmd) Run(ctx context.Context) error {
+	path, err := configPath()
+	if err != nil {
+		return err
+	}
+	problems := validateConfig(ctx, path)
+	for _, p := range problems {
+		fmt.Println(p)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("found %d problem(s) in %s", len(problems), path)
+	}
+	fmt.Printf("%s is valid\n", path)
+	return nil
+}
+
+// configCmdIfAsked runs the config command on the command line, if it's one,
+// as those also need to run if the configuration can't be parsed. It returns
+// whether it ran one, and the error it returned, leaving it to the caller to
+// exit.
+func configCmdIfAsked(ctx context.Context) (bool, error) {
+	var c CLI
+	parser, err := kong.New(&c, platformDefaults())
+	if err != nil {
+		return false, nil
+	}
+	kctx, err := parser.Parse(os.Args[1:])
+	if err != nil || !strings.HasPrefix(kctx.Command(), "config ") {
+		return false, nil
+	}
+	kctx.BindTo(ctx, (*context.Context)(nil))
+	return true, kctx.Run(&c.Globals)
+}
+
+var (
+	tableLine = regexp.MustCompile(`^\s*\[\[?([^\]]+)\]\]?`)
+	keyLine   = regexp.MustCompile(`^\s*([\w."' -]+?)\s*=`)
+)
+
+// dottedKey normalizes a key of a TOML file, like `a . "b"`, to a.b.
+func dottedKey(key string) string {
+	parts := strings.Split(key, ".")
+	for i, part := range parts {
+		parts[i] = strings.Trim(strings.TrimSpace(part), `"'`)
+	}
+	return strings.Join(parts, ".")
+}
+
+// keyLines returns the line each table and key of a TOML file is defined on,
+// by dotted key. It doesn't parse TOML, but only needs to be good enough to
+// point at problems.
+func keyLines(data []byte) map[string]int {
+	lines := map[string]int{}
+	table := ""
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Text()
+		if m := tableLine.FindStringSubmatch(line); m != nil {
+			table = dottedKey(m[1]) + "."
+			lines[strings.TrimSuffix(table, ".")] = n
+		} else if m := keyLine.FindStringSubmatch(line); m != nil {
+			if _, ok := lines[table+dottedKey(m[1])]; !ok {
+				lines[table+dottedKey(m[1])] = n
+			}
+		}
+	}
+	return lines
+}
+
+// problem is something wrong with the configuration, at a line of the
+// configuration file, if known.
+type problem struct {
+	path string
+	line int
+	err  error
+}
+
+func (p problem) String() string {
+	if p.line > 0 {
+		return fmt.Sprintf("%s:%d: %v", p.path, p.line, p.err)
+	}
+	return fmt.Sprintf("%s: %v", p.path, p.err)
+}
+
+// validateConfig returns the problems of the configuration file at path:
+// syntax errors, unknown keys, invalid flags, themes that don't exist, and
+// files that can't be written.
+func validateConfig(ctx context.Context, path string) []problem {
+	config, err := loadTOMLConfig(path)
+	if err != nil {
+		where := path
+		var ferr *fileError
+		if errors.As(err, &ferr) {
+			where, err = ferr.path, ferr.err
+		}
+		var perr toml.ParseError
+		if errors.As(err, &perr) && perr.Message != "" {
+			return []problem{{path: where, line: perr.Position.Line, err: errors.New(perr.Message)}}
+		}
+		return []problem{{path: where, err: err}}
+	}
+	if config == nil {
+		log.Infof("%s doesn't exist, checking the defaults", path)
+		config = &tomlConfig{values: map[string]interface{}{}}
+	}
+
+	// keys are looked up in the including files first, as they take
+	// precedence.
+	lines := make([]map[string]int, len(config.files))
+	for i, file := range config.files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return []problem{{path: file, err: err}}
+		}
+		lines[i] = keyLines(data)
+	}
+	at := func(err error, keys ...string) problem {
+		for _, key := range keys {
+			for i, file := range config.files {
+				if line, ok := lines[i][key]; ok {
+					return problem{path: file, line: line, err: err}
+				}
+			}
+		}
+		return problem{path: path, err: err}
+	}
+
+	var bare CLI
+	parser, err := kong.New(&bare, platformDefaults())
+	if err != nil {
+		return []problem{{path: path, err: err}}
+	}
+	var problems []problem
+	for _, key := range config.unknownKeys(parser.Model) {
+		problems = append(problems, at(fmt.Errorf("unknown key %s", key), key))
+	}
+	if len(problems) > 0 {
+		return problems
+	}
+
+	var c CLI
+	if parser, err = newParser(&c, path); err == nil {
+		_, err = parser.Parse(os.Args[1:])
+	}
+	if err == nil {
+		err = checkProfile(path, c.Profile)
+	}
+	if err == nil {
+		err = c.usePack()
+	}
+	if err != nil {
+		return []problem{{path: path, err: err}}
+	}
+	if err := c.defineModes(); err != nil {
+		problems = append(problems, at(err, "modes", "mode_themes"))
+	}
+	if _, err := c.Globals.source(ctx); err != nil {
+		problems = append(problems, at(err, "source"))
+	}
+	s, err := c.Globals.switcher()
+	if err != nil {
+		return append(problems, problem{path: path, err: err})
+	}
+
+	for _, b := range s.Backends {
+		name := b.Name()
+		if err := b.Detect(ctx); err != nil {
+			log.WithError(err).WithField("backend", name).Info("backend not available, not checking it")
+			continue
+		}
+		checker, ok := b.(backends.Checker)
+		if !ok {
+			continue
+		}
+		for _, err := range checker.Check(ctx) {
+			problems = append(problems, at(fmt.Errorf("%s: %w", name, err), name+".themes", "template."+name, name))
+		}
+	}
+	for _, h := range s.Hooks {
+		if checker, ok := h.(backends.Checker); ok {
+			for _, err := range checker.Check(ctx) {
+				problems = append(problems, at(err, "script"))
+			}
+		}
+	}
+	return problems
+}
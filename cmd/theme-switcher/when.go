@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/flokli/theme-switcher/internal/cond"
+	"github.com/flokli/theme-switcher/pkg/hooks"
+	"github.com/flokli/theme-switcher/pkg/switcher"
+)
+
+// conditions parses the conditions set with --when, of the backends of
+// enabled.
+func (g *Globals) conditions(enabled []switcher.Backend) (*hooks.When, error) {
+	known := make(map[string]bool, len(enabled))
+	for _, b := range enabled {
+		known[b.Name()] = true
+	}
+	when := &hooks.When{Conditions: make(map[string]*cond.Expr, len(g.When))}
+	for name, src := range g.When {
+		if !known[name] {
+			return nil, fmt.Errorf("condition set for %s, which isn't enabled", name)
+		}
+		expr, err := cond.Parse(src)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		when.Conditions[name] = expr
+	}
+	return when, nil
+}
+
+// hoistConditions moves the when keys of the tables of backends, like
+// [kitty], into the when table, so conditions can be set next to the other
+// settings of a backend. Ones in the when table take precedence.
+func hoistConditions(table map[string]interface{}) {
+	backends := (&Globals{}).packed()
+	for key, value := range table {
+		t, ok := value.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if key == "profile" || key == "host" {
+			for _, overrides := range t {
+				if overrides, ok := overrides.(map[string]interface{}); ok {
+					hoistConditions(overrides)
+				}
+			}
+			continue
+		}
+		name := strings.ReplaceAll(key, "_", "-")
+		condition, ok := t["when"]
+		if _, backend := backends[name]; !ok || !backend {
+			continue
+		}
+		when, ok := table["when"].(map[string]interface{})
+		if _, exists := table["when"]; exists && !ok {
+			// rejected by kong, as it's not a table.
+			continue
+		}
+		if !ok {
+			when = map[string]interface{}{}
+			table["when"] = when
+		}
+		if _, set := when[name]; !set {
+			when[name] = condition
+		}
+		delete(t, "when")
+	}
+}
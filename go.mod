@@ -3,8 +3,13 @@ module github.com/flokli/theme-switcher
 go 1.19
 
 require (
+	github.com/BurntSushi/toml v1.4.0
 	github.com/alecthomas/kong v0.8.1
+	github.com/fsnotify/fsnotify v1.7.0
+	github.com/godbus/dbus/v5 v5.2.2
 	github.com/sirupsen/logrus v1.9.3
+	go.starlark.net v0.0.0-20231121155337-90ade8b19d09
+	golang.org/x/sync v0.3.0
+	golang.org/x/sys v0.27.0
+	gopkg.in/yaml.v3 v3.0.1
 )
-
-require golang.org/x/sys v0.0.0-20220715151400-c0bba94af5f8 // indirect
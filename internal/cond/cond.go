@@ -0,0 +1,374 @@
+// Package cond parses and evaluates the conditions backends are switched on,
+// like env.XDG_SESSION_TYPE == 'wayland' && running('sway').
+//
+// Conditions compare strings with == and !=, or match them against a regular
+// expression with =~, and combine them with &&, || and !, in parentheses if
+// needed. Strings are quoted with ' or ", and a string by itself holds if
+// it isn't empty. Variables are:
+//
+//   - env.NAME, the environment variable NAME, or "" if it's unset
+//   - mode, the mode switched to, and appearance, "light" or "dark"
+//   - os, like "linux" or "darwin", and hostname
+//
+// Functions are running('NAME'), whether a process named NAME of the user
+// runs, installed('NAME'), whether the executable NAME is on $PATH, and
+// exists('PATH'), whether the file PATH exists.
+package cond
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"runtime"
+	"strings"
+
+	"github.com/flokli/theme-switcher/internal/procs"
+)
+
+// Expr is a parsed condition.
+type Expr struct {
+	src  string
+	root node
+}
+
+func (e *Expr) String() string { return e.src }
+
+// Vars are the variables conditions are evaluated with, besides env.NAME, os
+// and hostname, like mode.
+type Vars map[string]string
+
+// variables are the names of the variables besides env.NAME.
+var variables = map[string]bool{"mode": true, "appearance": true, "os": true, "hostname": true}
+
+// functions are the functions conditions can call, with a string.
+var functions = map[string]func(string) (bool, error){
+	"running": procs.Running,
+	"installed": func(name string) (bool, error) {
+		_, err := exec.LookPath(name)
+		return err == nil, nil
+	},
+	"exists": func(path string) (bool, error) {
+		_, err := os.Stat(path)
+		return err == nil, nil
+	},
+}
+
+// Eval returns whether the condition holds with vars.
+func (e *Expr) Eval(vars Vars) (bool, error) {
+	v, err := e.root.eval(vars)
+	if err != nil {
+		return false, err
+	}
+	return truthy(v), nil
+}
+
+// value is a string or a bool.
+type value interface{}
+
+func truthy(v value) bool {
+	switch v := v.(type) {
+	case bool:
+		return v
+	case string:
+		return v != ""
+	}
+	return false
+}
+
+type node interface {
+	eval(vars Vars) (value, error)
+}
+
+type literal struct{ v value }
+
+func (n literal) eval(Vars) (value, error) { return n.v, nil }
+
+type variable struct{ name string }
+
+func (n variable) eval(vars Vars) (value, error) {
+	if name := strings.TrimPrefix(n.name, "env."); name != n.name {
+		return os.Getenv(name), nil
+	}
+	if v, ok := vars[n.name]; ok {
+		return v, nil
+	}
+	switch n.name {
+	case "os":
+		return runtime.GOOS, nil
+	case "hostname":
+		hostname, err := os.Hostname()
+		if err != nil {
+			return nil, fmt.Errorf("unable to determine hostname: %w", err)
+		}
+		return hostname, nil
+	}
+	return "", nil
+}
+
+type call struct {
+	name string
+	arg  node
+}
+
+func (n call) eval(vars Vars) (value, error) {
+	arg, err := n.arg.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	s, ok := arg.(string)
+	if !ok {
+		return nil, fmt.Errorf("%s needs a string", n.name)
+	}
+	return functions[n.name](s)
+}
+
+type not struct{ x node }
+
+func (n not) eval(vars Vars) (value, error) {
+	v, err := n.x.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	return !truthy(v), nil
+}
+
+type logical struct {
+	and  bool
+	l, r node
+}
+
+func (n logical) eval(vars Vars) (value, error) {
+	l, err := n.l.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	// short-circuit, not to look for processes for nothing.
+	if truthy(l) != n.and {
+		return truthy(l), nil
+	}
+	r, err := n.r.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	return truthy(r), nil
+}
+
+type compare struct {
+	op   string
+	l, r node
+	// re is the regular expression of =~, if r is a literal.
+	re *regexp.Regexp
+}
+
+func (n compare) eval(vars Vars) (value, error) {
+	l, err := n.l.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	r, err := n.r.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	switch n.op {
+	case "==":
+		return l == r, nil
+	case "!=":
+		return l != r, nil
+	}
+	s, ok := l.(string)
+	pattern, isString := r.(string)
+	if !ok || !isString {
+		return nil, errors.New("=~ needs strings")
+	}
+	re := n.re
+	if re == nil {
+		if re, err = regexp.Compile(pattern); err != nil {
+			return nil, fmt.Errorf("invalid regular expression %q: %w", pattern, err)
+		}
+	}
+	return re.MatchString(s), nil
+}
+
+// Parse parses the condition src.
+func Parse(src string) (*Expr, error) {
+	p := &parser{src: src}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	root, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if p.tok != "" {
+		return nil, p.errorf("unexpected %s", p.tok)
+	}
+	return &Expr{src: src, root: root}, nil
+}
+
+// parser is a recursive descent parser of conditions, looking ahead one
+// token.
+type parser struct {
+	src string
+	pos int
+	// tok is the current token, empty at the end, and str the value of it
+	// if it's a string.
+	tok   string
+	str   string
+	isStr bool
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("invalid condition %q: %s", p.src, fmt.Sprintf(format, args...))
+}
+
+func isIdent(c byte) bool {
+	return c == '_' || c == '.' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+// next reads the next token.
+func (p *parser) next() error {
+	for p.pos < len(p.src) && strings.ContainsRune(" \t\n", rune(p.src[p.pos])) {
+		p.pos++
+	}
+	p.tok, p.str, p.isStr = "", "", false
+	if p.pos >= len(p.src) {
+		return nil
+	}
+	start := p.pos
+	c := p.src[p.pos]
+	switch {
+	case c == '\'' || c == '"':
+		end := strings.IndexByte(p.src[p.pos+1:], c)
+		if end < 0 {
+			return p.errorf("unterminated string")
+		}
+		p.str, p.isStr = p.src[p.pos+1:p.pos+1+end], true
+		p.pos += end + 2
+	case isIdent(c):
+		for p.pos < len(p.src) && isIdent(p.src[p.pos]) {
+			p.pos++
+		}
+	case strings.HasPrefix(p.src[p.pos:], "=="), strings.HasPrefix(p.src[p.pos:], "!="),
+		strings.HasPrefix(p.src[p.pos:], "=~"), strings.HasPrefix(p.src[p.pos:], "&&"),
+		strings.HasPrefix(p.src[p.pos:], "||"):
+		p.pos += 2
+	case strings.ContainsRune("()!", rune(c)):
+		p.pos++
+	default:
+		return p.errorf("unexpected %c", c)
+	}
+	p.tok = p.src[start:p.pos]
+	return nil
+}
+
+func (p *parser) or() (node, error) {
+	l, err := p.and()
+	for err == nil && p.tok == "||" {
+		var r node
+		if err = p.next(); err != nil {
+			break
+		}
+		r, err = p.and()
+		l = logical{and: false, l: l, r: r}
+	}
+	return l, err
+}
+
+func (p *parser) and() (node, error) {
+	l, err := p.unary()
+	for err == nil && p.tok == "&&" {
+		var r node
+		if err = p.next(); err != nil {
+			break
+		}
+		r, err = p.unary()
+		l = logical{and: true, l: l, r: r}
+	}
+	return l, err
+}
+
+func (p *parser) unary() (node, error) {
+	if p.tok == "!" && !p.isStr {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		x, err := p.unary()
+		return not{x: x}, err
+	}
+	l, err := p.operand()
+	if err != nil {
+		return nil, err
+	}
+	op := p.tok
+	if p.isStr || (op != "==" && op != "!=" && op != "=~") {
+		return l, nil
+	}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	r, err := p.operand()
+	if err != nil {
+		return nil, err
+	}
+	n := compare{op: op, l: l, r: r}
+	if lit, ok := r.(literal); ok && op == "=~" {
+		pattern, _ := lit.v.(string)
+		if n.re, err = regexp.Compile(pattern); err != nil {
+			return nil, p.errorf("invalid regular expression %q: %v", pattern, err)
+		}
+	}
+	return n, nil
+}
+
+// operand parses a string, variable, function call or condition in
+// parentheses.
+func (p *parser) operand() (node, error) {
+	tok, str, isStr := p.tok, p.str, p.isStr
+	switch {
+	case isStr:
+		return literal{v: str}, p.next()
+	case tok == "(":
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		x, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if p.tok != ")" || p.isStr {
+			return nil, p.errorf("missing )")
+		}
+		return x, p.next()
+	case tok == "true" || tok == "false":
+		return literal{v: tok == "true"}, p.next()
+	case tok != "" && isIdent(tok[0]):
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		if p.tok != "(" || p.isStr {
+			if !variables[tok] && !(strings.HasPrefix(tok, "env.") && len(tok) > len("env.")) {
+				return nil, p.errorf("unknown variable %s", tok)
+			}
+			return variable{name: tok}, nil
+		}
+		if _, ok := functions[tok]; !ok {
+			return nil, p.errorf("unknown function %s", tok)
+		}
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		arg, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if p.tok != ")" || p.isStr {
+			return nil, p.errorf("missing ) after the argument of %s", tok)
+		}
+		return call{name: tok, arg: arg}, p.next()
+	case tok == "":
+		return nil, p.errorf("unexpected end")
+	}
+	return nil, p.errorf("unexpected %s", tok)
+}
@@ -0,0 +1,118 @@
+package cond
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestEval(t *testing.T) {
+	t.Setenv("THEME_SWITCHER_TEST", "xterm-kitty")
+	// restored after the test.
+	t.Setenv("THEME_SWITCHER_UNSET", "")
+	os.Unsetenv("THEME_SWITCHER_UNSET")
+	dir := t.TempDir()
+	vars := Vars{"mode": "oled", "appearance": "dark"}
+
+	for _, tt := range []struct {
+		src  string
+		want bool
+	}{
+		{`mode == 'oled'`, true},
+		{`mode != "oled"`, false},
+		{`appearance == "dark" && mode != 'dark'`, true},
+		{`"it's" == 'it' || true`, true},
+		{`mode`, true},
+		{`''`, false},
+
+		// && binds tighter than ||, and both associate left.
+		{`'a' || '' && ''`, true},
+		{`('a' || '') && ''`, false},
+		{`'' && '' || 'a'`, true},
+		{`'' && ('' || 'a')`, false},
+		{`true || false && false`, true},
+		{`false && false || true`, true},
+
+		// ! binds to the comparison after it.
+		{`!mode == 'dark'`, true},
+		{`!(mode == 'oled')`, false},
+		{`!!mode`, true},
+		{`!false && !''`, true},
+
+		// unset variables are empty.
+		{`env.THEME_SWITCHER_UNSET != ''`, false},
+		{`env.THEME_SWITCHER_UNSET != 'x'`, true},
+		{`env.THEME_SWITCHER_UNSET == ''`, true},
+		{`env.THEME_SWITCHER_UNSET`, false},
+		{`env.THEME_SWITCHER_TEST == 'xterm-kitty'`, true},
+		{`env.THEME_SWITCHER_TEST =~ '^xterm-'`, true},
+		{`env.THEME_SWITCHER_TEST =~ "^kitty"`, false},
+		{`mode =~ appearance`, false},
+
+		{fmt.Sprintf(`os == '%s'`, runtime.GOOS), true},
+		{fmt.Sprintf(`exists('%s')`, dir), true},
+		{fmt.Sprintf(`exists("%s") || mode == 'dark'`, filepath.Join(dir, "missing")), false},
+		{`installed('theme-switcher-not-installed')`, false},
+	} {
+		expr, err := Parse(tt.src)
+		if err != nil {
+			t.Errorf("Parse(%s): %v", tt.src, err)
+			continue
+		}
+		if got, err := expr.Eval(vars); err != nil || got != tt.want {
+			t.Errorf("%s = %v, %v, want %v", tt.src, got, err, tt.want)
+		}
+		if expr.String() != tt.src {
+			t.Errorf("String() = %s, want %s", expr.String(), tt.src)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, src := range []string{
+		``,
+		`mode == 'dark`,
+		`"unterminated`,
+		`mode == "dark' || true`,
+		`theme == 'dark'`,
+		`env. == ''`,
+		`nope('x')`,
+		`Running('sway')`,
+		`running('sway'`,
+		`running('sway') true`,
+		`mode == 'dark' mode`,
+		`mode == 'dark')`,
+		`(mode == 'dark'`,
+		`mode ==`,
+		`mode = 'dark'`,
+		`&& mode`,
+		`mode || `,
+		`mode =~ '('`,
+		`mode == 'a' == 'b'`,
+		`mode @ 'a'`,
+	} {
+		if expr, err := Parse(src); err == nil {
+			t.Errorf("Parse(%s) = %v, want an error", src, expr.root)
+		}
+	}
+}
+
+func TestEvalErrors(t *testing.T) {
+	for _, src := range []string{
+		`running(true)`,
+		`exists(mode == 'dark')`,
+		`mode =~ true`,
+		`mode =~ appearance`,
+	} {
+		expr, err := Parse(src)
+		if err != nil {
+			t.Errorf("Parse(%s): %v", src, err)
+			continue
+		}
+		if got, err := expr.Eval(Vars{"mode": "dark", "appearance": "("}); err == nil {
+			t.Errorf("%s = %v, want an error", src, got)
+		}
+	}
+}
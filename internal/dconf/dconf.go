@@ -0,0 +1,206 @@
+// Package dconf reads keys from the dconf user database, and writes and
+// watches them via the dconf service on the session bus, without depending
+// on the dconf or gsettings binaries.
+//
+// Only the user database is read. System databases listed in the dconf
+// profile, which hold defaults and locks set by the administrator, aren't:
+// for a key missing from the user database, the Read functions report it
+// as not set, and callers fall back to the schema default.
+package dconf
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/godbus/dbus/v5"
+)
+
+const (
+	writerBusName   = "ca.desrt.dconf"
+	writerInterface = "ca.desrt.dconf.Writer"
+	userWriterPath  = dbus.ObjectPath("/ca/desrt/dconf/Writer/user")
+)
+
+// UserDBPath returns the path to the dconf user database.
+func UserDBPath() (string, error) {
+	confDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("unable to determine user config dir: %w", err)
+	}
+	return filepath.Join(confDir, "dconf", "user"), nil
+}
+
+// read returns the serialized value stored at key in the dconf user database,
+// and the byte order it's serialized in.
+// ok is false if the key is not set.
+func read(key string) (raw []byte, order binary.ByteOrder, ok bool, err error) {
+	dbPath, err := UserDBPath()
+	if err != nil {
+		return nil, nil, false, err
+	}
+
+	data, err := os.ReadFile(dbPath)
+	if err != nil {
+		// no database is written before the first key is changed.
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil, false, nil
+		}
+		return nil, nil, false, fmt.Errorf("unable to read dconf database: %w", err)
+	}
+
+	values, order, err := parseGVDB(data)
+	if err != nil {
+		return nil, nil, false, fmt.Errorf("unable to parse dconf database %s: %w", dbPath, err)
+	}
+
+	raw, ok = values[key]
+	return raw, order, ok, nil
+}
+
+// ReadString reads the string stored at key (like /org/gnome/desktop/interface/color-scheme)
+// in the dconf user database.
+// ok is false if the key is not set, in which case the schema default applies.
+func ReadString(key string) (value string, ok bool, err error) {
+	raw, _, ok, err := read(key)
+	if err != nil || !ok {
+		return "", false, err
+	}
+
+	value, err = parseVariantString(raw)
+	if err != nil {
+		return "", false, fmt.Errorf("unable to parse value of %s: %w", key, err)
+	}
+	return value, true, nil
+}
+
+// ReadBool reads the boolean stored at key in the dconf user database, like ReadString.
+func ReadBool(key string) (value bool, ok bool, err error) {
+	raw, _, ok, err := read(key)
+	if err != nil || !ok {
+		return false, false, err
+	}
+
+	value, err = parseVariantBool(raw)
+	if err != nil {
+		return false, false, fmt.Errorf("unable to parse value of %s: %w", key, err)
+	}
+	return value, true, nil
+}
+
+// ReadDouble reads the double stored at key in the dconf user database, like ReadString.
+func ReadDouble(key string) (value float64, ok bool, err error) {
+	values, ok, err := ReadDoubles(key, 1)
+	if err != nil || !ok {
+		return 0, false, err
+	}
+	return values[0], true, nil
+}
+
+// ReadDoubles reads the tuple of n doubles stored at key in the dconf user
+// database, like ReadString.
+func ReadDoubles(key string, n int) (values []float64, ok bool, err error) {
+	raw, order, ok, err := read(key)
+	if err != nil || !ok {
+		return nil, false, err
+	}
+
+	values, err = parseVariantDoubles(raw, order, n)
+	if err != nil {
+		return nil, false, fmt.Errorf("unable to parse value of %s: %w", key, err)
+	}
+	return values, true, nil
+}
+
+// WriteString sets key to a string value in the dconf user database,
+// through the dconf service.
+func WriteString(ctx context.Context, key, value string) error {
+	conn, err := dbus.ConnectSessionBus(dbus.WithContext(ctx))
+	if err != nil {
+		return fmt.Errorf("unable to connect to session bus: %w", err)
+	}
+	defer conn.Close()
+
+	var tag string
+	if err := conn.Object(writerBusName, userWriterPath).CallWithContext(ctx,
+		writerInterface+".Change", 0, serializeChangeset(key, value),
+	).Store(&tag); err != nil {
+		return fmt.Errorf("unable to write %s: %w", key, err)
+	}
+	return nil
+}
+
+// Affects returns true if a change to path, as sent by Watch, affects key.
+// Paths ending in a slash refer to all keys below them.
+func Affects(path, key string) bool {
+	if strings.HasSuffix(path, "/") {
+		return strings.HasPrefix(key, path)
+	}
+	return path == key
+}
+
+// Watch subscribes to change notifications of the dconf user database,
+// and sends the path of every changed key or dir to the returned channel.
+// The channel is closed once ctx is done, or the bus connection is lost.
+func Watch(ctx context.Context) (<-chan string, error) {
+	conn, err := dbus.ConnectSessionBus(dbus.WithContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to session bus: %w", err)
+	}
+
+	if err := conn.AddMatchSignalContext(ctx,
+		dbus.WithMatchInterface(writerInterface),
+		dbus.WithMatchMember("Notify"),
+		dbus.WithMatchObjectPath(userWriterPath),
+	); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("unable to subscribe to dconf changes: %w", err)
+	}
+
+	signals := make(chan *dbus.Signal, 16)
+	conn.Signal(signals)
+
+	changes := make(chan string)
+
+	go func() {
+		defer close(changes)
+		defer conn.Close()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case sig, ok := <-signals:
+				if !ok {
+					return
+				}
+				if sig.Name != writerInterface+".Notify" || sig.Path != userWriterPath {
+					continue
+				}
+
+				// Notify carries a prefix, a list of paths relative to it, and a tag.
+				var prefix, tag string
+				var paths []string
+				if err := dbus.Store(sig.Body, &prefix, &paths, &tag); err != nil {
+					continue
+				}
+				if len(paths) == 0 {
+					paths = []string{""}
+				}
+				for _, p := range paths {
+					select {
+					case changes <- prefix + p:
+					case <-ctx.Done():
+						return
+					}
+				}
+			}
+		}
+	}()
+
+	return changes, nil
+}
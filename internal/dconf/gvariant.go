@@ -0,0 +1,65 @@
+package dconf
+
+import "bytes"
+
+// This implements just enough of the GVariant serialization format to encode
+// the changesets sent to the dconf service. See the "GVariant Serialisation"
+// chapter of the glib documentation.
+
+// align pads buf with zero bytes to a multiple of n.
+func align(buf *bytes.Buffer, n int) {
+	for buf.Len()%n != 0 {
+		buf.WriteByte(0)
+	}
+}
+
+// offsetSize returns the size of framing offsets in a container with a body
+// of the given length, containing n framing offsets.
+func offsetSize(length, n int) int {
+	for _, size := range []int{1, 2, 4} {
+		if length+n*size <= 1<<(8*size)-1 {
+			return size
+		}
+	}
+	return 8
+}
+
+// writeOffsets appends the framing offsets to a container body.
+func writeOffsets(buf *bytes.Buffer, offsets ...int) {
+	size := offsetSize(buf.Len(), len(offsets))
+	for _, offset := range offsets {
+		for i := 0; i < size; i++ {
+			buf.WriteByte(byte(offset >> (8 * i)))
+		}
+	}
+}
+
+// serializeChangeset serializes a dconf changeset setting key to a string value,
+// which is a GVariant of type a{smv}.
+func serializeChangeset(key, value string) []byte {
+	// the variant holding the value: the string, its terminator, a
+	// separator, and the type string.
+	var v bytes.Buffer
+	v.WriteString(value)
+	v.WriteByte(0)
+	v.WriteByte(0)
+	v.WriteString("s")
+
+	// the dict entry: the key, the maybe (a variable-size "Just" gets a
+	// trailing zero byte), and the framing offset marking the end of the key.
+	var entry bytes.Buffer
+	entry.WriteString(key)
+	entry.WriteByte(0)
+	keyEnd := entry.Len()
+	align(&entry, 8)
+	entry.Write(v.Bytes())
+	entry.WriteByte(0)
+	writeOffsets(&entry, keyEnd)
+
+	// the array: its only element, and the framing offset marking its end.
+	var array bytes.Buffer
+	array.Write(entry.Bytes())
+	writeOffsets(&array, array.Len())
+
+	return array.Bytes()
+}
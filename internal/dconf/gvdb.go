@@ -0,0 +1,162 @@
+package dconf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// This implements just enough of the GVDB file format used by dconf to
+// look up values in a database. See gvdb-format.h in the glib/dconf sources.
+
+const (
+	gvdbHeaderSize = 24
+	gvdbItemSize   = 24
+	gvdbNoParent   = 0xffffffff
+)
+
+var (
+	gvdbSignature        = []byte("GVariant")
+	gvdbSignatureSwapped = []byte("raVGtnai")
+)
+
+// parseGVDB parses the root hash table of a GVDB file, and returns the
+// serialized values of all value items in it, keyed by their full name, and
+// the byte order they're serialized in.
+func parseGVDB(data []byte) (map[string][]byte, binary.ByteOrder, error) {
+	if len(data) < gvdbHeaderSize {
+		return nil, nil, errors.New("file too short")
+	}
+
+	var order binary.ByteOrder
+	switch {
+	case bytes.Equal(data[0:8], gvdbSignature):
+		order = binary.LittleEndian
+	case bytes.Equal(data[0:8], gvdbSignatureSwapped):
+		order = binary.BigEndian
+	default:
+		return nil, nil, errors.New("invalid signature")
+	}
+
+	slice := func(start, end uint32) ([]byte, error) {
+		if start > end || int(end) > len(data) {
+			return nil, fmt.Errorf("pointer %d-%d out of bounds", start, end)
+		}
+		return data[start:end], nil
+	}
+
+	table, err := slice(order.Uint32(data[16:20]), order.Uint32(data[20:24]))
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid root pointer: %w", err)
+	}
+	if len(table) < 8 {
+		return nil, nil, errors.New("hash table too short")
+	}
+
+	// the upper 5 bits of the first word contain the bloom shift.
+	nBloomWords := order.Uint32(table[0:4]) & (1<<27 - 1)
+	nBuckets := order.Uint32(table[4:8])
+	itemsStart := 8 + 4*(uint64(nBloomWords)+uint64(nBuckets))
+	if itemsStart > uint64(len(table)) || (uint64(len(table))-itemsStart)%gvdbItemSize != 0 {
+		return nil, nil, errors.New("invalid hash table size")
+	}
+	items := table[itemsStart:]
+	nItems := uint32(len(items) / gvdbItemSize)
+
+	// keys are stored relative to their parent item, so we first collect
+	// the key segments, then join them.
+	parents := make([]uint32, nItems)
+	segments := make([]string, nItems)
+	for i := uint32(0); i < nItems; i++ {
+		item := items[i*gvdbItemSize : (i+1)*gvdbItemSize]
+		parents[i] = order.Uint32(item[4:8])
+		keyStart := order.Uint32(item[8:12])
+		keySize := uint32(order.Uint16(item[12:14]))
+		key, err := slice(keyStart, keyStart+keySize)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid key of item %d: %w", i, err)
+		}
+		segments[i] = string(key)
+	}
+
+	fullKey := func(i uint32) (string, error) {
+		key := segments[i]
+		for depth := uint32(0); parents[i] != gvdbNoParent; depth++ {
+			if parents[i] >= nItems || depth > nItems {
+				return "", fmt.Errorf("invalid parent of item %d", i)
+			}
+			i = parents[i]
+			key = segments[i] + key
+		}
+		return key, nil
+	}
+
+	values := make(map[string][]byte)
+	for i := uint32(0); i < nItems; i++ {
+		item := items[i*gvdbItemSize : (i+1)*gvdbItemSize]
+		if item[14] != 'v' {
+			continue
+		}
+		key, err := fullKey(i)
+		if err != nil {
+			return nil, nil, err
+		}
+		value, err := slice(order.Uint32(item[16:20]), order.Uint32(item[20:24]))
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid value of %s: %w", key, err)
+		}
+		values[key] = value
+	}
+
+	return values, order, nil
+}
+
+// parseVariantString parses a serialized GVariant of type "v",
+// which is expected to contain a string.
+func parseVariantString(data []byte) (string, error) {
+	// a variant is serialized as the child value, a zero byte, and the type string.
+	sep := bytes.LastIndexByte(data, 0)
+	if sep < 0 {
+		return "", errors.New("invalid variant")
+	}
+	if typ := string(data[sep+1:]); typ != "s" {
+		return "", fmt.Errorf("expected string, got type %q", typ)
+	}
+	// strings are serialized with a trailing zero byte.
+	value := data[:sep]
+	if len(value) == 0 || value[len(value)-1] != 0 {
+		return "", errors.New("invalid string")
+	}
+	return string(value[:len(value)-1]), nil
+}
+
+// parseVariantBool parses a serialized GVariant of type "v",
+// which is expected to contain a boolean.
+func parseVariantBool(data []byte) (bool, error) {
+	// booleans are serialized as a single byte, followed by the zero byte.
+	if len(data) != 3 || data[1] != 0 || data[2] != 'b' {
+		return false, errors.New("expected boolean")
+	}
+	return data[0] != 0, nil
+}
+
+// parseVariantDoubles parses a serialized GVariant of type "v", which is
+// expected to contain a double, if n is 1, or a tuple of n doubles.
+func parseVariantDoubles(data []byte, order binary.ByteOrder, n int) ([]float64, error) {
+	typ := "d"
+	if n > 1 {
+		typ = "(" + strings.Repeat("d", n) + ")"
+	}
+	// doubles are fixed-size, so they're serialized back to back.
+	if len(data) != 8*n+1+len(typ) || data[8*n] != 0 || string(data[8*n+1:]) != typ {
+		return nil, fmt.Errorf("expected %s", typ)
+	}
+	values := make([]float64, n)
+	for i := range values {
+		values[i] = math.Float64frombits(order.Uint64(data[8*i : 8*(i+1)]))
+	}
+	return values, nil
+}
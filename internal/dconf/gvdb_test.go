@@ -0,0 +1,96 @@
+package dconf
+
+import (
+	"encoding/binary"
+	"os"
+	"testing"
+)
+
+// testdata/user is a user database with these keys set:
+//
+//	/org/gnome/desktop/interface/color-scheme 'prefer-dark'
+//	/org/gnome/desktop/a11y/interface/high-contrast true
+//	/org/gnome/settings-daemon/plugins/color/night-light-schedule-from 20.5
+//	/org/gnome/settings-daemon/plugins/color/night-light-last-coordinates (52.52, 13.405)
+func readFixture(t testing.TB) []byte {
+	data, err := os.ReadFile("testdata/user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestParseGVDB(t *testing.T) {
+	values, order, err := parseGVDB(readFixture(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if order != binary.LittleEndian {
+		t.Errorf("byte order %v, want little endian", order)
+	}
+	if len(values) != 4 {
+		t.Errorf("got %d values, want 4, as dirs aren't values", len(values))
+	}
+
+	if value, err := parseVariantString(values["/org/gnome/desktop/interface/color-scheme"]); err != nil || value != "prefer-dark" {
+		t.Errorf("color-scheme = %q, %v, want prefer-dark", value, err)
+	}
+	if value, err := parseVariantBool(values["/org/gnome/desktop/a11y/interface/high-contrast"]); err != nil || !value {
+		t.Errorf("high-contrast = %v, %v, want true", value, err)
+	}
+	if value, err := parseVariantDoubles(values["/org/gnome/settings-daemon/plugins/color/night-light-schedule-from"], order, 1); err != nil || value[0] != 20.5 {
+		t.Errorf("night-light-schedule-from = %v, %v, want 20.5", value, err)
+	}
+	if value, err := parseVariantDoubles(values["/org/gnome/settings-daemon/plugins/color/night-light-last-coordinates"], order, 2); err != nil || value[0] != 52.52 || value[1] != 13.405 {
+		t.Errorf("night-light-last-coordinates = %v, %v, want [52.52 13.405]", value, err)
+	}
+
+	// values of the wrong type aren't taken for another one.
+	if _, err := parseVariantBool(values["/org/gnome/desktop/interface/color-scheme"]); err == nil {
+		t.Error("string parsed as boolean")
+	}
+	if _, err := parseVariantDoubles(values["/org/gnome/settings-daemon/plugins/color/night-light-last-coordinates"], order, 1); err == nil {
+		t.Error("tuple parsed as double")
+	}
+}
+
+func TestParseGVDBErrors(t *testing.T) {
+	valid := readFixture(t)
+	modified := func(f func(data []byte)) []byte {
+		data := append([]byte(nil), valid...)
+		f(data)
+		return data
+	}
+
+	for name, data := range map[string][]byte{
+		"empty":              {},
+		"truncated header":   valid[:20],
+		"truncated":          valid[:len(valid)-1],
+		"invalid signature":  modified(func(data []byte) { copy(data, "GVariang") }),
+		"root out of bounds": modified(func(data []byte) { binary.LittleEndian.PutUint32(data[20:], uint32(len(data)+1)) }),
+		"root reversed":      modified(func(data []byte) { binary.LittleEndian.PutUint32(data[16:], uint32(len(data))) }),
+		"too many buckets": modified(func(data []byte) {
+			binary.LittleEndian.PutUint32(data[binary.LittleEndian.Uint32(data[16:])+4:], 1<<31)
+		}),
+	} {
+		if values, _, err := parseGVDB(data); err == nil {
+			t.Errorf("%s: got %d values, want an error", name, len(values))
+		}
+	}
+}
+
+func FuzzParseGVDB(f *testing.F) {
+	f.Add(readFixture(f))
+	f.Add([]byte("GVariant"))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		values, order, err := parseGVDB(data)
+		if err != nil {
+			return
+		}
+		for _, value := range values {
+			parseVariantString(value)
+			parseVariantBool(value)
+			parseVariantDoubles(value, order, 2)
+		}
+	})
+}
@@ -0,0 +1,93 @@
+package diff
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// replaced returns the lines from 1 to last, with the ones in lines replaced.
+func replaced(last int, lines map[int]string) string {
+	var sb strings.Builder
+	for i := 1; i <= last; i++ {
+		if line, ok := lines[i]; ok {
+			sb.WriteString(line)
+			continue
+		}
+		fmt.Fprintf(&sb, "%d\n", i)
+	}
+	return sb.String()
+}
+
+func TestUnified(t *testing.T) {
+	for _, tt := range []struct {
+		name, old, new, want string
+	}{
+		{
+			name: "equal",
+			old:  "a\nb\n",
+			new:  "a\nb\n",
+			want: "",
+		},
+		{
+			name: "both empty",
+			want: "",
+		},
+		{
+			name: "insertion into an empty file",
+			new:  "a\nb\n",
+			want: "--- f\n+++ f\n@@ -0,0 +1,2 @@\n+a\n+b\n",
+		},
+		{
+			name: "deletion of everything",
+			old:  "a\nb\nc\n",
+			want: "--- f\n+++ f\n@@ -1,3 +0,0 @@\n-a\n-b\n-c\n",
+		},
+		{
+			name: "change with context",
+			old:  replaced(10, nil),
+			new:  replaced(10, map[int]string{5: "five\n"}),
+			want: "--- f\n+++ f\n@@ -2,7 +2,7 @@\n 2\n 3\n 4\n-5\n+five\n 6\n 7\n 8\n",
+		},
+		{
+			name: "insertion after a line",
+			old:  replaced(10, nil),
+			new:  replaced(10, map[int]string{5: "5\nnew\n"}),
+			want: "--- f\n+++ f\n@@ -3,6 +3,7 @@\n 3\n 4\n 5\n+new\n 6\n 7\n 8\n",
+		},
+		{
+			name: "changes twice the context apart",
+			old:  replaced(20, nil),
+			new:  replaced(20, map[int]string{3: "x\n", 10: "y\n"}),
+			want: "--- f\n+++ f\n@@ -1,13 +1,13 @@\n 1\n 2\n-3\n+x\n 4\n 5\n 6\n 7\n 8\n 9\n-10\n+y\n 11\n 12\n 13\n",
+		},
+		{
+			name: "changes further apart",
+			old:  replaced(20, nil),
+			new:  replaced(20, map[int]string{3: "x\n", 11: "y\n"}),
+			want: "--- f\n+++ f\n@@ -1,6 +1,6 @@\n 1\n 2\n-3\n+x\n 4\n 5\n 6\n@@ -8,7 +8,7 @@\n 8\n 9\n 10\n-11\n+y\n 12\n 13\n 14\n",
+		},
+		{
+			name: "newline added at the end",
+			old:  "a\nb",
+			new:  "a\nb\n",
+			want: "--- f\n+++ f\n@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+b\n",
+		},
+		{
+			name: "newline removed at the end",
+			old:  "a\nb\n",
+			new:  "a\nb",
+			want: "--- f\n+++ f\n@@ -1,2 +1,2 @@\n a\n-b\n+b\n\\ No newline at end of file\n",
+		},
+		{
+			name: "unchanged last line without newline",
+			old:  "a\nb",
+			new:  "x\nb",
+			want: "--- f\n+++ f\n@@ -1,2 +1,2 @@\n-a\n+x\n b\n\\ No newline at end of file\n",
+		},
+	} {
+		if got := Unified("f", tt.old, tt.new); got != tt.want {
+			t.Errorf("%s: got\n%s\nwant\n%s", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+// Package lines reads newline-delimited streams, like server-sent events and
+// the requests on the control socket. Unlike bufio.Scanner, it skips lines
+// that are too long, instead of giving up on the rest of the stream.
+package lines
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+)
+
+// MaxLength is the maximum length of lines streams are read with.
+const MaxLength = 1 << 20
+
+// ErrTooLong is returned for a line longer than the maximum. It's skipped,
+// and reading can continue with the next one.
+var ErrTooLong = errors.New("line too long")
+
+// Reader reads lines from a stream.
+type Reader struct {
+	r   *bufio.Reader
+	max int
+}
+
+// NewReader returns a Reader reading lines of up to max bytes from r.
+func NewReader(r io.Reader, max int) *Reader {
+	return &Reader{r: bufio.NewReader(r), max: max}
+}
+
+// Read returns the next line, without its line ending. A last line without
+// newline is returned as well, before io.EOF. Lines longer than the maximum
+// are read to their end, but only up to the maximum is kept in memory.
+func (r *Reader) Read() ([]byte, error) {
+	var line []byte
+	n := 0
+	for {
+		chunk, err := r.r.ReadSlice('\n')
+		n += len(chunk)
+		// keep up to the maximum and the newline.
+		if n <= r.max+1 {
+			line = append(line, chunk...)
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err != nil && !(err == io.EOF && n > 0) {
+			return nil, err
+		}
+		if bytes.HasSuffix(chunk, []byte("\n")) {
+			n--
+		}
+		if n > r.max {
+			return nil, ErrTooLong
+		}
+		return bytes.TrimSuffix(bytes.TrimSuffix(line, []byte("\n")), []byte("\r")), nil
+	}
+}
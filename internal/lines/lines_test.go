@@ -0,0 +1,51 @@
+package lines
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestRead(t *testing.T) {
+	// longer than the buffer of the underlying reader, too.
+	long := strings.Repeat("x", 10000)
+	for _, tt := range []struct {
+		name string
+		max  int
+		in   string
+		want []string
+	}{
+		{name: "empty", max: 8, in: "", want: nil},
+		{name: "lines", max: 8, in: "a\n\nb\n", want: []string{"a", "", "b"}},
+		{name: "CRLF", max: 8, in: "a\r\nb\r\n", want: []string{"a", "b"}},
+		{name: "no trailing newline", max: 8, in: "a\nb", want: []string{"a", "b"}},
+		{name: "maximum length", max: 8, in: "12345678\n12345678", want: []string{"12345678", "12345678"}},
+		{name: "too long", max: 8, in: "123456789\nnext\n", want: []string{"!", "next"}},
+		{name: "too long without newline", max: 8, in: "a\n123456789", want: []string{"a", "!"}},
+		{name: "longer than the buffer", max: 8, in: "a\n" + long + "\nnext\n", want: []string{"a", "!", "next"}},
+		{name: "long line within the maximum", max: 20000, in: long + "\nnext", want: []string{long, "next"}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewReader(strings.NewReader(tt.in), tt.max)
+			// "!" stands for ErrTooLong.
+			var got []string
+			for {
+				line, err := r.Read()
+				if err == io.EOF {
+					break
+				}
+				switch err {
+				case nil:
+					got = append(got, string(line))
+				case ErrTooLong:
+					got = append(got, "!")
+				default:
+					t.Fatal(err)
+				}
+			}
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") || len(got) != len(tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
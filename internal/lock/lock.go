@@ -0,0 +1,55 @@
+// Package lock takes exclusive locks on files, held until they're released
+// or the process exits, so only one daemon modifies configuration files at a
+// time.
+package lock
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// ErrLocked is returned by Acquire if another process holds the lock.
+var ErrLocked = errors.New("locked by another process")
+
+// Lock is a lock held on a file.
+type Lock struct {
+	f *os.File
+}
+
+// Acquire takes the lock on the file at path, creating it, and writes the pid
+// of the current process to it. If another process holds the lock, it returns
+// an error wrapping ErrLocked, with the pid of that process, if it's known.
+func Acquire(path string) (*Lock, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("unable to create lock dir: %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open lock file: %w", err)
+	}
+	if err := lockFile(f); err != nil {
+		f.Close()
+		if !errors.Is(err, ErrLocked) {
+			return nil, fmt.Errorf("unable to lock %s: %w", path, err)
+		}
+		if pid, _ := os.ReadFile(path); len(bytes.TrimSpace(pid)) > 0 {
+			return nil, fmt.Errorf("%w (pid %s)", ErrLocked, bytes.TrimSpace(pid))
+		}
+		return nil, err
+	}
+
+	// the pid is only informational, the lock is what counts.
+	if err := f.Truncate(0); err == nil {
+		_, _ = f.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0)
+	}
+	return &Lock{f: f}, nil
+}
+
+// Release releases the lock.
+func (l *Lock) Release() error {
+	return l.f.Close()
+}
@@ -0,0 +1,8 @@
+//go:build !linux && !darwin && !dragonfly && !freebsd && !netbsd && !openbsd && !windows
+
+package lock
+
+import "os"
+
+// lockFile does nothing, as there's no flock(2).
+func lockFile(f *os.File) error { return nil }
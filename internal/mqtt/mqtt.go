@@ -0,0 +1,402 @@
+// Package mqtt implements the parts of an MQTT 3.1.1 client needed to publish
+// and subscribe at QoS 0.
+package mqtt
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// packet types
+const (
+	typeConnect     = 1
+	typeConnack     = 2
+	typePublish     = 3
+	typeSubscribe   = 8
+	typeSuback      = 9
+	typePingreq     = 12
+	typePingresp    = 13
+	typeDisconnect  = 14
+	protocolLevel   = 4 // MQTT 3.1.1
+	maxRemainingLen = 268435455
+)
+
+// Message is a message published to a topic.
+type Message struct {
+	Topic   string
+	Payload []byte
+	Retain  bool
+}
+
+// Options configure the connection to a broker.
+type Options struct {
+	ClientID string
+	Username string
+	// Password can only be sent along with Username.
+	Password string
+	// KeepAlive is the interval pings are sent in. Zero disables them.
+	KeepAlive time.Duration
+	// Will is published by the broker if the connection is lost.
+	Will *Message
+}
+
+// Client is a connection to an MQTT broker.
+type Client struct {
+	conn net.Conn
+	r    *bufio.Reader
+
+	// mu serializes writes.
+	mu sync.Mutex
+
+	nextID uint16
+}
+
+// Dial connects to the broker at addr, which is a URL like tcp://host:1883 or
+// tls://host:8883, or just host:port.
+func Dial(ctx context.Context, addr string, opts Options) (*Client, error) {
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+	network, hostport, useTLS, err := parseAddr(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, network, hostport)
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to %s: %w", addr, err)
+	}
+	if useTLS {
+		host, _, _ := net.SplitHostPort(hostport)
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: host})
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("unable to establish TLS connection: %w", err)
+		}
+		conn = tlsConn
+	}
+
+	c, err := newClient(ctx, conn, opts)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// ErrPasswordWithoutUsername is returned for Options with a password, but no
+// user name, which MQTT 3.1.1 doesn't allow.
+var ErrPasswordWithoutUsername = errors.New("a password can't be sent without a user name")
+
+// validate returns an error for options the broker would refuse.
+func (opts Options) validate() error {
+	if opts.Password != "" && opts.Username == "" {
+		return ErrPasswordWithoutUsername
+	}
+	return nil
+}
+
+// newClient connects to the broker over conn.
+func newClient(ctx context.Context, conn net.Conn, opts Options) (*Client, error) {
+	c := &Client{conn: conn, r: bufio.NewReader(conn)}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	if err := c.connect(opts); err != nil {
+		return nil, err
+	}
+	_ = conn.SetDeadline(time.Time{})
+	return c, nil
+}
+
+// parseAddr returns the network and address to dial, and whether to use TLS.
+func parseAddr(addr string) (network, hostport string, useTLS bool, err error) {
+	u, err := url.Parse(addr)
+	if err != nil || u.Host == "" {
+		// no scheme
+		return "tcp", withDefaultPort(addr, "1883"), false, nil
+	}
+	switch u.Scheme {
+	case "tcp", "mqtt":
+		return "tcp", withDefaultPort(u.Host, "1883"), false, nil
+	case "tls", "ssl", "mqtts":
+		return "tcp", withDefaultPort(u.Host, "8883"), true, nil
+	default:
+		return "", "", false, fmt.Errorf("unsupported scheme %s", u.Scheme)
+	}
+}
+
+// withDefaultPort appends port to host, unless it already contains one.
+func withDefaultPort(host, port string) string {
+	if _, _, err := net.SplitHostPort(host); err == nil {
+		return host
+	}
+	return net.JoinHostPort(host, port)
+}
+
+// connect sends CONNECT, and waits for CONNACK.
+func (c *Client) connect(opts Options) error {
+	var flags byte = 0x02 // clean session
+	var payload []byte
+	payload = appendString(payload, opts.ClientID)
+	if opts.Will != nil {
+		flags |= 0x04
+		if opts.Will.Retain {
+			flags |= 0x20
+		}
+		payload = appendString(payload, opts.Will.Topic)
+		payload = appendBytes(payload, opts.Will.Payload)
+	}
+	if opts.Username != "" {
+		flags |= 0x80
+		payload = appendString(payload, opts.Username)
+	}
+	if opts.Password != "" {
+		flags |= 0x40
+		payload = appendString(payload, opts.Password)
+	}
+
+	var body []byte
+	body = appendString(body, "MQTT")
+	body = append(body, protocolLevel, flags)
+	body = binary.BigEndian.AppendUint16(body, uint16(opts.KeepAlive/time.Second))
+	body = append(body, payload...)
+
+	if err := c.write(typeConnect<<4, body); err != nil {
+		return err
+	}
+
+	typ, _, resp, err := c.read()
+	if err != nil {
+		return fmt.Errorf("unable to read CONNACK: %w", err)
+	}
+	if typ != typeConnack || len(resp) != 2 {
+		return errors.New("invalid CONNACK")
+	}
+	if resp[1] != 0 {
+		return fmt.Errorf("connection refused: %s", connackError(resp[1]))
+	}
+	return nil
+}
+
+// connackError describes the return code of a CONNACK.
+func connackError(code byte) string {
+	switch code {
+	case 1:
+		return "unacceptable protocol version"
+	case 2:
+		return "client identifier rejected"
+	case 3:
+		return "server unavailable"
+	case 4:
+		return "bad user name or password"
+	case 5:
+		return "not authorized"
+	default:
+		return fmt.Sprintf("return code %d", code)
+	}
+}
+
+// Publish publishes msg at QoS 0.
+func (c *Client) Publish(msg Message) error {
+	var flags byte
+	if msg.Retain {
+		flags |= 0x01
+	}
+	body := appendString(nil, msg.Topic)
+	body = append(body, msg.Payload...)
+	return c.write(typePublish<<4|flags, body)
+}
+
+// Subscribe subscribes to topic at QoS 0. The SUBACK is handled by Run.
+func (c *Client) Subscribe(topic string) error {
+	c.mu.Lock()
+	c.nextID++
+	if c.nextID == 0 {
+		c.nextID = 1
+	}
+	id := c.nextID
+	c.mu.Unlock()
+
+	body := binary.BigEndian.AppendUint16(nil, id)
+	body = appendString(body, topic)
+	body = append(body, 0)
+	return c.write(typeSubscribe<<4|0x02, body)
+}
+
+// Run reads from the connection, calling handle for every message received
+// on a subscribed topic, and sends pings every keepAlive.
+// It returns once the connection fails, or ctx is done.
+func (c *Client) Run(ctx context.Context, keepAlive time.Duration, handle func(Message)) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// close the connection once we're done, also to unblock reads.
+	go func() {
+		<-ctx.Done()
+		c.conn.Close()
+	}()
+
+	if keepAlive > 0 {
+		go func() {
+			t := time.NewTicker(keepAlive)
+			defer t.Stop()
+			for {
+				select {
+				case <-t.C:
+					if err := c.write(typePingreq<<4, nil); err != nil {
+						cancel()
+						return
+					}
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	for {
+		// the broker answers our pings, so anything slower is a dead connection.
+		if keepAlive > 0 {
+			_ = c.conn.SetReadDeadline(time.Now().Add(keepAlive * 3 / 2))
+		}
+		typ, flags, body, err := c.read()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		switch typ {
+		case typePublish:
+			msg, err := parsePublish(flags, body)
+			if err != nil {
+				return err
+			}
+			handle(msg)
+		case typeSuback:
+			if len(body) == 3 && body[2] == 0x80 {
+				return errors.New("subscription refused")
+			}
+		case typePingresp:
+		default:
+			return fmt.Errorf("unexpected packet type %d", typ)
+		}
+	}
+}
+
+// parsePublish parses the body of a PUBLISH packet.
+func parsePublish(flags byte, body []byte) (Message, error) {
+	topic, rest, err := readString(body)
+	if err != nil {
+		return Message{}, err
+	}
+	// skip the packet id of QoS 1 and 2 messages, which we didn't ask for.
+	if (flags>>1)&0x03 != 0 {
+		if len(rest) < 2 {
+			return Message{}, errors.New("truncated PUBLISH")
+		}
+		rest = rest[2:]
+	}
+	return Message{Topic: topic, Payload: rest, Retain: flags&0x01 != 0}, nil
+}
+
+// Close disconnects from the broker, without it publishing the will.
+func (c *Client) Close() error {
+	_ = c.write(typeDisconnect<<4, nil)
+	return c.conn.Close()
+}
+
+// write sends a packet with the given first header byte.
+func (c *Client) write(header byte, body []byte) error {
+	if len(body) > maxRemainingLen {
+		return errors.New("packet too large")
+	}
+
+	packet := []byte{header}
+	// the remaining length is encoded in 7 bits per byte, least significant first.
+	n := len(body)
+	for {
+		b := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			b |= 0x80
+		}
+		packet = append(packet, b)
+		if n == 0 {
+			break
+		}
+	}
+	packet = append(packet, body...)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, err := c.conn.Write(packet); err != nil {
+		return fmt.Errorf("unable to write to broker: %w", err)
+	}
+	return nil
+}
+
+// read reads a packet, and returns its type, flags and body.
+func (c *Client) read() (byte, byte, []byte, error) {
+	header, err := c.r.ReadByte()
+	if err != nil {
+		return 0, 0, nil, err
+	}
+
+	n, shift := 0, 0
+	for {
+		b, err := c.r.ReadByte()
+		if err != nil {
+			return 0, 0, nil, err
+		}
+		n |= int(b&0x7f) << shift
+		if b&0x80 == 0 {
+			break
+		}
+		shift += 7
+		if shift > 21 {
+			return 0, 0, nil, errors.New("invalid remaining length")
+		}
+	}
+
+	body := make([]byte, n)
+	if _, err := io.ReadFull(c.r, body); err != nil {
+		return 0, 0, nil, err
+	}
+	return header >> 4, header & 0x0f, body, nil
+}
+
+// appendString appends s, prefixed with its length.
+func appendString(b []byte, s string) []byte {
+	return appendBytes(b, []byte(s))
+}
+
+// appendBytes appends data, prefixed with its length.
+func appendBytes(b []byte, data []byte) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(data)))
+	return append(b, data...)
+}
+
+// readString reads a length-prefixed string from b, and returns the rest.
+func readString(b []byte) (string, []byte, error) {
+	if len(b) < 2 {
+		return "", nil, errors.New("truncated string")
+	}
+	n := int(binary.BigEndian.Uint16(b))
+	if len(b) < 2+n {
+		return "", nil, errors.New("truncated string")
+	}
+	return string(b[2 : 2+n]), b[2+n:], nil
+}
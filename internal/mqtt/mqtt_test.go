@@ -0,0 +1,199 @@
+package mqtt
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// pipe returns a client and a fake broker connected to each other. The
+// broker speaks the same framing, so it's a Client as well.
+func pipe(t *testing.T) (client, broker *Client) {
+	c, b := net.Pipe()
+	t.Cleanup(func() {
+		c.Close()
+		b.Close()
+	})
+	return &Client{conn: c, r: bufio.NewReader(c)}, &Client{conn: b, r: bufio.NewReader(b)}
+}
+
+// expect returns the body of the next packet the broker receives, and false,
+// failing the test, unless it's of type typ. It's called by the fake broker,
+// which can't stop the test.
+func expect(t *testing.T, broker *Client, typ byte) ([]byte, bool) {
+	t.Helper()
+	gotType, _, body, err := broker.read()
+	if err != nil {
+		t.Error(err)
+		return nil, false
+	}
+	if gotType != typ {
+		t.Errorf("got packet type %d, want %d", gotType, typ)
+		return nil, false
+	}
+	return body, true
+}
+
+func TestRemainingLength(t *testing.T) {
+	for _, tt := range []struct {
+		n      int
+		header []byte
+	}{
+		{0, []byte{0x00}},
+		{127, []byte{0x7f}},
+		{128, []byte{0x80, 0x01}},
+		{16383, []byte{0xff, 0x7f}},
+		{16384, []byte{0x80, 0x80, 0x01}},
+	} {
+		client, broker := pipe(t)
+		body := bytes.Repeat([]byte{'x'}, tt.n)
+		go client.write(typePublish<<4, body)
+
+		// the encoding on the wire.
+		raw := make([]byte, 1+len(tt.header))
+		if _, err := io.ReadFull(broker.r, raw); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(raw[1:], tt.header) {
+			t.Errorf("length %d encoded as % x, want % x", tt.n, raw[1:], tt.header)
+			continue
+		}
+
+		// and decoding it again.
+		go func() {
+			broker.conn.Write(raw)
+			broker.conn.Write(body)
+		}()
+		typ, _, got, err := client.read()
+		if err != nil || typ != typePublish || len(got) != tt.n {
+			t.Errorf("length %d read as type %d, length %d, %v", tt.n, typ, len(got), err)
+		}
+	}
+}
+
+func TestInvalidRemainingLength(t *testing.T) {
+	client, broker := pipe(t)
+	go broker.conn.Write([]byte{typePublish << 4, 0xff, 0xff, 0xff, 0xff, 0x01})
+	if _, _, _, err := client.read(); err == nil {
+		t.Error("remaining length of 5 bytes accepted")
+	}
+}
+
+func TestConnect(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		code byte
+		err  string
+	}{
+		{"accepted", 0, ""},
+		{"bad credentials", 4, "bad user name or password"},
+		{"not authorized", 5, "not authorized"},
+		{"unknown code", 42, "return code 42"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			client, broker := pipe(t)
+			go func() {
+				body, ok := expect(t, broker, typeConnect)
+				if !ok {
+					return
+				}
+				// protocol name and level, flags and keep alive.
+				if want := []byte{0, 4, 'M', 'Q', 'T', 'T', protocolLevel, 0x80 | 0x40 | 0x02, 0, 30}; !bytes.HasPrefix(body, want) {
+					t.Errorf("got CONNECT % x, want it to start with % x", body, want)
+				}
+				broker.write(typeConnack<<4, []byte{0, tt.code})
+			}()
+
+			_, err := newClient(context.Background(), client.conn, Options{
+				ClientID:  "test",
+				Username:  "user",
+				Password:  "secret",
+				KeepAlive: 30 * time.Second,
+			})
+			switch {
+			case tt.err == "" && err != nil:
+				t.Errorf("got %v, want no error", err)
+			case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+				t.Errorf("got %v, want %s", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestPasswordWithoutUsername(t *testing.T) {
+	// it's refused before connecting anywhere.
+	_, err := Dial(context.Background(), "tcp://invalid.invalid", Options{Password: "secret"})
+	if !errors.Is(err, ErrPasswordWithoutUsername) {
+		t.Errorf("got %v, want %v", err, ErrPasswordWithoutUsername)
+	}
+}
+
+func TestParsePublish(t *testing.T) {
+	topic := appendString(nil, "a/b")
+	for _, tt := range []struct {
+		name  string
+		flags byte
+		body  []byte
+		want  Message
+		err   bool
+	}{
+		{name: "QoS 0", body: append(topic, "dark"...), want: Message{Topic: "a/b", Payload: []byte("dark")}},
+		{name: "retained", flags: 0x01, body: append(topic, "dark"...), want: Message{Topic: "a/b", Payload: []byte("dark"), Retain: true}},
+		{name: "QoS 1", flags: 0x02, body: append(append(topic, 0, 7), "dark"...), want: Message{Topic: "a/b", Payload: []byte("dark")}},
+		{name: "QoS 2", flags: 0x04, body: append(append(topic, 0, 7), "light"...), want: Message{Topic: "a/b", Payload: []byte("light")}},
+		{name: "QoS 1 without packet id", flags: 0x02, body: append(topic, 0), err: true},
+		{name: "truncated topic", body: []byte{0, 10, 'a'}, err: true},
+	} {
+		msg, err := parsePublish(tt.flags, tt.body)
+		if tt.err {
+			if err == nil {
+				t.Errorf("%s: got %+v, want an error", tt.name, msg)
+			}
+			continue
+		}
+		if err != nil || msg.Topic != tt.want.Topic || !bytes.Equal(msg.Payload, tt.want.Payload) || msg.Retain != tt.want.Retain {
+			t.Errorf("%s: got %+v, %v, want %+v", tt.name, msg, err, tt.want)
+		}
+	}
+}
+
+func TestRun(t *testing.T) {
+	client, broker := pipe(t)
+	go func() {
+		body, ok := expect(t, broker, typeSubscribe)
+		if !ok || len(body) < 2 {
+			return
+		}
+		id := body[:2]
+		// a message the broker sends at QoS 1 anyway, then the refusal.
+		broker.write(typePublish<<4|0x02, append(append(appendString(nil, "theme-switcher/set"), 0, 1), "toggle"...))
+		broker.write(typeSuback<<4, append(id, 0x80))
+	}()
+
+	var got []Message
+	errs := make(chan error, 1)
+	go func() {
+		errs <- client.Run(context.Background(), 0, func(msg Message) { got = append(got, msg) })
+	}()
+	if err := client.Subscribe("theme-switcher/set"); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case err := <-errs:
+		if err == nil || !strings.Contains(err.Error(), "subscription refused") {
+			t.Errorf("got %v, want the subscription refused", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Run didn't return")
+	}
+	if len(got) != 1 || got[0].Topic != "theme-switcher/set" || string(got[0].Payload) != "toggle" {
+		t.Errorf("got %+v, want the toggle message", got)
+	}
+}
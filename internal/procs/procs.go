@@ -0,0 +1,3 @@
+// Package procs signals processes belonging to the current graphical session,
+// so switching themes doesn't affect other users or sessions on the same machine.
+package procs
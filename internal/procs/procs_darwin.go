@@ -0,0 +1,82 @@
+package procs
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"syscall"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+)
+
+// find returns the pids of all processes named name, owned by the current
+// user. Without /proc, sessions can't be told apart.
+func find(name string) ([]int, error) {
+	procs, err := unix.SysctlKinfoProcSlice("kern.proc.uid", os.Geteuid())
+	if err != nil {
+		return nil, fmt.Errorf("unable to list processes: %w", err)
+	}
+
+	self := os.Getpid()
+	var pids []int
+	for _, p := range procs {
+		pid := int(p.Proc.P_pid)
+		// p_comm is truncated to MAXCOMLEN, so name is too.
+		if pid == self || unix.ByteSliceToString(p.Proc.P_comm[:]) != truncate(name) {
+			continue
+		}
+		pids = append(pids, pid)
+	}
+	return pids, nil
+}
+
+// truncate truncates name to MAXCOMLEN, like the kernel does for p_comm.
+func truncate(name string) string {
+	const maxComLen = 16
+	if len(name) > maxComLen {
+		return name[:maxComLen]
+	}
+	return name
+}
+
+// Reload sends SIGUSR1 to all processes named name owned by the current user.
+func Reload(ctx context.Context, name string) error {
+	pids, err := find(name)
+	if err != nil {
+		return err
+	}
+
+	n := 0
+	for _, pid := range pids {
+		if err := syscall.Kill(pid, syscall.SIGUSR1); err != nil {
+			log.WithError(err).WithField("pid", pid).Debugf("unable to signal %s", name)
+			continue
+		}
+		n++
+	}
+	log.Debugf("signalled %d %s processes", n, name)
+	return nil
+}
+
+// ReloadPID sends SIGUSR1 to the process pid, if it's named name and owned by
+// the current user.
+func ReloadPID(ctx context.Context, name string, pid int) error {
+	pids, err := find(name)
+	if err != nil {
+		return err
+	}
+	for _, p := range pids {
+		if p == pid {
+			return syscall.Kill(pid, syscall.SIGUSR1)
+		}
+	}
+	return fmt.Errorf("no %s with pid %d", name, pid)
+}
+
+// Running returns whether a process named name, owned by the current user,
+// runs.
+func Running(name string) (bool, error) {
+	pids, err := find(name)
+	return len(pids) > 0, err
+}
@@ -0,0 +1,167 @@
+package procs
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// session identifies the graphical session we're running in.
+type session struct {
+	// env contains the values of DISPLAY and WAYLAND_DISPLAY that are set.
+	env map[string]string
+	// scope is the session-N.scope systemd-logind placed us in, if any.
+	scope string
+}
+
+// currentSession returns the session of the current process.
+func currentSession() session {
+	s := session{env: make(map[string]string)}
+	for _, k := range []string{"DISPLAY", "WAYLAND_DISPLAY"} {
+		if v := os.Getenv(k); v != "" {
+			s.env[k] = v
+		}
+	}
+	s.scope = sessionScope("self")
+	return s
+}
+
+// sessionScope returns the name of the session scope in the cgroup of the process pid.
+func sessionScope(pid string) string {
+	cgroup, err := os.ReadFile(filepath.Join("/proc", pid, "cgroup"))
+	if err != nil {
+		return ""
+	}
+	for _, line := range strings.Split(string(cgroup), "\n") {
+		for _, elem := range strings.Split(line, "/") {
+			if strings.HasPrefix(elem, "session-") && strings.HasSuffix(elem, ".scope") {
+				return elem
+			}
+		}
+	}
+	return ""
+}
+
+// environ returns the initial environment of the process pid.
+func environ(pid string) map[string]string {
+	env := make(map[string]string)
+	data, err := os.ReadFile(filepath.Join("/proc", pid, "environ"))
+	if err != nil {
+		return env
+	}
+	for _, kv := range bytes.Split(data, []byte{0}) {
+		if k, v, ok := strings.Cut(string(kv), "="); ok {
+			env[k] = v
+		}
+	}
+	return env
+}
+
+// contains returns whether the process pid belongs to the session.
+// Processes connected to one of our displays match, otherwise processes in
+// the same logind session. Without either, all processes of the user match.
+func (s session) contains(pid string) bool {
+	if len(s.env) > 0 {
+		env := environ(pid)
+		for k, v := range s.env {
+			if env[k] == v {
+				return true
+			}
+		}
+		return false
+	}
+	if s.scope != "" {
+		return sessionScope(pid) == s.scope
+	}
+	return true
+}
+
+// find returns the pids of all processes named name, owned by the current
+// user, and belonging to the current graphical session if inSession is set.
+func find(name string, inSession bool) ([]int, error) {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil, fmt.Errorf("unable to list processes: %w", err)
+	}
+
+	s := currentSession()
+	uid := uint32(os.Getuid())
+	self := os.Getpid()
+
+	var pids []int
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil || pid == self {
+			continue
+		}
+
+		// processes might exit while we look at them, so ignore all errors.
+		fi, err := os.Stat(filepath.Join("/proc", entry.Name()))
+		if err != nil {
+			continue
+		}
+		if st, ok := fi.Sys().(*syscall.Stat_t); !ok || st.Uid != uid {
+			continue
+		}
+		comm, err := os.ReadFile(filepath.Join("/proc", entry.Name(), "comm"))
+		if err != nil || strings.TrimSpace(string(comm)) != name {
+			continue
+		}
+		if inSession && !s.contains(entry.Name()) {
+			log.WithField("pid", pid).Debugf("skipping %s of another session", name)
+			continue
+		}
+		pids = append(pids, pid)
+	}
+	return pids, nil
+}
+
+// Reload sends SIGUSR1 to all processes named name, owned by the current user
+// and belonging to the current graphical session.
+func Reload(ctx context.Context, name string) error {
+	pids, err := find(name, true)
+	if err != nil {
+		return err
+	}
+
+	n := 0
+	for _, pid := range pids {
+		if err := syscall.Kill(pid, syscall.SIGUSR1); err != nil {
+			log.WithError(err).WithField("pid", pid).Debugf("unable to signal %s", name)
+			continue
+		}
+		n++
+	}
+	log.Debugf("signalled %d %s processes", n, name)
+	return nil
+}
+
+// ReloadPID sends SIGUSR1 to the process pid, if it's named name, owned by the
+// current user and belongs to the current graphical session.
+func ReloadPID(ctx context.Context, name string, pid int) error {
+	pids, err := find(name, true)
+	if err != nil {
+		return err
+	}
+	for _, p := range pids {
+		if p == pid {
+			return syscall.Kill(pid, syscall.SIGUSR1)
+		}
+	}
+	return fmt.Errorf("no %s with pid %d in this session", name, pid)
+}
+
+// Running returns whether a process named name, owned by the current user,
+// runs. Processes of other sessions count, as compositors don't have the
+// variables of the session they start in their environment.
+func Running(name string) (bool, error) {
+	pids, err := find(name, false)
+	return len(pids) > 0, err
+}
@@ -0,0 +1,63 @@
+//go:build !linux && !darwin
+
+package procs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// Reload sends SIGUSR1 to all processes named name owned by the current user.
+// Without /proc, sessions can't be told apart. pkill is killed once ctx is
+// done.
+func Reload(ctx context.Context, name string) error {
+	cmd := exec.CommandContext(ctx, "pkill", "-USR1", "-U", strconv.Itoa(os.Getuid()), "-x", name)
+	if err := cmd.Run(); err != nil {
+		// pkill exits with 1 if no processes matched.
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+			return nil
+		}
+		return fmt.Errorf("unable to run pkill: %w", err)
+	}
+	return nil
+}
+
+// ReloadPID sends SIGUSR1 to the process pid, if it's named name and owned by
+// the current user.
+func ReloadPID(ctx context.Context, name string, pid int) error {
+	out, err := exec.CommandContext(ctx, "pgrep", "-U", strconv.Itoa(os.Getuid()), "-x", name).Output()
+	var exitErr *exec.ExitError
+	if err != nil && !(errors.As(err, &exitErr) && exitErr.ExitCode() == 1) {
+		return fmt.Errorf("unable to run pgrep: %w", err)
+	}
+	for _, field := range strings.Fields(string(out)) {
+		if field == strconv.Itoa(pid) {
+			if err := exec.CommandContext(ctx, "kill", "-USR1", field).Run(); err != nil {
+				return fmt.Errorf("unable to signal %s: %w", name, err)
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("no %s with pid %d", name, pid)
+}
+
+// Running returns whether a process named name, owned by the current user,
+// runs.
+func Running(name string) (bool, error) {
+	cmd := exec.Command("pgrep", "-U", strconv.Itoa(os.Getuid()), "-x", name)
+	if err := cmd.Run(); err != nil {
+		// pgrep exits with 1 if no processes matched.
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+			return false, nil
+		}
+		return false, fmt.Errorf("unable to run pgrep: %w", err)
+	}
+	return true, nil
+}
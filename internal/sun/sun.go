@@ -0,0 +1,71 @@
+// Package sun calculates sunrise and sunset times, using the equations of
+// the NOAA solar calculator. They're accurate to about a minute, which is
+// plenty for switching themes.
+package sun
+
+import (
+	"math"
+	"time"
+)
+
+// zenith is the zenith angle of the sun at sunrise and sunset, accounting
+// for atmospheric refraction and the size of the solar disk.
+const zenith = 90.833
+
+// Times returns the sunrise and sunset on the day of t, in t's location, at
+// the given latitude and longitude in degrees.
+// During polar day or night the sun doesn't rise or set, and ok is false.
+func Times(t time.Time, latitude, longitude float64) (sunrise, sunset time.Time, ok bool) {
+	sunrise, sunset, polar := times(t, latitude, longitude)
+	return sunrise, sunset, polar == 0
+}
+
+// IsUp returns true if the sun is up at t, at the given latitude and
+// longitude in degrees.
+func IsUp(t time.Time, latitude, longitude float64) bool {
+	sunrise, sunset, polar := times(t, latitude, longitude)
+	if polar != 0 {
+		return polar > 0
+	}
+	return !t.Before(sunrise) && t.Before(sunset)
+}
+
+// times returns the sunrise and sunset on the day of t. polar is 1 during
+// polar day, -1 during polar night, in which case they're not set, and 0
+// otherwise.
+func times(t time.Time, latitude, longitude float64) (sunrise, sunset time.Time, polar int) {
+	year, month, day := t.Date()
+	midnight := time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+
+	// the fractional year, in radians, at noon.
+	g := 2 * math.Pi / 365 * float64(t.YearDay()-1)
+
+	// equation of time, in minutes, and solar declination, in radians.
+	eqTime := 229.18 * (0.000075 + 0.001868*math.Cos(g) - 0.032077*math.Sin(g) -
+		0.014615*math.Cos(2*g) - 0.040849*math.Sin(2*g))
+	decl := 0.006918 - 0.399912*math.Cos(g) + 0.070257*math.Sin(g) -
+		0.006758*math.Cos(2*g) + 0.000907*math.Sin(2*g) -
+		0.002697*math.Cos(3*g) + 0.00148*math.Sin(3*g)
+
+	lat := latitude * math.Pi / 180
+	cosHA := math.Cos(zenith*math.Pi/180)/(math.Cos(lat)*math.Cos(decl)) - math.Tan(lat)*math.Tan(decl)
+	switch {
+	case cosHA < -1:
+		return time.Time{}, time.Time{}, 1
+	case cosHA > 1:
+		return time.Time{}, time.Time{}, -1
+	}
+	ha := math.Acos(cosHA) * 180 / math.Pi
+
+	// in minutes after midnight UTC, 4 minutes per degree.
+	rise := 720 - 4*(longitude+ha) - eqTime
+	set := 720 - 4*(longitude-ha) - eqTime
+
+	loc := t.Location()
+	return midnight.Add(minutes(rise)).In(loc), midnight.Add(minutes(set)).In(loc), 0
+}
+
+// minutes converts m minutes to a duration.
+func minutes(m float64) time.Duration {
+	return time.Duration(m * float64(time.Minute))
+}
@@ -0,0 +1,76 @@
+package sun
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTimes(t *testing.T) {
+	berlin := time.FixedZone("CEST", 2*60*60)
+	newYork := time.FixedZone("EST", -5*60*60)
+	for _, tt := range []struct {
+		name                string
+		date                time.Time
+		latitude, longitude float64
+		sunrise, sunset     time.Time
+	}{
+		{
+			name:     "Berlin, summer solstice",
+			date:     time.Date(2024, time.June, 21, 12, 0, 0, 0, berlin),
+			latitude: 52.52, longitude: 13.405,
+			sunrise: time.Date(2024, time.June, 21, 4, 43, 0, 0, berlin),
+			sunset:  time.Date(2024, time.June, 21, 21, 33, 0, 0, berlin),
+		},
+		{
+			name:     "New York, winter solstice",
+			date:     time.Date(2024, time.December, 21, 0, 0, 0, 0, newYork),
+			latitude: 40.7128, longitude: -74.006,
+			sunrise: time.Date(2024, time.December, 21, 7, 16, 0, 0, newYork),
+			sunset:  time.Date(2024, time.December, 21, 16, 32, 0, 0, newYork),
+		},
+	} {
+		sunrise, sunset, ok := Times(tt.date, tt.latitude, tt.longitude)
+		if !ok {
+			t.Errorf("%s: no sunrise", tt.name)
+			continue
+		}
+		if d := sunrise.Sub(tt.sunrise); d < -2*time.Minute || d > 2*time.Minute {
+			t.Errorf("%s: sunrise at %v, want %v", tt.name, sunrise, tt.sunrise)
+		}
+		if d := sunset.Sub(tt.sunset); d < -2*time.Minute || d > 2*time.Minute {
+			t.Errorf("%s: sunset at %v, want %v", tt.name, sunset, tt.sunset)
+		}
+		if sunrise.Location() != tt.date.Location() {
+			t.Errorf("%s: sunrise in %v, want %v", tt.name, sunrise.Location(), tt.date.Location())
+		}
+
+		if IsUp(tt.sunrise.Add(-5*time.Minute), tt.latitude, tt.longitude) {
+			t.Errorf("%s: sun up before sunrise", tt.name)
+		}
+		if !IsUp(tt.sunrise.Add(5*time.Minute), tt.latitude, tt.longitude) {
+			t.Errorf("%s: sun not up after sunrise", tt.name)
+		}
+		if IsUp(tt.sunset.Add(5*time.Minute), tt.latitude, tt.longitude) {
+			t.Errorf("%s: sun up after sunset", tt.name)
+		}
+	}
+}
+
+func TestPolar(t *testing.T) {
+	const latitude, longitude = 69.65, 18.96 // Tromsø
+	summer := time.Date(2024, time.June, 21, 0, 0, 0, 0, time.UTC)
+	winter := time.Date(2024, time.December, 21, 12, 0, 0, 0, time.UTC)
+
+	if _, _, ok := Times(summer, latitude, longitude); ok {
+		t.Error("sunrise during polar day")
+	}
+	if !IsUp(summer, latitude, longitude) {
+		t.Error("sun not up during polar day")
+	}
+	if _, _, ok := Times(winter, latitude, longitude); ok {
+		t.Error("sunrise during polar night")
+	}
+	if IsUp(winter, latitude, longitude) {
+		t.Error("sun up during polar night")
+	}
+}
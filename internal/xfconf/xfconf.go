@@ -0,0 +1,149 @@
+// Package xfconf reads, writes and watches properties of Xfce's
+// configuration store, via the xfconfd service on the session bus, without
+// depending on xfconf-query.
+package xfconf
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/godbus/dbus/v5"
+)
+
+const (
+	serviceName      = "org.xfce.Xfconf"
+	servicePath      = dbus.ObjectPath("/org/xfce/Xfconf")
+	serviceInterface = "org.xfce.Xfconf"
+
+	errPropertyNotFound = "org.xfce.Xfconf.Error.PropertyNotFound"
+)
+
+const (
+	// XSettingsChannel and ThemeNameProperty are where Xfce stores the GTK theme.
+	XSettingsChannel  = "xsettings"
+	ThemeNameProperty = "/Net/ThemeName"
+)
+
+// Available returns nil if xfconfd is running, or can be started via D-Bus
+// activation.
+func Available(ctx context.Context) error {
+	conn, err := dbus.ConnectSessionBus(dbus.WithContext(ctx))
+	if err != nil {
+		return fmt.Errorf("unable to connect to session bus: %w", err)
+	}
+	defer conn.Close()
+
+	var running bool
+	if err := conn.BusObject().CallWithContext(ctx, "org.freedesktop.DBus.NameHasOwner", 0, serviceName).Store(&running); err != nil {
+		return err
+	}
+	if running {
+		return nil
+	}
+
+	var activatable []string
+	if err := conn.BusObject().CallWithContext(ctx, "org.freedesktop.DBus.ListActivatableNames", 0).Store(&activatable); err != nil {
+		return err
+	}
+	for _, name := range activatable {
+		if name == serviceName {
+			return nil
+		}
+	}
+	return errors.New("xfconfd not available")
+}
+
+// GetString reads the string property (like /Net/ThemeName) of channel (like xsettings).
+// ok is false if the property is not set.
+func GetString(ctx context.Context, channel, property string) (value string, ok bool, err error) {
+	conn, err := dbus.ConnectSessionBus(dbus.WithContext(ctx))
+	if err != nil {
+		return "", false, fmt.Errorf("unable to connect to session bus: %w", err)
+	}
+	defer conn.Close()
+
+	var v dbus.Variant
+	if err := conn.Object(serviceName, servicePath).CallWithContext(ctx, serviceInterface+".GetProperty", 0, channel, property).Store(&v); err != nil {
+		var dbusErr dbus.Error
+		if errors.As(err, &dbusErr) && dbusErr.Name == errPropertyNotFound {
+			return "", false, nil
+		}
+		return "", false, fmt.Errorf("unable to read %s %s: %w", channel, property, err)
+	}
+	if err := v.Store(&value); err != nil {
+		return "", false, fmt.Errorf("unable to read %s %s: %w", channel, property, err)
+	}
+	return value, true, nil
+}
+
+// SetString sets the property of channel to a string value.
+func SetString(ctx context.Context, channel, property, value string) error {
+	conn, err := dbus.ConnectSessionBus(dbus.WithContext(ctx))
+	if err != nil {
+		return fmt.Errorf("unable to connect to session bus: %w", err)
+	}
+	defer conn.Close()
+
+	if err := conn.Object(serviceName, servicePath).CallWithContext(ctx, serviceInterface+".SetProperty", 0, channel, property, dbus.MakeVariant(value)).Err; err != nil {
+		return fmt.Errorf("unable to write %s %s: %w", channel, property, err)
+	}
+	return nil
+}
+
+// Watch subscribes to changes of the properties of channel, and sends the
+// name of every changed or removed property to the returned channel.
+// The channel is closed once ctx is done, or the bus connection is lost.
+func Watch(ctx context.Context, channel string) (<-chan string, error) {
+	conn, err := dbus.ConnectSessionBus(dbus.WithContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to session bus: %w", err)
+	}
+
+	for _, member := range []string{"PropertyChanged", "PropertyRemoved"} {
+		if err := conn.AddMatchSignalContext(ctx,
+			dbus.WithMatchObjectPath(servicePath),
+			dbus.WithMatchInterface(serviceInterface),
+			dbus.WithMatchMember(member),
+			dbus.WithMatchArg(0, channel),
+		); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("unable to subscribe to xfconf changes: %w", err)
+		}
+	}
+
+	signals := make(chan *dbus.Signal, 16)
+	conn.Signal(signals)
+
+	changes := make(chan string)
+
+	go func() {
+		defer close(changes)
+		defer conn.Close()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case sig, ok := <-signals:
+				if !ok {
+					return
+				}
+				if sig.Name != serviceInterface+".PropertyChanged" && sig.Name != serviceInterface+".PropertyRemoved" {
+					continue
+				}
+				var sigChannel, property string
+				if len(sig.Body) < 2 || dbus.Store(sig.Body[:2], &sigChannel, &property) != nil || sigChannel != channel {
+					continue
+				}
+				select {
+				case changes <- property:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return changes, nil
+}
@@ -0,0 +1,215 @@
+package backends
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/flokli/theme-switcher/pkg/switcher"
+	log "github.com/sirupsen/logrus"
+)
+
+// backupIndex is the file in the backup dir mapping the paths of the files
+// backed up to the names of their copies, or to "" if they didn't exist.
+const backupIndex = "index.json"
+
+// Backups saves a copy of each file backends modify to Dir before they
+// modify it for the first time, so Restore can roll them back to how they
+// were before theme-switcher touched them.
+type Backups struct {
+	Dir string
+
+	// mu serializes access to the index, as backends are applied
+	// concurrently.
+	mu sync.Mutex
+}
+
+// DefaultBackupDir returns the default backup dir,
+// $XDG_STATE_HOME/theme-switcher/backups.
+func DefaultBackupDir() (string, error) {
+	statePath, err := switcher.DefaultStatePath()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(statePath), "backups"), nil
+}
+
+func (b *Backups) readIndex() (map[string]string, error) {
+	index := make(map[string]string)
+	data, err := os.ReadFile(filepath.Join(b.Dir, backupIndex))
+	if errors.Is(err, os.ErrNotExist) {
+		return index, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("unable to read backup index: %w", err)
+	}
+	if err := json.Unmarshal(data, &index); err != nil {
+		return nil, fmt.Errorf("unable to parse backup index: %w", err)
+	}
+	return index, nil
+}
+
+func (b *Backups) writeIndex(index map[string]string) error {
+	data, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeAtomic(filepath.Join(b.Dir, backupIndex), append(data, '\n'), 0o644)
+}
+
+// save saves a copy of the file at path, if there's none yet.
+// It does nothing if b is nil, or in dry-run mode.
+func (b *Backups) save(ctx context.Context, path string) error {
+	if b == nil || switcher.IsDryRun(ctx) {
+		return nil
+	}
+	// symlinks are followed when writing, so back up what they point to.
+	if target, err := filepath.EvalSymlinks(path); err == nil {
+		path = target
+	}
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	index, err := b.readIndex()
+	if err != nil {
+		return err
+	}
+	if _, ok := index[path]; ok {
+		return nil
+	}
+
+	if err := os.MkdirAll(b.Dir, 0o700); err != nil {
+		return fmt.Errorf("unable to create backup dir: %w", err)
+	}
+	var name string
+	if data, err := os.ReadFile(path); err == nil {
+		if name, err = b.copy(path, data); err != nil {
+			return fmt.Errorf("unable to back up %s: %w", path, err)
+		}
+		log.WithField("path", path).Debugf("backed up to %s", name)
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("unable to back up %s: %w", path, err)
+	}
+	index[path] = name
+	return b.writeIndex(index)
+}
+
+// copy writes data, the contents of the file at path, to a new file in Dir,
+// with the same permissions, and returns its name.
+func (b *Backups) copy(path string, data []byte) (string, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	f, err := os.CreateTemp(b.Dir, filepath.Base(path)+".*")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	if _, err := f.Write(data); err != nil {
+		return "", err
+	}
+	if err := f.Chmod(fi.Mode().Perm()); err != nil {
+		return "", err
+	}
+	return filepath.Base(f.Name()), f.Close()
+}
+
+// Restore writes the files backed up back, and removes the ones that didn't
+// exist before. The backups are removed afterwards, so the next modification
+// is backed up again. In dry-run mode, it prints the differences instead.
+func (b *Backups) Restore(ctx context.Context) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	index, err := b.readIndex()
+	if err != nil {
+		return err
+	}
+	if len(index) == 0 {
+		log.Info("nothing to restore")
+		return nil
+	}
+
+	paths := make([]string, 0, len(index))
+	for path := range index {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	failed := 0
+	for _, path := range paths {
+		name := index[path]
+		if err := restore(ctx, path, b.Dir, name); err != nil {
+			log.WithError(err).WithField("path", path).Warn("unable to restore file")
+			failed++
+			continue
+		}
+		if switcher.IsDryRun(ctx) {
+			continue
+		}
+		delete(index, path)
+		if name != "" {
+			_ = os.Remove(filepath.Join(b.Dir, name))
+		}
+	}
+	if !switcher.IsDryRun(ctx) {
+		// the ones that failed are kept, to try again.
+		if len(index) == 0 {
+			err = os.RemoveAll(b.Dir)
+		} else {
+			err = b.writeIndex(index)
+		}
+		if err != nil {
+			return fmt.Errorf("unable to update backups: %w", err)
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("unable to restore %d file(s)", failed)
+	}
+	return nil
+}
+
+// restore restores the file at path from the backup name in dir, or removes
+// it if name is empty.
+func restore(ctx context.Context, path, dir, name string) error {
+	current, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("unable to read %s: %w", path, err)
+	}
+	if name == "" {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		if switcher.IsDryRun(ctx) {
+			log.Infof("would remove %s", path)
+			return nil
+		}
+		log.WithField("path", path).Info("removing file, which didn't exist before")
+		return os.Remove(path)
+	}
+
+	backup := filepath.Join(dir, name)
+	fi, err := os.Stat(backup)
+	if err != nil {
+		return fmt.Errorf("unable to restore %s: %w", path, err)
+	}
+	data, err := os.ReadFile(backup)
+	if err != nil {
+		return fmt.Errorf("unable to restore %s: %w", path, err)
+	}
+	if string(current) == string(data) {
+		return nil
+	}
+	if !switcher.IsDryRun(ctx) {
+		log.WithField("path", path).Info("restoring file")
+	}
+	return writeFile(ctx, nil, nil, path, current, data, fi.Mode().Perm())
+}
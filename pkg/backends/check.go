@@ -0,0 +1,53 @@
+package backends
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/flokli/theme-switcher/pkg/switcher"
+)
+
+// Checker is implemented by backends able to check their configuration
+// beyond Detect, like whether their themes exist, without applying anything.
+type Checker interface {
+	// Check returns all problems found.
+	Check(ctx context.Context) []error
+}
+
+// allThemes returns the distinct themes of all modes, sorted.
+func allThemes(themes ...switcher.Themes) []string {
+	seen := map[string]bool{}
+	var all []string
+	for _, t := range themes {
+		for _, theme := range t {
+			if !seen[theme] {
+				seen[theme] = true
+				all = append(all, theme)
+			}
+		}
+	}
+	sort.Strings(all)
+	return all
+}
+
+// checkWritable returns an error if path can't be written, or created if it
+// doesn't exist yet.
+func checkWritable(path string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err == nil {
+		return f.Close()
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("%s is not writable: %w", path, err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".theme-switcher-check-*")
+	if err != nil {
+		return fmt.Errorf("%s can't be created: %w", path, err)
+	}
+	tmp.Close()
+	return os.Remove(tmp.Name())
+}
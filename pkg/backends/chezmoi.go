@@ -0,0 +1,97 @@
+package backends
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Chezmoi writes files managed by chezmoi (https://chezmoi.io) into its
+// source state, and applies them from there, instead of modifying them in
+// place, so managed dotfiles don't show a diff after every switch.
+// Files it doesn't manage, or can't be written into the source state, like
+// templates and encrypted files, are written in place.
+type Chezmoi struct {
+	// Args are passed to chezmoi before every command, like --source.
+	Args []string
+
+	// mu serializes chezmoi invocations, as they lock its persistent state.
+	mu sync.Mutex
+}
+
+// chezmoiPrefixes are the prefixes of source files that can't be written
+// with the contents of their target, as they're transformed, or aren't
+// regular files.
+var chezmoiPrefixes = []string{"create_", "modify_", "remove_", "symlink_", "run_", "encrypted_"}
+
+func (c *Chezmoi) command(ctx context.Context, args ...string) (*execCmd, context.CancelFunc) {
+	return command(ctx, "chezmoi", append(append([]string{}, c.Args...), args...)...)
+}
+
+// sourcePath returns the path of the source file of target, if chezmoi
+// manages it, and its contents can be written to it as-is.
+func (c *Chezmoi) sourcePath(ctx context.Context, target string) (string, bool) {
+	cmd, cancel := c.command(ctx, "source-path", target)
+	defer cancel()
+	out, err := cmd.Output()
+	if err != nil {
+		log.WithError(err).WithField("path", target).Debug("not managed by chezmoi, writing it in place")
+		return "", false
+	}
+	source := strings.TrimSpace(string(out))
+	name := filepath.Base(source)
+	if strings.HasSuffix(name, ".tmpl") {
+		log.WithField("path", target).Warnf("%s is a chezmoi template, writing the file in place", source)
+		return "", false
+	}
+	for _, prefix := range chezmoiPrefixes {
+		if strings.Contains(name, prefix) {
+			log.WithField("path", target).Warnf("%s can't be written by theme-switcher, writing the file in place", source)
+			return "", false
+		}
+	}
+	return source, true
+}
+
+// write writes data to target through the source state, if chezmoi manages
+// it, and reports whether it did.
+func (c *Chezmoi) write(ctx context.Context, target string, old, data []byte) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	source, ok := c.sourcePath(ctx, target)
+	if !ok {
+		return false, nil
+	}
+	fi, err := os.Stat(source)
+	if err != nil {
+		return true, fmt.Errorf("unable to stat chezmoi source %s: %w", source, err)
+	}
+	current, err := os.ReadFile(source)
+	if err != nil {
+		return true, fmt.Errorf("unable to read chezmoi source %s: %w", source, err)
+	}
+	if !bytes.Equal(current, data) {
+		if err := writeFile(ctx, nil, nil, source, current, data, fi.Mode().Perm()); err != nil {
+			return true, err
+		}
+	}
+	if bytes.Equal(old, data) {
+		return true, nil
+	}
+	// --force, as the target might have been modified without chezmoi.
+	cmd, cancel := c.command(ctx, "apply", "--force", target)
+	defer cancel()
+	if dryRun(ctx, cmd) {
+		return true, nil
+	}
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return true, fmt.Errorf("unable to apply %s with chezmoi: %w: %s", target, err, strings.TrimSpace(string(out)))
+	}
+	return true, nil
+}
@@ -0,0 +1,8 @@
+//go:build !unix
+
+package backends
+
+import "os"
+
+// chown does nothing, as files don't have owners in the unix sense.
+func chown(f *os.File, fi os.FileInfo) error { return nil }
@@ -0,0 +1,18 @@
+//go:build unix
+
+package backends
+
+import (
+	"os"
+	"syscall"
+)
+
+// chown gives f the owner and group of the file fi describes, if they're
+// not ours, like when running as root.
+func chown(f *os.File, fi os.FileInfo) error {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok || (int(st.Uid) == os.Geteuid() && int(st.Gid) == os.Getegid()) {
+		return nil
+	}
+	return f.Chown(int(st.Uid), int(st.Gid))
+}
@@ -0,0 +1,76 @@
+package backends
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/flokli/theme-switcher/pkg/switcher"
+)
+
+// Command runs an arbitrary command to switch an application's theme.
+// In its arguments, {mode} is replaced by the mode, {theme} by the theme
+// configured for it (or the mode, if there's no theme configured), and
+// {accent} by the accent color, if the source reports one.
+// They're also passed as $THEME_SWITCHER_MODE, $THEME_SWITCHER_THEME and
+// $THEME_SWITCHER_ACCENT_COLOR, along with $THEME_SWITCHER_HIGH_CONTRAST.
+type Command struct {
+	BackendName string
+	Command     []string
+	Themes      switcher.Themes
+}
+
+func (c *Command) Name() string { return c.BackendName }
+
+// Events returns the appearance events, as the command is passed the appearance.
+func (c *Command) Events() []switcher.EventKind { return switcher.AppearanceEvents }
+
+func (c *Command) Theme(mode switcher.Mode) string {
+	if theme, ok := c.Themes.Lookup(mode); ok {
+		return theme
+	}
+	return string(mode)
+}
+
+func (c *Command) Detect(ctx context.Context) error {
+	if len(c.Command) == 0 {
+		return errors.New("no command configured")
+	}
+	if _, err := exec.LookPath(c.Command[0]); err != nil {
+		return fmt.Errorf("%s not found: %w", c.Command[0], err)
+	}
+	return nil
+}
+
+func (c *Command) Apply(ctx context.Context, mode switcher.Mode) error {
+	if len(c.Command) == 0 {
+		return errors.New("no command configured")
+	}
+
+	theme := c.Theme(mode)
+	appearance := switcher.AppearanceFrom(ctx)
+	r := strings.NewReplacer("{mode}", string(mode), "{theme}", theme, "{accent}", appearance.AccentColor, "{wallpaper}", appearance.Wallpaper)
+
+	args := make([]string, len(c.Command))
+	for i, arg := range c.Command {
+		args[i] = r.Replace(arg)
+	}
+
+	cmd, cancel := command(ctx, args[0], args[1:]...)
+	defer cancel()
+	cmd.Env = append(os.Environ(),
+		"THEME_SWITCHER_MODE="+string(mode),
+		"THEME_SWITCHER_THEME="+theme,
+	)
+	cmd.Env = append(cmd.Env, appearance.Env()...)
+	if dryRun(ctx, cmd) {
+		return nil
+	}
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
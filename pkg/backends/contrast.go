@@ -0,0 +1,27 @@
+package backends
+
+import (
+	"context"
+
+	"github.com/flokli/theme-switcher/pkg/switcher"
+)
+
+// themeFor returns the theme for mode, using the one of highContrast while
+// high contrast is enabled, if there is one.
+func themeFor(ctx context.Context, themes, highContrast switcher.Themes, mode switcher.Mode) string {
+	if switcher.AppearanceFrom(ctx).HighContrast {
+		if theme, ok := highContrast.Lookup(mode); ok {
+			return theme
+		}
+	}
+	return themes.For(mode)
+}
+
+// contrastEvents returns the events backends need to be applied again for,
+// to switch to and from their highContrast themes, if they have any.
+func contrastEvents(highContrast switcher.Themes) []switcher.EventKind {
+	if len(highContrast) == 0 {
+		return nil
+	}
+	return []switcher.EventKind{switcher.ContrastChanged}
+}
@@ -0,0 +1,71 @@
+package backends
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/flokli/theme-switcher/pkg/palette"
+	"github.com/flokli/theme-switcher/pkg/switcher"
+)
+
+// DerivedTheme is a theme defined in the configuration, inheriting from a
+// theme of the application and overriding some of its colors.
+type DerivedTheme struct {
+	// Base is the theme of the application it inherits from, with any
+	// derived themes in between resolved.
+	Base string
+	// Colors override the ones of Base, by the application's names for
+	// them, like background for kitty, or a palette entry for helix.
+	Colors palette.Palette
+}
+
+// DerivedThemes maps the names of derived themes to their definition.
+type DerivedThemes map[string]DerivedTheme
+
+// Base returns the theme of the application theme is derived from, or theme
+// itself if it isn't derived.
+func (d DerivedThemes) Base(theme string) string {
+	if derived, ok := d[theme]; ok {
+		return derived.Base
+	}
+	return theme
+}
+
+// sortedColors returns the names of colors, sorted.
+func sortedColors(colors palette.Palette) []string {
+	names := make([]string, 0, len(colors))
+	for name := range colors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// writeDerived writes the theme file of a derived theme to path, if it
+// changed, creating its directory.
+func writeDerived(ctx context.Context, chezmoi *Chezmoi, backups *Backups, path string, data []byte) error {
+	old, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("unable to read %s: %w", path, err)
+	}
+	if string(old) == string(data) {
+		return nil
+	}
+	if !switcher.IsDryRun(ctx) {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return fmt.Errorf("unable to create theme dir: %w", err)
+		}
+	}
+	if err := writeFile(ctx, chezmoi, backups, path, old, data, 0o644); err != nil {
+		return fmt.Errorf("unable to write derived theme: %w", err)
+	}
+	return nil
+}
+
+// derivedHeader is the comment at the top of derived theme files.
+func derivedHeader(name, base string) string {
+	return fmt.Sprintf("# %s, derived from %s by theme-switcher. Changes will be overwritten.\n", name, base)
+}
@@ -0,0 +1,155 @@
+package backends
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/flokli/theme-switcher/internal/diff"
+	"github.com/flokli/theme-switcher/internal/procs"
+	"github.com/flokli/theme-switcher/pkg/switcher"
+	log "github.com/sirupsen/logrus"
+)
+
+// stdoutMu serializes diffs printed by concurrently applied backends.
+var stdoutMu sync.Mutex
+
+// dryRun returns true if ctx is in dry-run mode, logging cmd instead of running it.
+func dryRun(ctx context.Context, cmd *execCmd) bool {
+	if !switcher.IsDryRun(ctx) {
+		return false
+	}
+	log.Infof("would run %s", strings.Join(cmd.Args, " "))
+	return true
+}
+
+// writeFile writes data to path, which currently contains old, through
+// chezmoi if it's set and manages path, saving a copy to backups first, if
+// it's set.
+// In dry-run mode, it prints the difference instead.
+func writeFile(ctx context.Context, chezmoi *Chezmoi, backups *Backups, path string, old, data []byte, perm os.FileMode) error {
+	if err := backups.save(ctx, path); err != nil {
+		return err
+	}
+	if chezmoi != nil {
+		if managed, err := chezmoi.write(ctx, path, old, data); managed {
+			return err
+		}
+	}
+	if switcher.IsDryRun(ctx) {
+		d := diff.Unified(path, string(old), string(data))
+		if d == "" {
+			log.Infof("would leave %s unchanged", path)
+			return nil
+		}
+		log.Infof("would modify %s", path)
+		stdoutMu.Lock()
+		defer stdoutMu.Unlock()
+		fmt.Print(d)
+		return nil
+	}
+
+	return writeAtomic(path, data, perm)
+}
+
+// writeAtomic writes data to a temporary file next to path, and renames it
+// over path, so a crash can't leave it truncated. An existing file keeps its
+// permissions, and its owner if we're allowed to set it. Symlinks, like the
+// ones of dotfile managers, are followed, so the file they point to is
+// replaced instead of them. Dangling ones are refused.
+func writeAtomic(path string, data []byte, perm os.FileMode) error {
+	if target, err := filepath.EvalSymlinks(path); err == nil {
+		path = target
+	} else if fi, lerr := os.Lstat(path); lerr == nil && fi.Mode()&os.ModeSymlink != 0 {
+		// replacing it would unlink the file from wherever it points to,
+		// like a dotfiles repository that isn't checked out.
+		return fmt.Errorf("not replacing %s, a symlink to a file that can't be resolved: %w", path, err)
+	}
+	fi, err := os.Stat(path)
+	if err == nil {
+		perm = fi.Mode().Perm()
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	// a no-op once it's renamed.
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return err
+	}
+	if fi != nil {
+		if err := chown(tmp, fi); err != nil {
+			// like a file of another user we may write to. Writing it in
+			// place could leave it truncated, so it's replaced anyway.
+			log.WithError(err).WithField("path", path).Warn("unable to keep the owner of the file, it's now owned by us")
+		}
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// reloadPID signals the process pid, if it's named name and of the current
+// session, to reload its config.
+func reloadPID(ctx context.Context, name string, pid int) error {
+	if switcher.IsDryRun(ctx) {
+		log.Infof("would signal %s %d to reload", name, pid)
+		return nil
+	}
+	ctx, cancel := switcher.CommandContext(ctx)
+	defer cancel()
+	return procs.ReloadPID(ctx, name, pid)
+}
+
+// reload signals processes named name of the current session to reload their config.
+func reload(ctx context.Context, name string) error {
+	if switcher.IsDryRun(ctx) {
+		log.Infof("would signal %s to reload", name)
+		return nil
+	}
+	ctx, cancel := switcher.CommandContext(ctx)
+	defer cancel()
+	return procs.Reload(ctx, name)
+}
+
+// reloadWith runs reloadCmd to have the application reload its config, with
+// {mode} and {theme} replaced in its arguments. Without a command, processes
+// named name are signalled, like with reload.
+func reloadWith(ctx context.Context, name string, reloadCmd []string, mode switcher.Mode, theme string) error {
+	if len(reloadCmd) == 0 {
+		return reload(ctx, name)
+	}
+	r := strings.NewReplacer("{mode}", string(mode), "{theme}", theme)
+	args := make([]string, len(reloadCmd))
+	for i, arg := range reloadCmd {
+		args[i] = r.Replace(arg)
+	}
+	cmd, cancel := command(ctx, args[0], args[1:]...)
+	defer cancel()
+	cmd.Env = append(os.Environ(),
+		"THEME_SWITCHER_MODE="+string(mode),
+		"THEME_SWITCHER_THEME="+theme,
+	)
+	if dryRun(ctx, cmd) {
+		return nil
+	}
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("unable to reload %s: %w: %s", name, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
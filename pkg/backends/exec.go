@@ -0,0 +1,63 @@
+package backends
+
+import (
+	"bytes"
+	"context"
+	"os/exec"
+
+	"github.com/flokli/theme-switcher/pkg/switcher"
+)
+
+// execCmd is a command run in a process group of its own, which is killed as
+// a whole once its context is done, so processes it started, like the ones
+// of a shell script, can't keep it from returning by holding on to its
+// output.
+type execCmd struct {
+	*exec.Cmd
+	ctx context.Context
+}
+
+// command returns a command running name with args, which is killed once the
+// command timeout of ctx passed. cancel needs to be called once it's done.
+func command(ctx context.Context, name string, args ...string) (*execCmd, context.CancelFunc) {
+	ctx, cancel := switcher.CommandContext(ctx)
+	cmd := exec.CommandContext(ctx, name, args...)
+	newProcessGroup(cmd)
+	return &execCmd{Cmd: cmd, ctx: ctx}, cancel
+}
+
+// Run starts the command and waits for it, killing its process group once
+// the context is done.
+func (c *execCmd) Run() error {
+	if err := c.Start(); err != nil {
+		return err
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-c.ctx.Done():
+			killProcessGroup(c.Process)
+		case <-done:
+		}
+	}()
+	return c.Wait()
+}
+
+// Output runs the command, and returns its standard output.
+func (c *execCmd) Output() ([]byte, error) {
+	var stdout bytes.Buffer
+	c.Stdout = &stdout
+	err := c.Run()
+	return stdout.Bytes(), err
+}
+
+// CombinedOutput runs the command, and returns its standard output and
+// standard error.
+func (c *execCmd) CombinedOutput() ([]byte, error) {
+	var out bytes.Buffer
+	c.Stdout = &out
+	c.Stderr = &out
+	err := c.Run()
+	return out.Bytes(), err
+}
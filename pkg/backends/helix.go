@@ -0,0 +1,429 @@
+package backends
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"runtime"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/BurntSushi/toml"
+	"github.com/flokli/theme-switcher/pkg/switcher"
+	log "github.com/sirupsen/logrus"
+)
+
+// Helix switches the theme of helix, by editing its config file and
+// signalling all instances running in the current session to reload it.
+type Helix struct {
+	Themes switcher.Themes
+	// HighContrast, if set, are the themes used while high contrast is enabled.
+	HighContrast switcher.Themes
+	// ReloadCommand, if set, is run instead of signalling helix to reload,
+	// with {mode} and {theme} replaced in its arguments.
+	ReloadCommand []string
+	// ConfigPath, if set, is the config file to edit instead of the one in
+	// the user config dir, like one managed by chezmoi.
+	ConfigPath string
+	// Derived are the themes derived from helix themes, written to the
+	// themes directory next to the config file before switching to them.
+	Derived DerivedThemes
+	// Chezmoi, if set, writes the files chezmoi manages through it.
+	Chezmoi *Chezmoi
+	// Backups, if set, saves a copy of files before modifying them.
+	Backups *Backups
+}
+
+func (h *Helix) Name() string { return "helix" }
+
+func (h *Helix) Theme(mode switcher.Mode) string { return h.Themes.For(mode) }
+
+func (h *Helix) Events() []switcher.EventKind { return contrastEvents(h.HighContrast) }
+
+// helixFlatpak is the app ID of the helix Flatpak, whose config is in a
+// directory of its own.
+const helixFlatpak = "com.helix_editor.Helix"
+
+// configPath returns the path to the helix config file in the user config
+// dir, which is the one created if there's none.
+func (h *Helix) configPath() (string, error) {
+	if h.ConfigPath != "" {
+		return h.ConfigPath, nil
+	}
+	confDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("unable to determine user config dir: %w", err)
+	}
+
+	// helix uses the XDG layout on macOS too, not ~/Library/Application Support.
+	if runtime.GOOS == "darwin" {
+		if confDir = os.Getenv("XDG_CONFIG_HOME"); confDir == "" {
+			homeDir, err := os.UserHomeDir()
+			if err != nil {
+				return "", fmt.Errorf("unable to determine home dir: %w", err)
+			}
+			confDir = filepath.Join(homeDir, ".config")
+		}
+	}
+
+	return filepath.Join(confDir, "helix", "config.toml"), nil
+}
+
+// configPaths returns the paths of the helix config files to edit: the ones
+// that exist of the one in the user config dir, the one of the Flatpak, and
+// one next to $HELIX_RUNTIME, or the one in the user config dir, if none of
+// them does. With ConfigPath set, it's the only one.
+func (h *Helix) configPaths() ([]string, error) {
+	configPath, err := h.configPath()
+	if err != nil || h.ConfigPath != "" {
+		return []string{configPath}, err
+	}
+	candidates := []string{configPath}
+	if homeDir, err := os.UserHomeDir(); err == nil {
+		candidates = append(candidates, filepath.Join(homeDir, ".var", "app", helixFlatpak, "config", "helix", "config.toml"))
+	}
+	if runtimeDir := os.Getenv("HELIX_RUNTIME"); runtimeDir != "" {
+		candidates = append(candidates, filepath.Join(filepath.Dir(filepath.Clean(runtimeDir)), "config.toml"))
+	}
+
+	var paths []string
+	seen := make(map[string]bool, len(candidates))
+	for _, path := range candidates {
+		if seen[path] {
+			continue
+		}
+		seen[path] = true
+		if _, err := os.Stat(path); err == nil {
+			paths = append(paths, path)
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("unable to stat config file %s: %w", path, err)
+		}
+	}
+	if len(paths) == 0 {
+		paths = []string{configPath}
+	}
+	return paths, nil
+}
+
+// Detect returns nil if helix is installed, or has a config file, which is
+// created when switching if it doesn't exist yet.
+func (h *Helix) Detect(ctx context.Context) error {
+	configPaths, err := h.configPaths()
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(configPaths[0]); err == nil {
+		return nil
+	}
+	if _, err := exec.LookPath("hx"); err != nil {
+		return fmt.Errorf("hx not found, and no config file at %s: %w", configPaths[0], err)
+	}
+	return nil
+}
+
+// Apply edits the helix config files and sends a -USR1 to all helix instances
+// in the current session to reload, or runs the ReloadCommand.
+// On Windows, running instances only pick up the theme on :config-reload.
+// A missing config file is created.
+func (h *Helix) Apply(ctx context.Context, mode switcher.Mode) error {
+	configPaths, err := h.configPaths()
+	if err != nil {
+		return err
+	}
+	theme := themeFor(ctx, h.Themes, h.HighContrast, mode)
+	for _, configPath := range configPaths {
+		if err := h.applyConfig(ctx, configPath, theme); err != nil {
+			return err
+		}
+	}
+
+	// helix can't be signalled to reload on Windows.
+	if runtime.GOOS == "windows" && len(h.ReloadCommand) == 0 {
+		return nil
+	}
+
+	// send sigusr1 to all helixes of this session, so they pick up changes
+	return reloadWith(ctx, "hx", h.ReloadCommand, mode, theme)
+}
+
+// applyConfig sets the theme in the config file at configPath.
+func (h *Helix) applyConfig(ctx context.Context, configPath, theme string) error {
+	// read helix config
+	config, err := os.ReadFile(configPath)
+	if errors.Is(err, os.ErrNotExist) {
+		log.WithField("path", configPath).Info("creating helix config file")
+		if !switcher.IsDryRun(ctx) {
+			if err := os.MkdirAll(filepath.Dir(configPath), 0o755); err != nil {
+				return fmt.Errorf("unable to create config dir: %w", err)
+			}
+		}
+	} else if err != nil {
+		return fmt.Errorf("unable to read config file %s: %w", configPath, err)
+	}
+
+	if derived, ok := h.Derived[theme]; ok {
+		if err := h.writeDerived(ctx, configPath, theme, derived); err != nil {
+			return err
+		}
+	}
+	configNew, err := setTOMLString(config, "theme", theme)
+	if err != nil {
+		return fmt.Errorf("unable to update config file %s: %w", configPath, err)
+	}
+
+	if err := writeFile(ctx, h.Chezmoi, h.Backups, configPath, config, configNew, 0o644); err != nil {
+		return fmt.Errorf("unable to write back config file: %w", err)
+	}
+	return nil
+}
+
+// topLevelKey matches a line setting a top-level key, with the key, bare or
+// quoted, as the first group.
+var topLevelKey = regexp.MustCompile(`^[ \t]*([\w-]+|"[^"]*"|'[^']*')[ \t]*=[ \t]*`)
+
+// setTOMLString sets the top-level key of the TOML document data to the string
+// value, adding it after the other top-level keys if it's missing.
+// Only the value itself is replaced, keeping its quotes if possible, to
+// leave comments and the rest of the file untouched. The result is parsed
+// again, to make sure nothing else changed.
+func setTOMLString(data []byte, key, value string) ([]byte, error) {
+	if !utf8.ValidString(value) {
+		return nil, fmt.Errorf("%q can't be written to TOML, as it isn't valid UTF-8", value)
+	}
+	var want map[string]interface{}
+	if _, err := toml.Decode(string(data), &want); err != nil {
+		return nil, fmt.Errorf("unable to parse TOML: %w", err)
+	}
+	want[key] = value
+
+	// insert is where to add the key if it's missing: after the last
+	// top-level one, or at the top.
+	var out []byte
+	insert := 0
+	for offset := 0; offset < len(data) && out == nil; {
+		end := bytes.IndexByte(data[offset:], '\n') + offset + 1
+		if end == offset {
+			end = len(data)
+		}
+		line := data[offset:end]
+		if trimmed := bytes.TrimLeft(line, " \t"); len(trimmed) > 0 && trimmed[0] == '[' {
+			// the first table ends the top-level keys.
+			break
+		}
+		m := topLevelKey.FindSubmatchIndex(line)
+		if m == nil {
+			offset = end
+			continue
+		}
+		valueStart := offset + m[1]
+		valueEnd, err := tomlValueEnd(data, valueStart)
+		if err != nil {
+			return nil, err
+		}
+		if strings.Trim(string(line[m[2]:m[3]]), `"'`) == key {
+			quoted := tomlQuote(value)
+			if data[valueStart] == '\'' && !strings.ContainsRune(value, '\'') && strings.IndexFunc(value, unicode.IsControl) < 0 {
+				quoted = "'" + value + "'"
+			}
+			out = splice(data, int64(valueStart), int64(valueEnd), []byte(quoted))
+			break
+		}
+		// continue after the value, which might span lines.
+		if next := bytes.IndexByte(data[valueEnd:], '\n'); next >= 0 {
+			end = valueEnd + next + 1
+		} else {
+			end = len(data)
+		}
+		insert, offset = end, end
+	}
+	if out == nil {
+		// match the line endings of the file.
+		newline := "\n"
+		if bytes.Contains(data, []byte("\r\n")) {
+			newline = "\r\n"
+		}
+		line := fmt.Sprintf("%s = %s%s", key, tomlQuote(value), newline)
+		if insert == 0 && len(data) > 0 {
+			line += newline
+		} else if insert > 0 && data[insert-1] != '\n' {
+			line = newline + line
+		}
+		out = splice(data, int64(insert), int64(insert), []byte(line))
+	}
+
+	var got map[string]interface{}
+	if _, err := toml.Decode(string(out), &got); err != nil || !reflect.DeepEqual(got, want) {
+		return nil, fmt.Errorf("unable to set %s without changing anything else", key)
+	}
+	return out, nil
+}
+
+// tomlQuote quotes s as a TOML basic string. Unlike strconv.Quote, it only
+// uses the escapes TOML knows.
+func tomlQuote(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"', '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case '\b':
+			b.WriteString(`\b`)
+		case '\t':
+			b.WriteString(`\t`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\f':
+			b.WriteString(`\f`)
+		case '\r':
+			b.WriteString(`\r`)
+		default:
+			if unicode.IsControl(r) {
+				fmt.Fprintf(&b, `\u%04X`, r)
+			} else {
+				b.WriteRune(r)
+			}
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// tomlValueEnd returns the offset right after the TOML value starting at
+// start in data.
+func tomlValueEnd(data []byte, start int) (int, error) {
+	rest := data[start:]
+	for _, delim := range []string{`"""`, "'''"} {
+		if bytes.HasPrefix(rest, []byte(delim)) {
+			end := bytes.Index(rest[3:], []byte(delim))
+			if end < 0 {
+				return 0, errors.New("unterminated multi-line string")
+			}
+			// up to two quotes can directly precede the closing ones.
+			end += 6
+			for end < len(rest) && rest[end] == delim[0] {
+				end++
+			}
+			return start + end, nil
+		}
+	}
+	// depth counts the brackets and braces of arrays and inline tables.
+	depth := 0
+	for i := 0; i < len(rest); i++ {
+		c := rest[i]
+		switch c {
+		case '"', '\'':
+			for i++; i < len(rest) && rest[i] != c; i++ {
+				if c == '"' && rest[i] == '\\' {
+					i++
+				}
+			}
+		case '[', '{':
+			depth++
+		case ']', '}':
+			depth--
+		case '#':
+			// skip comments, also inside multi-line arrays.
+			if depth == 0 {
+				return start + len(bytes.TrimRight(rest[:i], " \t")), nil
+			}
+			for i < len(rest) && rest[i] != '\n' {
+				i++
+			}
+		case '\n':
+			if depth == 0 {
+				return start + len(bytes.TrimRight(rest[:i], " \t\r")), nil
+			}
+		}
+		if depth == 0 && (c == '"' || c == '\'' || c == ']' || c == '}') {
+			return start + i + 1, nil
+		}
+	}
+	return len(data), nil
+}
+
+// writeDerived writes the derived theme name next to the config file at
+// configPath, inheriting from its base, with the colors overriding the ones
+// of its palette.
+func (h *Helix) writeDerived(ctx context.Context, configPath, name string, derived DerivedTheme) error {
+	var b strings.Builder
+	b.WriteString(derivedHeader(name, derived.Base))
+	fmt.Fprintf(&b, "inherits = %q\n", derived.Base)
+	if len(derived.Colors) > 0 {
+		b.WriteString("\n[palette]\n")
+		for _, color := range sortedColors(derived.Colors) {
+			fmt.Fprintf(&b, "%q = %q\n", color, derived.Colors[color])
+		}
+	}
+	return writeDerived(ctx, h.Chezmoi, h.Backups, filepath.Join(filepath.Dir(configPath), "themes", name+".toml"), []byte(b.String()))
+}
+
+// builtinHelixThemes are compiled into helix.
+var builtinHelixThemes = map[string]bool{"default": true, "base16_default": true}
+
+// themeDirs returns the directories helix looks up themes in: next to its
+// config, and in the runtime directories reported by hx --health.
+func (h *Helix) themeDirs(ctx context.Context, configPath string) []string {
+	dirs := []string{filepath.Join(filepath.Dir(configPath), "themes")}
+	if runtimeDir := os.Getenv("HELIX_RUNTIME"); runtimeDir != "" {
+		dirs = append(dirs, filepath.Join(runtimeDir, "themes"))
+	}
+	cmd, cancel := command(ctx, "hx", "--health")
+	defer cancel()
+	out, err := cmd.Output()
+	if err != nil {
+		return dirs
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		// "Runtime directories: a;b", or "Runtime directory: a" in older versions.
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if !ok || !strings.HasPrefix(key, "Runtime director") {
+			continue
+		}
+		for _, dir := range strings.Split(value, ";") {
+			dirs = append(dirs, filepath.Join(strings.TrimSpace(dir), "themes"))
+		}
+	}
+	return dirs
+}
+
+// Check returns an error for each theme helix doesn't ship or find in its
+// theme directories, and for each config file that can't be written.
+func (h *Helix) Check(ctx context.Context) []error {
+	configPaths, err := h.configPaths()
+	if err != nil {
+		return []error{err}
+	}
+	var errs []error
+	for _, configPath := range configPaths {
+		if err := checkWritable(configPath); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	dirs := h.themeDirs(ctx, configPaths[0])
+	for _, theme := range allThemes(h.Themes, h.HighContrast) {
+		// derived themes are only written when switching to them.
+		theme = h.Derived.Base(theme)
+		found := builtinHelixThemes[theme]
+		for _, dir := range dirs {
+			if _, err := os.Stat(filepath.Join(dir, theme+".toml")); err == nil {
+				found = true
+				break
+			}
+		}
+		if !found {
+			errs = append(errs, fmt.Errorf("helix theme %s not found in %s", theme, strings.Join(dirs, ", ")))
+		}
+	}
+	return errs
+}
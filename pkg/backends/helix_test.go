@@ -0,0 +1,176 @@
+package backends
+
+import (
+	"testing"
+
+	"github.com/BurntSushi/toml"
+)
+
+func TestSetTOMLString(t *testing.T) {
+	for _, tt := range []struct {
+		name, in, value, want string
+	}{
+		{
+			name: "empty file",
+			in:   "",
+			want: "theme = \"dark\"\n",
+		},
+		{
+			name: "comment only",
+			in:   "# helix config\n",
+			want: "theme = \"dark\"\n\n# helix config\n",
+		},
+		{
+			name: "replaces value, keeping comments",
+			in:   "# mine\ntheme = \"light\" # the theme\n\n[editor]\nline-number = \"relative\"\n",
+			want: "# mine\ntheme = \"dark\" # the theme\n\n[editor]\nline-number = \"relative\"\n",
+		},
+		{
+			name: "keeps literal quotes",
+			in:   "theme = 'light'\n",
+			want: "theme = 'dark'\n",
+		},
+		{
+			name:  "literal quotes can't hold a quote",
+			in:    "theme = 'light'\n",
+			value: "it's",
+			want:  "theme = \"it's\"\n",
+		},
+		{
+			name:  "escapes for TOML",
+			in:    "theme = \"light\"\n",
+			value: "a \"b\" \\ \x1b",
+			want:  "theme = \"a \\\"b\\\" \\\\ \\u001B\"\n",
+		},
+		{
+			name: "quoted key",
+			in:   "\"theme\" = \"light\"\n",
+			want: "\"theme\" = \"dark\"\n",
+		},
+		{
+			name: "key only in a table",
+			in:   "[editor]\ntheme = \"light\"\n",
+			want: "theme = \"dark\"\n\n[editor]\ntheme = \"light\"\n",
+		},
+		{
+			name: "added after the top-level keys",
+			in:   "mouse = false\n\n[editor]\nline-number = \"relative\"\n",
+			want: "mouse = false\ntheme = \"dark\"\n\n[editor]\nline-number = \"relative\"\n",
+		},
+		{
+			name: "dotted keys",
+			in:   "editor.line-number = \"relative\"\ntheme = \"light\"\n",
+			want: "editor.line-number = \"relative\"\ntheme = \"dark\"\n",
+		},
+		{
+			name: "dotted key with the name of the key",
+			in:   "editor.theme = \"light\"\n",
+			want: "theme = \"dark\"\n\neditor.theme = \"light\"\n",
+		},
+		{
+			name: "multi-line array before the key",
+			in:   "shell = [\n  \"sh\", # comment ]\n  \"-c\",\n]\ntheme = \"light\"\n",
+			want: "shell = [\n  \"sh\", # comment ]\n  \"-c\",\n]\ntheme = \"dark\"\n",
+		},
+		{
+			name: "added after a multi-line array",
+			in:   "shell = [\n  \"sh\",\n  \"-c\",\n]\n[editor]\n",
+			want: "shell = [\n  \"sh\",\n  \"-c\",\n]\ntheme = \"dark\"\n[editor]\n",
+		},
+		{
+			name: "multi-line string",
+			in:   "theme = \"\"\"\nlight\"\"\"\n",
+			want: "theme = \"dark\"\n",
+		},
+		{
+			name: "CRLF",
+			in:   "mouse = false\r\ntheme = \"light\"\r\n[editor]\r\n",
+			want: "mouse = false\r\ntheme = \"dark\"\r\n[editor]\r\n",
+		},
+		{
+			name: "added with CRLF",
+			in:   "mouse = false\r\n[editor]\r\n",
+			want: "mouse = false\r\ntheme = \"dark\"\r\n[editor]\r\n",
+		},
+		{
+			name: "no trailing newline",
+			in:   "mouse = false",
+			want: "mouse = false\ntheme = \"dark\"\n",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			value := tt.value
+			if value == "" {
+				value = "dark"
+			}
+			got, err := setTOMLString([]byte(tt.in), "theme", value)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+			var config struct{ Theme string }
+			if _, err := toml.Decode(string(got), &config); err != nil || config.Theme != value {
+				t.Errorf("theme decoded as %q (%v), want %q", config.Theme, err, value)
+			}
+		})
+	}
+}
+
+func TestSetTOMLStringErrors(t *testing.T) {
+	for _, tt := range []struct {
+		name, in, value string
+	}{
+		{name: "invalid TOML", in: "theme = ", value: "dark"},
+		{name: "invalid UTF-8", in: "", value: "\xff"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, err := setTOMLString([]byte(tt.in), "theme", tt.value); err == nil {
+				t.Errorf("got %q, want an error", got)
+			}
+		})
+	}
+}
+
+func TestTOMLValueEnd(t *testing.T) {
+	for _, tt := range []struct {
+		in   string
+		want string
+	}{
+		{in: `"a" # comment`, want: `"a"`},
+		{in: `'a\' rest`, want: `'a\'`},
+		{in: `"a\"b" rest`, want: `"a\"b"`},
+		{in: "\"\"\"a\n\"\"\"\"\" rest", want: "\"\"\"a\n\"\"\"\"\""},
+		{in: "[1, [2]] # x", want: "[1, [2]]"},
+		{in: "{ a = \"}\" } rest", want: "{ a = \"}\" }"},
+		{in: "true  \r\nnext = 1", want: "true"},
+		{in: "42", want: "42"},
+	} {
+		end, err := tomlValueEnd([]byte(tt.in), 0)
+		if err != nil {
+			t.Errorf("tomlValueEnd(%q): %v", tt.in, err)
+			continue
+		}
+		if got := tt.in[:end]; got != tt.want {
+			t.Errorf("tomlValueEnd(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+	if _, err := tomlValueEnd([]byte(`"""never closed`), 0); err == nil {
+		t.Error("unterminated multi-line string accepted")
+	}
+}
+
+func TestTOMLQuote(t *testing.T) {
+	for in, want := range map[string]string{
+		"catppuccin_mocha": `"catppuccin_mocha"`,
+		`a"b\c`:            `"a\"b\\c"`,
+		"tab\there\n":      `"tab\there\n"`,
+		"\x7f\u0085":       `"\u007F\u0085"`,
+		"ünïcödé":          `"ünïcödé"`,
+	} {
+		if got := tomlQuote(in); got != want {
+			t.Errorf("tomlQuote(%q) = %s, want %s", in, got, want)
+		}
+	}
+}
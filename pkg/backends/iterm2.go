@@ -0,0 +1,25 @@
+package backends
+
+import (
+	"errors"
+
+	"github.com/flokli/theme-switcher/pkg/switcher"
+)
+
+// errNotMacOS is returned by macOS-only backends on other platforms.
+var errNotMacOS = errors.New("only supported on macOS")
+
+// ITerm2 switches the color preset of all open iTerm2 sessions, by writing
+// iTerm2's SetColors escape sequence to their terminals.
+type ITerm2 struct {
+	// Themes maps modes to the names of iTerm2 color presets.
+	Themes switcher.Themes
+	// HighContrast, if set, are the themes used while high contrast is enabled.
+	HighContrast switcher.Themes
+}
+
+func (i *ITerm2) Name() string { return "iterm2" }
+
+func (i *ITerm2) Theme(mode switcher.Mode) string { return i.Themes.For(mode) }
+
+func (i *ITerm2) Events() []switcher.EventKind { return contrastEvents(i.HighContrast) }
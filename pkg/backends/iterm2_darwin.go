@@ -0,0 +1,63 @@
+package backends
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/flokli/theme-switcher/pkg/switcher"
+	log "github.com/sirupsen/logrus"
+)
+
+// iTerm2TTYsScript prints the ttys of all iTerm2 sessions, without launching iTerm2.
+const iTerm2TTYsScript = `if application "iTerm2" is running then
+	tell application "iTerm2" to get tty of every session of every tab of every window
+end if`
+
+func (i *ITerm2) Detect(ctx context.Context) error {
+	if _, err := os.Stat("/Applications/iTerm.app"); err != nil {
+		return fmt.Errorf("iTerm2 not found: %w", err)
+	}
+	return nil
+}
+
+func (i *ITerm2) Apply(ctx context.Context, mode switcher.Mode) error {
+	cmd, cancel := command(ctx, "osascript", "-e", iTerm2TTYsScript)
+	defer cancel()
+	out, err := cmd.Output()
+	if err != nil {
+		return fmt.Errorf("unable to list iTerm2 sessions: %w", err)
+	}
+
+	// the nested lists are printed flattened, and comma-separated.
+	preset := themeFor(ctx, i.Themes, i.HighContrast, mode)
+	escape := "\x1b]1337;SetColors=preset=" + preset + "\x07"
+	for _, tty := range strings.Split(strings.TrimSpace(string(out)), ", ") {
+		if tty == "" {
+			continue
+		}
+		if switcher.IsDryRun(ctx) {
+			log.Infof("would set color preset %s on %s", preset, tty)
+			continue
+		}
+		if err := writeTTY(tty, escape); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeTTY writes s to the terminal device at path.
+func writeTTY(path, s string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return fmt.Errorf("unable to open %s: %w", path, err)
+	}
+	defer f.Close()
+
+	if _, err := f.WriteString(s); err != nil {
+		return fmt.Errorf("unable to write to %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,17 @@
+//go:build !darwin
+
+package backends
+
+import (
+	"context"
+
+	"github.com/flokli/theme-switcher/pkg/switcher"
+)
+
+func (i *ITerm2) Detect(ctx context.Context) error {
+	return errNotMacOS
+}
+
+func (i *ITerm2) Apply(ctx context.Context, mode switcher.Mode) error {
+	return errNotMacOS
+}
@@ -0,0 +1,312 @@
+package backends
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/flokli/theme-switcher/pkg/switcher"
+	log "github.com/sirupsen/logrus"
+)
+
+// Kitty switches the theme of all kitty instances running in the current
+// session, using the themes kitten.
+type Kitty struct {
+	Themes switcher.Themes
+	// HighContrast, if set, are the themes used while high contrast is enabled.
+	HighContrast switcher.Themes
+	// ReloadCommand, if set, is run instead of signalling kitty to reload,
+	// with {mode} and {theme} replaced in its arguments.
+	ReloadCommand []string
+	// ConfigDir, if set, is the directory of kitty.conf, passed to the
+	// kitten as $KITTY_CONFIG_DIRECTORY, instead of kitty's default.
+	ConfigDir string
+	// Socket, if set, is the remote control address (see listen_on) kitty
+	// is told to reload through, instead of signalling it. A unix socket
+	// path can be a pattern, like unix:/tmp/kitty-*, as kitty appends its
+	// pid to it.
+	Socket string
+	// Derived are the themes derived from kitty themes, written to the
+	// themes directory of kitty's config before switching to them.
+	Derived DerivedThemes
+	// Chezmoi, if set, writes the files chezmoi manages through it.
+	Chezmoi *Chezmoi
+	// Backups, if set, saves a copy of files before modifying them.
+	Backups *Backups
+
+	// warned are the problems already warned about, see warnOnce.
+	mu     sync.Mutex
+	warned map[string]bool
+}
+
+func (k *Kitty) Name() string { return "kitty" }
+
+func (k *Kitty) Theme(mode switcher.Mode) string { return k.Themes.For(mode) }
+
+func (k *Kitty) Events() []switcher.EventKind { return contrastEvents(k.HighContrast) }
+
+func (k *Kitty) Detect(ctx context.Context) error {
+	if _, err := exec.LookPath("kitty"); err != nil {
+		return fmt.Errorf("kitty not found, install it or remove it from the backends: %w", err)
+	}
+	return nil
+}
+
+// Apply invokes kitty to set the theme configured for the given mode.
+// The kitten would signal kitty instances of all sessions to reload,
+// so we do that ourselves, through Socket, or run the ReloadCommand.
+// If the kitten fails, like when it can't download the themes, the theme is
+// written to current-theme.conf directly, if it's in the themes directory.
+func (k *Kitty) Apply(ctx context.Context, mode switcher.Mode) error {
+	theme := themeFor(ctx, k.Themes, k.HighContrast, mode)
+	if derived, ok := k.Derived[theme]; ok {
+		if err := k.writeDerived(ctx, theme, derived); err != nil {
+			return err
+		}
+	}
+	cmd, cancel := k.command(ctx, "+kitten", "themes", "--reload-in=none", theme)
+	defer cancel()
+	if !dryRun(ctx, cmd) {
+		if err := k.backUp(ctx); err != nil {
+			return err
+		}
+		if out, err := cmd.CombinedOutput(); err != nil {
+			err = fmt.Errorf("themes kitten failed: %w: %s", err, strings.TrimSpace(string(out)))
+			if fallbackErr := k.writeCurrentTheme(ctx, theme); fallbackErr != nil {
+				log.WithError(fallbackErr).Debug("unable to write kitty's current-theme.conf instead")
+				return err
+			}
+			k.warnOnce("kitten", err, "unable to switch kitty's theme with the themes kitten, wrote current-theme.conf instead")
+		}
+	}
+	if k.Socket != "" && len(k.ReloadCommand) == 0 {
+		return k.reloadSockets(ctx)
+	}
+	return reloadWith(ctx, "kitty", k.ReloadCommand, mode, theme)
+}
+
+// backUp saves a copy of the files the themes kitten modifies to Backups.
+func (k *Kitty) backUp(ctx context.Context) error {
+	if k.Backups == nil {
+		return nil
+	}
+	dir, err := k.configDir()
+	if err != nil {
+		return err
+	}
+	for _, name := range []string{"kitty.conf", "current-theme.conf"} {
+		if err := k.Backups.save(ctx, filepath.Join(dir, name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// warnOnce logs msg with err as a warning the first time problem occurs, and
+// at debug level after that, so a lasting problem doesn't fill the log on
+// every switch.
+func (k *Kitty) warnOnce(problem string, err error, msg string) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	logger := log.WithError(err).WithField("backend", k.Name())
+	if k.warned[problem] {
+		logger.Debug(msg)
+		return
+	}
+	if k.warned == nil {
+		k.warned = make(map[string]bool)
+	}
+	k.warned[problem] = true
+	logger.Warn(msg)
+}
+
+// writeCurrentTheme writes the theme name from the themes directory of kitty's
+// config to current-theme.conf, like the themes kitten does, if kitty.conf
+// includes it.
+func (k *Kitty) writeCurrentTheme(ctx context.Context, name string) error {
+	dir, err := k.configDir()
+	if err != nil {
+		return err
+	}
+	conf, err := os.ReadFile(filepath.Join(dir, "kitty.conf"))
+	if err != nil {
+		return err
+	}
+	if !kittyIncludesCurrentTheme(string(conf)) {
+		return errors.New("kitty.conf doesn't include current-theme.conf")
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "themes", name+".conf"))
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(dir, "current-theme.conf")
+	old, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return writeFile(ctx, k.Chezmoi, k.Backups, path, old, data, 0o644)
+}
+
+// kittyIncludesCurrentTheme returns whether conf includes current-theme.conf,
+// like the themes kitten sets it up.
+func kittyIncludesCurrentTheme(conf string) bool {
+	for _, line := range strings.Split(conf, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 && fields[0] == "include" && fields[1] == "current-theme.conf" {
+			return true
+		}
+	}
+	return false
+}
+
+// command returns a command running kitty with args, in ConfigDir if set,
+// like the package-level command.
+func (k *Kitty) command(ctx context.Context, args ...string) (*execCmd, context.CancelFunc) {
+	cmd, cancel := command(ctx, "kitty", args...)
+	if k.ConfigDir != "" {
+		cmd.Env = append(os.Environ(), "KITTY_CONFIG_DIRECTORY="+k.ConfigDir)
+	}
+	return cmd, cancel
+}
+
+// configDir returns the directory kitty reads its config from.
+func (k *Kitty) configDir() (string, error) {
+	if k.ConfigDir != "" {
+		return k.ConfigDir, nil
+	}
+	if dir := os.Getenv("KITTY_CONFIG_DIRECTORY"); dir != "" {
+		return dir, nil
+	}
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return filepath.Join(dir, "kitty"), nil
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("unable to determine home dir: %w", err)
+	}
+	return filepath.Join(homeDir, ".config", "kitty"), nil
+}
+
+// writeDerived writes the derived theme name to the themes directory of
+// kitty's config, where the kitten finds it: the colors of its base, followed
+// by the ones overriding them.
+func (k *Kitty) writeDerived(ctx context.Context, name string, derived DerivedTheme) error {
+	dir, err := k.configDir()
+	if err != nil {
+		return err
+	}
+	cmd, cancel := k.command(ctx, "+kitten", "themes", "--dump-theme", derived.Base)
+	defer cancel()
+	base, err := cmd.Output()
+	if err != nil {
+		return fmt.Errorf("unable to read kitty theme %s: %w", derived.Base, err)
+	}
+	var b strings.Builder
+	b.WriteString(derivedHeader(name, derived.Base))
+	b.Write(base)
+	b.WriteString("\n")
+	for _, color := range sortedColors(derived.Colors) {
+		fmt.Fprintf(&b, "%s %s\n", color, derived.Colors[color])
+	}
+	return writeDerived(ctx, k.Chezmoi, k.Backups, filepath.Join(dir, "themes", name+".conf"), []byte(b.String()))
+}
+
+// sockets returns the remote control addresses matching Socket.
+func (k *Kitty) sockets() ([]string, error) {
+	path := strings.TrimPrefix(k.Socket, "unix:")
+	if path == k.Socket || strings.HasPrefix(path, "@") {
+		return []string{k.Socket}, nil
+	}
+	matches, err := filepath.Glob(path)
+	if err != nil {
+		return nil, fmt.Errorf("invalid kitty socket %s: %w", k.Socket, err)
+	}
+	addrs := make([]string, len(matches))
+	for i, match := range matches {
+		addrs[i] = "unix:" + match
+	}
+	return addrs, nil
+}
+
+// socketPID returns the pid of the kitty instance listening on addr, which
+// kitty appends to the path of unix sockets.
+func socketPID(addr string) (int, bool) {
+	path := strings.TrimPrefix(addr, "unix:")
+	i := strings.LastIndexByte(path, '-')
+	if path == addr || i < 0 {
+		return 0, false
+	}
+	pid, err := strconv.Atoi(path[i+1:])
+	return pid, err == nil && pid > 0
+}
+
+// reloadSockets has the kitty instances listening on Socket reload their
+// config, including the theme. Instances refusing remote control are
+// signalled instead, each by itself if its pid is known from its socket, or
+// else along with all other instances.
+func (k *Kitty) reloadSockets(ctx context.Context) error {
+	addrs, err := k.sockets()
+	if err != nil {
+		return err
+	}
+	if len(addrs) == 0 {
+		log.WithField("socket", k.Socket).Debug("no kitty listening")
+	}
+	var firstErr error
+	signalAll := false
+	for _, addr := range addrs {
+		cmd, cancel := k.command(ctx, "@", "--to", addr, "load-config")
+		if dryRun(ctx, cmd) {
+			cancel()
+			continue
+		}
+		out, err := cmd.CombinedOutput()
+		cancel()
+		if err == nil {
+			continue
+		}
+		err = fmt.Errorf("unable to reload kitty at %s: %w: %s", addr, err, strings.TrimSpace(string(out)))
+		if !strings.Contains(string(out), "allow_remote_control") && !strings.Contains(strings.ToLower(string(out)), "remote control is disabled") {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		k.warnOnce("remote control", err, "kitty's remote control is disabled, set allow_remote_control in kitty.conf, signalling it instead")
+		if pid, ok := socketPID(addr); ok {
+			err := reloadPID(ctx, "kitty", pid)
+			if err == nil {
+				continue
+			}
+			log.WithError(err).WithField("socket", addr).Debug("unable to signal kitty by its pid")
+		}
+		signalAll = true
+	}
+	if signalAll {
+		if err := reload(ctx, "kitty"); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// Check returns an error for each theme the themes kitten doesn't know.
+func (k *Kitty) Check(ctx context.Context) []error {
+	var errs []error
+	for _, theme := range allThemes(k.Themes, k.HighContrast) {
+		// derived themes are only written when switching to them.
+		theme = k.Derived.Base(theme)
+		cmd, cancel := k.command(ctx, "+kitten", "themes", "--dump-theme", theme)
+		if err := cmd.Run(); err != nil {
+			errs = append(errs, fmt.Errorf("kitty theme %s not found: %w", theme, err))
+		}
+		cancel()
+	}
+	return errs
+}
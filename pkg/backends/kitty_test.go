@@ -0,0 +1,60 @@
+package backends
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestSocketPID(t *testing.T) {
+	for _, tt := range []struct {
+		addr string
+		pid  int
+		ok   bool
+	}{
+		{"unix:/tmp/kitty-1234", 1234, true},
+		{"unix:/run/user/1000/kitty-socket-42", 42, true},
+		{"unix:/tmp/kitty", 0, false},
+		{"unix:/tmp/kitty-", 0, false},
+		{"unix:/tmp/kitty-abc", 0, false},
+		{"unix:@kitty-1234", 1234, true},
+		{"tcp:localhost:12345", 0, false},
+	} {
+		if pid, ok := socketPID(tt.addr); pid != tt.pid || ok != tt.ok {
+			t.Errorf("socketPID(%s) = %d, %v, want %d, %v", tt.addr, pid, ok, tt.pid, tt.ok)
+		}
+	}
+}
+
+func TestReloadSocketsTriesAll(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs a shell script as kitty")
+	}
+	dir := t.TempDir()
+	// a kitty that fails to reach the first instance, logging the others.
+	logPath := filepath.Join(dir, "log")
+	script := "#!/bin/sh\ncase \"$3\" in *-1) echo 'connection refused' >&2; exit 1;; esac\necho \"$3\" >> " + logPath + "\n"
+	if err := os.WriteFile(filepath.Join(dir, "kitty"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir)
+	for _, name := range []string{"kitty-1", "kitty-2", "kitty-3"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	k := &Kitty{Socket: "unix:" + filepath.Join(dir, "kitty-*")}
+	err := k.reloadSockets(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "kitty-1") {
+		t.Errorf("got %v, want the error of the first instance", err)
+	}
+	reloaded, _ := os.ReadFile(logPath)
+	want := "unix:" + filepath.Join(dir, "kitty-2") + "\nunix:" + filepath.Join(dir, "kitty-3") + "\n"
+	if string(reloaded) != want {
+		t.Errorf("reloaded %q, want %q", reloaded, want)
+	}
+}
@@ -0,0 +1,63 @@
+package backends
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/flokli/theme-switcher/pkg/switcher"
+)
+
+// ValidateThemes returns an error for the first theme of themes the backend
+// named backend can't be switched to, whatever it's quoted with. Names
+// can't be empty, and can't contain control characters or invalid UTF-8, as
+// they're passed as arguments and written into configuration files. kitty and
+// helix also use them as file names, and neovim's :colorscheme only takes
+// names without spaces.
+func ValidateThemes(backend string, themes switcher.Themes) error {
+	names := make([]string, 0, len(themes))
+	for _, theme := range themes {
+		names = append(names, theme)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := validateThemeName(backend, name); err != nil {
+			return fmt.Errorf("invalid %s theme %q: %w", backend, name, err)
+		}
+	}
+	return nil
+}
+
+func validateThemeName(backend, name string) error {
+	if name == "" {
+		return errors.New("it's empty")
+	}
+	if !utf8.ValidString(name) {
+		return errors.New("it isn't valid UTF-8")
+	}
+	if strings.IndexFunc(name, unicode.IsControl) >= 0 {
+		return errors.New("it contains control characters")
+	}
+
+	switch backend {
+	case "kitty", "helix":
+		// themes are looked up in, and derived ones written to, the themes
+		// directory as NAME.conf or NAME.toml.
+		if strings.ContainsAny(name, `/\`) || name == "." || name == ".." {
+			return errors.New("it can't be used as a file name")
+		}
+		// the themes kitten would parse it as an option.
+		if backend == "kitty" && strings.HasPrefix(name, "-") {
+			return errors.New("it starts with -")
+		}
+	case "neovim":
+		// | and " end the command, and the name is split on spaces.
+		if strings.ContainsAny(name, `|" `) {
+			return errors.New(`it contains |, " or spaces, which :colorscheme doesn't take`)
+		}
+	}
+	return nil
+}
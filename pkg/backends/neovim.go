@@ -0,0 +1,168 @@
+package backends
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/flokli/theme-switcher/pkg/switcher"
+	log "github.com/sirupsen/logrus"
+)
+
+// Neovim switches the colorscheme and 'background' of all running neovim
+// instances, via their RPC servers.
+type Neovim struct {
+	Themes switcher.Themes
+	// HighContrast, if set, are the themes used while high contrast is enabled.
+	HighContrast switcher.Themes
+}
+
+func (n *Neovim) Name() string { return "neovim" }
+
+func (n *Neovim) Theme(mode switcher.Mode) string { return n.Themes.For(mode) }
+
+func (n *Neovim) Events() []switcher.EventKind {
+	return append(contrastEvents(n.HighContrast), switcher.InstancesStarted)
+}
+
+// neovimPollInterval is how often WatchInstances looks for new servers. It
+// also gives new instances time to load their configuration, which would
+// set its colorscheme over the one switched to otherwise.
+const neovimPollInterval = 2 * time.Second
+
+func (n *Neovim) Detect(ctx context.Context) error {
+	if _, err := exec.LookPath("nvim"); err != nil {
+		return fmt.Errorf("nvim not found: %w", err)
+	}
+	return nil
+}
+
+// serverAddrs returns the addresses of the RPC servers neovim instances
+// listen on by default.
+func (n *Neovim) serverAddrs() ([]string, error) {
+	// named pipes on Windows can't be globbed, but the pipe namespace can be listed.
+	if runtime.GOOS == "windows" {
+		entries, err := os.ReadDir(`\\.\pipe\`)
+		if err != nil {
+			return nil, fmt.Errorf("unable to list named pipes: %w", err)
+		}
+		var addrs []string
+		for _, entry := range entries {
+			if strings.HasPrefix(entry.Name(), "nvim.") {
+				addrs = append(addrs, `\\.\pipe\`+entry.Name())
+			}
+		}
+		return addrs, nil
+	}
+
+	// neovim listens on $XDG_RUNTIME_DIR/nvim.PID.0, or in a per-user
+	// directory in $TMPDIR if that's not set.
+	patterns := []string{filepath.Join(os.TempDir(), "nvim.*", "*", "nvim.*")}
+	if runtimeDir := os.Getenv("XDG_RUNTIME_DIR"); runtimeDir != "" {
+		patterns = append(patterns, filepath.Join(runtimeDir, "nvim.*"))
+	}
+
+	var addrs []string
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, err
+		}
+		addrs = append(addrs, matches...)
+	}
+	return addrs, nil
+}
+
+// WatchInstances reports neovim instances started since it was called, by
+// looking for new RPC servers, as they only get the colorscheme from their
+// configuration.
+func (n *Neovim) WatchInstances(ctx context.Context) (<-chan struct{}, error) {
+	addrs, err := n.serverAddrs()
+	if err != nil {
+		return nil, err
+	}
+	known := make(map[string]bool, len(addrs))
+	for _, addr := range addrs {
+		known[addr] = true
+	}
+
+	started := make(chan struct{})
+	go func() {
+		defer close(started)
+		ticker := time.NewTicker(neovimPollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			addrs, err := n.serverAddrs()
+			if err != nil {
+				log.WithError(err).Debug("unable to look for new neovim instances")
+				continue
+			}
+			current := make(map[string]bool, len(addrs))
+			isNew := false
+			for _, addr := range addrs {
+				current[addr] = true
+				isNew = isNew || !known[addr]
+			}
+			// forget exited instances, as their addresses can be reused.
+			known = current
+			if !isNew {
+				continue
+			}
+			select {
+			case started <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return started, nil
+}
+
+// vimString quotes s as a literal string of vimscript, where only ' needs
+// escaping, by doubling it.
+func vimString(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// Apply sets 'background' and the colorscheme configured for mode in all running instances.
+func (n *Neovim) Apply(ctx context.Context, mode switcher.Mode) error {
+	addrs, err := n.serverAddrs()
+	if err != nil {
+		return err
+	}
+
+	cmdline := fmt.Sprintf("set background=%s | colorscheme %s", mode.Appearance(), themeFor(ctx, n.Themes, n.HighContrast, mode))
+	expr := fmt.Sprintf("execute(%s)", vimString(cmdline))
+
+	// keep switching the remaining instances if one fails.
+	var failed []string
+	for _, addr := range addrs {
+		log.WithField("addr", addr).Debug("switching neovim instance")
+
+		cmd, cancel := command(ctx, "nvim", "--server", addr, "--remote-expr", expr)
+		if dryRun(ctx, cmd) {
+			cancel()
+			continue
+		}
+		if out, err := cmd.CombinedOutput(); err != nil {
+			log.WithError(err).WithField("addr", addr).Warnf("unable to switch neovim instance: %s", strings.TrimSpace(string(out)))
+			failed = append(failed, addr)
+		}
+		cancel()
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("%d neovim instances failed: %s", len(failed), strings.Join(failed, ", "))
+	}
+	return nil
+}
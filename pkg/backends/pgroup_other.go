@@ -0,0 +1,18 @@
+//go:build !unix
+
+package backends
+
+import (
+	"os"
+	"os/exec"
+)
+
+// newProcessGroup does nothing, as there are no process groups in the unix
+// sense.
+func newProcessGroup(cmd *exec.Cmd) {}
+
+// killProcessGroup kills only p, as there are no process groups in the unix
+// sense.
+func killProcessGroup(p *os.Process) {
+	_ = p.Kill()
+}
@@ -0,0 +1,19 @@
+//go:build unix
+
+package backends
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// newProcessGroup has cmd start a process group of its own.
+func newProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// killProcessGroup kills the process group p started with newProcessGroup.
+func killProcessGroup(p *os.Process) {
+	_ = syscall.Kill(-p.Pid, syscall.SIGKILL)
+}
@@ -0,0 +1,131 @@
+package backends
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/flokli/theme-switcher/pkg/switcher"
+	log "github.com/sirupsen/logrus"
+)
+
+// DefaultPluginDir returns the default directory plugins are read from,
+// ~/.config/theme-switcher/backends.
+func DefaultPluginDir() (string, error) {
+	confDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("unable to determine user config dir: %w", err)
+	}
+	return filepath.Join(confDir, "theme-switcher", "backends"), nil
+}
+
+// Plugins returns a plugin for every executable in dir, sorted by name.
+// A missing dir contains no plugins.
+func Plugins(dir string) ([]*Plugin, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("unable to list plugins: %w", err)
+	}
+
+	var plugins []*Plugin
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+		// follow symlinks, and skip everything not executable.
+		fi, err := os.Stat(path)
+		if err != nil || !fi.Mode().IsRegular() || fi.Mode().Perm()&0o111 == 0 {
+			continue
+		}
+		plugins = append(plugins, &Plugin{Path: path})
+	}
+	sort.Slice(plugins, func(i, j int) bool { return plugins[i].Path < plugins[j].Path })
+
+	return plugins, nil
+}
+
+// PluginRequest is written to the stdin of a plugin, as a single line of JSON.
+type PluginRequest struct {
+	// Version is the version of the protocol, currently 1.
+	Version int `json:"version"`
+	// Command is "detect" or "apply".
+	Command string `json:"command"`
+	// Mode is the mode to switch to, for "apply".
+	Mode string `json:"mode,omitempty"`
+	// Appearance is the further appearance settings to apply, for "apply".
+	Appearance *switcher.Appearance `json:"appearance,omitempty"`
+}
+
+// PluginResponse is read back from the stdout of a plugin.
+type PluginResponse struct {
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+// Plugin is a backend implemented by an external executable.
+// For every detect and apply, it's run with a PluginRequest on stdin,
+// and is expected to answer with a PluginResponse on stdout, and exit.
+// Its name is the name of the executable, without extension.
+type Plugin struct {
+	Path string
+}
+
+func (p *Plugin) Name() string {
+	name := filepath.Base(p.Path)
+	return strings.TrimSuffix(name, filepath.Ext(name))
+}
+
+// Events returns the appearance events, as the plugin is passed the appearance.
+func (p *Plugin) Events() []switcher.EventKind { return switcher.AppearanceEvents }
+
+// call runs the plugin with req, and returns an error unless it reported success.
+func (p *Plugin) call(ctx context.Context, req PluginRequest) error {
+	req.Version = 1
+	in, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	var stdout bytes.Buffer
+	cmd, cancel := command(ctx, p.Path)
+	defer cancel()
+	cmd.Stdin = bytes.NewReader(append(in, '\n'))
+	cmd.Stdout = &stdout
+	cmd.Stderr = os.Stderr
+	runErr := cmd.Run()
+
+	var resp PluginResponse
+	if err := json.NewDecoder(&stdout).Decode(&resp); err != nil {
+		if runErr != nil {
+			return runErr
+		}
+		return fmt.Errorf("unable to parse plugin response: %w", err)
+	}
+	if !resp.OK {
+		if resp.Error == "" {
+			resp.Error = "plugin reported failure"
+		}
+		return errors.New(resp.Error)
+	}
+	return runErr
+}
+
+func (p *Plugin) Detect(ctx context.Context) error {
+	return p.call(ctx, PluginRequest{Command: "detect"})
+}
+
+func (p *Plugin) Apply(ctx context.Context, mode switcher.Mode) error {
+	if switcher.IsDryRun(ctx) {
+		log.Infof("would run plugin %s to apply %s", p.Path, mode)
+		return nil
+	}
+	appearance := switcher.AppearanceFrom(ctx)
+	return p.call(ctx, PluginRequest{Command: "apply", Mode: string(mode), Appearance: &appearance})
+}
@@ -0,0 +1,163 @@
+package backends
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/flokli/theme-switcher/pkg/palette"
+	"github.com/flokli/theme-switcher/pkg/switcher"
+)
+
+// Template renders a Go template (text/template) into a file, for
+// applications without a way to switch themes, but reading a config file.
+// After writing it, the Reload command runs, if set, so they pick it up.
+type Template struct {
+	BackendName string
+	// Source is the path of the template.
+	Source string
+	// Target is the path of the file to render the template into.
+	Target string
+	// Reload is the command to run after the target changed, if any.
+	Reload []string
+
+	// Palettes are the colors passed to the template in each mode.
+	Palettes palette.Palettes
+	// PaletteName is the name of the named palette Palettes are derived
+	// from, if any.
+	PaletteName string
+	// Named are all named palettes, by name.
+	Named map[string]palette.Palettes
+	// Themed are the other backends switching between named themes, by
+	// their name, to pass their themes to the template.
+	Themed map[string]switcher.Themed
+	// Chezmoi, if set, writes the files chezmoi manages through it.
+	Chezmoi *Chezmoi
+	// Backups, if set, saves a copy of files before modifying them.
+	Backups *Backups
+}
+
+// TemplateData is what templates are executed with.
+type TemplateData struct {
+	// Mode is "light", "dark" or "no-preference".
+	Mode switcher.Mode
+	// Dark is true in dark mode, to use with {{if .Dark}}.
+	Dark bool
+	// Themes are the themes of the backends in Mode, by backend name.
+	Themes map[string]string
+	// Colors are the palette colors of Mode, by name, like base00 with a
+	// base16 scheme.
+	Colors palette.Palette
+	// Palette holds the colors of light and dark mode, to use the ones of
+	// the other mode, like .Palette.Dark.base00.
+	Palette palette.Pair
+	// Palettes are all named palettes, by name, like
+	// .Palettes.gruvbox.Light.bg.
+	Palettes map[string]palette.Pair
+	// AccentColor, HighContrast and Wallpaper are the appearance settings
+	// reported by the source, if any.
+	AccentColor  string
+	HighContrast bool
+	Wallpaper    string
+}
+
+func (t *Template) Name() string { return t.BackendName }
+
+// Events returns the appearance events, as the template is passed the appearance.
+func (t *Template) Events() []switcher.EventKind { return switcher.AppearanceEvents }
+
+// Detect returns nil if the template exists.
+func (t *Template) Detect(ctx context.Context) error {
+	if t.Source == "" || t.Target == "" {
+		return errors.New("template and target need to be set")
+	}
+	if _, err := os.Stat(t.Source); err != nil {
+		return fmt.Errorf("unable to find template: %w", err)
+	}
+	if len(t.Reload) > 0 {
+		if _, err := exec.LookPath(t.Reload[0]); err != nil {
+			return fmt.Errorf("%s not found: %w", t.Reload[0], err)
+		}
+	}
+	return nil
+}
+
+// data returns the data to execute the template with in mode.
+func (t *Template) data(ctx context.Context, mode switcher.Mode) TemplateData {
+	appearance := switcher.AppearanceFrom(ctx)
+	data := TemplateData{
+		Mode:         mode,
+		Dark:         mode.Appearance() == switcher.Dark,
+		Themes:       make(map[string]string, len(t.Themed)),
+		Colors:       t.Palettes.For(mode),
+		Palette:      t.Palettes.Pair(t.PaletteName),
+		Palettes:     make(map[string]palette.Pair, len(t.Named)),
+		AccentColor:  appearance.AccentColor,
+		HighContrast: appearance.HighContrast,
+		Wallpaper:    appearance.Wallpaper,
+	}
+	for name, themed := range t.Themed {
+		data.Themes[name] = themed.Theme(mode)
+	}
+	for name, palettes := range t.Named {
+		data.Palettes[name] = palettes.Pair(name)
+	}
+	return data
+}
+
+// Apply renders the template for mode into the target, and runs the reload
+// command if that changed it.
+func (t *Template) Apply(ctx context.Context, mode switcher.Mode) error {
+	tmpl, err := template.New(filepath.Base(t.Source)).Funcs(palette.Funcs()).Option("missingkey=error").ParseFiles(t.Source)
+	if err != nil {
+		return fmt.Errorf("unable to parse template: %w", err)
+	}
+	var rendered bytes.Buffer
+	if err := tmpl.Execute(&rendered, t.data(ctx, mode)); err != nil {
+		return fmt.Errorf("unable to render template: %w", err)
+	}
+
+	old, err := os.ReadFile(t.Target)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("unable to read %s: %w", t.Target, err)
+	}
+	if bytes.Equal(old, rendered.Bytes()) {
+		return nil
+	}
+	if err := writeFile(ctx, t.Chezmoi, t.Backups, t.Target, old, rendered.Bytes(), 0o644); err != nil {
+		return fmt.Errorf("unable to write %s: %w", t.Target, err)
+	}
+
+	if len(t.Reload) == 0 {
+		return nil
+	}
+	cmd, cancel := command(ctx, t.Reload[0], t.Reload[1:]...)
+	defer cancel()
+	cmd.Env = append(os.Environ(), "THEME_SWITCHER_MODE="+string(mode))
+	if dryRun(ctx, cmd) {
+		return nil
+	}
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("unable to reload: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// Check returns an error if the template doesn't parse, or the target can't
+// be written.
+func (t *Template) Check(ctx context.Context) []error {
+	var errs []error
+	if _, err := template.New(filepath.Base(t.Source)).Funcs(palette.Funcs()).ParseFiles(t.Source); err != nil {
+		errs = append(errs, fmt.Errorf("unable to parse template: %w", err))
+	}
+	if err := checkWritable(t.Target); err != nil {
+		errs = append(errs, err)
+	}
+	return errs
+}
@@ -0,0 +1,213 @@
+package backends
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"github.com/flokli/theme-switcher/pkg/switcher"
+	log "github.com/sirupsen/logrus"
+)
+
+// WindowsTerminal switches the color scheme of Windows Terminal, by setting
+// profiles.defaults.colorScheme in its settings.json.
+// Windows Terminal reloads the file on its own when it changes.
+type WindowsTerminal struct {
+	Themes switcher.Themes
+	// HighContrast, if set, are the themes used while high contrast is enabled.
+	HighContrast switcher.Themes
+	// SettingsPath, if set, is the settings file to edit instead of the
+	// ones of the installed packages.
+	SettingsPath string
+	// Chezmoi, if set, writes the files chezmoi manages through it.
+	Chezmoi *Chezmoi
+	// Backups, if set, saves a copy of files before modifying them.
+	Backups *Backups
+}
+
+func (w *WindowsTerminal) Name() string { return "windows-terminal" }
+
+func (w *WindowsTerminal) Theme(mode switcher.Mode) string { return w.Themes.For(mode) }
+
+func (w *WindowsTerminal) Events() []switcher.EventKind { return contrastEvents(w.HighContrast) }
+
+// settingsPaths returns the paths of all existing Windows Terminal settings files,
+// for the stable and preview packages, and unpackaged installs, or SettingsPath
+// if set.
+func (w *WindowsTerminal) settingsPaths() ([]string, error) {
+	if w.SettingsPath != "" {
+		if _, err := os.Stat(w.SettingsPath); err != nil {
+			return nil, fmt.Errorf("unable to stat settings file %s: %w", w.SettingsPath, err)
+		}
+		return []string{w.SettingsPath}, nil
+	}
+	if runtime.GOOS != "windows" {
+		return nil, errors.New("only supported on Windows")
+	}
+
+	localAppData := os.Getenv("LOCALAPPDATA")
+	if localAppData == "" {
+		return nil, errors.New("LOCALAPPDATA not set")
+	}
+
+	var paths []string
+	for _, p := range []string{
+		filepath.Join(localAppData, "Packages", "Microsoft.WindowsTerminal_8wekyb3d8bbwe", "LocalState", "settings.json"),
+		filepath.Join(localAppData, "Packages", "Microsoft.WindowsTerminalPreview_8wekyb3d8bbwe", "LocalState", "settings.json"),
+		filepath.Join(localAppData, "Microsoft", "Windows Terminal", "settings.json"),
+	} {
+		if _, err := os.Stat(p); err == nil {
+			paths = append(paths, p)
+		}
+	}
+	if len(paths) == 0 {
+		return nil, errors.New("no settings.json found")
+	}
+	return paths, nil
+}
+
+func (w *WindowsTerminal) Detect(ctx context.Context) error {
+	_, err := w.settingsPaths()
+	return err
+}
+
+// Apply sets the color scheme configured for mode in all settings files.
+// Only the value itself is replaced, to leave the rest of the file untouched.
+func (w *WindowsTerminal) Apply(ctx context.Context, mode switcher.Mode) error {
+	paths, err := w.settingsPaths()
+	if err != nil {
+		return err
+	}
+
+	for _, p := range paths {
+		log.WithField("path", p).Debug("updating windows terminal settings")
+
+		fi, err := os.Stat(p)
+		if err != nil {
+			return fmt.Errorf("unable to stat %s: %w", p, err)
+		}
+		old, err := os.ReadFile(p)
+		if err != nil {
+			return fmt.Errorf("unable to read %s: %w", p, err)
+		}
+
+		data, err := setJSONString(old, []string{"profiles", "defaults", "colorScheme"}, themeFor(ctx, w.Themes, w.HighContrast, mode))
+		if err != nil {
+			return fmt.Errorf("unable to update %s: %w", p, err)
+		}
+
+		if err := writeFile(ctx, w.Chezmoi, w.Backups, p, old, data, fi.Mode().Perm()); err != nil {
+			return fmt.Errorf("unable to write back %s: %w", p, err)
+		}
+	}
+	return nil
+}
+
+// setJSONString sets the string at path in the JSON document data to value.
+// The key is inserted into its parent object if missing, which needs to exist.
+// Everything but the value is left as-is.
+func setJSONString(data []byte, path []string, value string) ([]byte, error) {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	// frame is an object or array we're in.
+	type frame struct {
+		isObject bool
+		// key is the most recently read key, and expectKey is set if the next
+		// string token is a key.
+		key       string
+		expectKey bool
+		// matched is set if this object is at path[:depth].
+		matched bool
+		// open is the offset right after the opening delimiter, and empty is
+		// set as long as no members were read.
+		open  int64
+		empty bool
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	var stack []*frame
+	for {
+		start := dec.InputOffset()
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse JSON (comments aren't supported): %w", err)
+		}
+
+		var parent *frame
+		if len(stack) > 0 {
+			parent = stack[len(stack)-1]
+		}
+
+		// handle keys
+		if parent != nil && parent.isObject && parent.expectKey {
+			if delim, ok := tok.(json.Delim); !ok || delim != '}' {
+				parent.key = tok.(string)
+				parent.expectKey = false
+				parent.empty = false
+				continue
+			}
+		}
+
+		// whether this value is at a prefix of path.
+		depth := len(stack)
+		atPath := depth > 0 && depth <= len(path) && parent.matched && parent.isObject && parent.key == path[depth-1]
+
+		switch tok {
+		case json.Delim('{'), json.Delim('['):
+			stack = append(stack, &frame{
+				isObject:  tok == json.Delim('{'),
+				expectKey: tok == json.Delim('{'),
+				matched:   depth == 0 || atPath,
+				open:      dec.InputOffset(),
+				empty:     true,
+			})
+			continue
+		case json.Delim('}'), json.Delim(']'):
+			stack = stack[:len(stack)-1]
+			// insert the key if the parent object didn't contain it.
+			if tok == json.Delim('}') && parent.matched && depth == len(path) {
+				member := append([]byte(fmt.Sprintf("%q: ", path[len(path)-1])), encoded...)
+				if !parent.empty {
+					member = append(member, ',')
+				}
+				return splice(data, parent.open, parent.open, member), nil
+			}
+		default:
+			if atPath && depth == len(path) {
+				if _, ok := tok.(string); !ok {
+					return nil, fmt.Errorf("%v is not a string", path)
+				}
+				// start is the end of the previous token, skip the separator.
+				valueStart := start + int64(bytes.IndexByte(data[start:], '"'))
+				return splice(data, valueStart, dec.InputOffset(), encoded), nil
+			}
+		}
+
+		// the next token in an object is a key again.
+		if len(stack) > 0 && stack[len(stack)-1].isObject {
+			stack[len(stack)-1].expectKey = true
+		}
+	}
+
+	return nil, fmt.Errorf("%v not found", path[:len(path)-1])
+}
+
+// splice replaces data[start:end] with s.
+func splice(data []byte, start, end int64, s []byte) []byte {
+	out := make([]byte, 0, int64(len(data))-(end-start)+int64(len(s)))
+	out = append(out, data[:start]...)
+	out = append(out, s...)
+	return append(out, data[end:]...)
+}
@@ -0,0 +1,37 @@
+package backends
+
+import (
+	"context"
+
+	"github.com/flokli/theme-switcher/internal/xfconf"
+	"github.com/flokli/theme-switcher/pkg/switcher"
+	log "github.com/sirupsen/logrus"
+)
+
+// Xfce switches the GTK theme configured in Xfce, which xfsettingsd applies
+// to all running GTK applications.
+type Xfce struct {
+	Themes switcher.Themes
+	// HighContrast, if set, are the themes used while high contrast is enabled.
+	HighContrast switcher.Themes
+}
+
+func (x *Xfce) Name() string { return "xfce" }
+
+func (x *Xfce) Theme(mode switcher.Mode) string { return x.Themes.For(mode) }
+
+func (x *Xfce) Events() []switcher.EventKind { return contrastEvents(x.HighContrast) }
+
+func (x *Xfce) Detect(ctx context.Context) error {
+	return xfconf.Available(ctx)
+}
+
+// Apply sets the GTK theme configured for mode.
+func (x *Xfce) Apply(ctx context.Context, mode switcher.Mode) error {
+	theme := themeFor(ctx, x.Themes, x.HighContrast, mode)
+	if switcher.IsDryRun(ctx) {
+		log.Infof("would set %s %s to %s", xfconf.XSettingsChannel, xfconf.ThemeNameProperty, theme)
+		return nil
+	}
+	return xfconf.SetString(ctx, xfconf.XSettingsChannel, xfconf.ThemeNameProperty, theme)
+}
@@ -0,0 +1,108 @@
+// Package control exposes a running switcher.Daemon to other programs.
+package control
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/flokli/theme-switcher/pkg/switcher"
+	"github.com/godbus/dbus/v5"
+	"github.com/godbus/dbus/v5/introspect"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	DBusName      = "org.flokli.ThemeSwitcher"
+	DBusInterface = "org.flokli.ThemeSwitcher"
+	DBusPath      = dbus.ObjectPath("/org/flokli/ThemeSwitcher")
+)
+
+const dbusIntrospection = `
+<node>
+	<interface name="` + DBusInterface + `">
+		<method name="SetMode">
+			<arg name="mode" direction="in" type="s"/>
+		</method>
+		<method name="Toggle">
+			<arg name="mode" direction="out" type="s"/>
+		</method>
+		<method name="GetMode">
+			<arg name="mode" direction="out" type="s"/>
+		</method>
+		<signal name="ModeChanged">
+			<arg name="mode" type="s"/>
+		</signal>
+	</interface>` + introspect.IntrospectDataString + `</node>`
+
+// dbusService implements the methods of the D-Bus interface.
+type dbusService struct {
+	ctx    context.Context
+	daemon *switcher.Daemon
+}
+
+func (s *dbusService) SetMode(mode string) *dbus.Error {
+	m, err := switcher.ParseMode(mode)
+	if err != nil {
+		return dbus.MakeFailedError(err)
+	}
+	if err := s.daemon.SetMode(s.ctx, m); err != nil {
+		return dbus.MakeFailedError(err)
+	}
+	return nil
+}
+
+func (s *dbusService) Toggle() (string, *dbus.Error) {
+	mode, err := s.daemon.Toggle(s.ctx)
+	if err != nil {
+		return "", dbus.MakeFailedError(err)
+	}
+	return string(mode), nil
+}
+
+func (s *dbusService) GetMode() (string, *dbus.Error) {
+	mode := s.daemon.Mode()
+	if mode == "" {
+		return "", dbus.MakeFailedError(fmt.Errorf("current mode not known yet"))
+	}
+	return string(mode), nil
+}
+
+// ServeDBus publishes the org.flokli.ThemeSwitcher service on the session bus,
+// and emits ModeChanged whenever the daemon applies a new mode, until ctx is done.
+func ServeDBus(ctx context.Context, daemon *switcher.Daemon) error {
+	conn, err := dbus.ConnectSessionBus(dbus.WithContext(ctx))
+	if err != nil {
+		return fmt.Errorf("unable to connect to session bus: %w", err)
+	}
+	defer conn.Close()
+
+	svc := &dbusService{ctx: ctx, daemon: daemon}
+	if err := conn.Export(svc, DBusPath, DBusInterface); err != nil {
+		return fmt.Errorf("unable to export service: %w", err)
+	}
+	if err := conn.Export(introspect.Introspectable(dbusIntrospection), DBusPath, "org.freedesktop.DBus.Introspectable"); err != nil {
+		return fmt.Errorf("unable to export introspection: %w", err)
+	}
+
+	reply, err := conn.RequestName(DBusName, dbus.NameFlagDoNotQueue)
+	if err != nil {
+		return fmt.Errorf("unable to request name %s: %w", DBusName, err)
+	}
+	if reply != dbus.RequestNameReplyPrimaryOwner {
+		return fmt.Errorf("name %s already taken", DBusName)
+	}
+
+	events, unsubscribe := daemon.Subscribe(switcher.ColorSchemeChanged)
+	defer unsubscribe()
+
+	for {
+		select {
+		case event := <-events:
+			if err := conn.Emit(DBusPath, DBusInterface+".ModeChanged", string(event.Mode)); err != nil {
+				log.WithError(err).Warn("unable to emit ModeChanged signal")
+			}
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
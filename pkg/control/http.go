@@ -0,0 +1,208 @@
+package control
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/flokli/theme-switcher/pkg/switcher"
+	log "github.com/sirupsen/logrus"
+)
+
+// ServeHTTP serves a REST API on addr, which is either host:port, or
+// unix:PATH for a unix socket, until ctx is done.
+//
+//	GET  /status   returns a Response
+//	POST /mode     sets the mode, taking a Request with mode and for
+//	POST /toggle   toggles the mode
+//	POST /reapply  re-applies the current mode
+//	GET  /events   streams an Event whenever a new mode was applied, as server-sent events
+//
+// POST requests need to have a JSON body, so browsers can't send them from
+// other sites without asking first.
+//
+// If token is set, requests need to send it as Authorization: Bearer TOKEN.
+// Without one, only loopback addresses are served, and only requests for
+// localhost, so pages of other sites resolving to 127.0.0.1 (DNS rebinding)
+// can't use it either.
+func ServeHTTP(ctx context.Context, daemon *switcher.Daemon, addr, token string) error {
+	var l net.Listener
+	var err error
+	isUnix := strings.HasPrefix(addr, "unix:")
+	if isUnix {
+		path := strings.TrimPrefix(addr, "unix:")
+		// remove a stale socket from a previous run, unless someone's still listening on it.
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			return fmt.Errorf("%s is already in use", path)
+		}
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("unable to remove stale socket: %w", err)
+		}
+		l, err = net.Listen("unix", path)
+	} else {
+		if token == "" && !isLoopbackAddr(addr) {
+			return fmt.Errorf("refusing to serve on %s without a token, as anyone reaching it could control the daemon", addr)
+		}
+		l, err = net.Listen("tcp", addr)
+	}
+	if err != nil {
+		return fmt.Errorf("unable to listen on %s: %w", addr, err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", httpHandler(ctx, daemon, http.MethodGet, "status"))
+	mux.HandleFunc("/mode", httpHandler(ctx, daemon, http.MethodPost, "set"))
+	mux.HandleFunc("/toggle", httpHandler(ctx, daemon, http.MethodPost, "toggle"))
+	mux.HandleFunc("/reapply", httpHandler(ctx, daemon, http.MethodPost, "reapply"))
+	mux.HandleFunc("/events", func(w http.ResponseWriter, r *http.Request) {
+		handleEvents(ctx, daemon, w, r)
+	})
+
+	srv := &http.Server{Handler: authorize(mux, token, !isUnix), ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		// event streams only end with ctx, so don't wait for them.
+		srv.Close()
+	}()
+
+	if err := srv.Serve(l); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// isLoopbackAddr returns whether addr, as host:port, is only reachable from
+// this machine.
+func isLoopbackAddr(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	return err == nil && isLoopbackHost(host)
+}
+
+func isLoopbackHost(host string) bool {
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// authorize only lets requests through to next that send token, or, without
+// one, if checkHost is set, that are for a loopback host.
+func authorize(next http.Handler, token string, checkHost bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token != "" {
+			got := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				writeJSON(w, http.StatusUnauthorized, Response{Error: "missing or wrong token"})
+				return
+			}
+		} else if checkHost {
+			host := r.Host
+			if h, _, err := net.SplitHostPort(host); err == nil {
+				host = h
+			}
+			if !isLoopbackHost(strings.Trim(host, "[]")) {
+				writeJSON(w, http.StatusForbidden, Response{Error: "only requests for localhost are served"})
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// httpHandler returns a handler executing command for requests with the given method.
+func httpHandler(ctx context.Context, daemon *switcher.Daemon, method, command string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != method {
+			w.Header().Set("Allow", method)
+			writeJSON(w, http.StatusMethodNotAllowed, Response{Error: "method not allowed"})
+			return
+		}
+
+		var req Request
+		if method == http.MethodPost {
+			if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != "application/json" {
+				writeJSON(w, http.StatusUnsupportedMediaType, Response{Error: "expected application/json"})
+				return
+			}
+			// an empty body is fine for commands without arguments.
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+				writeJSON(w, http.StatusBadRequest, Response{Error: fmt.Sprintf("invalid request: %v", err)})
+				return
+			}
+		}
+		req.Command = command
+
+		resp := handleRequest(ctx, daemon, req)
+		status := http.StatusOK
+		if !resp.OK {
+			status = http.StatusBadRequest
+		}
+		writeJSON(w, status, resp)
+	}
+}
+
+// writeJSON writes v as the response body.
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.WithError(err).Debug("unable to write HTTP response")
+	}
+}
+
+// handleEvents streams mode changes as server-sent events.
+func handleEvents(ctx context.Context, daemon *switcher.Daemon, w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		writeJSON(w, http.StatusMethodNotAllowed, Response{Error: "method not allowed"})
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeJSON(w, http.StatusInternalServerError, Response{Error: "streaming not supported"})
+		return
+	}
+
+	events, unsubscribe := daemon.Subscribe(switcher.ColorSchemeChanged)
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	// send the current mode first, so clients don't need to ask separately.
+	mode := daemon.Mode()
+	for {
+		if mode != "" {
+			data, err := json.Marshal(Event{Event: "mode-changed", Mode: string(mode)})
+			if err != nil {
+				return
+			}
+			if _, err := fmt.Fprintf(w, "event: mode-changed\ndata: %s\n\n", data); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+
+		select {
+		case event := <-events:
+			mode = event.Mode
+		case <-r.Context().Done():
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
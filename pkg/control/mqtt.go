@@ -0,0 +1,149 @@
+package control
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/flokli/theme-switcher/internal/mqtt"
+	"github.com/flokli/theme-switcher/pkg/switcher"
+	log "github.com/sirupsen/logrus"
+)
+
+// MQTTOptions configure the connection to an MQTT broker.
+type MQTTOptions struct {
+	// Broker is the URL of the broker, like tcp://localhost:1883 or tls://host:8883.
+	Broker   string
+	Username string
+	Password string
+	// Topic is the prefix of all topics used.
+	Topic string
+}
+
+const (
+	mqttKeepAlive         = 30 * time.Second
+	mqttMinReconnectDelay = time.Second
+	mqttMaxReconnectDelay = time.Minute
+)
+
+// ServeMQTT connects to an MQTT broker, and reconnects whenever the connection
+// is lost, until ctx is done.
+//
+// The applied mode is published (retained) to TOPIC/mode, and TOPIC/status is
+// "online" while connected, or "offline" otherwise. Messages sent to TOPIC/set
+// control the daemon: "light" or "dark" set the mode, "auto" clears an
+// override, "toggle" and "reapply" do what they say.
+func ServeMQTT(ctx context.Context, daemon *switcher.Daemon, opts MQTTOptions) error {
+	if opts.Topic == "" {
+		opts.Topic = "theme-switcher"
+	}
+	// no point in retrying.
+	if opts.Password != "" && opts.Username == "" {
+		return mqtt.ErrPasswordWithoutUsername
+	}
+
+	events, unsubscribe := daemon.Subscribe(switcher.ColorSchemeChanged)
+	defer unsubscribe()
+
+	delay := mqttMinReconnectDelay
+	for {
+		connected, err := serveMQTTConn(ctx, daemon, opts, events)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if connected {
+			delay = mqttMinReconnectDelay
+		}
+		log.WithError(err).Warnf("lost connection to MQTT broker, reconnecting in %s", delay)
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return nil
+		}
+		if delay *= 2; delay > mqttMaxReconnectDelay {
+			delay = mqttMaxReconnectDelay
+		}
+	}
+}
+
+// serveMQTTConn handles a single connection to the broker.
+// It returns whether it successfully connected.
+func serveMQTTConn(ctx context.Context, daemon *switcher.Daemon, opts MQTTOptions, events <-chan switcher.Event) (bool, error) {
+	hostname, _ := os.Hostname()
+	statusTopic := opts.Topic + "/status"
+
+	dialCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	client, err := mqtt.Dial(dialCtx, opts.Broker, mqtt.Options{
+		ClientID:  fmt.Sprintf("theme-switcher-%s-%d", hostname, os.Getpid()),
+		Username:  opts.Username,
+		Password:  opts.Password,
+		KeepAlive: mqttKeepAlive,
+		Will:      &mqtt.Message{Topic: statusTopic, Payload: []byte("offline"), Retain: true},
+	})
+	if err != nil {
+		return false, err
+	}
+	defer func() {
+		// the will isn't published on a clean disconnect.
+		_ = client.Publish(mqtt.Message{Topic: statusTopic, Payload: []byte("offline"), Retain: true})
+		client.Close()
+	}()
+	log.WithField("broker", opts.Broker).Info("connected to MQTT broker")
+
+	if err := client.Subscribe(opts.Topic + "/set"); err != nil {
+		return true, err
+	}
+	if err := client.Publish(mqtt.Message{Topic: statusTopic, Payload: []byte("online"), Retain: true}); err != nil {
+		return true, err
+	}
+
+	ctx, cancel = context.WithCancel(ctx)
+	defer cancel()
+
+	// publish the current mode, and every change.
+	errs := make(chan error, 2)
+	go func() {
+		mode := daemon.Mode()
+		for {
+			if mode != "" {
+				if err := client.Publish(mqtt.Message{Topic: opts.Topic + "/mode", Payload: []byte(mode), Retain: true}); err != nil {
+					errs <- err
+					return
+				}
+			}
+			select {
+			case event := <-events:
+				mode = event.Mode
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	go func() {
+		errs <- client.Run(ctx, mqttKeepAlive, func(msg mqtt.Message) {
+			handleMQTTCommand(ctx, daemon, strings.TrimSpace(string(msg.Payload)))
+		})
+	}()
+
+	return true, <-errs
+}
+
+// handleMQTTCommand executes a message sent to the set topic.
+func handleMQTTCommand(ctx context.Context, daemon *switcher.Daemon, command string) {
+	var req Request
+	switch command {
+	case "toggle", "reapply":
+		req = Request{Command: command}
+	default:
+		req = Request{Command: "set", Mode: command}
+	}
+
+	if resp := handleRequest(ctx, daemon, req); !resp.OK {
+		log.WithField("command", command).Warnf("unable to handle MQTT command: %s", resp.Error)
+	}
+}
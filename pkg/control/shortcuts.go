@@ -0,0 +1,164 @@
+package control
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+
+	"github.com/flokli/theme-switcher/pkg/switcher"
+	"github.com/godbus/dbus/v5"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	portalBusName                  = "org.freedesktop.portal.Desktop"
+	portalObjectPath               = dbus.ObjectPath("/org/freedesktop/portal/desktop")
+	portalRequestInterface         = "org.freedesktop.portal.Request"
+	portalSessionInterface         = "org.freedesktop.portal.Session"
+	portalGlobalShortcutsInterface = "org.freedesktop.portal.GlobalShortcuts"
+
+	// toggleShortcut is the id of the shortcut toggling the mode.
+	toggleShortcut = "toggle"
+)
+
+// portalShortcut is a shortcut to bind, as passed to BindShortcuts.
+type portalShortcut struct {
+	ID      string
+	Options map[string]dbus.Variant
+}
+
+// ServeShortcuts registers a global shortcut toggling the mode through the
+// GlobalShortcuts portal, so it works the same on all desktops implementing it.
+// trigger is suggested to the desktop (like "CTRL+ALT+t"), which lets the user
+// choose the one to use. Activations are handled until ctx is done.
+func ServeShortcuts(ctx context.Context, daemon *switcher.Daemon, trigger string) error {
+	conn, err := dbus.ConnectSessionBus(dbus.WithContext(ctx))
+	if err != nil {
+		return fmt.Errorf("unable to connect to session bus: %w", err)
+	}
+	defer conn.Close()
+
+	// subscribe before calling anything, so no response is missed.
+	for _, iface := range []string{portalRequestInterface, portalGlobalShortcutsInterface} {
+		if err := conn.AddMatchSignalContext(ctx, dbus.WithMatchInterface(iface)); err != nil {
+			return fmt.Errorf("unable to subscribe to portal signals: %w", err)
+		}
+	}
+	signals := make(chan *dbus.Signal, 16)
+	conn.Signal(signals)
+
+	portal := conn.Object(portalBusName, portalObjectPath)
+
+	results, err := portalRequest(ctx, conn, signals, portal, portalGlobalShortcutsInterface+".CreateSession", map[string]dbus.Variant{
+		"session_handle_token": dbus.MakeVariant(portalToken("session")),
+	})
+	if err != nil {
+		return fmt.Errorf("unable to create global shortcuts session: %w", err)
+	}
+	var session dbus.ObjectPath
+	if v, ok := results["session_handle"]; ok {
+		// it's a string in older versions of the portal, and an object path in newer ones.
+		var s string
+		if v.Store(&s) == nil {
+			session = dbus.ObjectPath(s)
+		} else if err := v.Store(&session); err != nil {
+			return fmt.Errorf("unexpected session handle %s: %w", v, err)
+		}
+	}
+	if !session.IsValid() {
+		return errors.New("no global shortcuts session created")
+	}
+	defer conn.Object(portalBusName, session).Call(portalSessionInterface+".Close", 0)
+
+	options := map[string]dbus.Variant{"description": dbus.MakeVariant("Toggle between light and dark mode")}
+	if trigger != "" {
+		options["preferred_trigger"] = dbus.MakeVariant(trigger)
+	}
+	if _, err := portalRequest(ctx, conn, signals, portal, portalGlobalShortcutsInterface+".BindShortcuts", nil,
+		session, []portalShortcut{{ID: toggleShortcut, Options: options}}, ""); err != nil {
+		return fmt.Errorf("unable to bind global shortcut: %w", err)
+	}
+	log.Info("registered global shortcut")
+
+	for {
+		select {
+		case sig, ok := <-signals:
+			if !ok {
+				return errors.New("lost connection to session bus")
+			}
+			if sig.Name != portalGlobalShortcutsInterface+".Activated" || len(sig.Body) < 2 {
+				continue
+			}
+			var sigSession dbus.ObjectPath
+			var id string
+			if dbus.Store(sig.Body[:2], &sigSession, &id) != nil || sigSession != session || id != toggleShortcut {
+				continue
+			}
+			mode, err := daemon.Toggle(ctx)
+			if err != nil {
+				log.WithError(err).Warn("unable to toggle mode")
+				continue
+			}
+			log.Infof("toggled to %s mode by global shortcut", mode)
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// portalToken returns a token to identify a portal request or session by.
+// It only needs to be unique for this connection.
+func portalToken(kind string) string {
+	return fmt.Sprintf("theme_switcher_%s%d", kind, portalTokens.Add(1))
+}
+
+var portalTokens atomic.Uint32
+
+// portalRequest calls method of the portal, with options (plus a
+// handle_token) as its last argument following args, and waits for the
+// response of the resulting request, returning its results.
+func portalRequest(ctx context.Context, conn *dbus.Conn, signals <-chan *dbus.Signal, portal dbus.BusObject, method string, options map[string]dbus.Variant, args ...interface{}) (map[string]dbus.Variant, error) {
+	if options == nil {
+		options = map[string]dbus.Variant{}
+	}
+	token := portalToken("request")
+	options["handle_token"] = dbus.MakeVariant(token)
+
+	// the request path is known upfront, the response might arrive before the reply.
+	sender := strings.ReplaceAll(strings.TrimPrefix(conn.Names()[0], ":"), ".", "_")
+	predicted := portalObjectPath + "/request/" + dbus.ObjectPath(sender+"/"+token)
+
+	// older portals don't use the predicted path, though.
+	var handle dbus.ObjectPath
+	if err := portal.CallWithContext(ctx, method, 0, append(args, options)...).Store(&handle); err != nil {
+		return nil, err
+	}
+	for {
+		select {
+		case sig, ok := <-signals:
+			if !ok {
+				return nil, errors.New("lost connection to session bus")
+			}
+			if sig.Name != portalRequestInterface+".Response" || (sig.Path != predicted && sig.Path != handle) {
+				continue
+			}
+			var response uint32
+			var results map[string]dbus.Variant
+			if err := dbus.Store(sig.Body, &response, &results); err != nil {
+				return nil, fmt.Errorf("unexpected response: %w", err)
+			}
+			switch response {
+			case 0:
+				return results, nil
+			case 1:
+				return nil, errors.New("cancelled by the user")
+			default:
+				return nil, errors.New("request failed")
+			}
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
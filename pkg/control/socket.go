@@ -0,0 +1,246 @@
+package control
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/flokli/theme-switcher/internal/lines"
+	"github.com/flokli/theme-switcher/pkg/switcher"
+	log "github.com/sirupsen/logrus"
+)
+
+// Request is a command sent to the control socket, as a single line of JSON.
+type Request struct {
+	// Command is one of "set", "toggle", "status", "reapply" or "subscribe".
+	Command string `json:"command"`
+	// Mode is the mode to switch to, for "set".
+	// "auto" clears any override, and follows the source again.
+	Mode string `json:"mode,omitempty"`
+	// For overrides the mode for the given duration (like "2h") for "set",
+	// ignoring changes of the source in the meantime.
+	For string `json:"for,omitempty"`
+}
+
+// Response is sent back for every request, as a single line of JSON.
+// After a "subscribe" request, an Event line follows for every change.
+type Response struct {
+	OK     bool   `json:"ok"`
+	Error  string `json:"error,omitempty"`
+	Mode   string `json:"mode,omitempty"`
+	Source string `json:"source,omitempty"`
+	// OverrideUntil is set while the mode is overridden.
+	OverrideUntil *time.Time `json:"override_until,omitempty"`
+	// AccentColor, HighContrast and Wallpaper are the appearance settings applied last.
+	AccentColor  string `json:"accent_color,omitempty"`
+	HighContrast bool   `json:"high_contrast,omitempty"`
+	Wallpaper    string `json:"wallpaper,omitempty"`
+}
+
+// Event is sent to subscribed clients whenever a new mode was applied.
+type Event struct {
+	Event string `json:"event"`
+	Mode  string `json:"mode"`
+}
+
+// SocketPath returns the default path of the control socket.
+func SocketPath() (string, error) {
+	runtimeDir := os.Getenv("XDG_RUNTIME_DIR")
+	if runtimeDir == "" {
+		// macOS and Windows have no XDG_RUNTIME_DIR, but a per-user temp dir.
+		if runtime.GOOS != "darwin" && runtime.GOOS != "windows" {
+			return "", errors.New("XDG_RUNTIME_DIR not set")
+		}
+		runtimeDir = os.TempDir()
+	}
+	return filepath.Join(runtimeDir, "theme-switcher.sock"), nil
+}
+
+// ServeSocket listens on a unix socket at path, and handles requests
+// until ctx is done.
+func ServeSocket(ctx context.Context, daemon *switcher.Daemon, path string) error {
+	// remove a stale socket from a previous run, unless someone's still listening on it.
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		return fmt.Errorf("%s is already in use", path)
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("unable to remove stale socket: %w", err)
+	}
+
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return fmt.Errorf("unable to listen on %s: %w", path, err)
+	}
+	defer l.Close()
+
+	go func() {
+		<-ctx.Done()
+		l.Close()
+	}()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("unable to accept connection: %w", err)
+		}
+		go handleSocketConn(ctx, daemon, conn)
+	}
+}
+
+// handleSocketConn handles requests from a single client.
+func handleSocketConn(ctx context.Context, daemon *switcher.Daemon, conn net.Conn) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// close the connection once we're done, also to unblock reads on shutdown.
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+
+	// responses and events are written from multiple goroutines.
+	var mu sync.Mutex
+	enc := json.NewEncoder(conn)
+	send := func(v interface{}) {
+		mu.Lock()
+		defer mu.Unlock()
+		if err := enc.Encode(v); err != nil {
+			log.WithError(err).Debug("unable to write to control socket client")
+			cancel()
+		}
+	}
+
+	subscribed := false
+	reader := lines.NewReader(conn, lines.MaxLength)
+	for {
+		line, err := reader.Read()
+		if errors.Is(err, lines.ErrTooLong) {
+			send(Response{Error: fmt.Sprintf("request longer than %d bytes", lines.MaxLength)})
+			continue
+		} else if err != nil {
+			return
+		}
+		var req Request
+		if err := json.Unmarshal(line, &req); err != nil {
+			send(Response{Error: fmt.Sprintf("invalid request: %v", err)})
+			continue
+		}
+
+		if req.Command == "subscribe" && !subscribed {
+			subscribed = true
+			events, unsubscribe := daemon.Subscribe(switcher.ColorSchemeChanged)
+			go func() {
+				defer unsubscribe()
+				for {
+					select {
+					case event := <-events:
+						send(Event{Event: "mode-changed", Mode: string(event.Mode)})
+					case <-ctx.Done():
+						return
+					}
+				}
+			}()
+		}
+
+		send(handleRequest(ctx, daemon, req))
+	}
+}
+
+// handleRequest executes a single request.
+func handleRequest(ctx context.Context, daemon *switcher.Daemon, req Request) Response {
+	// set and toggle are applied asynchronously, so report the requested mode.
+	mode := daemon.Mode()
+	var err error
+	switch req.Command {
+	case "set":
+		err = handleSet(ctx, daemon, req)
+		mode = switcher.Mode(req.Mode)
+	case "toggle":
+		mode, err = daemon.Toggle(ctx)
+	case "reapply":
+		err = daemon.Reapply(ctx)
+	case "status", "subscribe":
+	default:
+		err = fmt.Errorf("unknown command: %s", req.Command)
+	}
+	if err != nil {
+		return Response{Error: err.Error()}
+	}
+
+	appearance := daemon.Appearance()
+	resp := Response{
+		OK:           true,
+		Mode:         string(mode),
+		Source:       daemon.Source.Name(),
+		AccentColor:  appearance.AccentColor,
+		HighContrast: appearance.HighContrast,
+		Wallpaper:    appearance.Wallpaper,
+	}
+	if until := daemon.OverrideUntil(); !until.IsZero() {
+		resp.OverrideUntil = &until
+	}
+	return resp
+}
+
+// handleSet executes a "set" request.
+func handleSet(ctx context.Context, daemon *switcher.Daemon, req Request) error {
+	if req.Mode == "auto" {
+		return daemon.ClearOverride(ctx)
+	}
+
+	mode, err := switcher.ParseMode(req.Mode)
+	if err != nil {
+		return err
+	}
+
+	if req.For == "" {
+		return daemon.SetMode(ctx, mode)
+	}
+	duration, err := time.ParseDuration(req.For)
+	if err != nil {
+		return fmt.Errorf("invalid duration: %w", err)
+	}
+	return daemon.Override(ctx, mode, duration)
+}
+
+// ErrNotRunning is returned by Call if no daemon is listening on the socket.
+var ErrNotRunning = errors.New("daemon not running")
+
+// Call sends a single request to the control socket at path,
+// and returns the response.
+func Call(ctx context.Context, path string, req Request) (*Response, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrNotRunning, err)
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return nil, fmt.Errorf("unable to send request: %w", err)
+	}
+
+	var resp Response
+	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		return nil, fmt.Errorf("unable to read response: %w", err)
+	}
+	if !resp.OK {
+		return &resp, errors.New(resp.Error)
+	}
+	return &resp, nil
+}
@@ -0,0 +1,358 @@
+package control
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/flokli/theme-switcher/pkg/switcher"
+	"github.com/godbus/dbus/v5"
+	"github.com/godbus/dbus/v5/introspect"
+	"github.com/godbus/dbus/v5/prop"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	sniWatcherName      = "org.kde.StatusNotifierWatcher"
+	sniWatcherPath      = dbus.ObjectPath("/StatusNotifierWatcher")
+	sniWatcherInterface = "org.kde.StatusNotifierWatcher"
+	sniInterface        = "org.kde.StatusNotifierItem"
+	sniPath             = dbus.ObjectPath("/StatusNotifierItem")
+
+	dbusMenuInterface = "com.canonical.dbusmenu"
+	dbusMenuPath      = dbus.ObjectPath("/MenuBar")
+)
+
+// ids of the tray menu entries, 0 is the root.
+const (
+	trayMenuLight int32 = iota + 1
+	trayMenuDark
+	trayMenuAuto
+	trayMenuSeparator
+	trayMenuReapply
+)
+
+// trayIcon returns the (freedesktop) icon name shown in mode.
+func trayIcon(mode switcher.Mode) string {
+	switch mode.Base() {
+	case switcher.Light:
+		return "weather-clear"
+	case switcher.Dark:
+		return "weather-clear-night"
+	default:
+		return "weather-few-clouds"
+	}
+}
+
+// trayToolTip is the ToolTip property of a StatusNotifierItem.
+type trayToolTip struct {
+	IconName string
+	Pixmaps  []struct {
+		Width, Height int32
+		Data          []byte
+	}
+	Title string
+	Text  string
+}
+
+// trayMenuItem is an item in the layout of a com.canonical.dbusmenu menu.
+type trayMenuItem struct {
+	ID         int32
+	Properties map[string]dbus.Variant
+	Children   []dbus.Variant
+}
+
+// trayMenuItemProperties are the properties of a menu item, by id.
+type trayMenuItemProperties struct {
+	ID         int32
+	Properties map[string]dbus.Variant
+}
+
+// trayItem implements the methods of the StatusNotifierItem interface.
+type trayItem struct {
+	ctx    context.Context
+	daemon *switcher.Daemon
+}
+
+// Activate toggles the mode on clicking the icon.
+func (t *trayItem) Activate(x, y int32) *dbus.Error {
+	if _, err := t.daemon.Toggle(t.ctx); err != nil {
+		return dbus.MakeFailedError(err)
+	}
+	return nil
+}
+
+func (t *trayItem) SecondaryActivate(x, y int32) *dbus.Error           { return nil }
+func (t *trayItem) ContextMenu(x, y int32) *dbus.Error                 { return nil }
+func (t *trayItem) Scroll(delta int32, orientation string) *dbus.Error { return nil }
+
+// trayMenu implements the methods of the com.canonical.dbusmenu interface.
+type trayMenu struct {
+	ctx    context.Context
+	daemon *switcher.Daemon
+
+	mu       sync.Mutex
+	revision uint32
+}
+
+// items returns the entries of the menu, for the current mode.
+func (m *trayMenu) items() []trayMenuItem {
+	mode := m.daemon.Mode()
+	radio := func(id int32, label string, checked bool) trayMenuItem {
+		state := int32(0)
+		if checked {
+			state = 1
+		}
+		return trayMenuItem{ID: id, Properties: map[string]dbus.Variant{
+			"label":        dbus.MakeVariant(label),
+			"toggle-type":  dbus.MakeVariant("radio"),
+			"toggle-state": dbus.MakeVariant(state),
+		}, Children: []dbus.Variant{}}
+	}
+	return []trayMenuItem{
+		radio(trayMenuLight, "Light", mode == switcher.Light),
+		radio(trayMenuDark, "Dark", mode == switcher.Dark),
+		{ID: trayMenuAuto, Properties: map[string]dbus.Variant{
+			"label": dbus.MakeVariant("Automatic (" + m.daemon.Source.Name() + ")"),
+		}, Children: []dbus.Variant{}},
+		{ID: trayMenuSeparator, Properties: map[string]dbus.Variant{
+			"type": dbus.MakeVariant("separator"),
+		}, Children: []dbus.Variant{}},
+		{ID: trayMenuReapply, Properties: map[string]dbus.Variant{
+			"label": dbus.MakeVariant("Re-apply"),
+		}, Children: []dbus.Variant{}},
+	}
+}
+
+// changed bumps the revision of the layout, and returns it.
+func (m *trayMenu) changed() uint32 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.revision++
+	return m.revision
+}
+
+func (m *trayMenu) GetLayout(parentID, recursionDepth int32, propertyNames []string) (uint32, trayMenuItem, *dbus.Error) {
+	m.mu.Lock()
+	revision := m.revision
+	m.mu.Unlock()
+
+	root := trayMenuItem{ID: 0, Properties: map[string]dbus.Variant{
+		"children-display": dbus.MakeVariant("submenu"),
+	}, Children: []dbus.Variant{}}
+	for _, item := range m.items() {
+		if item.ID == parentID {
+			return revision, item, nil
+		}
+		if recursionDepth != 0 {
+			root.Children = append(root.Children, dbus.MakeVariant(item))
+		}
+	}
+	if parentID != 0 {
+		return 0, trayMenuItem{}, dbus.MakeFailedError(fmt.Errorf("unknown menu item %d", parentID))
+	}
+	return revision, root, nil
+}
+
+func (m *trayMenu) GetGroupProperties(ids []int32, propertyNames []string) ([]trayMenuItemProperties, *dbus.Error) {
+	props := []trayMenuItemProperties{}
+	for _, item := range m.items() {
+		for _, id := range ids {
+			if item.ID == id {
+				props = append(props, trayMenuItemProperties{item.ID, item.Properties})
+			}
+		}
+	}
+	return props, nil
+}
+
+func (m *trayMenu) GetProperty(id int32, name string) (dbus.Variant, *dbus.Error) {
+	for _, item := range m.items() {
+		if v, ok := item.Properties[name]; ok && item.ID == id {
+			return v, nil
+		}
+	}
+	return dbus.Variant{}, dbus.MakeFailedError(fmt.Errorf("no property %s on menu item %d", name, id))
+}
+
+// Event handles clicks on menu entries.
+func (m *trayMenu) Event(id int32, eventID string, data dbus.Variant, timestamp uint32) *dbus.Error {
+	if eventID != "clicked" {
+		return nil
+	}
+	var err error
+	switch id {
+	case trayMenuLight:
+		err = m.daemon.SetMode(m.ctx, switcher.Light)
+	case trayMenuDark:
+		err = m.daemon.SetMode(m.ctx, switcher.Dark)
+	case trayMenuAuto:
+		err = m.daemon.ClearOverride(m.ctx)
+	case trayMenuReapply:
+		err = m.daemon.Reapply(m.ctx)
+	}
+	if err != nil {
+		return dbus.MakeFailedError(err)
+	}
+	return nil
+}
+
+func (m *trayMenu) EventGroup(events []struct {
+	ID        int32
+	EventID   string
+	Data      dbus.Variant
+	Timestamp uint32
+}) ([]int32, *dbus.Error) {
+	for _, e := range events {
+		if err := m.Event(e.ID, e.EventID, e.Data, e.Timestamp); err != nil {
+			return nil, err
+		}
+	}
+	return []int32{}, nil
+}
+
+func (m *trayMenu) AboutToShow(id int32) (bool, *dbus.Error) { return false, nil }
+
+func (m *trayMenu) AboutToShowGroup(ids []int32) ([]int32, []int32, *dbus.Error) {
+	return []int32{}, []int32{}, nil
+}
+
+// trayToolTipFor returns the tool tip shown in mode.
+func trayToolTipFor(mode switcher.Mode) trayToolTip {
+	return trayToolTip{IconName: trayIcon(mode), Title: "theme-switcher", Text: fmt.Sprintf("%s mode", mode)}
+}
+
+// ServeTray shows a StatusNotifierItem tray icon for the current mode, with a
+// menu to set it, until ctx is done. Clicking the icon toggles the mode.
+// It's registered again whenever the tray (StatusNotifierWatcher) restarts.
+func ServeTray(ctx context.Context, daemon *switcher.Daemon) error {
+	conn, err := dbus.ConnectSessionBus(dbus.WithContext(ctx))
+	if err != nil {
+		return fmt.Errorf("unable to connect to session bus: %w", err)
+	}
+	defer conn.Close()
+
+	item := &trayItem{ctx: ctx, daemon: daemon}
+	menu := &trayMenu{ctx: ctx, daemon: daemon}
+
+	mode := daemon.Mode()
+	props, err := prop.Export(conn, sniPath, prop.Map{
+		sniInterface: {
+			"Category":   {Value: "ApplicationStatus", Emit: prop.EmitFalse},
+			"Id":         {Value: "theme-switcher", Emit: prop.EmitFalse},
+			"Title":      {Value: "theme-switcher", Emit: prop.EmitFalse},
+			"Status":     {Value: "Active", Emit: prop.EmitFalse},
+			"IconName":   {Value: trayIcon(mode), Emit: prop.EmitFalse},
+			"ToolTip":    {Value: trayToolTipFor(mode), Emit: prop.EmitFalse},
+			"ItemIsMenu": {Value: false, Emit: prop.EmitFalse},
+			"Menu":       {Value: dbusMenuPath, Emit: prop.EmitFalse},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("unable to export tray icon properties: %w", err)
+	}
+	if err := conn.Export(item, sniPath, sniInterface); err != nil {
+		return fmt.Errorf("unable to export tray icon: %w", err)
+	}
+	if err := conn.Export(introspect.NewIntrospectable(&introspect.Node{
+		Name: string(sniPath),
+		Interfaces: []introspect.Interface{
+			introspect.IntrospectData,
+			prop.IntrospectData,
+			{
+				Name:       sniInterface,
+				Methods:    introspect.Methods(item),
+				Properties: props.Introspection(sniInterface),
+				Signals:    []introspect.Signal{{Name: "NewIcon"}, {Name: "NewToolTip"}},
+			},
+		},
+	}), sniPath, "org.freedesktop.DBus.Introspectable"); err != nil {
+		return fmt.Errorf("unable to export introspection: %w", err)
+	}
+
+	menuProps, err := prop.Export(conn, dbusMenuPath, prop.Map{
+		dbusMenuInterface: {
+			"Version":       {Value: uint32(3), Emit: prop.EmitFalse},
+			"TextDirection": {Value: "ltr", Emit: prop.EmitFalse},
+			"Status":        {Value: "normal", Emit: prop.EmitFalse},
+			"IconThemePath": {Value: []string{}, Emit: prop.EmitFalse},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("unable to export tray menu properties: %w", err)
+	}
+	if err := conn.Export(menu, dbusMenuPath, dbusMenuInterface); err != nil {
+		return fmt.Errorf("unable to export tray menu: %w", err)
+	}
+	if err := conn.Export(introspect.NewIntrospectable(&introspect.Node{
+		Name: string(dbusMenuPath),
+		Interfaces: []introspect.Interface{
+			introspect.IntrospectData,
+			prop.IntrospectData,
+			{
+				Name:       dbusMenuInterface,
+				Methods:    introspect.Methods(menu),
+				Properties: menuProps.Introspection(dbusMenuInterface),
+				Signals:    []introspect.Signal{{Name: "LayoutUpdated"}, {Name: "ItemsPropertiesUpdated"}},
+			},
+		},
+	}), dbusMenuPath, "org.freedesktop.DBus.Introspectable"); err != nil {
+		return fmt.Errorf("unable to export introspection: %w", err)
+	}
+
+	name := fmt.Sprintf("org.kde.StatusNotifierItem-%d-1", os.Getpid())
+	if _, err := conn.RequestName(name, dbus.NameFlagDoNotQueue); err != nil {
+		return fmt.Errorf("unable to request name %s: %w", name, err)
+	}
+
+	// register again whenever the tray restarts.
+	if err := conn.AddMatchSignalContext(ctx,
+		dbus.WithMatchInterface("org.freedesktop.DBus"),
+		dbus.WithMatchMember("NameOwnerChanged"),
+		dbus.WithMatchArg(0, sniWatcherName),
+	); err != nil {
+		return fmt.Errorf("unable to watch for the tray: %w", err)
+	}
+	signals := make(chan *dbus.Signal, 16)
+	conn.Signal(signals)
+
+	register := func() {
+		if err := conn.Object(sniWatcherName, sniWatcherPath).CallWithContext(ctx, sniWatcherInterface+".RegisterStatusNotifierItem", 0, name).Err; err != nil {
+			log.WithError(err).Warn("unable to register tray icon, waiting for a tray")
+		}
+	}
+	register()
+
+	events, unsubscribe := daemon.Subscribe(switcher.ColorSchemeChanged)
+	defer unsubscribe()
+
+	for {
+		select {
+		case event := <-events:
+			props.SetMust(sniInterface, "IconName", trayIcon(event.Mode))
+			props.SetMust(sniInterface, "ToolTip", trayToolTipFor(event.Mode))
+			for _, signal := range []string{"NewIcon", "NewToolTip"} {
+				if err := conn.Emit(sniPath, sniInterface+"."+signal); err != nil {
+					log.WithError(err).Warnf("unable to emit %s signal", signal)
+				}
+			}
+			if err := conn.Emit(dbusMenuPath, dbusMenuInterface+".LayoutUpdated", menu.changed(), int32(0)); err != nil {
+				log.WithError(err).Warn("unable to emit LayoutUpdated signal")
+			}
+		case sig, ok := <-signals:
+			if !ok {
+				return fmt.Errorf("lost connection to session bus")
+			}
+			var owner, oldOwner, newOwner string
+			if sig.Name != "org.freedesktop.DBus.NameOwnerChanged" || dbus.Store(sig.Body, &owner, &oldOwner, &newOwner) != nil {
+				continue
+			}
+			if owner == sniWatcherName && newOwner != "" {
+				register()
+			}
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package hooks
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/flokli/theme-switcher/pkg/switcher"
+	log "github.com/sirupsen/logrus"
+)
+
+// dataDirs returns $XDG_DATA_HOME and $XDG_DATA_DIRS, in order of precedence.
+func dataDirs() ([]string, error) {
+	dataHome := os.Getenv("XDG_DATA_HOME")
+	if dataHome == "" {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return nil, fmt.Errorf("unable to determine home dir: %w", err)
+		}
+		dataHome = filepath.Join(homeDir, ".local", "share")
+	}
+
+	dataDirs := os.Getenv("XDG_DATA_DIRS")
+	if dataDirs == "" {
+		dataDirs = "/usr/local/share:/usr/share"
+	}
+
+	return append([]string{dataHome}, filepath.SplitList(dataDirs)...), nil
+}
+
+// Darkman runs the scripts darkman would run after switching, from the
+// dark-mode.d and light-mode.d directories in $XDG_DATA_HOME and $XDG_DATA_DIRS.
+// Like with darkman, they're invoked without arguments, no preference counts
+// as light, and a script in
+// $XDG_DATA_HOME shadows one of the same name in $XDG_DATA_DIRS.
+type Darkman struct{}
+
+func (d *Darkman) Name() string { return "darkman" }
+
+// scripts returns the paths of all scripts to run for mode.
+func (d *Darkman) scripts(mode switcher.Mode) ([]string, error) {
+	dirs, err := dataDirs()
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	var paths []string
+	for _, dir := range dirs {
+		dirPaths, err := executables(filepath.Join(dir, string(mode.Appearance())+"-mode.d"))
+		if err != nil {
+			return nil, err
+		}
+		for _, path := range dirPaths {
+			if name := filepath.Base(path); !seen[name] {
+				seen[name] = true
+				paths = append(paths, path)
+			}
+		}
+	}
+	return paths, nil
+}
+
+func (d *Darkman) Run(ctx context.Context, stage switcher.Stage, mode switcher.Mode) error {
+	// darkman only runs scripts after switching.
+	if stage != switcher.Post {
+		return nil
+	}
+
+	paths, err := d.scripts(mode)
+	if err != nil {
+		return fmt.Errorf("unable to list darkman scripts: %w", err)
+	}
+
+	// keep running the remaining scripts if one fails.
+	var failed []string
+	for _, path := range paths {
+		log.WithField("path", path).Debug("running darkman script")
+
+		cmd := exec.CommandContext(ctx, path)
+		cmd.Stdout = os.Stderr
+		cmd.Stderr = os.Stderr
+
+		if switcher.IsDryRun(ctx) {
+			log.Infof("would run darkman script %s", path)
+			continue
+		}
+		if err := cmd.Run(); err != nil {
+			log.WithError(err).WithField("path", path).Warn("darkman script failed")
+			failed = append(failed, path)
+		}
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("%d darkman scripts failed: %s", len(failed), strings.Join(failed, ", "))
+	}
+	return nil
+}
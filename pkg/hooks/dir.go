@@ -0,0 +1,114 @@
+// Package hooks provides switcher.Hook implementations running user scripts.
+package hooks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/flokli/theme-switcher/pkg/palette"
+	"github.com/flokli/theme-switcher/pkg/switcher"
+	log "github.com/sirupsen/logrus"
+)
+
+// DefaultDir returns the default directory hook executables are read from,
+// ~/.config/theme-switcher/hooks.d.
+func DefaultDir() (string, error) {
+	confDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("unable to determine user config dir: %w", err)
+	}
+	return filepath.Join(confDir, "theme-switcher", "hooks.d"), nil
+}
+
+// executables returns the paths of all executable files in dir, sorted by name.
+// A missing dir contains no executables.
+func executables(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var paths []string
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+		// follow symlinks, and skip everything not executable.
+		fi, err := os.Stat(path)
+		if err != nil || !fi.Mode().IsRegular() || fi.Mode().Perm()&0o111 == 0 {
+			continue
+		}
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	return paths, nil
+}
+
+// Dir runs all executables in a directory, in lexical order.
+// They're invoked with the stage ("pre" or "post") and the mode as arguments,
+// which are also passed as $THEME_SWITCHER_STAGE and $THEME_SWITCHER_MODE.
+// The colors of the palette of the mode are passed like
+// $THEME_SWITCHER_COLOR_BASE00, and the ones of light and dark mode like
+// $THEME_SWITCHER_LIGHT_COLOR_BASE00 and $THEME_SWITCHER_DARK_COLOR_BASE00.
+type Dir struct {
+	Path     string
+	Palettes palette.Palettes
+	// PaletteName is the name of the named palette Palettes are derived
+	// from, if any, passed as $THEME_SWITCHER_PALETTE.
+	PaletteName string
+}
+
+func (d *Dir) Name() string { return d.Path }
+
+// Events returns the appearance events, as the hooks are passed the appearance.
+func (d *Dir) Events() []switcher.EventKind { return switcher.AppearanceEvents }
+
+func (d *Dir) Run(ctx context.Context, stage switcher.Stage, mode switcher.Mode) error {
+	paths, err := executables(d.Path)
+	if err != nil {
+		return fmt.Errorf("unable to list hooks: %w", err)
+	}
+
+	// keep running the remaining hooks if one fails.
+	var failed []string
+	for _, path := range paths {
+		log.WithField("path", path).Debug("running hook")
+
+		cmd := exec.CommandContext(ctx, path, string(stage), string(mode))
+		cmd.Env = append(os.Environ(),
+			"THEME_SWITCHER_STAGE="+string(stage),
+			"THEME_SWITCHER_MODE="+string(mode),
+		)
+		cmd.Env = append(cmd.Env, switcher.AppearanceFrom(ctx).Env()...)
+		cmd.Env = append(cmd.Env, d.Palettes.For(mode).Env()...)
+		cmd.Env = append(cmd.Env, d.Palettes.For(switcher.Light).EnvPrefix("THEME_SWITCHER_LIGHT_COLOR_")...)
+		cmd.Env = append(cmd.Env, d.Palettes.For(switcher.Dark).EnvPrefix("THEME_SWITCHER_DARK_COLOR_")...)
+		if d.PaletteName != "" {
+			cmd.Env = append(cmd.Env, "THEME_SWITCHER_PALETTE="+d.PaletteName)
+		}
+		cmd.Stdout = os.Stderr
+		cmd.Stderr = os.Stderr
+
+		if switcher.IsDryRun(ctx) {
+			log.Infof("would run hook %s %s %s", path, stage, mode)
+			continue
+		}
+		if err := cmd.Run(); err != nil {
+			log.WithError(err).WithField("path", path).Warn("hook failed")
+			failed = append(failed, filepath.Base(path))
+		}
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("%d hooks failed: %s", len(failed), strings.Join(failed, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package hooks
+
+import (
+	"context"
+
+	"github.com/flokli/theme-switcher/pkg/palette"
+	"github.com/flokli/theme-switcher/pkg/switcher"
+	log "github.com/sirupsen/logrus"
+)
+
+// Material generates Material You color schemes from the wallpaper or accent
+// color before switching, like GTK4/libadwaita and Android do, so templates
+// and hooks run after it get roles like primary or surface_container.
+type Material struct {
+	// From is "wallpaper" or "accent".
+	From string
+	// Path is the wallpaper to use if the source doesn't report one.
+	Path string
+	// Base are the configured palettes, taking precedence over the
+	// generated colors.
+	Base palette.Palettes
+	// Palettes, shared with templates and hooks, get the generated colors
+	// of light and dark mode, merged with Base.
+	Palettes palette.Palettes
+}
+
+func (m *Material) Name() string { return "material" }
+
+// Events returns the appearance events, to follow changes of the wallpaper
+// and accent color.
+func (m *Material) Events() []switcher.EventKind { return switcher.AppearanceEvents }
+
+// source returns the color to generate the schemes from, or "" if there's
+// none.
+func (m *Material) source(ctx context.Context) (string, error) {
+	appearance := switcher.AppearanceFrom(ctx)
+	if m.From == "accent" {
+		return appearance.AccentColor, nil
+	}
+	wallpaper := appearance.Wallpaper
+	if wallpaper == "" {
+		wallpaper = m.Path
+	}
+	if wallpaper == "" {
+		return "", nil
+	}
+	return palette.WallpaperColor(wallpaper)
+}
+
+func (m *Material) Run(ctx context.Context, stage switcher.Stage, mode switcher.Mode) error {
+	if stage != switcher.Pre {
+		return nil
+	}
+	source, err := m.source(ctx)
+	if err != nil {
+		return err
+	}
+	if source == "" {
+		log.WithField("hook", m.Name()).Debugf("no %s to generate colors from", m.From)
+		return nil
+	}
+	generated, err := palette.Material(source)
+	if err != nil {
+		return err
+	}
+	for _, mode := range []switcher.Mode{switcher.Light, switcher.Dark} {
+		m.Palettes[mode] = m.Palettes[mode].Merge(generated[mode]).Merge(m.Base[mode])
+	}
+	return nil
+}
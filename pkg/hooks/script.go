@@ -0,0 +1,230 @@
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/flokli/theme-switcher/pkg/switcher"
+	log "github.com/sirupsen/logrus"
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+)
+
+// Script runs a Starlark script, a small Python dialect, to decide which
+// backends to switch, and to do things before and after switching, without
+// writing shell scripts for everything. The script may define any of these
+// functions, which are passed a struct of the switch, with its mode,
+// appearance ("light" or "dark"), stage, accent_color, high_contrast and
+// wallpaper:
+//
+//	def pre(switch): ...
+//	def post(switch): ...
+//	def apply(backend, switch): return True  # False not to switch backend
+//
+// Besides the Starlark builtins, scripts can call run(*args), which runs a
+// command and returns a struct of its code, stdout and stderr, env(name,
+// default=""), and exists(path). print logs its arguments.
+// The script is loaded again when it changes.
+type Script struct {
+	Path string
+
+	mu      sync.Mutex
+	modTime time.Time
+	globals starlark.StringDict
+}
+
+func (s *Script) Name() string { return s.Path }
+
+// Events returns the appearance events, as the script is passed the
+// appearance.
+func (s *Script) Events() []switcher.EventKind { return switcher.AppearanceEvents }
+
+// builtins are the functions scripts can call besides the Starlark ones.
+var builtins = starlark.StringDict{
+	"run":    starlark.NewBuiltin("run", scriptRun),
+	"env":    starlark.NewBuiltin("env", scriptEnv),
+	"exists": starlark.NewBuiltin("exists", scriptExists),
+}
+
+// thread returns a thread to call the script in, which can't be shared, as
+// backends are decided on concurrently.
+func (s *Script) thread(ctx context.Context) *starlark.Thread {
+	thread := &starlark.Thread{
+		Name: s.Path,
+		Print: func(_ *starlark.Thread, msg string) {
+			log.WithField("hook", s.Path).Info(msg)
+		},
+	}
+	thread.SetLocal("ctx", ctx)
+	return thread
+}
+
+// load returns the globals of the script, loading it if it changed since it
+// was loaded last.
+func (s *Script) load(ctx context.Context) (starlark.StringDict, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fi, err := os.Stat(s.Path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read script: %w", err)
+	}
+	if s.globals != nil && fi.ModTime().Equal(s.modTime) {
+		return s.globals, nil
+	}
+	src, err := os.ReadFile(s.Path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read script: %w", err)
+	}
+	globals, err := starlark.ExecFile(s.thread(ctx), s.Path, src, builtins)
+	if err != nil {
+		return nil, scriptError(err)
+	}
+	// freeze them, so concurrent calls can't modify them.
+	globals.Freeze()
+	s.globals, s.modTime = globals, fi.ModTime()
+	return globals, nil
+}
+
+// call calls the function name of the script with args, returning nil if the
+// script doesn't define it.
+func (s *Script) call(ctx context.Context, name string, args ...starlark.Value) (starlark.Value, error) {
+	globals, err := s.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	fn, ok := globals[name]
+	if !ok {
+		return nil, nil
+	}
+	if _, ok := fn.(starlark.Callable); !ok {
+		return nil, fmt.Errorf("%s is a %s, not a function", name, fn.Type())
+	}
+	result, err := starlark.Call(s.thread(ctx), fn, args, nil)
+	if err != nil {
+		return nil, scriptError(err)
+	}
+	return result, nil
+}
+
+// Check loads the script, to report syntax errors before switching.
+func (s *Script) Check(ctx context.Context) []error {
+	if _, err := s.load(ctx); err != nil {
+		return []error{err}
+	}
+	return nil
+}
+
+// scriptError returns err with the Starlark backtrace, if there's one.
+func scriptError(err error) error {
+	var evalErr *starlark.EvalError
+	if errors.As(err, &evalErr) {
+		return errors.New(evalErr.Backtrace())
+	}
+	return err
+}
+
+// switchValue returns the struct passed to the script's functions.
+func switchValue(ctx context.Context, stage switcher.Stage, mode switcher.Mode) starlark.Value {
+	appearance := switcher.AppearanceFrom(ctx)
+	return starlarkstruct.FromStringDict(starlark.String("switch"), starlark.StringDict{
+		"mode":          starlark.String(mode),
+		"appearance":    starlark.String(mode.Appearance()),
+		"stage":         starlark.String(stage),
+		"accent_color":  starlark.String(appearance.AccentColor),
+		"high_contrast": starlark.Bool(appearance.HighContrast),
+		"wallpaper":     starlark.String(appearance.Wallpaper),
+	})
+}
+
+func (s *Script) Run(ctx context.Context, stage switcher.Stage, mode switcher.Mode) error {
+	if switcher.IsDryRun(ctx) {
+		log.Infof("would run %s of script %s", stage, s.Path)
+		return nil
+	}
+	_, err := s.call(ctx, string(stage), switchValue(ctx, stage, mode))
+	return err
+}
+
+// Allow returns what the script's apply function returns for backend, or
+// true if it doesn't define one. It's also called in dry-run mode, to show
+// which backends would be switched.
+func (s *Script) Allow(ctx context.Context, backend string, mode switcher.Mode) (bool, error) {
+	result, err := s.call(ctx, "apply", starlark.String(backend), switchValue(ctx, switcher.Pre, mode))
+	if err != nil || result == nil {
+		return true, err
+	}
+	allowed, ok := result.(starlark.Bool)
+	if !ok {
+		return true, fmt.Errorf("apply returned a %s, not a bool", result.Type())
+	}
+	return bool(allowed), nil
+}
+
+// scriptRun runs a command, returning its exit code and output. A command
+// that can't be started is an error, one exiting with another code than 0
+// isn't.
+func scriptRun(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	if len(kwargs) > 0 {
+		return nil, fmt.Errorf("%s: unexpected keyword arguments", fn.Name())
+	}
+	if len(args) == 0 {
+		return nil, fmt.Errorf("%s: missing command", fn.Name())
+	}
+	argv := make([]string, len(args))
+	for i, arg := range args {
+		s, ok := starlark.AsString(arg)
+		if !ok {
+			return nil, fmt.Errorf("%s: argument %d is a %s, not a string", fn.Name(), i+1, arg.Type())
+		}
+		argv[i] = s
+	}
+	ctx, _ := thread.Local("ctx").(context.Context)
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	code := 0
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			return nil, fmt.Errorf("%s: %w", fn.Name(), err)
+		}
+		code = exitErr.ExitCode()
+	}
+	return starlarkstruct.FromStringDict(starlark.String("result"), starlark.StringDict{
+		"code":   starlark.MakeInt(code),
+		"stdout": starlark.String(stdout.String()),
+		"stderr": starlark.String(stderr.String()),
+	}), nil
+}
+
+// scriptEnv returns an environment variable, or the default if it's unset.
+func scriptEnv(_ *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var name, def string
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "name", &name, "default?", &def); err != nil {
+		return nil, err
+	}
+	if value, ok := os.LookupEnv(name); ok {
+		return starlark.String(value), nil
+	}
+	return starlark.String(def), nil
+}
+
+// scriptExists returns whether a file exists.
+func scriptExists(_ *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var path string
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "path", &path); err != nil {
+		return nil, err
+	}
+	_, err := os.Stat(path)
+	return starlark.Bool(err == nil), nil
+}
@@ -0,0 +1,91 @@
+package hooks
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/flokli/theme-switcher/pkg/palette"
+	"github.com/flokli/theme-switcher/pkg/switcher"
+	log "github.com/sirupsen/logrus"
+)
+
+// Wallpaper derives palette colors from the wallpaper of the mode before
+// switching, with pywal or wallust, so templates and hooks run after it get
+// colors matching it. The colors are read from the colors.json in pywal's
+// cache dir, which wallust needs a template to write, too.
+type Wallpaper struct {
+	// Tool is "pywal" or "wallust".
+	Tool string
+	// Path is the wallpaper to use if the source doesn't report one.
+	Path string
+	// Base are the configured palettes, taking precedence over the colors
+	// of the wallpaper.
+	Base palette.Palettes
+	// Palettes, shared with templates and hooks, are replaced with the
+	// colors of the wallpaper, merged with Base, in the mode switched to.
+	Palettes palette.Palettes
+}
+
+func (w *Wallpaper) Name() string { return w.Tool }
+
+// Events returns the appearance events, to follow changes of the wallpaper.
+func (w *Wallpaper) Events() []switcher.EventKind { return switcher.AppearanceEvents }
+
+// command returns the command generating the colors of wallpaper in mode.
+func (w *Wallpaper) command(ctx context.Context, wallpaper string, mode switcher.Mode) (*exec.Cmd, error) {
+	switch w.Tool {
+	case "pywal":
+		// only generate colors, without setting the wallpaper or colors of
+		// terminals.
+		args := []string{"-n", "-s", "-t", "-e", "-q", "-i", wallpaper}
+		if mode.Appearance() == switcher.Light {
+			args = append(args, "-l")
+		}
+		return exec.CommandContext(ctx, "wal", args...), nil
+	case "wallust":
+		return exec.CommandContext(ctx, "wallust", "run", "-s", "-q", "-p", string(mode.Appearance()), wallpaper), nil
+	default:
+		return nil, fmt.Errorf("unknown wallpaper color tool: %s", w.Tool)
+	}
+}
+
+func (w *Wallpaper) Run(ctx context.Context, stage switcher.Stage, mode switcher.Mode) error {
+	if stage != switcher.Pre {
+		return nil
+	}
+	wallpaper := switcher.AppearanceFrom(ctx).Wallpaper
+	if wallpaper == "" {
+		wallpaper = w.Path
+	}
+	if wallpaper == "" {
+		log.WithField("hook", w.Name()).Debug("no wallpaper to derive colors from")
+		return nil
+	}
+
+	cmd, err := w.command(ctx, wallpaper, mode)
+	if err != nil {
+		return err
+	}
+	if switcher.IsDryRun(ctx) {
+		log.Infof("would run %s", strings.Join(cmd.Args, " "))
+		return nil
+	}
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("unable to derive colors from %s: %w: %s", wallpaper, err, strings.TrimSpace(string(out)))
+	}
+
+	cacheDir, err := palette.PywalCacheDir()
+	if err != nil {
+		return err
+	}
+	colors, err := palette.LoadPywal(filepath.Join(cacheDir, "colors.json"))
+	if err != nil {
+		return err
+	}
+	// no preference uses the palette of light mode.
+	w.Palettes[mode.Appearance()] = colors.Merge(w.Base.For(mode))
+	return nil
+}
@@ -0,0 +1,33 @@
+package hooks
+
+import (
+	"context"
+
+	"github.com/flokli/theme-switcher/internal/cond"
+	"github.com/flokli/theme-switcher/pkg/switcher"
+)
+
+// When only lets backends be switched while their condition holds, like
+// env.XDG_SESSION_TYPE == 'wayland', so one configuration can handle
+// different sessions or machines. See package cond for the conditions.
+type When struct {
+	// Conditions are the conditions of backends, by backend name. Backends
+	// without one are always switched.
+	Conditions map[string]*cond.Expr
+}
+
+func (w *When) Name() string { return "when" }
+
+func (w *When) Run(ctx context.Context, stage switcher.Stage, mode switcher.Mode) error {
+	return nil
+}
+
+// Allow evaluates the condition of backend, with mode and appearance set to
+// the ones switched to.
+func (w *When) Allow(ctx context.Context, backend string, mode switcher.Mode) (bool, error) {
+	expr, ok := w.Conditions[backend]
+	if !ok {
+		return true, nil
+	}
+	return expr.Eval(cond.Vars{"mode": string(mode), "appearance": string(mode.Appearance())})
+}
@@ -0,0 +1,95 @@
+package palette
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Scheme is a base16 or base24 color scheme.
+type Scheme struct {
+	// System is "base16" or "base24".
+	System string
+	Name   string
+	Author string
+	// Variant is "light" or "dark", if the scheme says.
+	Variant string
+	// Colors holds base00 to base0F, and base10 to base17 with base24.
+	Colors Palette
+}
+
+// schemeFile is a scheme in either the original format, with the colors
+// (without a leading #) next to scheme and author, or the one of
+// tinted-theming, with system, name, variant and a palette.
+type schemeFile struct {
+	System  string            `yaml:"system"`
+	Name    string            `yaml:"name"`
+	Scheme  string            `yaml:"scheme"`
+	Author  string            `yaml:"author"`
+	Variant string            `yaml:"variant"`
+	Palette map[string]string `yaml:"palette"`
+	Colors  map[string]string `yaml:",inline"`
+}
+
+// baseNames returns the names of the colors of system, base00 to base0F, and
+// for base24 base10 to base17.
+func baseNames(system string) []string {
+	count := 16
+	if system == "base24" {
+		count = 24
+	}
+	names := make([]string, count)
+	for i := range names {
+		names[i] = fmt.Sprintf("base%02X", i)
+	}
+	return names
+}
+
+// LoadScheme reads a base16 or base24 scheme from a YAML file.
+func LoadScheme(path string) (*Scheme, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read scheme: %w", err)
+	}
+	var f schemeFile
+	if err := yaml.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("unable to parse scheme %s: %w", path, err)
+	}
+
+	all := f.Palette
+	if all == nil {
+		all = f.Colors
+	}
+	// some schemes spell base0a in lowercase.
+	colors := make(map[string]string, len(all))
+	for name, color := range all {
+		colors[strings.ToLower(name)] = color
+	}
+	s := &Scheme{System: f.System, Name: f.Name, Author: f.Author, Variant: f.Variant, Colors: Palette{}}
+	if s.Name == "" {
+		s.Name = f.Scheme
+	}
+	// the original format has no system, base24 schemes just have more colors.
+	if s.System == "" {
+		s.System = "base16"
+		if _, ok := colors["base10"]; ok {
+			s.System = "base24"
+		}
+	}
+	if s.System != "base16" && s.System != "base24" {
+		return nil, fmt.Errorf("unsupported scheme system %s in %s", s.System, path)
+	}
+
+	for _, name := range baseNames(s.System) {
+		color, ok := colors[strings.ToLower(name)]
+		if !ok {
+			return nil, fmt.Errorf("%s scheme %s is missing %s", s.System, path, name)
+		}
+		if s.Colors[name], err = normalize(color); err != nil {
+			return nil, fmt.Errorf("invalid %s in %s: %w", name, path, err)
+		}
+	}
+	return s, nil
+}
@@ -0,0 +1,115 @@
+package palette
+
+import (
+	"fmt"
+	"math"
+	"text/template"
+)
+
+// Funcs returns the functions templates can use to derive colors from the
+// palette, like hover or border colors. The amount comes first, so the color
+// can be piped into them, like {{.Colors.bg | lighten 0.1}}:
+//
+//   - lighten AMOUNT COLOR and darken AMOUNT COLOR change the lightness by
+//     AMOUNT, from 0 to 1, in CIE LCh, so hues stay the same.
+//   - mix WEIGHT COLOR2 COLOR1 mixes WEIGHT, from 0 to 1, of COLOR2 into
+//     COLOR1, like {{.Colors.bg | mix 0.2 .Colors.fg}}.
+//   - alpha ALPHA COLOR returns COLOR as #rrggbbaa, with the opacity ALPHA
+//     from 0 to 1.
+//   - contrast COLOR1 COLOR2 returns the WCAG contrast ratio of two colors,
+//     from 1 to 21, like {{if lt (contrast .Colors.fg .Colors.bg) 4.5}}.
+func Funcs() template.FuncMap {
+	return template.FuncMap{
+		"lighten":  lighten,
+		"darken":   darken,
+		"mix":      mix,
+		"alpha":    alpha,
+		"contrast": contrast,
+	}
+}
+
+// fraction checks that amount is between 0 and 1.
+func fraction(what string, amount float64) error {
+	if amount < 0 || amount > 1 || math.IsNaN(amount) {
+		return fmt.Errorf("%s %v needs to be between 0 and 1", what, amount)
+	}
+	return nil
+}
+
+// changeLightness returns color with amount, from -1 to 1, added to its
+// lightness.
+func changeLightness(amount float64, color string) (string, error) {
+	r, g, b, err := parseHex(color)
+	if err != nil {
+		return "", err
+	}
+	c := rgbToLCh(r, g, b)
+	c.l = math.Max(0, math.Min(100, c.l+amount*100))
+	return c.hex(), nil
+}
+
+func lighten(amount float64, color string) (string, error) {
+	if err := fraction("amount", amount); err != nil {
+		return "", err
+	}
+	return changeLightness(amount, color)
+}
+
+func darken(amount float64, color string) (string, error) {
+	if err := fraction("amount", amount); err != nil {
+		return "", err
+	}
+	return changeLightness(-amount, color)
+}
+
+func mix(weight float64, color2, color1 string) (string, error) {
+	if err := fraction("weight", weight); err != nil {
+		return "", err
+	}
+	r1, g1, b1, err := parseHex(color1)
+	if err != nil {
+		return "", err
+	}
+	r2, g2, b2, err := parseHex(color2)
+	if err != nil {
+		return "", err
+	}
+	channel := func(v1, v2 float64) int { return int(math.Round(v1 + (v2-v1)*weight)) }
+	return fmt.Sprintf("#%02x%02x%02x", channel(r1, r2), channel(g1, g2), channel(b1, b2)), nil
+}
+
+func alpha(alpha float64, color string) (string, error) {
+	if err := fraction("alpha", alpha); err != nil {
+		return "", err
+	}
+	color, err := normalize(color)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s%02x", color, int(math.Round(alpha*255))), nil
+}
+
+// luminance returns the relative luminance of color, as defined by WCAG.
+func luminance(color string) (float64, error) {
+	r, g, b, err := parseHex(color)
+	if err != nil {
+		return 0, err
+	}
+	return 0.2126*linearize(r) + 0.7152*linearize(g) + 0.0722*linearize(b), nil
+}
+
+func contrast(color1, color2 string) (float64, error) {
+	l1, err := luminance(color1)
+	if err != nil {
+		return 0, err
+	}
+	l2, err := luminance(color2)
+	if err != nil {
+		return 0, err
+	}
+	if l1 < l2 {
+		l1, l2 = l2, l1
+	}
+	// rounded, so it's printed as 4.5 rather than 4.499999.
+	return math.Round((l1+0.05)/(l2+0.05)*100) / 100, nil
+}
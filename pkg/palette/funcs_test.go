@@ -0,0 +1,115 @@
+package palette
+
+import (
+	"strings"
+	"testing"
+	"text/template"
+)
+
+func TestContrast(t *testing.T) {
+	for _, tt := range []struct {
+		color1, color2 string
+		want           float64
+	}{
+		{"#000000", "#ffffff", 21},
+		{"#FFFFFF", "#000000", 21},
+		{"#ffffff", "#ffffff", 1},
+		{"#777777", "#ffffff", 4.48},
+		{"#0000ff", "#ffffff", 8.59},
+	} {
+		if got, err := contrast(tt.color1, tt.color2); err != nil || got != tt.want {
+			t.Errorf("contrast(%s, %s) = %v, %v, want %v", tt.color1, tt.color2, got, err, tt.want)
+		}
+	}
+}
+
+func TestMix(t *testing.T) {
+	for _, tt := range []struct {
+		weight         float64
+		color2, color1 string
+		want           string
+	}{
+		{0, "#ffffff", "#3584e4", "#3584e4"},
+		{1, "#ffffff", "#3584e4", "#ffffff"},
+		{0.5, "#ffffff", "#000000", "#808080"},
+		{0.25, "#ff0000", "#0000ff", "#4000bf"},
+	} {
+		if got, err := mix(tt.weight, tt.color2, tt.color1); err != nil || got != tt.want {
+			t.Errorf("mix(%v, %s, %s) = %s, %v, want %s", tt.weight, tt.color2, tt.color1, got, err, tt.want)
+		}
+	}
+}
+
+func TestLightness(t *testing.T) {
+	for _, color := range []string{"#000000", "#ffffff", "#3584e4", "#e62d42", "#808080"} {
+		if got, err := lighten(0, color); err != nil || got != color {
+			t.Errorf("lighten(0, %s) = %s, %v, want it unchanged", color, got, err)
+		}
+		if got, err := lighten(1, color); err != nil || got != "#ffffff" {
+			t.Errorf("lighten(1, %s) = %s, %v, want white", color, got, err)
+		}
+		if got, err := darken(1, color); err != nil || got != "#000000" {
+			t.Errorf("darken(1, %s) = %s, %v, want black", color, got, err)
+		}
+	}
+
+	// the hue is kept.
+	lighter, err := lighten(0.1, "#3584e4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, g, b, _ := parseHex("#3584e4")
+	before := rgbToLCh(r, g, b)
+	r, g, b, _ = parseHex(lighter)
+	after := rgbToLCh(r, g, b)
+	if d := after.l - before.l; d < 9 || d > 11 {
+		t.Errorf("lightness of %s changed by %v, want 10", lighter, d)
+	}
+	if d := after.h - before.h; d < -2 || d > 2 {
+		t.Errorf("hue of %s changed by %v", lighter, d)
+	}
+}
+
+func TestAlpha(t *testing.T) {
+	for _, tt := range []struct {
+		alpha float64
+		want  string
+	}{
+		{0, "#ff000000"},
+		{0.5, "#ff000080"},
+		{1, "#ff0000ff"},
+	} {
+		if got, err := alpha(tt.alpha, "#FF0000"); err != nil || got != tt.want {
+			t.Errorf("alpha(%v, #FF0000) = %s, %v, want %s", tt.alpha, got, err, tt.want)
+		}
+	}
+}
+
+func TestFuncErrors(t *testing.T) {
+	for name, f := range map[string]func() (string, error){
+		"lighten above 1":     func() (string, error) { return lighten(1.5, "#ffffff") },
+		"darken below 0":      func() (string, error) { return darken(-0.1, "#ffffff") },
+		"mix invalid color":   func() (string, error) { return mix(0.5, "#fff", "#000000") },
+		"alpha invalid":       func() (string, error) { return alpha(2, "#000000") },
+		"lighten not a color": func() (string, error) { return lighten(0.1, "black") },
+	} {
+		if got, err := f(); err == nil {
+			t.Errorf("%s: got %s, want an error", name, got)
+		}
+	}
+	if _, err := contrast("#000000", "white"); err == nil {
+		t.Error("contrast with an invalid color succeeded")
+	}
+}
+
+func TestFuncsPiped(t *testing.T) {
+	tmpl := template.Must(template.New("").Funcs(Funcs()).Parse(
+		`{{.bg | lighten 0.1}} {{.bg | darken 0}} {{.bg | mix 0.5 .fg}} {{.bg | alpha 0.5}} {{contrast .fg .bg}}`))
+	var sb strings.Builder
+	if err := tmpl.Execute(&sb, map[string]string{"bg": "#000000", "fg": "#ffffff"}); err != nil {
+		t.Fatal(err)
+	}
+	if want := "#1b1b1b #000000 #808080 #00000080 21"; sb.String() != want {
+		t.Errorf("got %s, want %s", sb.String(), want)
+	}
+}
@@ -0,0 +1,255 @@
+package palette
+
+import (
+	"fmt"
+	"image"
+	_ "image/gif"  // wallpapers can be any of them
+	_ "image/jpeg" // wallpapers can be any of them
+	_ "image/png"  // wallpapers can be any of them
+	"math"
+	"os"
+	"strconv"
+
+	"github.com/flokli/theme-switcher/pkg/switcher"
+)
+
+// Material You colors are computed in CIE LCh(ab), with the lightness being
+// the tone, instead of the HCT color space of Material Design 3. Chroma and
+// hues are close enough to keep the character of the schemes, without
+// solving CAM16.
+
+// lch is a color in CIE LCh(ab), with the hue in degrees.
+type lch struct{ l, c, h float64 }
+
+// linearize converts an sRGB channel from 0 to 255 to linear light.
+func linearize(v float64) float64 {
+	v /= 255
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+// delinearize converts linear light to an sRGB channel from 0 to 255, and
+// reports whether it's in gamut.
+func delinearize(v float64) (float64, bool) {
+	if v <= 0.0031308 {
+		v *= 12.92
+	} else {
+		v = 1.055*math.Pow(v, 1/2.4) - 0.055
+	}
+	return v * 255, v >= -0.0001 && v <= 1.0001
+}
+
+// D65 white point.
+const whiteX, whiteY, whiteZ = 0.95047, 1.0, 1.08883
+
+func labF(t float64) float64 {
+	if t > 216.0/24389 {
+		return math.Cbrt(t)
+	}
+	return (24389.0/27*t + 16) / 116
+}
+
+func labFInv(t float64) float64 {
+	if t3 := t * t * t; t3 > 216.0/24389 {
+		return t3
+	}
+	return (116*t - 16) / (24389.0 / 27)
+}
+
+// rgbToLCh converts an sRGB color to LCh.
+func rgbToLCh(r, g, b float64) lch {
+	r, g, b = linearize(r), linearize(g), linearize(b)
+	x := 0.4124564*r + 0.3575761*g + 0.1804375*b
+	y := 0.2126729*r + 0.7151522*g + 0.0721750*b
+	z := 0.0193339*r + 0.1191920*g + 0.9503041*b
+	fx, fy, fz := labF(x/whiteX), labF(y/whiteY), labF(z/whiteZ)
+	l, a, bb := 116*fy-16, 500*(fx-fy), 200*(fy-fz)
+	h := math.Atan2(bb, a) * 180 / math.Pi
+	if h < 0 {
+		h += 360
+	}
+	return lch{l: l, c: math.Hypot(a, bb), h: h}
+}
+
+// rgb converts c to sRGB, and reports whether it's in gamut.
+func (c lch) rgb() (r, g, b float64, ok bool) {
+	rad := c.h * math.Pi / 180
+	a, bb := c.c*math.Cos(rad), c.c*math.Sin(rad)
+	fy := (c.l + 16) / 116
+	x, y, z := whiteX*labFInv(fy+a/500), whiteY*labFInv(fy), whiteZ*labFInv(fy-bb/200)
+	r, okR := delinearize(3.2404542*x - 1.5371385*y - 0.4985314*z)
+	g, okG := delinearize(-0.9692660*x + 1.8760108*y + 0.0415560*z)
+	b, okB := delinearize(0.0556434*x - 0.2040259*y + 1.0572252*z)
+	return r, g, b, okR && okG && okB
+}
+
+// hex returns c as #rrggbb, reducing its chroma until it's in gamut.
+func (c lch) hex() string {
+	r, g, b, ok := c.rgb()
+	if !ok {
+		lo, hi := 0.0, c.c
+		for i := 0; i < 24; i++ {
+			c.c = (lo + hi) / 2
+			if _, _, _, ok := c.rgb(); ok {
+				lo = c.c
+			} else {
+				hi = c.c
+			}
+		}
+		c.c = lo
+		r, g, b, _ = c.rgb()
+	}
+	clamp := func(v float64) int { return int(math.Round(math.Max(0, math.Min(255, v)))) }
+	return fmt.Sprintf("#%02x%02x%02x", clamp(r), clamp(g), clamp(b))
+}
+
+// parseHex returns the channels of a #rrggbb color.
+func parseHex(color string) (r, g, b float64, err error) {
+	color, err = normalize(color)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	v, _ := strconv.ParseUint(color[1:], 16, 32)
+	return float64(v >> 16 & 0xff), float64(v >> 8 & 0xff), float64(v & 0xff), nil
+}
+
+// tonalPalette is a hue and chroma, in all tones from 0 (black) to 100
+// (white).
+type tonalPalette struct{ hue, chroma float64 }
+
+func (p tonalPalette) tone(t float64) string {
+	return lch{l: t, c: p.chroma, h: math.Mod(p.hue+360, 360)}.hex()
+}
+
+// materialRoles maps the color roles of a Material You scheme to their
+// palette, and their tone in light and dark mode.
+var materialRoles = []struct {
+	name        string
+	palette     string
+	light, dark float64
+}{
+	{"primary", "primary", 40, 80},
+	{"on_primary", "primary", 100, 20},
+	{"primary_container", "primary", 90, 30},
+	{"on_primary_container", "primary", 10, 90},
+	{"inverse_primary", "primary", 80, 40},
+	{"secondary", "secondary", 40, 80},
+	{"on_secondary", "secondary", 100, 20},
+	{"secondary_container", "secondary", 90, 30},
+	{"on_secondary_container", "secondary", 10, 90},
+	{"tertiary", "tertiary", 40, 80},
+	{"on_tertiary", "tertiary", 100, 20},
+	{"tertiary_container", "tertiary", 90, 30},
+	{"on_tertiary_container", "tertiary", 10, 90},
+	{"error", "error", 40, 80},
+	{"on_error", "error", 100, 20},
+	{"error_container", "error", 90, 30},
+	{"on_error_container", "error", 10, 90},
+	{"background", "neutral", 98, 6},
+	{"on_background", "neutral", 10, 90},
+	{"surface", "neutral", 98, 6},
+	{"on_surface", "neutral", 10, 90},
+	{"surface_dim", "neutral", 87, 6},
+	{"surface_bright", "neutral", 98, 24},
+	{"surface_container_lowest", "neutral", 100, 4},
+	{"surface_container_low", "neutral", 96, 10},
+	{"surface_container", "neutral", 94, 12},
+	{"surface_container_high", "neutral", 92, 17},
+	{"surface_container_highest", "neutral", 90, 22},
+	{"inverse_surface", "neutral", 20, 90},
+	{"inverse_on_surface", "neutral", 95, 20},
+	{"surface_variant", "neutral_variant", 90, 30},
+	{"on_surface_variant", "neutral_variant", 30, 80},
+	{"outline", "neutral_variant", 50, 60},
+	{"outline_variant", "neutral_variant", 80, 30},
+	{"shadow", "neutral", 0, 0},
+	{"scrim", "neutral", 0, 0},
+}
+
+// Material returns the Material You color schemes of light and dark mode
+// derived from the source color, approximating the "tonal spot" schemes of
+// Android and matugen, with roles like primary, on_primary or
+// surface_container.
+func Material(source string) (Palettes, error) {
+	r, g, b, err := parseHex(source)
+	if err != nil {
+		return nil, err
+	}
+	hue := rgbToLCh(r, g, b).h
+	// the error colors are Material's red, regardless of the source.
+	red := rgbToLCh(0xb3, 0x26, 0x1e)
+	palettes := map[string]tonalPalette{
+		"primary":         {hue, 36},
+		"secondary":       {hue, 16},
+		"tertiary":        {hue + 60, 24},
+		"error":           {red.h, red.c},
+		"neutral":         {hue, 6},
+		"neutral_variant": {hue, 8},
+	}
+	light, dark := Palette{}, Palette{}
+	for _, role := range materialRoles {
+		p := palettes[role.palette]
+		light[role.name] = p.tone(role.light)
+		dark[role.name] = p.tone(role.dark)
+	}
+	light["source"], dark["source"] = source, source
+	return Palettes{switcher.Light: light, switcher.Dark: dark}, nil
+}
+
+// WallpaperColor returns the most prominent colorful color of the image at
+// path, as #rrggbb, to derive Material You schemes from. Images without one
+// get Material's default blue.
+func WallpaperColor(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("unable to open wallpaper: %w", err)
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return "", fmt.Errorf("unable to decode wallpaper %s: %w", path, err)
+	}
+
+	// sample about 128x128 pixels, and count the colorful ones by hue.
+	const bins = 36
+	var counts [bins]float64
+	var sums [bins][3]float64
+	bounds := img.Bounds()
+	step := bounds.Dx() / 128
+	if h := bounds.Dy() / 128; h > step {
+		step = h
+	}
+	if step < 1 {
+		step = 1
+	}
+	for y := bounds.Min.Y; y < bounds.Max.Y; y += step {
+		for x := bounds.Min.X; x < bounds.Max.X; x += step {
+			r, g, b, _ := img.At(x, y).RGBA()
+			c := rgbToLCh(float64(r>>8), float64(g>>8), float64(b>>8))
+			if c.c < 15 || c.l < 10 || c.l > 95 {
+				continue
+			}
+			bin := int(c.h/(360/bins)) % bins
+			counts[bin]++
+			sums[bin][0] += float64(r >> 8)
+			sums[bin][1] += float64(g >> 8)
+			sums[bin][2] += float64(b >> 8)
+		}
+	}
+
+	// neighbouring hues count half, so gradients aren't split up.
+	best, bestScore := -1, 0.0
+	for i := range counts {
+		score := counts[i] + (counts[(i+bins-1)%bins]+counts[(i+1)%bins])/2
+		if counts[i] > 0 && score > bestScore {
+			best, bestScore = i, score
+		}
+	}
+	if best < 0 {
+		return "#4285f4", nil
+	}
+	n := counts[best]
+	return fmt.Sprintf("#%02x%02x%02x", int(sums[best][0]/n), int(sums[best][1]/n), int(sums[best][2]/n)), nil
+}
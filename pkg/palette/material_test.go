@@ -0,0 +1,149 @@
+package palette
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/flokli/theme-switcher/pkg/switcher"
+)
+
+func TestTonalPaletteMonotonic(t *testing.T) {
+	for _, seed := range []string{"#3584e4", "#e62d42", "#2ec27e", "#f6d32d", "#9141ac", "#808080"} {
+		r, g, b, err := parseHex(seed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		seedHue := rgbToLCh(r, g, b).h
+		for _, p := range []tonalPalette{{seedHue, 36}, {seedHue, 6}, {seedHue + 60, 24}} {
+			last := -1.0
+			for tone := 0.0; tone <= 100; tone += 5 {
+				l, err := luminance(p.tone(tone))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if l < last {
+					t.Errorf("%s: tone %v of %+v is darker than the one before", seed, tone, p)
+				}
+				last = l
+			}
+			if black, white := p.tone(0), p.tone(100); black != "#000000" || white != "#ffffff" {
+				t.Errorf("%s: tones 0 and 100 of %+v are %s and %s, want black and white", seed, p, black, white)
+			}
+		}
+	}
+}
+
+func TestMaterial(t *testing.T) {
+	palettes, err := Material("#3584e4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, mode := range []switcher.Mode{switcher.Light, switcher.Dark} {
+		p := palettes[mode]
+		if len(p) != len(materialRoles)+1 || p["source"] != "#3584e4" {
+			t.Errorf("%s: got %d colors, source %s", mode, len(p), p["source"])
+		}
+		// the hue of the source color is kept.
+		r, g, b, _ := parseHex(p["primary"])
+		if h := rgbToLCh(r, g, b).h; math.Abs(h-rgbToLCh(0x35, 0x84, 0xe4).h) > 3 {
+			t.Errorf("%s: primary %s has hue %v", mode, p["primary"], h)
+		}
+		// colors on others are readable.
+		for _, pair := range [][2]string{
+			{"primary", "on_primary"},
+			{"primary_container", "on_primary_container"},
+			{"surface", "on_surface"},
+			{"error", "on_error"},
+		} {
+			if c, _ := contrast(p[pair[0]], p[pair[1]]); c < 4.5 {
+				t.Errorf("%s: contrast of %s %s and %s %s is %v", mode, pair[0], p[pair[0]], pair[1], p[pair[1]], c)
+			}
+		}
+	}
+
+	// light mode is light, and dark mode dark.
+	light, _ := luminance(palettes[switcher.Light]["surface"])
+	dark, _ := luminance(palettes[switcher.Dark]["surface"])
+	if light < 0.8 || dark > 0.05 {
+		t.Errorf("surface luminance is %v in light and %v in dark mode", light, dark)
+	}
+
+	if _, err := Material("blue"); err == nil {
+		t.Error("Material accepted an invalid color")
+	}
+}
+
+// writeImage writes an image of w×h pixels colored by at to a PNG file.
+func writeImage(t *testing.T, w, h int, at func(x, y int) color.Color) string {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, at(x, y))
+		}
+	}
+	path := filepath.Join(t.TempDir(), "wallpaper.png")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := png.Encode(f, img); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestWallpaperColor(t *testing.T) {
+	blue := color.RGBA{0x35, 0x84, 0xe4, 0xff}
+	red := color.RGBA{0xe6, 0x2d, 0x42, 0xff}
+	gray := color.RGBA{0x80, 0x80, 0x80, 0xff}
+	white := color.RGBA{0xff, 0xff, 0xff, 0xff}
+
+	for _, tt := range []struct {
+		name string
+		at   func(x, y int) color.Color
+		want string
+	}{
+		{
+			// the gray and white pixels outnumber the blue ones, but
+			// aren't colorful.
+			name: "colorful over gray",
+			at: func(x, y int) color.Color {
+				switch {
+				case y < 200:
+					return gray
+				case y < 300:
+					return white
+				case x < 50:
+					return red
+				}
+				return blue
+			},
+			want: "#3584e4",
+		},
+		{
+			name: "no colorful pixels",
+			at: func(x, y int) color.Color {
+				if x < 200 {
+					return gray
+				}
+				return white
+			},
+			want: "#4285f4",
+		},
+	} {
+		path := writeImage(t, 400, 400, tt.at)
+		if got, err := WallpaperColor(path); err != nil || got != tt.want {
+			t.Errorf("%s: got %s, %v, want %s", tt.name, got, err, tt.want)
+		}
+	}
+
+	if _, err := WallpaperColor(filepath.Join(t.TempDir(), "missing.png")); err == nil {
+		t.Error("missing wallpaper accepted")
+	}
+}
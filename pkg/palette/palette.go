@@ -0,0 +1,93 @@
+// Package palette provides the named colors passed to templates and hooks.
+package palette
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/flokli/theme-switcher/pkg/switcher"
+)
+
+// Palette maps color names, like base00 or bg, to colors as #rrggbb.
+type Palette map[string]string
+
+// Palettes maps each mode to the palette used in it.
+type Palettes map[switcher.Mode]Palette
+
+// For returns the palette for mode. Without one for NoPreference, the one for
+// Light is used, and without one for a defined mode, the one of the mode it's
+// based on, like with themes.
+func (p Palettes) For(mode switcher.Mode) Palette {
+	if palette, ok := p[mode]; ok || mode == mode.Appearance() {
+		return palette
+	}
+	return p[mode.Appearance()]
+}
+
+// Pair holds the palettes of light and dark mode, passed to templates to use
+// the colors of either, like .Palette.Dark.base00.
+type Pair struct {
+	// Name is the name of the palette in the configuration, if it's a named
+	// one.
+	Name  string
+	Light Palette
+	Dark  Palette
+}
+
+// Pair returns the palettes of light and dark mode, named name.
+func (p Palettes) Pair(name string) Pair {
+	return Pair{Name: name, Light: p.For(switcher.Light), Dark: p.For(switcher.Dark)}
+}
+
+// Parse returns the palette of colors, by name, normalizing them to #rrggbb.
+func Parse(colors map[string]string) (Palette, error) {
+	p := make(Palette, len(colors))
+	for name, color := range colors {
+		normalized, err := normalize(color)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", name, err)
+		}
+		p[name] = normalized
+	}
+	return p, nil
+}
+
+// Merge returns a palette with the colors of p, and those of other taking
+// precedence.
+func (p Palette) Merge(other Palette) Palette {
+	merged := make(Palette, len(p)+len(other))
+	for name, color := range p {
+		merged[name] = color
+	}
+	for name, color := range other {
+		merged[name] = color
+	}
+	return merged
+}
+
+// Env returns environment variables passing the palette to commands, like
+// $THEME_SWITCHER_COLOR_BASE00, sorted by name.
+func (p Palette) Env() []string { return p.EnvPrefix("THEME_SWITCHER_COLOR_") }
+
+// EnvPrefix returns environment variables passing the palette to commands,
+// named by prefix followed by the color name in uppercase, sorted by name.
+func (p Palette) EnvPrefix(prefix string) []string {
+	env := make([]string, 0, len(p))
+	for name, color := range p {
+		name = strings.ToUpper(strings.NewReplacer("-", "_", ".", "_").Replace(name))
+		env = append(env, prefix+name+"="+color)
+	}
+	sort.Strings(env)
+	return env
+}
+
+// normalize returns color as lowercase #rrggbb, accepting it with or without
+// the leading #.
+func normalize(color string) (string, error) {
+	hex := strings.ToLower(strings.TrimPrefix(strings.TrimSpace(color), "#"))
+	if len(hex) != 6 || strings.Trim(hex, "0123456789abcdef") != "" {
+		return "", fmt.Errorf("invalid color %q, expected #rrggbb", color)
+	}
+	return "#" + hex, nil
+}
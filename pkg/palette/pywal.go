@@ -0,0 +1,58 @@
+package palette
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// pywalFile is the colors.json pywal writes to its cache dir, which wallust
+// can render too.
+type pywalFile struct {
+	Special map[string]string `json:"special"`
+	Colors  map[string]string `json:"colors"`
+}
+
+// PywalCacheDir returns the directory pywal writes its colors to,
+// $PYWAL_CACHE_DIR, or ~/.cache/wal.
+func PywalCacheDir() (string, error) {
+	if dir := os.Getenv("PYWAL_CACHE_DIR"); dir != "" {
+		return dir, nil
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("unable to determine home dir: %w", err)
+	}
+	return filepath.Join(homeDir, ".cache", "wal"), nil
+}
+
+// LoadPywal reads the colors of a colors.json written by pywal: background,
+// foreground and cursor, and color0 to color15.
+func LoadPywal(path string) (Palette, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read pywal colors: %w", err)
+	}
+	var f pywalFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("unable to parse pywal colors %s: %w", path, err)
+	}
+	colors := make(map[string]string, len(f.Special)+len(f.Colors))
+	for name, color := range f.Colors {
+		colors[name] = color
+	}
+	for name, color := range f.Special {
+		colors[name] = color
+	}
+	p, err := Parse(colors)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pywal colors in %s: %w", path, err)
+	}
+	for i := 0; i < 16; i++ {
+		if _, ok := p[fmt.Sprintf("color%d", i)]; !ok {
+			return nil, fmt.Errorf("pywal colors %s are missing color%d", path, i)
+		}
+	}
+	return p, nil
+}
@@ -0,0 +1,184 @@
+package sources
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/flokli/theme-switcher/pkg/switcher"
+	"github.com/godbus/dbus/v5"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	sensorProxyBusName   = "net.hadess.SensorProxy"
+	sensorProxyPath      = dbus.ObjectPath("/net/hadess/SensorProxy")
+	sensorProxyInterface = "net.hadess.SensorProxy"
+)
+
+// AmbientLight switches to light mode in bright surroundings, and to dark
+// mode in dim ones, using the ambient light sensor via iio-sensor-proxy.
+// Between the two thresholds, the mode is kept, so it doesn't flip back and
+// forth around a single one.
+type AmbientLight struct {
+	// DarkBelow is the light level below which dark mode is used, in lux.
+	DarkBelow float64
+	// LightAbove is the light level above which light mode is used, in lux.
+	LightAbove float64
+
+	mu   sync.Mutex
+	last switcher.Mode
+}
+
+func (a *AmbientLight) Name() string { return "ambient-light" }
+
+// modeFor returns the mode for the given light level, and remembers it.
+func (a *AmbientLight) modeFor(level float64) switcher.Mode {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	switch {
+	case level < a.DarkBelow:
+		a.last = switcher.Dark
+	case level > a.LightAbove:
+		a.last = switcher.Light
+	case a.last == "":
+		// without a previous mode, use the closer threshold.
+		if level-a.DarkBelow < a.LightAbove-level {
+			a.last = switcher.Dark
+		} else {
+			a.last = switcher.Light
+		}
+	}
+	return a.last
+}
+
+// claimLight connects to iio-sensor-proxy, and starts reading the ambient
+// light sensor. The returned function stops reading, and disconnects. It may
+// be called multiple times.
+func claimLight(ctx context.Context) (*dbus.Conn, func(), error) {
+	conn, err := dbus.ConnectSystemBus(dbus.WithContext(ctx))
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to connect to system bus: %w", err)
+	}
+	proxy := conn.Object(sensorProxyBusName, sensorProxyPath)
+
+	var hasLight bool
+	if err := proxy.StoreProperty(sensorProxyInterface+".HasAmbientLight", &hasLight); err != nil {
+		conn.Close()
+		return nil, nil, fmt.Errorf("unable to query iio-sensor-proxy: %w", err)
+	}
+	if !hasLight {
+		conn.Close()
+		return nil, nil, errors.New("no ambient light sensor")
+	}
+
+	var unit string
+	if err := proxy.StoreProperty(sensorProxyInterface+".LightLevelUnit", &unit); err == nil && unit != "lux" {
+		log.Warnf("ambient light sensor reports %s units instead of lux, thresholds might need adjusting", unit)
+	}
+
+	if err := proxy.CallWithContext(ctx, sensorProxyInterface+".ClaimLight", 0).Err; err != nil {
+		conn.Close()
+		return nil, nil, fmt.Errorf("unable to claim ambient light sensor: %w", err)
+	}
+	var once sync.Once
+	return conn, func() {
+		once.Do(func() {
+			// the claim is also dropped when we disconnect, so errors don't matter.
+			proxy.Call(sensorProxyInterface+".ReleaseLight", 0)
+			conn.Close()
+		})
+	}, nil
+}
+
+// Get returns the mode for the current light level.
+func (a *AmbientLight) Get(ctx context.Context) (switcher.Mode, error) {
+	conn, release, err := claimLight(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer release()
+
+	var level float64
+	if err := conn.Object(sensorProxyBusName, sensorProxyPath).StoreProperty(sensorProxyInterface+".LightLevel", &level); err != nil {
+		return "", fmt.Errorf("unable to read light level: %w", err)
+	}
+	return a.modeFor(level), nil
+}
+
+// Watch subscribes to changes of the light level, and writes the mode to the
+// returned channel whenever it crosses a threshold.
+func (a *AmbientLight) Watch(ctx context.Context) (<-chan switcher.Mode, error) {
+	conn, release, err := claimLight(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := conn.AddMatchSignalContext(ctx,
+		dbus.WithMatchObjectPath(sensorProxyPath),
+		dbus.WithMatchInterface("org.freedesktop.DBus.Properties"),
+		dbus.WithMatchMember("PropertiesChanged"),
+	); err != nil {
+		release()
+		return nil, fmt.Errorf("unable to subscribe to light level changes: %w", err)
+	}
+
+	signals := make(chan *dbus.Signal, 16)
+	conn.Signal(signals)
+
+	a.mu.Lock()
+	last := a.last
+	a.mu.Unlock()
+
+	v := make(chan switcher.Mode)
+
+	go func() {
+		defer close(v)
+		defer release()
+
+		for sig := range signals {
+			var iface string
+			var changed map[string]dbus.Variant
+			var invalidated []string
+			if sig.Name != "org.freedesktop.DBus.Properties.PropertiesChanged" ||
+				dbus.Store(sig.Body, &iface, &changed, &invalidated) != nil || iface != sensorProxyInterface {
+				continue
+			}
+			value, ok := changed["LightLevel"]
+			if !ok {
+				continue
+			}
+			var level float64
+			if err := value.Store(&level); err != nil {
+				log.WithError(err).Warn("unable to parse light level")
+				continue
+			}
+
+			mode := a.modeFor(level)
+			log.Tracef("light level %g, mode %s", level, mode)
+			if mode == last {
+				continue
+			}
+			last = mode
+			select {
+			case v <- mode:
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		if ctx.Err() == nil {
+			log.Warn("lost connection to system bus")
+		}
+	}()
+
+	// close the connection once we're done, which closes the signals channel.
+	go func() {
+		<-ctx.Done()
+		release()
+	}()
+
+	return v, nil
+}
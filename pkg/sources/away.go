@@ -0,0 +1,124 @@
+package sources
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/godbus/dbus/v5"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	logindBusName          = "org.freedesktop.login1"
+	logindPath             = dbus.ObjectPath("/org/freedesktop/login1")
+	logindManagerInterface = "org.freedesktop.login1.Manager"
+	logindSessionInterface = "org.freedesktop.login1.Session"
+)
+
+// Away tells to pause switching while nobody's looking: while the session is
+// locked, or idle, according to systemd-logind. Switching once the user is
+// back keeps a suspended or locked laptop from piling up config rewrites and
+// reloads.
+type Away struct {
+	// Locked pauses while the session is locked.
+	Locked bool
+	// Idle pauses while the session is idle.
+	Idle bool
+}
+
+func (a *Away) Name() string { return "away" }
+
+// logindSession returns the path of our logind session.
+func logindSession(ctx context.Context, conn *dbus.Conn) (dbus.ObjectPath, error) {
+	// without $XDG_SESSION_ID, logind looks up the session of our PID.
+	id := os.Getenv("XDG_SESSION_ID")
+	if id == "" {
+		id = "auto"
+	}
+	var path dbus.ObjectPath
+	if err := conn.Object(logindBusName, logindPath).CallWithContext(ctx, logindManagerInterface+".GetSession", 0, id).Store(&path); err != nil {
+		return "", fmt.Errorf("unable to find logind session: %w", err)
+	}
+	return path, nil
+}
+
+// away returns true if the session is locked or idle, whichever is wanted.
+// Failing to read a property counts as not being away.
+func (a *Away) away(session dbus.BusObject) bool {
+	for _, hint := range []struct {
+		wanted   bool
+		property string
+	}{{a.Locked, "LockedHint"}, {a.Idle, "IdleHint"}} {
+		if !hint.wanted {
+			continue
+		}
+		var set bool
+		if err := session.StoreProperty(logindSessionInterface+"."+hint.property, &set); err != nil {
+			log.WithError(err).Debugf("unable to read %s", hint.property)
+		} else if set {
+			return true
+		}
+	}
+	return false
+}
+
+// WatchPaused subscribes to changes of the session, and writes whether it's
+// locked or idle to the returned channel whenever that changes, or right away
+// if it already is.
+func (a *Away) WatchPaused(ctx context.Context) (<-chan bool, error) {
+	conn, err := dbus.ConnectSystemBus(dbus.WithContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to system bus: %w", err)
+	}
+	path, err := logindSession(ctx, conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if err := conn.AddMatchSignalContext(ctx,
+		dbus.WithMatchObjectPath(path),
+		dbus.WithMatchInterface("org.freedesktop.DBus.Properties"),
+		dbus.WithMatchMember("PropertiesChanged"),
+	); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("unable to subscribe to session changes: %w", err)
+	}
+	signals := make(chan *dbus.Signal, 16)
+	conn.Signal(signals)
+
+	obj := conn.Object(logindBusName, path)
+
+	v := make(chan bool)
+
+	go func() {
+		defer close(v)
+		defer conn.Close()
+
+		last := false
+		for {
+			if away := a.away(obj); away != last {
+				last = away
+				select {
+				case v <- away:
+				case <-ctx.Done():
+					return
+				}
+			}
+
+			select {
+			case _, ok := <-signals:
+				if !ok {
+					if ctx.Err() == nil {
+						log.Warn("lost connection to logind")
+					}
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return v, nil
+}
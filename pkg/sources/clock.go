@@ -0,0 +1,53 @@
+package sources
+
+import (
+	"context"
+	"time"
+
+	"github.com/flokli/theme-switcher/pkg/switcher"
+	log "github.com/sirupsen/logrus"
+)
+
+// watchClock writes the mode to the returned channel whenever it changes
+// according to modeAt, which returns the mode at a given time, and when it
+// changes next.
+func watchClock(ctx context.Context, modeAt func(time.Time) (switcher.Mode, time.Time)) <-chan switcher.Mode {
+	v := make(chan switcher.Mode)
+
+	go func() {
+		defer close(v)
+
+		last, next := modeAt(time.Now())
+		log.Debugf("next change at %s", next.Format(time.RFC3339))
+		for {
+			// timers don't advance while suspended, so check at least every
+			// minute whether we slept past the next change.
+			wait := time.Until(next)
+			if wait > time.Minute {
+				wait = time.Minute
+			}
+			t := time.NewTimer(wait)
+			select {
+			case <-t.C:
+			case <-ctx.Done():
+				t.Stop()
+				return
+			}
+
+			var mode switcher.Mode
+			mode, next = modeAt(time.Now())
+			if mode == last {
+				continue
+			}
+			last = mode
+			log.Debugf("next change at %s", next.Format(time.RFC3339))
+			select {
+			case v <- mode:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return v
+}
@@ -0,0 +1,147 @@
+package sources
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/flokli/theme-switcher/pkg/switcher"
+	"github.com/godbus/dbus/v5"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	darkmanBusName   = "nl.whynothugo.darkman"
+	darkmanPath      = dbus.ObjectPath("/nl/whynothugo/darkman")
+	darkmanInterface = "nl.whynothugo.darkman"
+)
+
+// Darkman follows the mode decided by a running darkman, via its D-Bus
+// service, for setups where darkman already does the scheduling.
+type Darkman struct{}
+
+func (d *Darkman) Name() string { return "darkman" }
+
+// darkmanMode maps a mode reported by darkman to a mode.
+func darkmanMode(mode string) (switcher.Mode, error) {
+	switch mode {
+	case "light":
+		return switcher.Light, nil
+	case "dark":
+		return switcher.Dark, nil
+	default:
+		return "", fmt.Errorf("unknown darkman mode: %s", mode)
+	}
+}
+
+// Detect returns nil if darkman is running. Unlike calling it, this doesn't
+// start it via D-Bus activation.
+func (d *Darkman) Detect(ctx context.Context) error {
+	conn, err := dbus.ConnectSessionBus(dbus.WithContext(ctx))
+	if err != nil {
+		return fmt.Errorf("unable to connect to session bus: %w", err)
+	}
+	defer conn.Close()
+
+	var running bool
+	if err := conn.BusObject().CallWithContext(ctx, "org.freedesktop.DBus.NameHasOwner", 0, darkmanBusName).Store(&running); err != nil {
+		return err
+	}
+	if !running {
+		return errors.New("darkman not running")
+	}
+	return nil
+}
+
+// Get returns the mode darkman currently reports.
+func (d *Darkman) Get(ctx context.Context) (switcher.Mode, error) {
+	conn, err := dbus.ConnectSessionBus(dbus.WithContext(ctx))
+	if err != nil {
+		return "", fmt.Errorf("unable to connect to session bus: %w", err)
+	}
+	defer conn.Close()
+
+	var mode string
+	if err := conn.Object(darkmanBusName, darkmanPath).StoreProperty(darkmanInterface+".Mode", &mode); err != nil {
+		return "", fmt.Errorf("unable to read darkman mode: %w", err)
+	}
+	return darkmanMode(mode)
+}
+
+// Set tells darkman to switch to mode. With no preference, it's switched to
+// light mode.
+func (d *Darkman) Set(ctx context.Context, mode switcher.Mode) error {
+	value := string(mode.Appearance())
+	if switcher.IsDryRun(ctx) {
+		log.Infof("would set darkman mode to %s", value)
+		return nil
+	}
+
+	conn, err := dbus.ConnectSessionBus(dbus.WithContext(ctx))
+	if err != nil {
+		return fmt.Errorf("unable to connect to session bus: %w", err)
+	}
+	defer conn.Close()
+
+	if err := conn.Object(darkmanBusName, darkmanPath).SetProperty(darkmanInterface+".Mode", dbus.MakeVariant(value)); err != nil {
+		return fmt.Errorf("unable to set darkman mode: %w", err)
+	}
+	return nil
+}
+
+// Watch subscribes to darkman's ModeChanged signal, and writes the new mode
+// to the returned channel whenever it changes.
+func (d *Darkman) Watch(ctx context.Context) (<-chan switcher.Mode, error) {
+	conn, err := dbus.ConnectSessionBus(dbus.WithContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to session bus: %w", err)
+	}
+
+	if err := conn.AddMatchSignalContext(ctx,
+		dbus.WithMatchObjectPath(darkmanPath),
+		dbus.WithMatchInterface(darkmanInterface),
+		dbus.WithMatchMember("ModeChanged"),
+	); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("unable to subscribe to darkman mode changes: %w", err)
+	}
+
+	signals := make(chan *dbus.Signal, 16)
+	conn.Signal(signals)
+
+	v := make(chan switcher.Mode)
+
+	go func() {
+		defer close(v)
+		defer conn.Close()
+
+		for sig := range signals {
+			var value string
+			if sig.Name != darkmanInterface+".ModeChanged" || dbus.Store(sig.Body, &value) != nil {
+				continue
+			}
+			mode, err := darkmanMode(value)
+			if err != nil {
+				log.WithError(err).Warn("unable to parse darkman mode")
+				continue
+			}
+			select {
+			case v <- mode:
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		if ctx.Err() == nil {
+			log.Warn("lost connection to session bus")
+		}
+	}()
+
+	// close the connection once we're done, which closes the signals channel.
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+
+	return v, nil
+}
@@ -0,0 +1,86 @@
+package sources
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/flokli/theme-switcher/pkg/switcher"
+	log "github.com/sirupsen/logrus"
+)
+
+// probeTimeout is how long probing a single source may take.
+const probeTimeout = 3 * time.Second
+
+// detector is implemented by sources that can tell whether they're usable
+// more reliably than by getting the current mode.
+type detector interface {
+	Detect(ctx context.Context) error
+}
+
+// probe returns nil if source is usable on this system.
+func probe(ctx context.Context, source switcher.Source) error {
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+
+	if d, ok := source.(detector); ok {
+		if err := d.Detect(ctx); err != nil {
+			return err
+		}
+	}
+	_, err := source.Get(ctx)
+	return err
+}
+
+// Detect returns the first of candidates that's usable on this system.
+func Detect(ctx context.Context, candidates ...switcher.Source) (switcher.Source, error) {
+	var failed []string
+	for _, source := range candidates {
+		if err := probe(ctx, source); err != nil {
+			log.WithError(err).WithField("source", source.Name()).Debug("source not usable")
+			failed = append(failed, fmt.Sprintf("%s: %v", source.Name(), err))
+			continue
+		}
+		log.WithField("source", source.Name()).Debug("detected source")
+		return source, nil
+	}
+	if len(failed) == 0 {
+		return nil, errors.New("no sources to detect")
+	}
+	return nil, fmt.Errorf("no usable source found: %s", strings.Join(failed, ", "))
+}
+
+// Candidates returns the sources to detect on this platform, the ones
+// belonging to the current desktop first. desktops are the sources of
+// desktops needing configuration, keyed by their (uppercase) name in
+// $XDG_CURRENT_DESKTOP, like KDE. fallback is used if none works.
+func Candidates(desktops map[string]switcher.Source, fallback switcher.Source) []switcher.Source {
+	switch runtime.GOOS {
+	case "darwin":
+		return []switcher.Source{&MacOS{}, fallback}
+	case "windows":
+		return []switcher.Source{&Windows{}, fallback}
+	}
+
+	// XDG_CURRENT_DESKTOP is a colon-separated list, like "ubuntu:GNOME".
+	var candidates []switcher.Source
+	for _, desktop := range strings.Split(os.Getenv("XDG_CURRENT_DESKTOP"), ":") {
+		desktop = strings.ToUpper(desktop)
+		switch desktop {
+		case "GNOME", "UNITY", "PANTHEON", "BUDGIE":
+			candidates = append(candidates, &GSettings{})
+		default:
+			if source, ok := desktops[desktop]; ok {
+				candidates = append(candidates, source)
+			}
+		}
+	}
+	// the portal works on most desktops, and dconf might be written to
+	// by something else, like a gsettings call in a window manager config.
+	candidates = append(candidates, &Portal{}, &GSettings{}, fallback)
+	return candidates
+}
@@ -0,0 +1,61 @@
+package sources
+
+import (
+	"context"
+
+	"github.com/flokli/theme-switcher/pkg/switcher"
+)
+
+// modes returns a channel receiving the modes of all ColorSchemeChanged
+// events, for implementing Watch on top of WatchEvents.
+// It's closed once events is.
+func modes(ctx context.Context, events <-chan switcher.Event) <-chan switcher.Mode {
+	v := make(chan switcher.Mode)
+	go func() {
+		defer close(v)
+		for event := range events {
+			if event.Kind != switcher.ColorSchemeChanged {
+				continue
+			}
+			select {
+			case v <- event.Mode:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return v
+}
+
+// watchEvents watches source for sources wrapping it: through WatchEvents if
+// it's an EventSource, or reporting its modes as ColorSchemeChanged events.
+func watchEvents(ctx context.Context, source switcher.Source) (<-chan switcher.Event, error) {
+	if eventSource, ok := source.(switcher.EventSource); ok {
+		return eventSource.WatchEvents(ctx)
+	}
+	modes, err := source.Watch(ctx)
+	if err != nil {
+		return nil, err
+	}
+	v := make(chan switcher.Event)
+	go func() {
+		defer close(v)
+		for mode := range modes {
+			select {
+			case v <- switcher.Event{Kind: switcher.ColorSchemeChanged, Mode: mode}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return v, nil
+}
+
+// readAppearance returns the Appearance of source, if it's an
+// AppearanceSource, for sources wrapping it.
+func readAppearance(ctx context.Context, source switcher.Source) (switcher.Appearance, error) {
+	if appearanceSource, ok := source.(switcher.AppearanceSource); ok {
+		return appearanceSource.Appearance(ctx)
+	}
+	return switcher.Appearance{}, nil
+}
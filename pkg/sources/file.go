@@ -0,0 +1,138 @@
+package sources
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/flokli/theme-switcher/pkg/switcher"
+	"github.com/fsnotify/fsnotify"
+	log "github.com/sirupsen/logrus"
+)
+
+// File reads the mode from a plain text file, containing "light", "dark" or
+// "no-preference", so scripts can switch by writing to it.
+type File struct {
+	Path string
+}
+
+func (f *File) Name() string { return "file" }
+
+// DefaultModeFile returns the default path of the mode file,
+// $XDG_STATE_HOME/theme-mode.
+func DefaultModeFile() (string, error) {
+	stateDir := os.Getenv("XDG_STATE_HOME")
+	if stateDir == "" {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("unable to determine home dir: %w", err)
+		}
+		stateDir = filepath.Join(homeDir, ".local", "state")
+	}
+	return filepath.Join(stateDir, "theme-mode"), nil
+}
+
+// Get returns the mode written to the file.
+func (f *File) Get(ctx context.Context) (switcher.Mode, error) {
+	data, err := os.ReadFile(f.Path)
+	if err != nil {
+		return "", fmt.Errorf("unable to read mode file: %w", err)
+	}
+	return switcher.ParseMode(strings.TrimSpace(string(data)))
+}
+
+// Set writes mode to the file.
+func (f *File) Set(ctx context.Context, mode switcher.Mode) error {
+	if switcher.IsDryRun(ctx) {
+		log.Infof("would write %s to %s", mode, f.Path)
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(f.Path), 0o755); err != nil {
+		return fmt.Errorf("unable to create mode file dir: %w", err)
+	}
+	if err := os.WriteFile(f.Path, []byte(string(mode)+"\n"), 0o644); err != nil {
+		return fmt.Errorf("unable to write mode file: %w", err)
+	}
+	return nil
+}
+
+// Watch watches the file for changes, and writes the mode to the returned
+// channel whenever it changes. The file doesn't need to exist yet.
+func (f *File) Watch(ctx context.Context) (<-chan switcher.Mode, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("unable to create file watcher: %w", err)
+	}
+
+	// editors and scripts often replace the file instead of writing to it,
+	// so watch the directory.
+	path := filepath.Clean(f.Path)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		watcher.Close()
+		return nil, fmt.Errorf("unable to create mode file dir: %w", err)
+	}
+	if err := watcher.Add(filepath.Dir(path)); err != nil {
+		watcher.Close()
+		return nil, fmt.Errorf("unable to watch %s: %w", filepath.Dir(path), err)
+	}
+
+	last, err := f.Get(ctx)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.WithError(err).Warn("unable to read mode file")
+	}
+
+	v := make(chan switcher.Mode)
+
+	go func() {
+		defer close(v)
+		defer watcher.Close()
+
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if filepath.Clean(event.Name) != path || !event.Has(fsnotify.Write) && !event.Has(fsnotify.Create) {
+					continue
+				}
+				mode, err := f.Get(ctx)
+				if err != nil {
+					// writes might truncate the file first, so only complain about errors other than empty files.
+					if !errors.Is(err, os.ErrNotExist) && !isEmptyFile(path) {
+						log.WithError(err).Warn("unable to read mode file")
+					}
+					continue
+				}
+				if mode == last {
+					continue
+				}
+				last = mode
+				select {
+				case v <- mode:
+				case <-ctx.Done():
+					return
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				log.WithError(err).Warn("unable to watch mode file")
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return v, nil
+}
+
+// isEmptyFile returns true if path is an empty file.
+func isEmptyFile(path string) bool {
+	fi, err := os.Stat(path)
+	return err == nil && fi.Size() == 0
+}
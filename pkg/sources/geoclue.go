@@ -0,0 +1,115 @@
+package sources
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/godbus/dbus/v5"
+)
+
+const (
+	geoclueBusName         = "org.freedesktop.GeoClue2"
+	geoclueManagerPath     = dbus.ObjectPath("/org/freedesktop/GeoClue2/Manager")
+	geoclueManagerIface    = "org.freedesktop.GeoClue2.Manager"
+	geoclueClientInterface = "org.freedesktop.GeoClue2.Client"
+	geoclueLocationIface   = "org.freedesktop.GeoClue2.Location"
+
+	// geoclueAccuracyCity is the GClueAccuracyLevel for city-level accuracy,
+	// which is plenty for sunrise and sunset, and doesn't need GPS.
+	geoclueAccuracyCity = uint32(4)
+)
+
+// Location is a position on earth, in degrees.
+type Location struct {
+	Latitude  float64
+	Longitude float64
+}
+
+func (l Location) String() string {
+	return fmt.Sprintf("%g,%g", l.Latitude, l.Longitude)
+}
+
+// ParseLocation parses a location like "52.52,13.40", latitude first.
+func ParseLocation(s string) (Location, error) {
+	latitude, longitude, ok := strings.Cut(s, ",")
+	if !ok {
+		return Location{}, fmt.Errorf("invalid location %s, expected LATITUDE,LONGITUDE", s)
+	}
+
+	var l Location
+	var err error
+	if l.Latitude, err = strconv.ParseFloat(strings.TrimSpace(latitude), 64); err != nil || l.Latitude < -90 || l.Latitude > 90 {
+		return Location{}, fmt.Errorf("invalid latitude %s", latitude)
+	}
+	if l.Longitude, err = strconv.ParseFloat(strings.TrimSpace(longitude), 64); err != nil || l.Longitude < -180 || l.Longitude > 180 {
+		return Location{}, fmt.Errorf("invalid longitude %s", longitude)
+	}
+	return l, nil
+}
+
+// geoclueLocation asks geoclue for the current location. It's usually
+// determined from nearby WiFi networks or the IP address.
+func geoclueLocation(ctx context.Context) (Location, error) {
+	conn, err := dbus.ConnectSystemBus(dbus.WithContext(ctx))
+	if err != nil {
+		return Location{}, fmt.Errorf("unable to connect to system bus: %w", err)
+	}
+	defer conn.Close()
+
+	var clientPath dbus.ObjectPath
+	if err := conn.Object(geoclueBusName, geoclueManagerPath).CallWithContext(ctx, geoclueManagerIface+".GetClient", 0).Store(&clientPath); err != nil {
+		return Location{}, fmt.Errorf("unable to create geoclue client: %w", err)
+	}
+	client := conn.Object(geoclueBusName, clientPath)
+
+	// geoclue refuses clients not telling who they are.
+	if err := client.SetProperty(geoclueClientInterface+".DesktopId", dbus.MakeVariant("theme-switcher")); err != nil {
+		return Location{}, fmt.Errorf("unable to set geoclue desktop id: %w", err)
+	}
+	if err := client.SetProperty(geoclueClientInterface+".RequestedAccuracyLevel", dbus.MakeVariant(geoclueAccuracyCity)); err != nil {
+		return Location{}, fmt.Errorf("unable to set geoclue accuracy: %w", err)
+	}
+
+	if err := conn.AddMatchSignalContext(ctx,
+		dbus.WithMatchObjectPath(clientPath),
+		dbus.WithMatchInterface(geoclueClientInterface),
+		dbus.WithMatchMember("LocationUpdated"),
+	); err != nil {
+		return Location{}, fmt.Errorf("unable to subscribe to geoclue location updates: %w", err)
+	}
+	signals := make(chan *dbus.Signal, 1)
+	conn.Signal(signals)
+
+	if err := client.CallWithContext(ctx, geoclueClientInterface+".Start", 0).Err; err != nil {
+		return Location{}, fmt.Errorf("unable to start geoclue client: %w", err)
+	}
+	defer client.Call(geoclueClientInterface+".Stop", 0)
+
+	for {
+		select {
+		case sig, ok := <-signals:
+			if !ok {
+				return Location{}, errors.New("lost connection to system bus")
+			}
+			var oldPath, newPath dbus.ObjectPath
+			if sig.Name != geoclueClientInterface+".LocationUpdated" || dbus.Store(sig.Body, &oldPath, &newPath) != nil {
+				continue
+			}
+
+			location := conn.Object(geoclueBusName, newPath)
+			var l Location
+			if err := location.StoreProperty(geoclueLocationIface+".Latitude", &l.Latitude); err != nil {
+				return Location{}, fmt.Errorf("unable to read latitude: %w", err)
+			}
+			if err := location.StoreProperty(geoclueLocationIface+".Longitude", &l.Longitude); err != nil {
+				return Location{}, fmt.Errorf("unable to read longitude: %w", err)
+			}
+			return l, nil
+		case <-ctx.Done():
+			return Location{}, fmt.Errorf("no location from geoclue: %w", ctx.Err())
+		}
+	}
+}
@@ -0,0 +1,266 @@
+package sources
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/flokli/theme-switcher/internal/dconf"
+	"github.com/flokli/theme-switcher/pkg/switcher"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// colorSchemeKey is the dconf path of org.gnome.desktop.interface color-scheme.
+	colorSchemeKey = "/org/gnome/desktop/interface/color-scheme"
+	// accentColorKey is the dconf path of org.gnome.desktop.interface accent-color.
+	accentColorKey = "/org/gnome/desktop/interface/accent-color"
+	// highContrastKey is the dconf path of org.gnome.desktop.a11y.interface high-contrast.
+	highContrastKey = "/org/gnome/desktop/a11y/interface/high-contrast"
+	// pictureURIKey and pictureURIDarkKey are the dconf paths of
+	// org.gnome.desktop.background picture-uri and picture-uri-dark.
+	pictureURIKey     = "/org/gnome/desktop/background/picture-uri"
+	pictureURIDarkKey = "/org/gnome/desktop/background/picture-uri-dark"
+)
+
+// interfaceSchema is the file the org.gnome.desktop.interface schema is
+// installed as, by gsettings-desktop-schemas.
+const interfaceSchema = "org.gnome.desktop.interface.gschema.xml"
+
+// gnomeAccentColors maps the values of the accent-color key to the colors
+// libadwaita uses for them.
+var gnomeAccentColors = map[string]string{
+	"blue":   "#3584e4",
+	"teal":   "#2190a4",
+	"green":  "#3a944a",
+	"yellow": "#c88800",
+	"orange": "#ed5b00",
+	"red":    "#e62d42",
+	"pink":   "#d56199",
+	"purple": "#9141ac",
+	"slate":  "#6f8396",
+}
+
+// GSettings reads the mode from GNOME's org.gnome.desktop.interface color-scheme setting.
+type GSettings struct{}
+
+func (g *GSettings) Name() string { return "gsettings" }
+
+// gsettingsMode maps a value of the color-scheme key to a mode. Values it
+// doesn't know, like ones added by future GNOME versions, are matched by
+// whether they mention dark or light, and mean no preference otherwise, so
+// changes to them aren't dropped.
+func gsettingsMode(colorScheme string) switcher.Mode {
+	// tolerate the quoting of gsettings get, and stray whitespace.
+	colorScheme = strings.ToLower(strings.Trim(strings.TrimSpace(colorScheme), `'"`))
+	switch colorScheme {
+	case "prefer-dark":
+		return switcher.Dark
+	case "prefer-light":
+		return switcher.Light
+	case "default", "":
+		return switcher.NoPreference
+	}
+	log.WithField("color-scheme", colorScheme).Warn("unknown color scheme, guessing the mode from its name")
+	switch {
+	case strings.Contains(colorScheme, "dark"):
+		return switcher.Dark
+	case strings.Contains(colorScheme, "light"):
+		return switcher.Light
+	}
+	return switcher.NoPreference
+}
+
+// Detect returns nil if the org.gnome.desktop.interface schema is installed,
+// and there's a dconf user database. It's only written once a setting was
+// changed, but GNOME does that on first login, at the latest.
+func (g *GSettings) Detect(ctx context.Context) error {
+	if !schemaInstalled() {
+		return fmt.Errorf("the org.gnome.desktop.interface schema isn't installed, this doesn't seem to be a GNOME system (no %s)", interfaceSchema)
+	}
+	dbPath, err := dconf.UserDBPath()
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(dbPath); err != nil {
+		return fmt.Errorf("no dconf database at %s, no GNOME setting was ever changed: %w", dbPath, err)
+	}
+	return nil
+}
+
+// schemaInstalled returns whether the org.gnome.desktop.interface schema is
+// in $GSETTINGS_SCHEMA_DIR, or the glib-2.0/schemas directory of
+// $XDG_DATA_HOME or $XDG_DATA_DIRS, where gsettings looks for it.
+func schemaInstalled() bool {
+	dirs := filepath.SplitList(os.Getenv("GSETTINGS_SCHEMA_DIR"))
+	dataHome := os.Getenv("XDG_DATA_HOME")
+	if homeDir, err := os.UserHomeDir(); dataHome == "" && err == nil {
+		dataHome = filepath.Join(homeDir, ".local", "share")
+	}
+	dataDirs := os.Getenv("XDG_DATA_DIRS")
+	if dataDirs == "" {
+		dataDirs = "/usr/local/share:/usr/share"
+	}
+	for _, dir := range append([]string{dataHome}, filepath.SplitList(dataDirs)...) {
+		dirs = append(dirs, filepath.Join(dir, "glib-2.0", "schemas"))
+	}
+	for _, dir := range dirs {
+		if _, err := os.Stat(filepath.Join(dir, interfaceSchema)); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Get returns the mode currently selected in org.gnome.desktop.interface color-scheme.
+func (g *GSettings) Get(ctx context.Context) (switcher.Mode, error) {
+	colorScheme, ok, err := dconf.ReadString(colorSchemeKey)
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		colorScheme = "default"
+	}
+	return gsettingsMode(colorScheme), nil
+}
+
+// Set writes the color-scheme value corresponding to mode to dconf.
+func (g *GSettings) Set(ctx context.Context, mode switcher.Mode) error {
+	var colorScheme string
+	switch mode.Base() {
+	case switcher.Dark:
+		colorScheme = "prefer-dark"
+	case switcher.Light:
+		colorScheme = "prefer-light"
+	default:
+		colorScheme = "default"
+	}
+	if switcher.IsDryRun(ctx) {
+		log.Infof("would set %s to %s", colorSchemeKey, colorScheme)
+		return nil
+	}
+	return dconf.WriteString(ctx, colorSchemeKey, colorScheme)
+}
+
+// Appearance returns the accent color, high contrast setting and wallpaper.
+func (g *GSettings) Appearance(ctx context.Context) (switcher.Appearance, error) {
+	var appearance switcher.Appearance
+
+	accentColor, ok, err := dconf.ReadString(accentColorKey)
+	if err != nil {
+		return appearance, err
+	}
+	if ok {
+		appearance.AccentColor = gnomeAccentColors[accentColor]
+	}
+
+	if appearance.HighContrast, _, err = dconf.ReadBool(highContrastKey); err != nil {
+		return appearance, err
+	}
+
+	if appearance.Wallpaper, err = g.wallpaper(ctx); err != nil {
+		return appearance, err
+	}
+	return appearance, nil
+}
+
+// wallpaper returns the path of the wallpaper GNOME shows in the current
+// mode, picture-uri-dark in dark mode (if set), picture-uri otherwise.
+func (g *GSettings) wallpaper(ctx context.Context) (string, error) {
+	uri, _, err := dconf.ReadString(pictureURIKey)
+	if err != nil {
+		return "", err
+	}
+	if mode, err := g.Get(ctx); err == nil && mode == switcher.Dark {
+		darkURI, ok, err := dconf.ReadString(pictureURIDarkKey)
+		if err != nil {
+			return "", err
+		}
+		if ok {
+			uri = darkURI
+		}
+	}
+	return wallpaperPath(uri), nil
+}
+
+// wallpaperPath returns the path of a file:// URI, or uri itself if it's none.
+func wallpaperPath(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return uri
+	}
+	return u.Path
+}
+
+// Watch watches org.gnome.desktop.interface color-scheme in dconf for
+// changes, and writes the selected mode to the channel it returns.
+func (g *GSettings) Watch(ctx context.Context) (<-chan switcher.Mode, error) {
+	events, err := g.WatchEvents(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return modes(ctx, events), nil
+}
+
+// WatchEvents watches org.gnome.desktop.interface color-scheme, the wallpaper
+// and the other appearance settings in dconf for changes, and reports them as events.
+func (g *GSettings) WatchEvents(ctx context.Context) (<-chan switcher.Event, error) {
+	v := make(chan switcher.Event)
+
+	changes, err := dconf.Watch(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to watch dconf: %w", err)
+	}
+
+	go func() {
+		defer close(v)
+
+		for path := range changes {
+			// a single change can affect multiple keys, if a whole dir was reset.
+			var events []switcher.Event
+			if dconf.Affects(path, colorSchemeKey) {
+				mode, err := g.Get(ctx)
+				if err != nil {
+					log.WithError(err).Warn("unable to read color scheme")
+				} else {
+					events = append(events, switcher.Event{Kind: switcher.ColorSchemeChanged, Mode: mode})
+				}
+			}
+			// switching the mode picks up the wallpaper of the new one anyway.
+			wallpaperChanged := dconf.Affects(path, pictureURIKey) || dconf.Affects(path, pictureURIDarkKey)
+			if dconf.Affects(path, accentColorKey) || dconf.Affects(path, highContrastKey) || wallpaperChanged {
+				appearance, err := g.Appearance(ctx)
+				if err != nil {
+					log.WithError(err).Warn("unable to read appearance")
+				} else {
+					if dconf.Affects(path, accentColorKey) {
+						events = append(events, switcher.Event{Kind: switcher.AccentColorChanged, AccentColor: appearance.AccentColor})
+					}
+					if dconf.Affects(path, highContrastKey) {
+						events = append(events, switcher.Event{Kind: switcher.ContrastChanged, HighContrast: appearance.HighContrast})
+					}
+					if wallpaperChanged {
+						events = append(events, switcher.Event{Kind: switcher.WallpaperChanged, Wallpaper: appearance.Wallpaper})
+					}
+				}
+			}
+
+			for _, event := range events {
+				select {
+				case v <- event:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+
+		if ctx.Err() == nil {
+			log.Warn("lost connection to dconf")
+		}
+	}()
+
+	return v, nil
+}
@@ -0,0 +1,29 @@
+package sources
+
+import (
+	"testing"
+
+	"github.com/flokli/theme-switcher/pkg/switcher"
+)
+
+func TestGSettingsMode(t *testing.T) {
+	for _, tt := range []struct {
+		colorScheme string
+		want        switcher.Mode
+	}{
+		{"prefer-dark", switcher.Dark},
+		{"'prefer-dark'", switcher.Dark},
+		{"'prefer-dark'\n", switcher.Dark},
+		{`"prefer-light"`, switcher.Light},
+		{"Prefer-Light", switcher.Light},
+		{"default", switcher.NoPreference},
+		{"'default'", switcher.NoPreference},
+		{"", switcher.NoPreference},
+		{"prefer-foo", switcher.NoPreference},
+		{"prefer-darker", switcher.Dark},
+	} {
+		if got := gsettingsMode(tt.colorScheme); got != tt.want {
+			t.Errorf("gsettingsMode(%q) = %v, want %v", tt.colorScheme, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package sources
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/flokli/theme-switcher/internal/dconf"
+	"github.com/flokli/theme-switcher/pkg/switcher"
+	log "github.com/sirupsen/logrus"
+)
+
+// GTKTheme reads the mode from the GTK theme setting of desktops without a
+// color scheme setting, like Cinnamon and MATE, in dconf.
+// Themes with "dark" in their name are dark, all others light.
+type GTKTheme struct {
+	// Desktop is the name of the desktop, like "cinnamon".
+	Desktop string
+	// Key is the dconf path of the GTK theme setting.
+	Key string
+	// Default is the theme used while Key isn't set, the schema default.
+	Default string
+
+	// Themes are the GTK themes Set applies for each mode.
+	Themes switcher.Themes
+}
+
+// NewCinnamon returns a GTKTheme following Cinnamon's
+// org.cinnamon.desktop.interface gtk-theme setting.
+func NewCinnamon(themes switcher.Themes) *GTKTheme {
+	return &GTKTheme{
+		Desktop: "cinnamon",
+		Key:     "/org/cinnamon/desktop/interface/gtk-theme",
+		Default: "Adwaita",
+		Themes:  themes,
+	}
+}
+
+// NewMATE returns a GTKTheme following MATE's org.mate.interface gtk-theme setting.
+func NewMATE(themes switcher.Themes) *GTKTheme {
+	return &GTKTheme{
+		Desktop: "mate",
+		Key:     "/org/mate/desktop/interface/gtk-theme",
+		Default: "Menta",
+		Themes:  themes,
+	}
+}
+
+func (g *GTKTheme) Name() string { return g.Desktop }
+
+// gtkThemeMode maps a GTK theme name to a mode.
+func gtkThemeMode(theme string) switcher.Mode {
+	if strings.Contains(strings.ToLower(theme), "dark") {
+		return switcher.Dark
+	}
+	return switcher.Light
+}
+
+// Detect returns nil if there's a dconf user database.
+func (g *GTKTheme) Detect(ctx context.Context) error {
+	return (&GSettings{}).Detect(ctx)
+}
+
+// Get returns the mode of the current GTK theme.
+func (g *GTKTheme) Get(ctx context.Context) (switcher.Mode, error) {
+	theme, ok, err := dconf.ReadString(g.Key)
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		theme = g.Default
+	}
+	return gtkThemeMode(theme), nil
+}
+
+// Set writes the GTK theme configured for mode to dconf.
+func (g *GTKTheme) Set(ctx context.Context, mode switcher.Mode) error {
+	theme, ok := g.Themes.Lookup(mode)
+	if !ok {
+		return fmt.Errorf("no %s theme configured for %s mode", g.Desktop, mode)
+	}
+	if switcher.IsDryRun(ctx) {
+		log.Infof("would set %s to %s", g.Key, theme)
+		return nil
+	}
+	return dconf.WriteString(ctx, g.Key, theme)
+}
+
+// Watch watches the GTK theme setting in dconf for changes, and writes the
+// mode to the returned channel whenever it changes.
+func (g *GTKTheme) Watch(ctx context.Context) (<-chan switcher.Mode, error) {
+	changes, err := dconf.Watch(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to watch dconf: %w", err)
+	}
+
+	last, err := g.Get(ctx)
+	if err != nil {
+		log.WithError(err).Warnf("unable to read %s theme", g.Desktop)
+	}
+
+	v := make(chan switcher.Mode)
+
+	go func() {
+		defer close(v)
+
+		for path := range changes {
+			if !dconf.Affects(path, g.Key) {
+				continue
+			}
+			mode, err := g.Get(ctx)
+			if err != nil {
+				log.WithError(err).Warnf("unable to read %s theme", g.Desktop)
+				continue
+			}
+			if mode == last {
+				continue
+			}
+			last = mode
+			select {
+			case v <- mode:
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		if ctx.Err() == nil {
+			log.Warn("lost connection to dconf")
+		}
+	}()
+
+	return v, nil
+}
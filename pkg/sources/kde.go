@@ -0,0 +1,209 @@
+package sources
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/flokli/theme-switcher/pkg/switcher"
+	"github.com/godbus/dbus/v5"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	kdeConfigPath      = dbus.ObjectPath("/kdeglobals")
+	kdeConfigInterface = "org.kde.kconfig.notify"
+)
+
+// KDE reads the mode from the color scheme of KDE Plasma, in kdeglobals.
+// Schemes with a dark window background are dark, all others light.
+type KDE struct {
+	// Themes are the color schemes Set applies for each mode, with
+	// plasma-apply-colorscheme.
+	Themes switcher.Themes
+}
+
+func (k *KDE) Name() string { return "kde" }
+
+// kdeGlobalsPaths returns the paths kdeglobals is read from, the user one
+// first, then the system-wide ones.
+func kdeGlobalsPaths() []string {
+	var paths []string
+	if confDir, err := os.UserConfigDir(); err == nil {
+		paths = append(paths, filepath.Join(confDir, "kdeglobals"))
+	}
+	configDirs := os.Getenv("XDG_CONFIG_DIRS")
+	if configDirs == "" {
+		configDirs = "/etc/xdg"
+	}
+	for _, dir := range filepath.SplitList(configDirs) {
+		paths = append(paths, filepath.Join(dir, "kdeglobals"))
+	}
+	return paths
+}
+
+// readKDEConfig reads the keys of an INI-style KDE config file, by group.
+// Flags like [$e] are stripped from the keys.
+func readKDEConfig(path string) (map[string]map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	config := make(map[string]map[string]string)
+	var group map[string]string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "" || strings.HasPrefix(line, "#"):
+		case strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]"):
+			name := line[1 : len(line)-1]
+			if config[name] == nil {
+				config[name] = make(map[string]string)
+			}
+			group = config[name]
+		case group != nil:
+			key, value, ok := strings.Cut(line, "=")
+			if !ok {
+				continue
+			}
+			if i := strings.Index(key, "[$"); i >= 0 {
+				key = key[:i]
+			}
+			group[strings.TrimSpace(key)] = strings.TrimSpace(value)
+		}
+	}
+	return config, scanner.Err()
+}
+
+// kdeMode determines the mode of a kdeglobals config.
+func kdeMode(config map[string]map[string]string) switcher.Mode {
+	// the window background tells for all schemes, as r,g,b.
+	if background, ok := config["Colors:Window"]["BackgroundNormal"]; ok {
+		var rgb [3]float64
+		parts := strings.Split(background, ",")
+		if len(parts) >= 3 {
+			for i := range rgb {
+				rgb[i], _ = strconv.ParseFloat(strings.TrimSpace(parts[i]), 64)
+			}
+			if 0.2126*rgb[0]+0.7152*rgb[1]+0.0722*rgb[2] < 128 {
+				return switcher.Dark
+			}
+			return switcher.Light
+		}
+	}
+
+	// otherwise, go by name. Breeze, the default, is light.
+	for _, name := range []string{config["General"]["ColorScheme"], config["KDE"]["LookAndFeelPackage"]} {
+		if strings.Contains(strings.ToLower(name), "dark") {
+			return switcher.Dark
+		}
+	}
+	return switcher.Light
+}
+
+// Get returns the mode of the current KDE color scheme.
+func (k *KDE) Get(ctx context.Context) (switcher.Mode, error) {
+	for _, path := range kdeGlobalsPaths() {
+		config, err := readKDEConfig(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return "", fmt.Errorf("unable to read %s: %w", path, err)
+		}
+		return kdeMode(config), nil
+	}
+	return "", errors.New("no kdeglobals found")
+}
+
+// Set applies the color scheme configured for mode.
+func (k *KDE) Set(ctx context.Context, mode switcher.Mode) error {
+	theme, ok := k.Themes.Lookup(mode)
+	if !ok {
+		return fmt.Errorf("no KDE color scheme configured for %s mode", mode)
+	}
+	cmd := exec.CommandContext(ctx, "plasma-apply-colorscheme", theme)
+	if switcher.IsDryRun(ctx) {
+		log.Infof("would run %s", cmd)
+		return nil
+	}
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("unable to apply color scheme %s: %w: %s", theme, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// Watch subscribes to the notifications sent whenever kdeglobals is changed,
+// and writes the mode to the returned channel whenever it changes.
+func (k *KDE) Watch(ctx context.Context) (<-chan switcher.Mode, error) {
+	conn, err := dbus.ConnectSessionBus(dbus.WithContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to session bus: %w", err)
+	}
+
+	if err := conn.AddMatchSignalContext(ctx,
+		dbus.WithMatchObjectPath(kdeConfigPath),
+		dbus.WithMatchInterface(kdeConfigInterface),
+		dbus.WithMatchMember("ConfigChanged"),
+	); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("unable to subscribe to KDE config changes: %w", err)
+	}
+
+	last, err := k.Get(ctx)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	signals := make(chan *dbus.Signal, 16)
+	conn.Signal(signals)
+
+	v := make(chan switcher.Mode)
+
+	go func() {
+		defer close(v)
+		defer conn.Close()
+
+		for sig := range signals {
+			if sig.Name != kdeConfigInterface+".ConfigChanged" {
+				continue
+			}
+			mode, err := k.Get(ctx)
+			if err != nil {
+				log.WithError(err).Warn("unable to read KDE color scheme")
+				continue
+			}
+			if mode == last {
+				continue
+			}
+			last = mode
+			select {
+			case v <- mode:
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		if ctx.Err() == nil {
+			log.Warn("lost connection to session bus")
+		}
+	}()
+
+	// close the connection once we're done, which closes the signals channel.
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+
+	return v, nil
+}
@@ -0,0 +1,19 @@
+package sources
+
+import (
+	"errors"
+	"time"
+)
+
+// errNotMacOS is returned by the MacOS source on other platforms.
+var errNotMacOS = errors.New("only supported on macOS")
+
+// MacOS reads the mode from the macOS appearance setting (AppleInterfaceStyle).
+// As there's no way to subscribe to changes without cgo, it's polled.
+type MacOS struct {
+	// PollInterval is how often the setting is checked for changes.
+	// Defaults to 2 seconds.
+	PollInterval time.Duration
+}
+
+func (m *MacOS) Name() string { return "macos" }
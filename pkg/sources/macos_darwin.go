@@ -0,0 +1,91 @@
+package sources
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/flokli/theme-switcher/pkg/switcher"
+	log "github.com/sirupsen/logrus"
+)
+
+// Get returns the mode currently selected in the macOS appearance settings.
+func (m *MacOS) Get(ctx context.Context) (switcher.Mode, error) {
+	out, err := exec.CommandContext(ctx, "defaults", "read", "-g", "AppleInterfaceStyle").Output()
+	if err != nil {
+		// the key is removed entirely in light mode, making defaults exit nonzero.
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return switcher.Light, nil
+		}
+		return "", fmt.Errorf("unable to read AppleInterfaceStyle: %w", err)
+	}
+
+	if strings.TrimSpace(string(out)) == "Dark" {
+		return switcher.Dark, nil
+	}
+	return switcher.Light, nil
+}
+
+// Set switches the macOS appearance setting to the given mode.
+func (m *MacOS) Set(ctx context.Context, mode switcher.Mode) error {
+	script := fmt.Sprintf(`tell application "System Events" to tell appearance preferences to set dark mode to %t`, mode.Appearance() == switcher.Dark)
+	if switcher.IsDryRun(ctx) {
+		log.Infof("would run osascript -e %s", script)
+		return nil
+	}
+	if out, err := exec.CommandContext(ctx, "osascript", "-e", script).CombinedOutput(); err != nil {
+		return fmt.Errorf("unable to set appearance: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// Watch polls the macOS appearance setting, and writes the mode to the
+// returned channel whenever it changes.
+func (m *MacOS) Watch(ctx context.Context) (<-chan switcher.Mode, error) {
+	interval := m.PollInterval
+	if interval == 0 {
+		interval = 2 * time.Second
+	}
+
+	last, err := m.Get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	v := make(chan switcher.Mode)
+
+	go func() {
+		defer close(v)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				mode, err := m.Get(ctx)
+				if err != nil {
+					log.WithError(err).Warn("unable to read appearance")
+					continue
+				}
+				if mode == last {
+					continue
+				}
+				last = mode
+				select {
+				case v <- mode:
+				case <-ctx.Done():
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return v, nil
+}
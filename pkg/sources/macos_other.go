@@ -0,0 +1,21 @@
+//go:build !darwin
+
+package sources
+
+import (
+	"context"
+
+	"github.com/flokli/theme-switcher/pkg/switcher"
+)
+
+func (m *MacOS) Get(ctx context.Context) (switcher.Mode, error) {
+	return "", errNotMacOS
+}
+
+func (m *MacOS) Set(ctx context.Context, mode switcher.Mode) error {
+	return errNotMacOS
+}
+
+func (m *MacOS) Watch(ctx context.Context) (<-chan switcher.Mode, error) {
+	return nil, errNotMacOS
+}
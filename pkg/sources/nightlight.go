@@ -0,0 +1,180 @@
+package sources
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/flokli/theme-switcher/internal/dconf"
+	"github.com/flokli/theme-switcher/pkg/switcher"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// nightLightDir is the dconf path of org.gnome.settings-daemon.plugins.color.
+	nightLightDir = "/org/gnome/settings-daemon/plugins/color/"
+
+	nightLightAutomaticKey   = nightLightDir + "night-light-schedule-automatic"
+	nightLightFromKey        = nightLightDir + "night-light-schedule-from"
+	nightLightToKey          = nightLightDir + "night-light-schedule-to"
+	nightLightCoordinatesKey = nightLightDir + "night-light-last-coordinates"
+)
+
+// NightLight switches along with the schedule of GNOME's Night Light: to dark
+// mode when it starts, and to light mode when it ends. That's sunset and
+// sunrise at the last location gnome-settings-daemon got from geoclue, or
+// the manually configured times.
+type NightLight struct{}
+
+func (n *NightLight) Name() string { return "night-light" }
+
+// hoursToDuration converts fractional hours since midnight, like 20.5, to the
+// time since midnight, rounded to minutes.
+func hoursToDuration(hours float64) time.Duration {
+	return time.Duration(math.Round(hours*60)) * time.Minute
+}
+
+// modeAt reads the Night Light schedule, and returns a function returning the
+// mode at a given time, and when it changes next.
+func (n *NightLight) modeAt() (func(time.Time) (switcher.Mode, time.Time), error) {
+	automatic, ok, err := dconf.ReadBool(nightLightAutomaticKey)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		automatic = true
+	}
+	if automatic {
+		// invalid coordinates mean the location isn't known (yet), in which
+		// case gnome-settings-daemon also uses the manual schedule.
+		coordinates, ok, err := dconf.ReadDoubles(nightLightCoordinatesKey, 2)
+		if err != nil {
+			return nil, err
+		}
+		if ok && math.Abs(coordinates[0]) <= 90 && math.Abs(coordinates[1]) <= 180 {
+			l := Location{Latitude: coordinates[0], Longitude: coordinates[1]}
+			return func(t time.Time) (switcher.Mode, time.Time) {
+				return sunModeAt(t, l, 0, 0)
+			}, nil
+		}
+	}
+
+	// the schema defaults.
+	from, to := 20.0, 6.0
+	if value, ok, err := dconf.ReadDouble(nightLightFromKey); err != nil {
+		return nil, err
+	} else if ok {
+		from = value
+	}
+	if value, ok, err := dconf.ReadDouble(nightLightToKey); err != nil {
+		return nil, err
+	} else if ok {
+		to = value
+	}
+
+	schedule := Schedule{Light: hoursToDuration(to), Dark: hoursToDuration(from)}
+	if schedule.Light == schedule.Dark {
+		return nil, fmt.Errorf("invalid Night Light schedule, it starts and ends at the same time")
+	}
+	return schedule.modeAt, nil
+}
+
+// Get returns dark mode while Night Light is scheduled, and light mode otherwise.
+func (n *NightLight) Get(ctx context.Context) (switcher.Mode, error) {
+	modeAt, err := n.modeAt()
+	if err != nil {
+		return "", err
+	}
+	mode, _ := modeAt(time.Now())
+	return mode, nil
+}
+
+// affectsNightLight returns true if a change to path, as sent by dconf.Watch,
+// affects the Night Light schedule.
+func affectsNightLight(path string) bool {
+	for _, key := range []string{nightLightAutomaticKey, nightLightFromKey, nightLightToKey, nightLightCoordinatesKey} {
+		if dconf.Affects(path, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// Watch writes the new mode to the returned channel whenever Night Light
+// starts or ends, and whenever its schedule is changed.
+func (n *NightLight) Watch(ctx context.Context) (<-chan switcher.Mode, error) {
+	changes, err := dconf.Watch(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to watch dconf: %w", err)
+	}
+
+	modeAt, err := n.modeAt()
+	if err != nil {
+		return nil, err
+	}
+
+	v := make(chan switcher.Mode)
+
+	go func() {
+		defer close(v)
+
+		last, _ := modeAt(time.Now())
+		for {
+			// the clock is restarted whenever the schedule changes.
+			clockCtx, cancel := context.WithCancel(ctx)
+			modes := watchClock(clockCtx, modeAt)
+
+		watch:
+			for {
+				select {
+				case mode, ok := <-modes:
+					if !ok {
+						cancel()
+						return
+					}
+					last = mode
+					select {
+					case v <- mode:
+					case <-ctx.Done():
+						cancel()
+						return
+					}
+				case path, ok := <-changes:
+					if !ok {
+						cancel()
+						if ctx.Err() == nil {
+							log.Warn("lost connection to dconf")
+						}
+						return
+					}
+					if !affectsNightLight(path) {
+						continue
+					}
+					newModeAt, err := n.modeAt()
+					if err != nil {
+						log.WithError(err).Warn("unable to read Night Light schedule")
+						continue
+					}
+					modeAt = newModeAt
+					break watch
+				}
+			}
+			cancel()
+
+			log.Debug("Night Light schedule changed")
+			mode, _ := modeAt(time.Now())
+			if mode == last {
+				continue
+			}
+			last = mode
+			select {
+			case v <- mode:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return v, nil
+}
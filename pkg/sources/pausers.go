@@ -0,0 +1,95 @@
+package sources
+
+import (
+	"context"
+	"errors"
+
+	"github.com/flokli/theme-switcher/pkg/switcher"
+	log "github.com/sirupsen/logrus"
+)
+
+// Pausers pauses switching while any of its pausers tells to.
+type Pausers []switcher.Pauser
+
+func (p Pausers) Name() string {
+	if len(p) == 1 {
+		return p[0].Name()
+	}
+	return "pausers"
+}
+
+// WatchPaused watches all pausers, and writes whether any of them tells to
+// pause to the returned channel whenever that changes. Pausers failing to
+// be watched, or stopping, don't pause anymore.
+func (p Pausers) WatchPaused(ctx context.Context) (<-chan bool, error) {
+	type change struct {
+		i       int
+		paused  bool
+		stopped bool
+	}
+	changes := make(chan change)
+	watching := 0
+	for i, pauser := range p {
+		ch, err := pauser.WatchPaused(ctx)
+		if err != nil {
+			log.WithError(err).WithField("pauser", pauser.Name()).Warn("unable to watch whether to pause, never pausing for it")
+			continue
+		}
+		watching++
+		go func(i int, ch <-chan bool) {
+			for paused := range ch {
+				select {
+				case changes <- change{i: i, paused: paused}:
+				case <-ctx.Done():
+					return
+				}
+			}
+			if ctx.Err() == nil {
+				log.WithField("pauser", p[i].Name()).Warn("watch stopped, no longer pausing for it")
+			}
+			select {
+			case changes <- change{i: i, stopped: true}:
+			case <-ctx.Done():
+			}
+		}(i, ch)
+	}
+	if watching == 0 {
+		return nil, errors.New("unable to watch any pauser")
+	}
+
+	v := make(chan bool)
+
+	go func() {
+		defer close(v)
+
+		pausing := make([]bool, len(p))
+		last := false
+		for watching > 0 {
+			select {
+			case c := <-changes:
+				pausing[c.i] = c.paused
+				if c.stopped {
+					watching--
+				}
+			case <-ctx.Done():
+				return
+			}
+
+			paused := false
+			for _, pauser := range pausing {
+				paused = paused || pauser
+			}
+			if paused == last {
+				continue
+			}
+			last = paused
+			select {
+			case v <- paused:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return v, nil
+}
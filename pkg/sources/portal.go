@@ -0,0 +1,236 @@
+package sources
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/flokli/theme-switcher/pkg/switcher"
+	"github.com/godbus/dbus/v5"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	portalBusName           = "org.freedesktop.portal.Desktop"
+	portalObjectPath        = dbus.ObjectPath("/org/freedesktop/portal/desktop")
+	portalSettingsInterface = "org.freedesktop.portal.Settings"
+
+	appearanceNamespace = "org.freedesktop.appearance"
+)
+
+// Portal reads the mode from the org.freedesktop.appearance color-scheme key
+// of the xdg-desktop-portal Settings interface. This is implemented by most
+// desktops, not just GNOME.
+type Portal struct{}
+
+func (p *Portal) Name() string { return "portal" }
+
+// portalMode maps a value of the color-scheme key to a mode.
+// It's 0 for no preference, 1 for prefer-dark, 2 for prefer-light.
+func portalMode(value dbus.Variant) (switcher.Mode, error) {
+	var colorScheme uint32
+	if err := value.Store(&colorScheme); err != nil {
+		return "", fmt.Errorf("unexpected color-scheme value %s: %w", value, err)
+	}
+	switch colorScheme {
+	case 0:
+		return switcher.NoPreference, nil
+	case 1:
+		return switcher.Dark, nil
+	case 2:
+		return switcher.Light, nil
+	default:
+		return "", fmt.Errorf("unknown color-scheme value %d", colorScheme)
+	}
+}
+
+// portalAccentColor maps a value of the accent-color key to #rrggbb.
+// It's an RGB triple of values between 0 and 1, anything else means unset.
+func portalAccentColor(value dbus.Variant) string {
+	var rgb []interface{}
+	if err := value.Store(&rgb); err != nil || len(rgb) != 3 {
+		return ""
+	}
+	var color [3]uint8
+	for i, v := range rgb {
+		f, ok := v.(float64)
+		if !ok || f < 0 || f > 1 {
+			return ""
+		}
+		color[i] = uint8(f*255 + 0.5)
+	}
+	return fmt.Sprintf("#%02x%02x%02x", color[0], color[1], color[2])
+}
+
+// portalHighContrast maps a value of the contrast key to whether high
+// contrast is enabled. It's 0 for no preference, 1 for high contrast.
+func portalHighContrast(value dbus.Variant) bool {
+	var contrast uint32
+	return value.Store(&contrast) == nil && contrast == 1
+}
+
+// readPortalSetting reads a single setting from the portal.
+func readPortalSetting(ctx context.Context, conn *dbus.Conn, namespace, key string) (dbus.Variant, error) {
+	obj := conn.Object(portalBusName, portalObjectPath)
+
+	var value dbus.Variant
+	err := obj.CallWithContext(ctx, portalSettingsInterface+".ReadOne", 0, namespace, key).Store(&value)
+	if err == nil {
+		return value, nil
+	}
+
+	// ReadOne was only added in version 2 of the interface. The deprecated
+	// Read wraps the value in another variant.
+	if err := obj.CallWithContext(ctx, portalSettingsInterface+".Read", 0, namespace, key).Store(&value); err != nil {
+		return dbus.Variant{}, portalError(err)
+	}
+	if inner, ok := value.Value().(dbus.Variant); ok {
+		return inner, nil
+	}
+	return value, nil
+}
+
+// portalError explains the errors of the portal meaning it isn't usable.
+func portalError(err error) error {
+	var dbusErr dbus.Error
+	if !errors.As(err, &dbusErr) {
+		return err
+	}
+	switch dbusErr.Name {
+	case "org.freedesktop.DBus.Error.ServiceUnknown":
+		return fmt.Errorf("xdg-desktop-portal isn't running or installed: %w", err)
+	case "org.freedesktop.DBus.Error.UnknownMethod", "org.freedesktop.DBus.Error.UnknownInterface",
+		"org.freedesktop.portal.Error.NotFound":
+		return fmt.Errorf("no portal backend provides the setting, install one for the desktop, like xdg-desktop-portal-gtk: %w", err)
+	}
+	return err
+}
+
+// Get returns the mode currently selected in the color-scheme portal setting.
+func (p *Portal) Get(ctx context.Context) (switcher.Mode, error) {
+	conn, err := dbus.ConnectSessionBus(dbus.WithContext(ctx))
+	if err != nil {
+		return "", fmt.Errorf("unable to connect to session bus: %w", err)
+	}
+	defer conn.Close()
+
+	value, err := readPortalSetting(ctx, conn, appearanceNamespace, "color-scheme")
+	if err != nil {
+		return "", fmt.Errorf("unable to read color-scheme from portal: %w", err)
+	}
+	return portalMode(value)
+}
+
+// Appearance returns the accent color and contrast portal settings.
+// They're only supported by some portal implementations, so missing ones are ignored.
+func (p *Portal) Appearance(ctx context.Context) (switcher.Appearance, error) {
+	var appearance switcher.Appearance
+
+	conn, err := dbus.ConnectSessionBus(dbus.WithContext(ctx))
+	if err != nil {
+		return appearance, fmt.Errorf("unable to connect to session bus: %w", err)
+	}
+	defer conn.Close()
+
+	if value, err := readPortalSetting(ctx, conn, appearanceNamespace, "accent-color"); err == nil {
+		appearance.AccentColor = portalAccentColor(value)
+	}
+	if value, err := readPortalSetting(ctx, conn, appearanceNamespace, "contrast"); err == nil {
+		appearance.HighContrast = portalHighContrast(value)
+	}
+	return appearance, nil
+}
+
+// Watch subscribes to changes of the color-scheme portal setting, and writes
+// the selected mode to the channel it returns.
+func (p *Portal) Watch(ctx context.Context) (<-chan switcher.Mode, error) {
+	events, err := p.WatchEvents(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return modes(ctx, events), nil
+}
+
+// WatchEvents subscribes to changes of the color-scheme portal setting, and
+// the other appearance settings, and reports them as events.
+func (p *Portal) WatchEvents(ctx context.Context) (<-chan switcher.Event, error) {
+	conn, err := dbus.ConnectSessionBus(dbus.WithContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to session bus: %w", err)
+	}
+
+	if err := conn.AddMatchSignalContext(ctx,
+		dbus.WithMatchInterface(portalSettingsInterface),
+		dbus.WithMatchMember("SettingChanged"),
+		dbus.WithMatchObjectPath(portalObjectPath),
+	); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("unable to subscribe to portal setting changes: %w", err)
+	}
+
+	// ensure the portal is there at all, rather than waiting for signals forever.
+	if _, err := readPortalSetting(ctx, conn, appearanceNamespace, "color-scheme"); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("unable to read color-scheme from portal: %w", err)
+	}
+
+	signals := make(chan *dbus.Signal, 16)
+	conn.Signal(signals)
+
+	v := make(chan switcher.Event)
+
+	go func() {
+		defer close(v)
+		defer conn.Close()
+
+		for sig := range signals {
+			if sig.Name != portalSettingsInterface+".SettingChanged" {
+				continue
+			}
+
+			var namespace, key string
+			var value dbus.Variant
+			if err := dbus.Store(sig.Body, &namespace, &key, &value); err != nil {
+				log.WithError(err).Warn("unable to parse SettingChanged signal")
+				continue
+			}
+			if namespace != appearanceNamespace {
+				continue
+			}
+			var event switcher.Event
+			switch key {
+			case "color-scheme":
+				mode, err := portalMode(value)
+				if err != nil {
+					log.WithError(err).Warn("unable to parse color scheme")
+					continue
+				}
+				event = switcher.Event{Kind: switcher.ColorSchemeChanged, Mode: mode}
+			case "accent-color":
+				event = switcher.Event{Kind: switcher.AccentColorChanged, AccentColor: portalAccentColor(value)}
+			case "contrast":
+				event = switcher.Event{Kind: switcher.ContrastChanged, HighContrast: portalHighContrast(value)}
+			default:
+				continue
+			}
+
+			select {
+			case v <- event:
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		if ctx.Err() == nil {
+			log.Warn("lost connection to session bus")
+		}
+	}()
+
+	// close the connection once we're done, which closes the signals channel.
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+
+	return v, nil
+}
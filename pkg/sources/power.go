@@ -0,0 +1,208 @@
+package sources
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/flokli/theme-switcher/pkg/switcher"
+	"github.com/godbus/dbus/v5"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	upowerBusName   = "org.freedesktop.UPower"
+	upowerPath      = dbus.ObjectPath("/org/freedesktop/UPower")
+	upowerInterface = "org.freedesktop.UPower"
+
+	// power-profiles-daemon moved to the UPower namespace in 0.20, but still
+	// provides its old name.
+	powerProfilesBusName   = "org.freedesktop.UPower.PowerProfiles"
+	powerProfilesPath      = dbus.ObjectPath("/org/freedesktop/UPower/PowerProfiles")
+	powerProfilesInterface = "org.freedesktop.UPower.PowerProfiles"
+
+	legacyPowerProfilesBusName   = "net.hadess.PowerProfiles"
+	legacyPowerProfilesPath      = dbus.ObjectPath("/net/hadess/PowerProfiles")
+	legacyPowerProfilesInterface = "net.hadess.PowerProfiles"
+)
+
+// PowerSaving wraps a source, and reports Mode instead while saving power,
+// like a dark theme for OLED screens while on battery.
+type PowerSaving struct {
+	switcher.Source
+	Mode switcher.Mode
+
+	// OnBattery saves power while running on battery, according to UPower.
+	OnBattery bool
+	// PowerSaver saves power in the power-saver profile of power-profiles-daemon.
+	PowerSaver bool
+}
+
+// savingPower returns true if power is being saved. Missing services count
+// as not saving power.
+func (p *PowerSaving) savingPower(conn *dbus.Conn) bool {
+	if p.OnBattery {
+		var onBattery bool
+		if err := conn.Object(upowerBusName, upowerPath).StoreProperty(upowerInterface+".OnBattery", &onBattery); err != nil {
+			log.WithError(err).Debug("unable to query UPower")
+		} else if onBattery {
+			return true
+		}
+	}
+
+	if p.PowerSaver {
+		var profile string
+		err := conn.Object(powerProfilesBusName, powerProfilesPath).StoreProperty(powerProfilesInterface+".ActiveProfile", &profile)
+		if err != nil {
+			err = conn.Object(legacyPowerProfilesBusName, legacyPowerProfilesPath).StoreProperty(legacyPowerProfilesInterface+".ActiveProfile", &profile)
+		}
+		if err != nil {
+			log.WithError(err).Debug("unable to query power-profiles-daemon")
+		} else if profile == "power-saver" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Get returns Mode while saving power, and the mode of the wrapped source otherwise.
+func (p *PowerSaving) Get(ctx context.Context) (switcher.Mode, error) {
+	conn, err := dbus.ConnectSystemBus(dbus.WithContext(ctx))
+	if err != nil {
+		log.WithError(err).Debug("unable to connect to system bus")
+	} else {
+		defer conn.Close()
+		if p.savingPower(conn) {
+			return p.Mode, nil
+		}
+	}
+	return p.Source.Get(ctx)
+}
+
+// Set writes mode to the wrapped source, if it supports it.
+func (p *PowerSaving) Set(ctx context.Context, mode switcher.Mode) error {
+	if setter, ok := p.Source.(switcher.Setter); ok {
+		return setter.Set(ctx, mode)
+	}
+	return nil
+}
+
+// Clear clears the wrapped source, if it supports it.
+func (p *PowerSaving) Clear(ctx context.Context) error {
+	if clearer, ok := p.Source.(switcher.Clearer); ok {
+		return clearer.Clear(ctx)
+	}
+	return nil
+}
+
+// Appearance returns the Appearance of the wrapped source, if it reports one.
+func (p *PowerSaving) Appearance(ctx context.Context) (switcher.Appearance, error) {
+	return readAppearance(ctx, p.Source)
+}
+
+// Watch watches the wrapped source, and whether power is being saved, and
+// writes the resulting mode to the returned channel whenever it changes.
+func (p *PowerSaving) Watch(ctx context.Context) (<-chan switcher.Mode, error) {
+	events, err := p.WatchEvents(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return modes(ctx, events), nil
+}
+
+// WatchEvents is like Watch, but reports the resulting mode as events, along
+// with the other events of the wrapped source.
+func (p *PowerSaving) WatchEvents(ctx context.Context) (<-chan switcher.Event, error) {
+	events, err := watchEvents(ctx, p.Source)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := dbus.ConnectSystemBus(dbus.WithContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to system bus: %w", err)
+	}
+	for _, path := range []dbus.ObjectPath{upowerPath, powerProfilesPath, legacyPowerProfilesPath} {
+		if err := conn.AddMatchSignalContext(ctx,
+			dbus.WithMatchObjectPath(path),
+			dbus.WithMatchInterface("org.freedesktop.DBus.Properties"),
+			dbus.WithMatchMember("PropertiesChanged"),
+		); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("unable to subscribe to power changes: %w", err)
+		}
+	}
+	signals := make(chan *dbus.Signal, 16)
+	conn.Signal(signals)
+
+	mode, err := p.Source.Get(ctx)
+	if err != nil {
+		log.WithError(err).WithField("source", p.Source.Name()).Warn("unable to get current mode")
+	}
+	saving := p.savingPower(conn)
+
+	// effective returns the mode to report.
+	effective := func() switcher.Mode {
+		if saving {
+			return p.Mode
+		}
+		return mode
+	}
+	last := effective()
+
+	v := make(chan switcher.Event)
+
+	go func() {
+		defer close(v)
+		defer conn.Close()
+
+		for {
+			select {
+			case event, ok := <-events:
+				if !ok {
+					return
+				}
+				if event.Kind != switcher.ColorSchemeChanged {
+					select {
+					case v <- event:
+					case <-ctx.Done():
+						return
+					}
+					continue
+				}
+				mode = event.Mode
+			case _, ok := <-signals:
+				if !ok {
+					if ctx.Err() == nil {
+						log.Warn("lost connection to system bus")
+					}
+					return
+				}
+				if s := p.savingPower(conn); s != saving {
+					saving = s
+					log.Infof("power saving: %t", saving)
+				}
+			case <-ctx.Done():
+				return
+			}
+
+			if effective() == last || effective() == "" {
+				continue
+			}
+			last = effective()
+			select {
+			case v <- switcher.Event{Kind: switcher.ColorSchemeChanged, Mode: last}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	// close the connection once we're done, which closes the signals channel.
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+
+	return v, nil
+}
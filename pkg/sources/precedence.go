@@ -0,0 +1,336 @@
+package sources
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/flokli/theme-switcher/pkg/switcher"
+	log "github.com/sirupsen/logrus"
+)
+
+// errNoManualMode is returned by Manual while no mode was set.
+var errNoManualMode = errors.New("no mode set manually")
+
+// Manual reports the mode set last through it, like with theme-switcher set,
+// until it's cleared. Its place in Precedence decides which sources a
+// manually set mode holds against.
+type Manual struct {
+	mu      sync.Mutex
+	mode    switcher.Mode
+	changed chan switcher.Mode
+}
+
+func (m *Manual) Name() string { return "manual" }
+
+// Get returns the mode set last, or errNoManualMode if there's none.
+func (m *Manual) Get(ctx context.Context) (switcher.Mode, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.mode == "" {
+		return "", errNoManualMode
+	}
+	return m.mode, nil
+}
+
+// Set remembers mode, and reports it to the watcher.
+func (m *Manual) Set(ctx context.Context, mode switcher.Mode) error {
+	m.mu.Lock()
+	m.mode = mode
+	changed := m.changed
+	m.mu.Unlock()
+
+	if changed != nil {
+		select {
+		case changed <- mode:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// Clear forgets the mode set last.
+func (m *Manual) Clear(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.mode = ""
+	return nil
+}
+
+// Watch writes every mode set to the returned channel.
+// Only one watcher is supported at a time.
+func (m *Manual) Watch(ctx context.Context) (<-chan switcher.Mode, error) {
+	changed := make(chan switcher.Mode)
+	m.mu.Lock()
+	m.changed = changed
+	m.mu.Unlock()
+
+	v := make(chan switcher.Mode)
+
+	go func() {
+		defer close(v)
+		defer func() {
+			m.mu.Lock()
+			if m.changed == changed {
+				m.changed = nil
+			}
+			m.mu.Unlock()
+		}()
+
+		for {
+			select {
+			case mode := <-changed:
+				select {
+				case v <- mode:
+				case <-ctx.Done():
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return v, nil
+}
+
+// Precedence follows the source of the highest precedence that's available,
+// so multiple sources don't fight over the mode. Sources are unavailable
+// while they're unable to report a mode, like a missing sensor.
+// Changes of sources of a lower precedence than the one followed are ignored.
+// A Manual source in Sources is cleared by changes of the sources before it.
+type Precedence struct {
+	// Sources are the sources to follow, highest precedence first.
+	Sources []switcher.Source
+
+	// cleared is signalled once Manual sources were cleared.
+	cleared chan struct{}
+	once    sync.Once
+}
+
+func (p *Precedence) Name() string {
+	names := make([]string, len(p.Sources))
+	for i, source := range p.Sources {
+		names[i] = source.Name()
+	}
+	return strings.Join(names, ",")
+}
+
+func (p *Precedence) init() {
+	p.once.Do(func() {
+		p.cleared = make(chan struct{}, 1)
+	})
+}
+
+// Get returns the mode of the first source of Sources able to report one.
+func (p *Precedence) Get(ctx context.Context) (switcher.Mode, error) {
+	var errs []string
+	for _, source := range p.Sources {
+		mode, err := source.Get(ctx)
+		if err == nil {
+			return mode, nil
+		}
+		errs = append(errs, fmt.Sprintf("%s: %v", source.Name(), err))
+	}
+	return "", fmt.Errorf("no source available: %s", strings.Join(errs, ", "))
+}
+
+// Set remembers mode in the Manual sources of Sources.
+// With none, it's followed until the next change of any source.
+func (p *Precedence) Set(ctx context.Context, mode switcher.Mode) error {
+	for _, source := range p.Sources {
+		if manual, ok := source.(*Manual); ok {
+			if err := manual.Set(ctx, mode); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Clear clears the Manual sources of Sources, following the others again.
+func (p *Precedence) Clear(ctx context.Context) error {
+	p.init()
+	for _, source := range p.Sources {
+		if manual, ok := source.(*Manual); ok {
+			if err := manual.Clear(ctx); err != nil {
+				return err
+			}
+		}
+	}
+	select {
+	case p.cleared <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// sourceMode is a mode reported by one of Sources, by index.
+type sourceMode struct {
+	i    int
+	mode switcher.Mode
+}
+
+// appearanceSource returns the index of the first of Sources reporting
+// Appearance, or -1 if there's none. Other settings than the mode aren't
+// ordered by precedence, as most sources don't know about them.
+func (p *Precedence) appearanceSource() int {
+	for i, source := range p.Sources {
+		if _, ok := source.(switcher.AppearanceSource); ok {
+			return i
+		}
+	}
+	return -1
+}
+
+// Appearance returns the Appearance of the first of Sources reporting one.
+func (p *Precedence) Appearance(ctx context.Context) (switcher.Appearance, error) {
+	i := p.appearanceSource()
+	if i < 0 {
+		return switcher.Appearance{}, nil
+	}
+	return readAppearance(ctx, p.Sources[i])
+}
+
+// Watch watches all sources, and writes the mode of the one of the highest
+// precedence available to the returned channel whenever it changes.
+func (p *Precedence) Watch(ctx context.Context) (<-chan switcher.Mode, error) {
+	events, err := p.WatchEvents(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return modes(ctx, events), nil
+}
+
+// WatchEvents watches all sources, and reports the mode of the one of the
+// highest precedence available whenever it changes, and the other events of
+// the one Appearance is read from.
+// Sources failing to be watched are unavailable.
+// The channel is closed once any watch stops, so all of them are restarted.
+func (p *Precedence) WatchEvents(ctx context.Context) (<-chan switcher.Event, error) {
+	p.init()
+
+	ctx, cancel := context.WithCancel(ctx)
+
+	// modes are the current ones of all sources, or empty while unavailable.
+	modes := make([]switcher.Mode, len(p.Sources))
+	changes := make(chan sourceMode)
+	others := make(chan switcher.Event)
+	stopped := make(chan int, len(p.Sources))
+	appearanceSource := p.appearanceSource()
+	watching := 0
+	for i, source := range p.Sources {
+		ch, err := watchEvents(ctx, source)
+		if err != nil {
+			log.WithError(err).WithField("source", source.Name()).Warn("unable to watch, ignoring it")
+			continue
+		}
+		watching++
+		if mode, err := source.Get(ctx); err == nil {
+			modes[i] = mode
+		} else {
+			log.WithError(err).WithField("source", source.Name()).Debug("unable to get current mode")
+		}
+
+		go func(i int, ch <-chan switcher.Event) {
+			for event := range ch {
+				if event.Kind != switcher.ColorSchemeChanged {
+					if i != appearanceSource {
+						continue
+					}
+					select {
+					case others <- event:
+					case <-ctx.Done():
+					}
+					continue
+				}
+				select {
+				case changes <- sourceMode{i, event.Mode}:
+				case <-ctx.Done():
+				}
+			}
+			stopped <- i
+		}(i, ch)
+	}
+	if watching == 0 {
+		cancel()
+		return nil, errors.New("unable to watch any source")
+	}
+
+	// effective returns the mode of the first available source.
+	effective := func() (switcher.Mode, int) {
+		for i, mode := range modes {
+			if mode != "" {
+				return mode, i
+			}
+		}
+		return "", -1
+	}
+	last, _ := effective()
+
+	v := make(chan switcher.Event)
+
+	go func() {
+		defer close(v)
+		defer cancel()
+
+		for {
+			select {
+			case event := <-others:
+				select {
+				case v <- event:
+				case <-ctx.Done():
+					return
+				}
+				continue
+			case change := <-changes:
+				if modes[change.i] == change.mode {
+					continue
+				}
+				modes[change.i] = change.mode
+				source := p.Sources[change.i]
+				if _, followed := effective(); followed < change.i {
+					log.WithField("source", source.Name()).Debugf("ignoring new mode %s, following %s", change.mode, p.Sources[followed].Name())
+					continue
+				}
+				// changes of sources before Manual ones override them.
+				for i := change.i + 1; i < len(p.Sources); i++ {
+					if manual, ok := p.Sources[i].(*Manual); ok && modes[i] != "" {
+						log.WithField("source", source.Name()).Infof("manually set mode %s overridden", modes[i])
+						_ = manual.Clear(ctx)
+						modes[i] = ""
+					}
+				}
+			case <-p.cleared:
+				for i, source := range p.Sources {
+					if _, ok := source.(*Manual); ok {
+						modes[i] = ""
+					}
+				}
+			case i := <-stopped:
+				if ctx.Err() == nil {
+					log.WithField("source", p.Sources[i].Name()).Warn("watch stopped")
+				}
+				return
+			case <-ctx.Done():
+				return
+			}
+
+			mode, _ := effective()
+			if mode == "" || mode == last {
+				continue
+			}
+			last = mode
+			select {
+			case v <- switcher.Event{Kind: switcher.ColorSchemeChanged, Mode: mode}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return v, nil
+}
@@ -0,0 +1,153 @@
+package sources
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Presenting tells to pause switching while presenting: while the screen is
+// shared, or a window is fullscreen. As neither can be subscribed to, both
+// are polled.
+type Presenting struct {
+	// ScreenCast pauses while the screen is shared, according to the video
+	// streams of PipeWire, which all portal screencasts go through.
+	ScreenCast bool
+	// Fullscreen pauses while the active window is fullscreen. This is only
+	// known on X11.
+	Fullscreen bool
+
+	// PollInterval is how often is checked whether we're presenting.
+	// Defaults to 2 seconds.
+	PollInterval time.Duration
+}
+
+func (p *Presenting) Name() string { return "presenting" }
+
+// pwObject is the part of an object dumped by pw-dump we're interested in.
+type pwObject struct {
+	Type string `json:"type"`
+	Info struct {
+		State string                     `json:"state"`
+		Props map[string]json.RawMessage `json:"props"`
+	} `json:"info"`
+}
+
+// screenCasting returns true if PipeWire has a running video source which
+// isn't a camera, which is what compositors share the screen as.
+func screenCasting(ctx context.Context) (bool, error) {
+	out, err := exec.CommandContext(ctx, "pw-dump", "--no-colors").Output()
+	if err != nil {
+		return false, fmt.Errorf("unable to dump PipeWire objects: %w", err)
+	}
+
+	var objects []pwObject
+	if err := json.Unmarshal(out, &objects); err != nil {
+		return false, fmt.Errorf("unable to parse PipeWire objects: %w", err)
+	}
+	for _, object := range objects {
+		if object.Type != "PipeWire:Interface:Node" || object.Info.State != "running" {
+			continue
+		}
+		var class string
+		if err := json.Unmarshal(object.Info.Props["media.class"], &class); err != nil || class != "Video/Source" {
+			continue
+		}
+		// cameras are backed by a device.
+		if _, ok := object.Info.Props["device.api"]; ok {
+			continue
+		}
+		if _, ok := object.Info.Props["device.id"]; ok {
+			continue
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+// fullscreen returns true if the active X11 window is fullscreen.
+// Without an X11 display, nothing is fullscreen.
+func fullscreen(ctx context.Context) (bool, error) {
+	if os.Getenv("DISPLAY") == "" {
+		return false, nil
+	}
+
+	// prints like "_NET_ACTIVE_WINDOW(WINDOW): window id # 0x1e00007".
+	out, err := exec.CommandContext(ctx, "xprop", "-root", "_NET_ACTIVE_WINDOW").Output()
+	if err != nil {
+		return false, fmt.Errorf("unable to get active window: %w", err)
+	}
+	_, window, _ := strings.Cut(strings.TrimSpace(string(out)), "# ")
+	if window == "" || window == "0x0" {
+		return false, nil
+	}
+
+	out, err = exec.CommandContext(ctx, "xprop", "-id", window, "_NET_WM_STATE").Output()
+	if err != nil {
+		return false, fmt.Errorf("unable to get state of window %s: %w", window, err)
+	}
+	return strings.Contains(string(out), "_NET_WM_STATE_FULLSCREEN"), nil
+}
+
+// presenting returns true if we're presenting. Failing checks are logged,
+// and count as not presenting.
+func (p *Presenting) presenting(ctx context.Context) bool {
+	if p.ScreenCast {
+		if casting, err := screenCasting(ctx); err != nil {
+			log.WithError(err).Debug("unable to check for screencasts")
+		} else if casting {
+			return true
+		}
+	}
+	if p.Fullscreen {
+		if full, err := fullscreen(ctx); err != nil {
+			log.WithError(err).Debug("unable to check for fullscreen windows")
+		} else if full {
+			return true
+		}
+	}
+	return false
+}
+
+// WatchPaused polls whether we're presenting, and writes it to the returned
+// channel whenever it changes, or right away if we're already presenting.
+func (p *Presenting) WatchPaused(ctx context.Context) (<-chan bool, error) {
+	interval := p.PollInterval
+	if interval == 0 {
+		interval = 2 * time.Second
+	}
+
+	v := make(chan bool)
+
+	go func() {
+		defer close(v)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		last := false
+		for {
+			if presenting := p.presenting(ctx); presenting != last {
+				last = presenting
+				select {
+				case v <- presenting:
+				case <-ctx.Done():
+					return
+				}
+			}
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return v, nil
+}
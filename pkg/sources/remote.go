@@ -0,0 +1,183 @@
+package sources
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/flokli/theme-switcher/internal/lines"
+	"github.com/flokli/theme-switcher/pkg/control"
+	"github.com/flokli/theme-switcher/pkg/switcher"
+	log "github.com/sirupsen/logrus"
+)
+
+// remoteTimeout is how long requests to the remote instance may take, except
+// for the event stream.
+const remoteTimeout = 10 * time.Second
+
+// Remote follows the mode of another theme-switcher instance, through the
+// HTTP API it serves with --http-listen, to keep multiple machines in sync.
+type Remote struct {
+	// URL is where the API is served, like http://desktop:8377, or unix:PATH.
+	URL string
+	// Token, if set, is sent to authenticate to the API.
+	Token string
+}
+
+func (r *Remote) Name() string { return "follow" }
+
+// client returns the HTTP client to use, and the base URL of the API.
+func (r *Remote) client() (*http.Client, string) {
+	if !strings.HasPrefix(r.URL, "unix:") {
+		return http.DefaultClient, strings.TrimSuffix(r.URL, "/")
+	}
+	path := strings.TrimPrefix(r.URL, "unix:")
+	var dialer net.Dialer
+	return &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return dialer.DialContext(ctx, "unix", path)
+		},
+	}}, "http://unix"
+}
+
+// authorize adds the token to req, if set.
+func (r *Remote) authorize(req *http.Request) {
+	if r.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+r.Token)
+	}
+}
+
+// do sends a request to the API, and decodes its Response.
+func (r *Remote) do(ctx context.Context, method, endpoint string, req *control.Request) (control.Response, error) {
+	ctx, cancel := context.WithTimeout(ctx, remoteTimeout)
+	defer cancel()
+
+	client, base := r.client()
+	var body bytes.Buffer
+	if req != nil {
+		if err := json.NewEncoder(&body).Encode(req); err != nil {
+			return control.Response{}, err
+		}
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, method, base+endpoint, &body)
+	if err != nil {
+		return control.Response{}, err
+	}
+	if req != nil {
+		httpReq.Header.Set("Content-Type", "application/json")
+	}
+	r.authorize(httpReq)
+
+	httpResp, err := client.Do(httpReq)
+	if err != nil {
+		return control.Response{}, fmt.Errorf("unable to reach %s: %w", r.URL, err)
+	}
+	defer httpResp.Body.Close()
+
+	var resp control.Response
+	if err := json.NewDecoder(httpResp.Body).Decode(&resp); err != nil {
+		return control.Response{}, fmt.Errorf("unable to decode response of %s: %w", r.URL, err)
+	}
+	if !resp.OK {
+		return resp, fmt.Errorf("%s: %s", r.URL, resp.Error)
+	}
+	return resp, nil
+}
+
+// Get returns the mode the remote instance applied last.
+func (r *Remote) Get(ctx context.Context) (switcher.Mode, error) {
+	resp, err := r.do(ctx, http.MethodGet, "/status", nil)
+	if err != nil {
+		return "", err
+	}
+	if resp.Mode == "" {
+		return "", errors.New("remote mode not known yet")
+	}
+	return switcher.ParseMode(resp.Mode)
+}
+
+// Set sets the mode of the remote instance, so all machines switch along.
+func (r *Remote) Set(ctx context.Context, mode switcher.Mode) error {
+	_, err := r.do(ctx, http.MethodPost, "/mode", &control.Request{Mode: string(mode)})
+	return err
+}
+
+// Clear clears an override of the remote instance.
+func (r *Remote) Clear(ctx context.Context) error {
+	_, err := r.do(ctx, http.MethodPost, "/mode", &control.Request{Mode: "auto"})
+	return err
+}
+
+// Watch subscribes to the events of the remote instance, and writes every
+// mode it applies to the returned channel. The channel is closed once the
+// connection is lost.
+func (r *Remote) Watch(ctx context.Context) (<-chan switcher.Mode, error) {
+	client, base := r.client()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, base+"/events", nil)
+	if err != nil {
+		return nil, err
+	}
+	r.authorize(req)
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("unable to reach %s: %w", r.URL, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("unable to subscribe to %s: %s", r.URL, resp.Status)
+	}
+
+	v := make(chan switcher.Mode)
+
+	go func() {
+		defer close(v)
+		defer resp.Body.Close()
+
+		// server-sent events, only the data lines matter.
+		reader := lines.NewReader(resp.Body, lines.MaxLength)
+		for {
+			raw, err := reader.Read()
+			if errors.Is(err, lines.ErrTooLong) {
+				log.Warnf("skipping a line of more than %d bytes from %s", lines.MaxLength, r.URL)
+				continue
+			} else if err != nil {
+				if ctx.Err() == nil {
+					if errors.Is(err, io.EOF) {
+						err = nil
+					}
+					log.WithError(err).Warnf("lost connection to %s", r.URL)
+				}
+				return
+			}
+			line := string(raw)
+			if !strings.HasPrefix(line, "data:") {
+				continue
+			}
+			data := strings.TrimPrefix(line, "data:")
+			var event control.Event
+			if err := json.Unmarshal([]byte(strings.TrimSpace(data)), &event); err != nil {
+				log.WithError(err).Warn("unable to decode remote event")
+				continue
+			}
+			mode, err := switcher.ParseMode(event.Mode)
+			if err != nil {
+				log.WithError(err).Warn("unexpected remote mode")
+				continue
+			}
+			select {
+			case v <- mode:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return v, nil
+}
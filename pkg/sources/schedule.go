@@ -0,0 +1,184 @@
+package sources
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/flokli/theme-switcher/pkg/switcher"
+)
+
+// Schedule switches to light mode and to dark mode at fixed times of day,
+// in the local time zone.
+type Schedule struct {
+	// Light and Dark are when to switch to the respective mode, as the time
+	// since midnight.
+	Light time.Duration
+	Dark  time.Duration
+
+	// Weekdays overrides Light and Dark on some days of the week.
+	Weekdays map[time.Weekday]SwitchTimes
+}
+
+// SwitchTimes are when to switch to light mode and to dark mode on a day,
+// as the time since midnight.
+type SwitchTimes struct {
+	Light time.Duration
+	Dark  time.Duration
+}
+
+func (s *Schedule) Name() string { return "schedule" }
+
+// ParseSchedule parses a schedule like "07:00-19:00", the time range light
+// mode is used in. Dark mode is used the rest of the day.
+func ParseSchedule(s string) (*Schedule, error) {
+	times, err := parseSwitchTimes(s)
+	if err != nil {
+		return nil, err
+	}
+	return &Schedule{Light: times.Light, Dark: times.Dark}, nil
+}
+
+// parseSwitchTimes parses a time range like "07:00-19:00" light mode is used in.
+func parseSwitchTimes(s string) (SwitchTimes, error) {
+	light, dark, ok := strings.Cut(s, "-")
+	if !ok {
+		return SwitchTimes{}, fmt.Errorf("invalid schedule %s, expected HH:MM-HH:MM", s)
+	}
+
+	var times SwitchTimes
+	var err error
+	if times.Light, err = parseTimeOfDay(light); err != nil {
+		return SwitchTimes{}, err
+	}
+	if times.Dark, err = parseTimeOfDay(dark); err != nil {
+		return SwitchTimes{}, err
+	}
+	if times.Light == times.Dark {
+		return SwitchTimes{}, fmt.Errorf("invalid schedule %s, light and dark mode start at the same time", s)
+	}
+	return times, nil
+}
+
+// weekdays are the days of the week by their abbreviation.
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// parseWeekdays parses a comma-separated list of days of the week, or
+// ranges of them, like "mon-fri" or "sat,sun".
+func parseWeekdays(s string) ([]time.Weekday, error) {
+	var days []time.Weekday
+	for _, part := range strings.Split(s, ",") {
+		from, to, isRange := strings.Cut(strings.ToLower(strings.TrimSpace(part)), "-")
+		first, ok := weekdays[from]
+		if !ok {
+			return nil, fmt.Errorf("invalid day of the week %s, expected one of mon, tue, wed, thu, fri, sat, sun", from)
+		}
+		last := first
+		if isRange {
+			if last, ok = weekdays[to]; !ok {
+				return nil, fmt.Errorf("invalid day of the week %s, expected one of mon, tue, wed, thu, fri, sat, sun", to)
+			}
+		}
+		// ranges can wrap around the end of the week, like "fri-mon".
+		for day := first; ; day = (day + 1) % 7 {
+			days = append(days, day)
+			if day == last {
+				break
+			}
+		}
+	}
+	return days, nil
+}
+
+// SetWeekdays parses days like "sat,sun" or "mon-fri", and a time range like
+// "09:00-21:00" for ParseSchedule, and uses it on those days.
+func (s *Schedule) SetWeekdays(days, schedule string) error {
+	parsedDays, err := parseWeekdays(days)
+	if err != nil {
+		return err
+	}
+	times, err := parseSwitchTimes(schedule)
+	if err != nil {
+		return err
+	}
+	if s.Weekdays == nil {
+		s.Weekdays = make(map[time.Weekday]SwitchTimes)
+	}
+	for _, day := range parsedDays {
+		s.Weekdays[day] = times
+	}
+	return nil
+}
+
+// parseTimeOfDay parses a time like "07:30", and returns the time since midnight.
+func parseTimeOfDay(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %s, expected HH:MM", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// at returns the time on the day of t at which the wall clock shows offset
+// since midnight. On DST changes, that's not the absolute offset.
+func at(t time.Time, offset time.Duration) time.Time {
+	year, month, day := t.Date()
+	return time.Date(year, month, day, int(offset/time.Hour), int(offset%time.Hour/time.Minute), 0, 0, t.Location())
+}
+
+// timesOn returns the switch times on the day of the week of t.
+func (s *Schedule) timesOn(t time.Time) SwitchTimes {
+	if times, ok := s.Weekdays[t.Weekday()]; ok {
+		return times
+	}
+	return SwitchTimes{Light: s.Light, Dark: s.Dark}
+}
+
+// modeAt returns the mode at t, and when it changes next.
+func (s *Schedule) modeAt(t time.Time) (switcher.Mode, time.Time) {
+	// look at the changes from yesterday to tomorrow, as the times can
+	// differ between days. The mode is the one of the last change before t,
+	// which also covers light mode over midnight, with Light after Dark.
+	var mode switcher.Mode
+	var last, next time.Time
+	for _, day := range []time.Time{t.AddDate(0, 0, -1), t, t.AddDate(0, 0, 1)} {
+		times := s.timesOn(day)
+		for _, change := range []struct {
+			at   time.Time
+			mode switcher.Mode
+		}{
+			{at(day, times.Light), switcher.Light},
+			{at(day, times.Dark), switcher.Dark},
+		} {
+			if change.at.After(t) {
+				if next.IsZero() || change.at.Before(next) {
+					next = change.at
+				}
+			} else if last.IsZero() || change.at.After(last) {
+				last, mode = change.at, change.mode
+			}
+		}
+	}
+	return mode, next
+}
+
+// Get returns the mode the schedule has at the current time.
+func (s *Schedule) Get(ctx context.Context) (switcher.Mode, error) {
+	mode, _ := s.modeAt(time.Now())
+	return mode, nil
+}
+
+// Watch writes the new mode to the returned channel whenever the schedule
+// switches.
+func (s *Schedule) Watch(ctx context.Context) (<-chan switcher.Mode, error) {
+	return watchClock(ctx, s.modeAt), nil
+}
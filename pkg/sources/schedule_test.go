@@ -0,0 +1,103 @@
+package sources
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/flokli/theme-switcher/pkg/switcher"
+)
+
+func TestParseSchedule(t *testing.T) {
+	s, err := ParseSchedule(" 07:30 - 19:00 ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Light != 7*time.Hour+30*time.Minute || s.Dark != 19*time.Hour {
+		t.Errorf("got %v-%v, want 7h30m-19h", s.Light, s.Dark)
+	}
+
+	for _, schedule := range []string{"", "07:00", "07:00-", "7-19", "25:00-07:00", "07:00-07:00"} {
+		if _, err := ParseSchedule(schedule); err == nil {
+			t.Errorf("ParseSchedule(%q) succeeded", schedule)
+		}
+	}
+}
+
+func TestParseWeekdays(t *testing.T) {
+	for _, tt := range []struct {
+		days string
+		want []time.Weekday
+	}{
+		{"mon", []time.Weekday{time.Monday}},
+		{"Sat, sun", []time.Weekday{time.Saturday, time.Sunday}},
+		{"mon-fri", []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday}},
+		{"fri-mon", []time.Weekday{time.Friday, time.Saturday, time.Sunday, time.Monday}},
+	} {
+		got, err := parseWeekdays(tt.days)
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseWeekdays(%q) = %v, %v, want %v", tt.days, got, err, tt.want)
+		}
+	}
+
+	for _, days := range []string{"", "monday", "mon-", "mon-foo"} {
+		if got, err := parseWeekdays(days); err == nil {
+			t.Errorf("parseWeekdays(%q) = %v, want an error", days, got)
+		}
+	}
+}
+
+func TestScheduleModeAt(t *testing.T) {
+	loc := time.FixedZone("test", 2*60*60)
+	// 2024-06-07 is a Friday.
+	date := func(day, hour, minute int) time.Time {
+		return time.Date(2024, time.June, day, hour, minute, 0, 0, loc)
+	}
+
+	weekend, err := ParseSchedule("07:00-19:00")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := weekend.SetWeekdays("sat,sun", "09:00-21:00"); err != nil {
+		t.Fatal(err)
+	}
+	if err := weekend.SetWeekdays("sat,sun", "09:00"); err == nil {
+		t.Error("SetWeekdays accepted an invalid schedule")
+	}
+	if err := weekend.SetWeekdays("someday", "09:00-21:00"); err == nil {
+		t.Error("SetWeekdays accepted an invalid day")
+	}
+
+	for _, tt := range []struct {
+		name     string
+		schedule string
+		at       time.Time
+		mode     switcher.Mode
+		next     time.Time
+	}{
+		{"before light", "07:00-19:00", date(7, 6, 59), switcher.Dark, date(7, 7, 0)},
+		{"at light", "07:00-19:00", date(7, 7, 0), switcher.Light, date(7, 19, 0)},
+		{"during light", "07:00-19:00", date(7, 12, 0), switcher.Light, date(7, 19, 0)},
+		{"at dark", "07:00-19:00", date(7, 19, 0), switcher.Dark, date(8, 7, 0)},
+		{"after midnight", "07:00-19:00", date(8, 0, 30), switcher.Dark, date(8, 7, 0)},
+		{"light over midnight, before", "22:00-06:00", date(7, 23, 0), switcher.Light, date(8, 6, 0)},
+		{"light over midnight, after", "22:00-06:00", date(8, 5, 0), switcher.Light, date(8, 6, 0)},
+		{"light over midnight, dark", "22:00-06:00", date(7, 12, 0), switcher.Dark, date(7, 22, 0)},
+		{"friday evening", "", date(7, 20, 0), switcher.Dark, date(8, 9, 0)},
+		{"saturday morning", "", date(8, 8, 0), switcher.Dark, date(8, 9, 0)},
+		{"saturday evening", "", date(8, 20, 0), switcher.Light, date(8, 21, 0)},
+		{"sunday night", "", date(9, 21, 30), switcher.Dark, date(10, 7, 0)},
+		{"monday morning", "", date(10, 7, 30), switcher.Light, date(10, 19, 0)},
+	} {
+		s := weekend
+		if tt.schedule != "" {
+			if s, err = ParseSchedule(tt.schedule); err != nil {
+				t.Fatal(err)
+			}
+		}
+		mode, next := s.modeAt(tt.at)
+		if mode != tt.mode || !next.Equal(tt.next) {
+			t.Errorf("%s: modeAt(%v) = %v, %v, want %v, %v", tt.name, tt.at, mode, next, tt.mode, tt.next)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package sources
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/flokli/theme-switcher/internal/sun"
+	"github.com/flokli/theme-switcher/pkg/switcher"
+	log "github.com/sirupsen/logrus"
+)
+
+// geoclueTimeout is how long geoclue may take to determine the location.
+const geoclueTimeout = 30 * time.Second
+
+// Sun switches to dark mode at sunset, and to light mode at sunrise.
+type Sun struct {
+	// Location is where sunrise and sunset are calculated for.
+	// If nil, it's looked up via geoclue once, and then remembered.
+	Location *Location
+
+	// LightOffset and DarkOffset shift the switch to light mode relative to
+	// sunrise, and to dark mode relative to sunset, like -30 minutes to
+	// switch to dark mode before it gets dark.
+	LightOffset time.Duration
+	DarkOffset  time.Duration
+
+	mu sync.Mutex
+}
+
+func (s *Sun) Name() string { return "sun" }
+
+// location returns the configured location, or asks geoclue for it.
+func (s *Sun) location(ctx context.Context) (Location, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.Location != nil {
+		return *s.Location, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, geoclueTimeout)
+	defer cancel()
+	l, err := geoclueLocation(ctx)
+	if err != nil {
+		return Location{}, err
+	}
+	log.WithField("location", l).Info("got location from geoclue")
+	s.Location = &l
+	return l, nil
+}
+
+// sunModeAt returns the mode at t, switching to light mode lightOffset after
+// sunrise, and to dark mode darkOffset after sunset, and when it changes next.
+// During polar day or night, the next change is checked for again in an hour.
+func sunModeAt(t time.Time, l Location, lightOffset, darkOffset time.Duration) (switcher.Mode, time.Time) {
+	// without any change before t, like during polar day or night, go by
+	// whether the sun is up.
+	mode := switcher.Dark
+	if sun.IsUp(t, l.Latitude, l.Longitude) {
+		mode = switcher.Light
+	}
+
+	// offsets can move changes to the previous or next day, so we look at
+	// the changes from yesterday to tomorrow. The mode is the one of the
+	// last change before t.
+	var last, next time.Time
+	for _, day := range []time.Time{t.AddDate(0, 0, -1), t, t.AddDate(0, 0, 1)} {
+		sunrise, sunset, ok := sun.Times(day, l.Latitude, l.Longitude)
+		if !ok {
+			continue
+		}
+		for _, change := range []struct {
+			at   time.Time
+			mode switcher.Mode
+		}{
+			{sunrise.Add(lightOffset), switcher.Light},
+			{sunset.Add(darkOffset), switcher.Dark},
+		} {
+			if change.at.After(t) {
+				if next.IsZero() || change.at.Before(next) {
+					next = change.at
+				}
+			} else if last.IsZero() || change.at.After(last) {
+				last, mode = change.at, change.mode
+			}
+		}
+	}
+	if next.IsZero() {
+		next = t.Add(time.Hour)
+	}
+	return mode, next
+}
+
+// Get returns dark mode between sunset and sunrise, and light mode otherwise.
+func (s *Sun) Get(ctx context.Context) (switcher.Mode, error) {
+	l, err := s.location(ctx)
+	if err != nil {
+		return "", err
+	}
+	mode, _ := sunModeAt(time.Now(), l, s.LightOffset, s.DarkOffset)
+	return mode, nil
+}
+
+// Watch writes the new mode to the returned channel at every sunrise and sunset.
+func (s *Sun) Watch(ctx context.Context) (<-chan switcher.Mode, error) {
+	l, err := s.location(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return watchClock(ctx, func(t time.Time) (switcher.Mode, time.Time) {
+		return sunModeAt(t, l, s.LightOffset, s.DarkOffset)
+	}), nil
+}
@@ -0,0 +1,86 @@
+package sources
+
+import (
+	"context"
+
+	"github.com/flokli/theme-switcher/pkg/switcher"
+	log "github.com/sirupsen/logrus"
+)
+
+// Synced wraps a source, and writes every mode it reports to another one,
+// like the GNOME color-scheme setting, so applications following that
+// switch along.
+type Synced struct {
+	switcher.Source
+	To switcher.Setter
+}
+
+// sync writes mode to To, logging failures.
+func (s *Synced) sync(ctx context.Context, mode switcher.Mode) {
+	if err := s.To.Set(ctx, mode); err != nil {
+		log.WithError(err).Warn("unable to write mode")
+	}
+}
+
+// Set writes mode to To, and to the wrapped source, if it supports it.
+func (s *Synced) Set(ctx context.Context, mode switcher.Mode) error {
+	if setter, ok := s.Source.(switcher.Setter); ok {
+		if err := setter.Set(ctx, mode); err != nil {
+			return err
+		}
+	}
+	return s.To.Set(ctx, mode)
+}
+
+// Clear clears the wrapped source, if it supports it.
+func (s *Synced) Clear(ctx context.Context) error {
+	if clearer, ok := s.Source.(switcher.Clearer); ok {
+		return clearer.Clear(ctx)
+	}
+	return nil
+}
+
+// Appearance returns the Appearance of the wrapped source, if it reports one.
+func (s *Synced) Appearance(ctx context.Context) (switcher.Appearance, error) {
+	return readAppearance(ctx, s.Source)
+}
+
+// Watch watches the wrapped source, writing the current mode, and every
+// change of it, to To.
+func (s *Synced) Watch(ctx context.Context) (<-chan switcher.Mode, error) {
+	events, err := s.WatchEvents(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return modes(ctx, events), nil
+}
+
+// WatchEvents is like Watch, but reports the events of the wrapped source.
+func (s *Synced) WatchEvents(ctx context.Context) (<-chan switcher.Event, error) {
+	events, err := watchEvents(ctx, s.Source)
+	if err != nil {
+		return nil, err
+	}
+
+	if mode, err := s.Source.Get(ctx); err != nil {
+		log.WithError(err).WithField("source", s.Source.Name()).Warn("unable to get current mode")
+	} else {
+		s.sync(ctx, mode)
+	}
+
+	v := make(chan switcher.Event)
+	go func() {
+		defer close(v)
+		for event := range events {
+			if event.Kind == switcher.ColorSchemeChanged {
+				s.sync(ctx, event.Mode)
+			}
+			select {
+			case v <- event:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return v, nil
+}
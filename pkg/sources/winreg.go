@@ -0,0 +1,12 @@
+package sources
+
+import "errors"
+
+// errNotWindows is returned by the Windows source on other platforms.
+var errNotWindows = errors.New("only supported on Windows")
+
+// Windows reads the mode from the AppsUseLightTheme value in
+// HKCU\Software\Microsoft\Windows\CurrentVersion\Themes\Personalize.
+type Windows struct{}
+
+func (w *Windows) Name() string { return "windows" }
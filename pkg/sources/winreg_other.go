@@ -0,0 +1,21 @@
+//go:build !windows
+
+package sources
+
+import (
+	"context"
+
+	"github.com/flokli/theme-switcher/pkg/switcher"
+)
+
+func (w *Windows) Get(ctx context.Context) (switcher.Mode, error) {
+	return "", errNotWindows
+}
+
+func (w *Windows) Set(ctx context.Context, mode switcher.Mode) error {
+	return errNotWindows
+}
+
+func (w *Windows) Watch(ctx context.Context) (<-chan switcher.Mode, error) {
+	return nil, errNotWindows
+}
@@ -0,0 +1,133 @@
+package sources
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/flokli/theme-switcher/pkg/switcher"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/registry"
+)
+
+const personalizeKey = `Software\Microsoft\Windows\CurrentVersion\Themes\Personalize`
+
+// Get returns the mode currently selected for apps in the Windows personalization settings.
+func (w *Windows) Get(ctx context.Context) (switcher.Mode, error) {
+	k, err := registry.OpenKey(registry.CURRENT_USER, personalizeKey, registry.QUERY_VALUE)
+	if err != nil {
+		if errors.Is(err, registry.ErrNotExist) {
+			return switcher.Light, nil
+		}
+		return "", fmt.Errorf("unable to open registry key: %w", err)
+	}
+	defer k.Close()
+
+	v, _, err := k.GetIntegerValue("AppsUseLightTheme")
+	if err != nil {
+		if errors.Is(err, registry.ErrNotExist) {
+			return switcher.Light, nil
+		}
+		return "", fmt.Errorf("unable to read AppsUseLightTheme: %w", err)
+	}
+
+	if v == 0 {
+		return switcher.Dark, nil
+	}
+	return switcher.Light, nil
+}
+
+// Set writes AppsUseLightTheme for the given mode.
+func (w *Windows) Set(ctx context.Context, mode switcher.Mode) error {
+	if switcher.IsDryRun(ctx) {
+		log.Infof("would set AppsUseLightTheme for %s mode", mode)
+		return nil
+	}
+
+	k, _, err := registry.CreateKey(registry.CURRENT_USER, personalizeKey, registry.SET_VALUE)
+	if err != nil {
+		return fmt.Errorf("unable to open registry key: %w", err)
+	}
+	defer k.Close()
+
+	var v uint32 = 1
+	if mode.Appearance() == switcher.Dark {
+		v = 0
+	}
+	if err := k.SetDWordValue("AppsUseLightTheme", v); err != nil {
+		return fmt.Errorf("unable to write AppsUseLightTheme: %w", err)
+	}
+	return nil
+}
+
+// Watch subscribes to changes of the Personalize registry key, and writes the
+// mode to the returned channel whenever it changes.
+func (w *Windows) Watch(ctx context.Context) (<-chan switcher.Mode, error) {
+	k, err := registry.OpenKey(registry.CURRENT_USER, personalizeKey, registry.NOTIFY|registry.QUERY_VALUE)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open registry key: %w", err)
+	}
+
+	event, err := windows.CreateEvent(nil, 0, 0, nil)
+	if err != nil {
+		k.Close()
+		return nil, fmt.Errorf("unable to create event: %w", err)
+	}
+
+	last, err := w.Get(ctx)
+	if err != nil {
+		k.Close()
+		windows.CloseHandle(event)
+		return nil, err
+	}
+
+	v := make(chan switcher.Mode)
+
+	go func() {
+		defer close(v)
+		defer k.Close()
+		defer windows.CloseHandle(event)
+
+		for {
+			// the notification needs to be requested again after each change.
+			if err := windows.RegNotifyChangeKeyValue(windows.Handle(k), false, windows.REG_NOTIFY_CHANGE_LAST_SET, event, true); err != nil {
+				log.WithError(err).Warn("unable to watch registry key")
+				return
+			}
+
+			// wait for the event, with a timeout so we notice ctx being done.
+			for {
+				if ctx.Err() != nil {
+					return
+				}
+				res, err := windows.WaitForSingleObject(event, 500)
+				if err != nil {
+					log.WithError(err).Warn("unable to wait for registry change")
+					return
+				}
+				if res == windows.WAIT_OBJECT_0 {
+					break
+				}
+			}
+
+			// other values in the key might have changed.
+			mode, err := w.Get(ctx)
+			if err != nil {
+				log.WithError(err).Warn("unable to read AppsUseLightTheme")
+				continue
+			}
+			if mode == last {
+				continue
+			}
+			last = mode
+			select {
+			case v <- mode:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return v, nil
+}
@@ -0,0 +1,167 @@
+package sources
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/flokli/theme-switcher/pkg/switcher"
+)
+
+// modeSource only reports modes, sent to modes.
+type modeSource struct {
+	mode  switcher.Mode
+	modes chan switcher.Mode
+}
+
+func (s *modeSource) Name() string { return "modes" }
+
+func (s *modeSource) Get(ctx context.Context) (switcher.Mode, error) {
+	if s.mode == "" {
+		return "", errors.New("unavailable")
+	}
+	return s.mode, nil
+}
+
+func (s *modeSource) Watch(ctx context.Context) (<-chan switcher.Mode, error) {
+	return s.modes, nil
+}
+
+// eventSource reports modes and appearance, sent to events.
+type eventSource struct {
+	mode       switcher.Mode
+	appearance switcher.Appearance
+	events     chan switcher.Event
+}
+
+func (s *eventSource) Name() string { return "events" }
+
+func (s *eventSource) Get(ctx context.Context) (switcher.Mode, error) { return s.mode, nil }
+
+func (s *eventSource) Watch(ctx context.Context) (<-chan switcher.Mode, error) {
+	return modes(ctx, s.events), nil
+}
+
+func (s *eventSource) WatchEvents(ctx context.Context) (<-chan switcher.Event, error) {
+	return s.events, nil
+}
+
+func (s *eventSource) Appearance(ctx context.Context) (switcher.Appearance, error) {
+	return s.appearance, nil
+}
+
+// receive returns the next event of events, failing the test after a second.
+func receive(t *testing.T, events <-chan switcher.Event) switcher.Event {
+	t.Helper()
+	select {
+	case event, ok := <-events:
+		if !ok {
+			t.Fatal("events closed")
+		}
+		return event
+	case <-time.After(time.Second):
+		t.Fatal("no event received")
+	}
+	return switcher.Event{}
+}
+
+func TestPrecedenceForwardsAppearance(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	inner := &eventSource{
+		mode:       switcher.Light,
+		appearance: switcher.Appearance{AccentColor: "#3584e4"},
+		events:     make(chan switcher.Event),
+	}
+	first := &modeSource{modes: make(chan switcher.Mode)}
+	p := &Precedence{Sources: []switcher.Source{first, inner}}
+
+	appearance, err := p.Appearance(ctx)
+	if err != nil || appearance != inner.appearance {
+		t.Fatalf("Appearance() = %v, %v, want %v", appearance, err, inner.appearance)
+	}
+
+	events, err := p.WatchEvents(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inner.events <- switcher.Event{Kind: switcher.AccentColorChanged, AccentColor: "#e62d42"}
+	if event := receive(t, events); event.Kind != switcher.AccentColorChanged || event.AccentColor != "#e62d42" {
+		t.Errorf("got %+v, want the accent color change", event)
+	}
+
+	// modes are still followed by precedence.
+	inner.events <- switcher.Event{Kind: switcher.ColorSchemeChanged, Mode: switcher.Dark}
+	if event := receive(t, events); event.Kind != switcher.ColorSchemeChanged || event.Mode != switcher.Dark {
+		t.Errorf("got %+v, want dark mode", event)
+	}
+	first.modes <- switcher.Light
+	if event := receive(t, events); event.Mode != switcher.Light {
+		t.Errorf("got %+v, want light mode of the first source", event)
+	}
+	inner.events <- switcher.Event{Kind: switcher.ColorSchemeChanged, Mode: switcher.Dark}
+	inner.events <- switcher.Event{Kind: switcher.ContrastChanged, HighContrast: true}
+	if event := receive(t, events); event.Kind != switcher.ContrastChanged {
+		t.Errorf("got %+v, want the contrast change, ignoring the mode of the second source", event)
+	}
+}
+
+func TestPowerSavingAppearance(t *testing.T) {
+	inner := &eventSource{appearance: switcher.Appearance{HighContrast: true}}
+	var source switcher.Source = &PowerSaving{Source: inner, Mode: switcher.Dark}
+	if _, ok := source.(switcher.EventSource); !ok {
+		t.Error("PowerSaving doesn't report events")
+	}
+	appearanceSource, ok := source.(switcher.AppearanceSource)
+	if !ok {
+		t.Fatal("PowerSaving doesn't report Appearance")
+	}
+	if appearance, err := appearanceSource.Appearance(context.Background()); err != nil || appearance != inner.appearance {
+		t.Errorf("Appearance() = %v, %v, want %v", appearance, err, inner.appearance)
+	}
+}
+
+// recordingSetter remembers the modes set.
+type recordingSetter struct {
+	modes []switcher.Mode
+}
+
+func (r *recordingSetter) Set(ctx context.Context, mode switcher.Mode) error {
+	r.modes = append(r.modes, mode)
+	return nil
+}
+
+func TestSyncedForwardsAppearance(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	inner := &eventSource{
+		mode:       switcher.Light,
+		appearance: switcher.Appearance{Wallpaper: "/tmp/wallpaper.jpg"},
+		events:     make(chan switcher.Event),
+	}
+	to := &recordingSetter{}
+	s := &Synced{Source: inner, To: to}
+
+	if appearance, err := s.Appearance(ctx); err != nil || appearance != inner.appearance {
+		t.Errorf("Appearance() = %v, %v, want %v", appearance, err, inner.appearance)
+	}
+
+	events, err := s.WatchEvents(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inner.events <- switcher.Event{Kind: switcher.WallpaperChanged, Wallpaper: "/tmp/other.jpg"}
+	if event := receive(t, events); event.Kind != switcher.WallpaperChanged || event.Wallpaper != "/tmp/other.jpg" {
+		t.Errorf("got %+v, want the wallpaper change", event)
+	}
+	inner.events <- switcher.Event{Kind: switcher.ColorSchemeChanged, Mode: switcher.Dark}
+	if event := receive(t, events); event.Mode != switcher.Dark {
+		t.Errorf("got %+v, want dark mode", event)
+	}
+	if want := []switcher.Mode{switcher.Light, switcher.Dark}; len(to.modes) != 2 || to.modes[0] != want[0] || to.modes[1] != want[1] {
+		t.Errorf("synced %v, want %v", to.modes, want)
+	}
+}
@@ -0,0 +1,97 @@
+package sources
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/flokli/theme-switcher/internal/xfconf"
+	"github.com/flokli/theme-switcher/pkg/switcher"
+	log "github.com/sirupsen/logrus"
+)
+
+// Xfce reads the mode from the GTK theme configured in Xfce, as Xfce has no
+// separate color scheme setting. Themes with "dark" in their name are dark,
+// all others light.
+type Xfce struct {
+	// Themes are the GTK themes Set applies for each mode.
+	Themes switcher.Themes
+}
+
+func (x *Xfce) Name() string { return "xfce" }
+
+// Detect returns nil if xfconfd is available.
+func (x *Xfce) Detect(ctx context.Context) error {
+	return xfconf.Available(ctx)
+}
+
+// Get returns the mode of the current GTK theme.
+func (x *Xfce) Get(ctx context.Context) (switcher.Mode, error) {
+	theme, ok, err := xfconf.GetString(ctx, xfconf.XSettingsChannel, xfconf.ThemeNameProperty)
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return "", errors.New("no Xfce GTK theme set")
+	}
+	return gtkThemeMode(theme), nil
+}
+
+// Set applies the GTK theme configured for mode.
+func (x *Xfce) Set(ctx context.Context, mode switcher.Mode) error {
+	theme, ok := x.Themes.Lookup(mode)
+	if !ok {
+		return fmt.Errorf("no Xfce theme configured for %s mode", mode)
+	}
+	if switcher.IsDryRun(ctx) {
+		log.Infof("would set %s %s to %s", xfconf.XSettingsChannel, xfconf.ThemeNameProperty, theme)
+		return nil
+	}
+	return xfconf.SetString(ctx, xfconf.XSettingsChannel, xfconf.ThemeNameProperty, theme)
+}
+
+// Watch subscribes to changes of the GTK theme, and writes the mode to the
+// returned channel whenever it changes.
+func (x *Xfce) Watch(ctx context.Context) (<-chan switcher.Mode, error) {
+	changes, err := xfconf.Watch(ctx, xfconf.XSettingsChannel)
+	if err != nil {
+		return nil, fmt.Errorf("unable to watch xfconf: %w", err)
+	}
+
+	last, err := x.Get(ctx)
+	if err != nil {
+		log.WithError(err).Warn("unable to read Xfce theme")
+	}
+
+	v := make(chan switcher.Mode)
+
+	go func() {
+		defer close(v)
+
+		for property := range changes {
+			if property != xfconf.ThemeNameProperty {
+				continue
+			}
+			mode, err := x.Get(ctx)
+			if err != nil {
+				log.WithError(err).Warn("unable to read Xfce theme")
+				continue
+			}
+			if mode == last {
+				continue
+			}
+			last = mode
+			select {
+			case v <- mode:
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		if ctx.Err() == nil {
+			log.Warn("lost connection to xfconf")
+		}
+	}()
+
+	return v, nil
+}
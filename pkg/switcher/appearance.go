@@ -0,0 +1,69 @@
+package switcher
+
+import (
+	"context"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Appearance holds appearance settings besides the mode, for backends able
+// to follow them.
+type Appearance struct {
+	// AccentColor is the accent color chosen by the user, as #rrggbb,
+	// or empty if there's none.
+	AccentColor string `json:"accent_color,omitempty"`
+	// HighContrast is set if the user asked for high contrast.
+	HighContrast bool `json:"high_contrast,omitempty"`
+	// Wallpaper is the path of the wallpaper shown in the current mode,
+	// or empty if it's not known.
+	Wallpaper string `json:"wallpaper,omitempty"`
+}
+
+// AppearanceSource is implemented by sources also reporting Appearance.
+// To report changes of it, they also need to implement EventSource.
+type AppearanceSource interface {
+	Appearance(ctx context.Context) (Appearance, error)
+}
+
+// ReadAppearance returns the Appearance reported by source, if it's an
+// AppearanceSource. Errors are logged, and result in an empty Appearance.
+func ReadAppearance(ctx context.Context, source Source) Appearance {
+	appearanceSource, ok := source.(AppearanceSource)
+	if !ok {
+		return Appearance{}
+	}
+	appearance, err := appearanceSource.Appearance(ctx)
+	if err != nil {
+		log.WithError(err).WithField("source", source.Name()).Warn("unable to read appearance")
+	}
+	return appearance
+}
+
+// Env returns environment variables passing the appearance to commands,
+// $THEME_SWITCHER_ACCENT_COLOR, $THEME_SWITCHER_HIGH_CONTRAST ("1" or "0")
+// and $THEME_SWITCHER_WALLPAPER.
+func (a Appearance) Env() []string {
+	highContrast := "0"
+	if a.HighContrast {
+		highContrast = "1"
+	}
+	return []string{
+		"THEME_SWITCHER_ACCENT_COLOR=" + a.AccentColor,
+		"THEME_SWITCHER_HIGH_CONTRAST=" + highContrast,
+		"THEME_SWITCHER_WALLPAPER=" + a.Wallpaper,
+	}
+}
+
+type appearanceKey struct{}
+
+// WithAppearance returns a context passing appearance to backends and hooks.
+func WithAppearance(ctx context.Context, appearance Appearance) context.Context {
+	return context.WithValue(ctx, appearanceKey{}, appearance)
+}
+
+// AppearanceFrom returns the Appearance passed with WithAppearance,
+// or an empty one.
+func AppearanceFrom(ctx context.Context) Appearance {
+	appearance, _ := ctx.Value(appearanceKey{}).(Appearance)
+	return appearance
+}
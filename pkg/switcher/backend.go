@@ -0,0 +1,45 @@
+package switcher
+
+import "context"
+
+// Themes maps each mode to the name of the theme a backend should use for it.
+type Themes map[Mode]string
+
+// Lookup returns the theme for mode, and whether there is one.
+// Without a theme for NoPreference, the one for Light is used, and without
+// one for a defined mode, the one of the mode it's based on.
+func (t Themes) Lookup(mode Mode) (string, bool) {
+	if theme, ok := t[mode]; ok {
+		return theme, true
+	}
+	if appearance := mode.Appearance(); appearance != mode {
+		theme, ok := t[appearance]
+		return theme, ok
+	}
+	return "", false
+}
+
+// For returns the theme for mode, like Lookup.
+func (t Themes) For(mode Mode) string {
+	theme, _ := t.Lookup(mode)
+	return theme
+}
+
+// Backend is an application integration that can switch its theme.
+type Backend interface {
+	// Name returns a short, unique, lowercase name of the backend, like "kitty".
+	Name() string
+
+	// Detect returns nil if the application is present on this system,
+	// or an error describing why the backend can't be used.
+	Detect(ctx context.Context) error
+
+	// Apply switches the application to the theme configured for the given mode.
+	Apply(ctx context.Context, mode Mode) error
+}
+
+// Themed is implemented by backends switching between named themes.
+type Themed interface {
+	// Theme returns the name of the theme used for the given mode.
+	Theme(mode Mode) string
+}
@@ -0,0 +1,28 @@
+package switcher
+
+import (
+	"context"
+	"time"
+)
+
+// DefaultCommandTimeout is the default time a single command run by a backend
+// may take.
+const DefaultCommandTimeout = 10 * time.Second
+
+type commandTimeoutKey struct{}
+
+// WithCommandTimeout returns a context telling backends how long each command
+// they run may take. Zero means no limit, besides the one of ctx.
+func WithCommandTimeout(ctx context.Context, timeout time.Duration) context.Context {
+	return context.WithValue(ctx, commandTimeoutKey{}, timeout)
+}
+
+// CommandContext returns a context to run a single command with, which is
+// done after the command timeout of ctx at the latest, so a hanging command
+// can't hold up the backend running it until the backend times out.
+func CommandContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if timeout, _ := ctx.Value(commandTimeoutKey{}).(time.Duration); timeout > 0 {
+		return context.WithTimeout(ctx, timeout)
+	}
+	return context.WithCancel(ctx)
+}
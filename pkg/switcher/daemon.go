@@ -0,0 +1,580 @@
+package switcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Daemon keeps backends in sync with a source, and allows controlling
+// and observing the current mode while it's running.
+type Daemon struct {
+	Switcher *Switcher
+	Source   Source
+
+	// Pauser, if set, defers changes of the source while it reports
+	// switching to be paused. Explicitly requested modes are still applied.
+	Pauser Pauser
+
+	// OnReady, if set, is called once the source is being watched.
+	OnReady func()
+
+	// OnHeartbeat, if set, is called every HeartbeatInterval from the main
+	// loop, so it stops being called if the loop hangs.
+	OnHeartbeat       func()
+	HeartbeatInterval time.Duration
+
+	// Debounce is how long changes of the source need to settle before
+	// they're applied, so bursts of changes only cause a single switch.
+	Debounce time.Duration
+
+	// ShutdownTimeout is how long backends still being applied when ctx is
+	// done may take to finish, before they're cancelled.
+	ShutdownTimeout time.Duration
+
+	requests chan request
+
+	// events publishes what was applied.
+	events Bus
+
+	mu            sync.Mutex
+	mode          Mode
+	appearance    Appearance
+	overrideUntil time.Time
+}
+
+// request is sent from the control methods to the main loop.
+type request struct {
+	kind requestKind
+	mode Mode
+	// until is when an override expires.
+	until time.Time
+	// switcher replaces the Switcher, for requestReplace.
+	switcher *Switcher
+}
+
+type requestKind int
+
+const (
+	// requestSet applies mode, and clears any override.
+	requestSet requestKind = iota
+	// requestOverride applies mode, and ignores source changes until the override expires.
+	requestOverride
+	// requestClearOverride clears any override, and applies the mode of the source.
+	requestClearOverride
+	// requestReapply applies the current mode again.
+	requestReapply
+	// requestReplace replaces the Switcher, and applies the current mode with it.
+	requestReplace
+)
+
+const (
+	// DefaultDebounce is the default time changes of the source need to settle.
+	DefaultDebounce = 200 * time.Millisecond
+	// DefaultShutdownTimeout is the default time backends may take to finish on shutdown.
+	DefaultShutdownTimeout = 10 * time.Second
+)
+
+// NewDaemon returns a Daemon applying modes from source using s.
+func NewDaemon(s *Switcher, source Source) *Daemon {
+	return &Daemon{
+		Switcher:        s,
+		Source:          source,
+		Debounce:        DefaultDebounce,
+		ShutdownTimeout: DefaultShutdownTimeout,
+		requests:        make(chan request),
+	}
+}
+
+// Run watches the source for changes, and applies the new mode to all backends
+// whenever it changes, until ctx is done.
+// The current mode is applied on startup, so applications are in sync
+// without waiting for the next change.
+// If watching the source fails later on, it's restarted with backoff.
+func (d *Daemon) Run(ctx context.Context) error {
+	chEvents, err := d.watch(ctx)
+	if err != nil {
+		return fmt.Errorf("unable to watch %s: %w", d.Source.Name(), err)
+	}
+
+	// backends are applied with a separate context, so shutting down doesn't
+	// interrupt them halfway. They're only cancelled if they don't finish
+	// within ShutdownTimeout.
+	base := context.Background()
+	if IsDryRun(ctx) {
+		base = WithDryRun(base)
+	}
+	applyCtx, cancelApply := context.WithCancel(base)
+	defer cancelApply()
+	go func() {
+		<-ctx.Done()
+		select {
+		case <-time.After(d.ShutdownTimeout):
+			log.Warn("backends didn't finish in time, cancelling")
+			cancelApply()
+		case <-applyCtx.Done():
+		}
+	}()
+
+	if d.OnReady != nil {
+		d.OnReady()
+	}
+
+	var heartbeat <-chan time.Time
+	if d.OnHeartbeat != nil && d.HeartbeatInterval > 0 {
+		ticker := time.NewTicker(d.HeartbeatInterval)
+		defer ticker.Stop()
+		heartbeat = ticker.C
+	}
+
+	// on startup, skip applying if the state shows it's not needed.
+	if mode, err := d.Source.Get(ctx); err != nil {
+		log.WithError(err).Warn("unable to get current mode")
+	} else if appearance := ReadAppearance(ctx, d.Source); d.Switcher.UpToDate(mode, appearance) {
+		log.Infof("current mode: %s, already applied", mode)
+		d.setMode(mode, appearance)
+	} else {
+		log.Infof("current mode: %s", mode)
+		d.apply(applyCtx, mode)
+	}
+
+	// reports new instances of applications, restarted with the Switcher.
+	chInstances, stopInstances := d.watchInstances(ctx)
+	defer func() { stopInstances() }()
+
+	// when the watch fails, chEvents is set to nil, and restarted once retry fires.
+	var retry <-chan time.Time
+	backoff := minRestartBackoff
+
+	// fires once an override expires.
+	var overrideExpired <-chan time.Time
+
+	// fires once changes of the source have settled, applying pending, or
+	// refreshing the backends subscribed to pendingKinds.
+	var debounced <-chan time.Time
+	var pending Mode
+	var pendingKinds []EventKind
+
+	// while paused, changes are deferred until the pauser reports switching may resume.
+	var chPaused <-chan bool
+	if d.Pauser != nil {
+		if chPaused, err = d.Pauser.WatchPaused(ctx); err != nil {
+			log.WithError(err).WithField("pauser", d.Pauser.Name()).Warn("unable to watch whether to pause, never pausing")
+		}
+	}
+	var paused, deferred bool
+
+	for {
+		// stop handling new events once we're shutting down.
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		select {
+		case event, ok := <-chEvents:
+			if !ok {
+				if ctx.Err() != nil {
+					return nil
+				}
+				log.WithField("source", d.Source.Name()).Warnf("watch stopped, restarting in %s", backoff)
+				chEvents = nil
+				retry = time.After(backoff)
+				continue
+			}
+			backoff = minRestartBackoff
+			if event.Kind == ColorSchemeChanged {
+				pending = event.Mode
+			} else {
+				pendingKinds = append(pendingKinds, event.Kind)
+			}
+			debounced = time.After(d.Debounce)
+		case <-chInstances:
+			pendingKinds = append(pendingKinds, InstancesStarted)
+			debounced = time.After(d.Debounce)
+		case <-debounced:
+			debounced = nil
+			mode, kinds := pending, pendingKinds
+			pending, pendingKinds = "", nil
+			if paused {
+				log.Info("deferring changes, paused")
+				deferred = true
+				continue
+			}
+			if mode != "" && !unchanged(mode, d.Mode()) {
+				if overrideExpired == nil {
+					log.Infof("new mode: %s", mode)
+					d.apply(applyCtx, mode)
+					continue
+				}
+				log.Infof("ignoring new mode %s, overridden", mode)
+			}
+			d.refresh(applyCtx, kinds)
+		case <-retry:
+			retry = nil
+			if chEvents, err = d.watch(ctx); err != nil {
+				backoff = nextBackoff(backoff)
+				log.WithError(err).WithField("source", d.Source.Name()).Warnf("unable to restart watch, retrying in %s", backoff)
+				retry = time.After(backoff)
+				continue
+			}
+			log.WithField("source", d.Source.Name()).Info("watch restarted")
+			// we might have missed changes while not watching.
+			if paused {
+				deferred = true
+			} else if overrideExpired == nil {
+				d.applyCurrent(applyCtx)
+			}
+		case <-overrideExpired:
+			log.Info("override expired")
+			overrideExpired = nil
+			d.setOverrideUntil(time.Time{})
+			if paused {
+				deferred = true
+				continue
+			}
+			d.applyCurrent(applyCtx)
+		case p, ok := <-chPaused:
+			if !ok {
+				if ctx.Err() != nil {
+					return nil
+				}
+				log.WithField("pauser", d.Pauser.Name()).Warn("watch stopped, no longer pausing")
+				chPaused = nil
+				p = false
+			}
+			if p == paused {
+				continue
+			}
+			paused = p
+			if paused {
+				log.Info("pausing switching")
+				continue
+			}
+			log.Info("resuming switching")
+			if deferred {
+				deferred = false
+				if overrideExpired == nil {
+					d.applyCurrent(applyCtx)
+				}
+			}
+		case req := <-d.requests:
+			switch req.kind {
+			case requestSet:
+				log.Infof("mode requested: %s", req.mode)
+				overrideExpired = nil
+				d.setOverrideUntil(time.Time{})
+				d.apply(applyCtx, req.mode)
+			case requestOverride:
+				log.Infof("mode overridden until %s: %s", req.until.Format(time.RFC3339), req.mode)
+				overrideExpired = time.After(time.Until(req.until))
+				d.setOverrideUntil(req.until)
+				d.apply(applyCtx, req.mode)
+			case requestClearOverride:
+				log.Info("override cleared")
+				overrideExpired = nil
+				d.setOverrideUntil(time.Time{})
+				d.applyCurrent(applyCtx)
+			case requestReapply:
+				log.Infof("reapplying mode: %s", req.mode)
+				d.apply(applyCtx, req.mode)
+			case requestReplace:
+				d.Switcher = req.switcher
+				stopInstances()
+				chInstances, stopInstances = d.watchInstances(ctx)
+				if mode := d.Mode(); mode != "" {
+					log.Infof("backends replaced, reapplying mode: %s", mode)
+					d.apply(applyCtx, mode)
+				}
+			}
+		case <-heartbeat:
+			d.OnHeartbeat()
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+const (
+	minRestartBackoff = time.Second
+	maxRestartBackoff = time.Minute
+)
+
+// nextBackoff doubles backoff, up to maxRestartBackoff.
+func nextBackoff(backoff time.Duration) time.Duration {
+	backoff *= 2
+	if backoff > maxRestartBackoff {
+		return maxRestartBackoff
+	}
+	return backoff
+}
+
+// watch starts watching the source, and reports its changes as events.
+// Sources only reporting modes are wrapped in ColorSchemeChanged events.
+// While the daemon is busy, only the latest event of each kind is kept.
+func (d *Daemon) watch(ctx context.Context) (<-chan Event, error) {
+	if eventSource, ok := d.Source.(EventSource); ok {
+		events, err := eventSource.WatchEvents(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return coalesce(ctx, events), nil
+	}
+
+	modes, err := d.Source.Watch(ctx)
+	if err != nil {
+		return nil, err
+	}
+	events := make(chan Event)
+	go func() {
+		defer close(events)
+		for mode := range modes {
+			select {
+			case events <- Event{Kind: ColorSchemeChanged, Mode: mode}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return coalesce(ctx, events), nil
+}
+
+// watchInstances watches for new instances of the applications of the
+// backends implementing InstanceWatcher, until ctx is done or it's stopped
+// with the returned function. Bursts of them are reported once on the
+// returned channel.
+func (d *Daemon) watchInstances(ctx context.Context) (<-chan struct{}, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	started := make(chan struct{}, 1)
+	for _, b := range d.Switcher.Backends {
+		watcher, ok := b.(InstanceWatcher)
+		if !ok {
+			continue
+		}
+		ch, err := watcher.WatchInstances(ctx)
+		if err != nil {
+			log.WithError(err).WithField("backend", b.Name()).Warn("unable to watch for new instances")
+			continue
+		}
+		go func(name string) {
+			for range ch {
+				log.WithField("backend", name).Debug("new instances started")
+				select {
+				case started <- struct{}{}:
+				default:
+				}
+			}
+		}(b.Name())
+	}
+	return started, cancel
+}
+
+// applyCurrent gets the current mode from the source, and applies it if it
+// changed, or refreshes the backends following the appearance if that changed.
+// This must only be called after the watch is set up, so we don't miss changes in between.
+func (d *Daemon) applyCurrent(ctx context.Context) {
+	mode, err := d.Source.Get(ctx)
+	if err != nil {
+		log.WithError(err).Warn("unable to get current mode")
+		return
+	}
+	if !unchanged(mode, d.Mode()) {
+		log.Infof("current mode: %s", mode)
+		d.apply(ctx, mode)
+		return
+	}
+	d.refresh(ctx, nil)
+}
+
+// unchanged returns whether a source reporting mode keeps the current mode:
+// sources only knowing light and dark report the mode a defined one is based
+// on.
+func unchanged(mode, current Mode) bool {
+	return mode == current || mode == current.Base()
+}
+
+// refresh applies the current mode again to the backends subscribed to the
+// changes of the appearance reported by the source, and to those subscribed
+// to kinds which can't be compared. The wallpaper can change without its path
+// changing, like with slideshows, and new instances don't change anything.
+func (d *Daemon) refresh(ctx context.Context, kinds []EventKind) {
+	mode := d.Mode()
+	if mode == "" {
+		return
+	}
+
+	appearance := ReadAppearance(ctx, d.Source)
+	changed := d.Appearance().changes(appearance)
+	for _, kind := range []EventKind{WallpaperChanged, InstancesStarted} {
+		if containsKind(kinds, kind) && !containsKind(changed, kind) {
+			changed = append(changed, kind)
+		}
+	}
+	if len(changed) == 0 {
+		log.Debugf("mode unchanged: %s", mode)
+		return
+	}
+
+	log.Infof("%s changed, refreshing", joinKinds(changed))
+	d.Switcher.Refresh(WithAppearance(ctx, appearance), mode, changed...)
+	d.setAppearance(appearance)
+}
+
+// containsKind returns true if kind is one of kinds.
+func containsKind(kinds []EventKind, kind EventKind) bool {
+	for _, k := range kinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// joinKinds returns kinds as a comma-separated list.
+func joinKinds(kinds []EventKind) string {
+	s := make([]string, len(kinds))
+	for i, kind := range kinds {
+		s[i] = string(kind)
+	}
+	return strings.Join(s, ", ")
+}
+
+// apply applies mode to all backends, along with the appearance reported by
+// the source, and notifies subscribers.
+func (d *Daemon) apply(ctx context.Context, mode Mode) {
+	appearance := ReadAppearance(ctx, d.Source)
+	// after a rollback, the previous mode is still applied.
+	state := d.Switcher.Apply(WithAppearance(ctx, appearance), mode)
+	d.setMode(state.Mode, appearance)
+}
+
+// setMode records mode and appearance as the current ones, and notifies subscribers.
+func (d *Daemon) setMode(mode Mode, appearance Appearance) {
+	d.mu.Lock()
+	d.mode = mode
+	d.mu.Unlock()
+
+	d.events.Publish(Event{Kind: ColorSchemeChanged, Mode: mode})
+	d.setAppearance(appearance)
+}
+
+// setAppearance records appearance as the current one, and notifies
+// subscribers of what changed.
+func (d *Daemon) setAppearance(appearance Appearance) {
+	d.mu.Lock()
+	previous := d.appearance
+	d.appearance = appearance
+	d.mu.Unlock()
+
+	for _, event := range previous.events(appearance) {
+		d.events.Publish(event)
+	}
+}
+
+// Mode returns the mode applied last, or an empty string if none has been applied yet.
+func (d *Daemon) Mode() Mode {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.mode
+}
+
+// Appearance returns the appearance applied last.
+func (d *Daemon) Appearance() Appearance {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.appearance
+}
+
+// OverrideUntil returns when the current override expires,
+// or the zero time if the mode isn't overridden.
+func (d *Daemon) OverrideUntil() time.Time {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.overrideUntil
+}
+
+func (d *Daemon) setOverrideUntil(until time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.overrideUntil = until
+}
+
+// send sends a request to the main loop.
+func (d *Daemon) send(ctx context.Context, req request) error {
+	select {
+	case d.requests <- req:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// SetMode applies mode to all backends, and writes it to the source
+// if it supports it. Any override is cleared.
+// Failing to write to the source is logged, but the mode is applied nonetheless.
+func (d *Daemon) SetMode(ctx context.Context, mode Mode) error {
+	if setter, ok := d.Source.(Setter); ok {
+		if err := setter.Set(ctx, mode); err != nil {
+			log.WithError(err).WithField("source", d.Source.Name()).Warn("unable to write mode to source")
+		}
+	}
+
+	return d.send(ctx, request{kind: requestSet, mode: mode})
+}
+
+// Override applies mode to all backends, and ignores changes of the source
+// for the given duration, or until the override is cleared.
+func (d *Daemon) Override(ctx context.Context, mode Mode, duration time.Duration) error {
+	if duration <= 0 {
+		return errors.New("override duration must be positive")
+	}
+	return d.send(ctx, request{kind: requestOverride, mode: mode, until: time.Now().Add(duration)})
+}
+
+// ClearOverride clears any override, and any mode set through the source if
+// it remembers them, and applies the current mode of the source.
+func (d *Daemon) ClearOverride(ctx context.Context) error {
+	if clearer, ok := d.Source.(Clearer); ok {
+		if err := clearer.Clear(ctx); err != nil {
+			log.WithError(err).WithField("source", d.Source.Name()).Warn("unable to clear mode of source")
+		}
+	}
+	return d.send(ctx, request{kind: requestClearOverride})
+}
+
+// Reapply applies the current mode to all backends again.
+func (d *Daemon) Reapply(ctx context.Context) error {
+	mode := d.Mode()
+	if mode == "" {
+		return errors.New("current mode not known yet")
+	}
+	return d.send(ctx, request{kind: requestReapply, mode: mode})
+}
+
+// Replace replaces the switcher with s, like after the configuration changed,
+// and applies the current mode to its backends.
+func (d *Daemon) Replace(ctx context.Context, s *Switcher) error {
+	return d.send(ctx, request{kind: requestReplace, switcher: s})
+}
+
+// Toggle switches to the opposite of the current mode, and returns it.
+func (d *Daemon) Toggle(ctx context.Context) (Mode, error) {
+	mode := d.Mode()
+	if mode == "" {
+		return "", errors.New("current mode not known yet")
+	}
+	mode = mode.Toggled()
+	return mode, d.SetMode(ctx, mode)
+}
+
+// Subscribe returns a channel receiving an event of the given kinds (or all,
+// if none are given) whenever the respective setting was applied, and a
+// function to unsubscribe.
+// ColorSchemeChanged is sent for every applied mode, even if it's unchanged.
+func (d *Daemon) Subscribe(kinds ...EventKind) (<-chan Event, func()) {
+	return d.events.Subscribe(kinds...)
+}
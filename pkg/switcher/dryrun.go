@@ -0,0 +1,17 @@
+package switcher
+
+import "context"
+
+type dryRunKey struct{}
+
+// WithDryRun returns a context telling backends, hooks and sources to only
+// log what they would change, instead of changing anything.
+func WithDryRun(ctx context.Context) context.Context {
+	return context.WithValue(ctx, dryRunKey{}, true)
+}
+
+// IsDryRun returns true if ctx was returned by WithDryRun.
+func IsDryRun(ctx context.Context) bool {
+	dryRun, _ := ctx.Value(dryRunKey{}).(bool)
+	return dryRun
+}
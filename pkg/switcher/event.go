@@ -0,0 +1,227 @@
+package switcher
+
+import (
+	"context"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// EventKind is the kind of setting an Event reports a change of.
+type EventKind string
+
+const (
+	// ColorSchemeChanged reports a new mode.
+	ColorSchemeChanged EventKind = "color-scheme"
+	// AccentColorChanged reports a new accent color.
+	AccentColorChanged EventKind = "accent-color"
+	// ContrastChanged reports high contrast being enabled or disabled.
+	ContrastChanged EventKind = "contrast"
+	// WallpaperChanged reports a new wallpaper.
+	WallpaperChanged EventKind = "wallpaper"
+	// InstancesStarted reports new instances of an application reported by
+	// an InstanceWatcher.
+	InstancesStarted EventKind = "instances"
+)
+
+// AppearanceEvents are the kinds of events reporting changes of Appearance.
+var AppearanceEvents = []EventKind{AccentColorChanged, ContrastChanged, WallpaperChanged}
+
+// Event reports a change of a setting.
+// Only the fields belonging to Kind are set.
+type Event struct {
+	Kind EventKind `json:"kind"`
+	// Mode is set for ColorSchemeChanged.
+	Mode Mode `json:"mode,omitempty"`
+	// AccentColor is set for AccentColorChanged, as #rrggbb, or empty if it was unset.
+	AccentColor string `json:"accent_color,omitempty"`
+	// HighContrast is set for ContrastChanged.
+	HighContrast bool `json:"high_contrast,omitempty"`
+	// Wallpaper is set for WallpaperChanged, as a path, or empty if it was unset.
+	Wallpaper string `json:"wallpaper,omitempty"`
+}
+
+// EventSource is implemented by sources reporting changes of settings other
+// than the color scheme.
+type EventSource interface {
+	// WatchEvents is like Watch, but reports changes of all settings
+	// the source knows about, as events.
+	WatchEvents(ctx context.Context) (<-chan Event, error)
+}
+
+// Subscriber is implemented by backends and hooks following settings
+// other than the color scheme, which they're always applied for.
+type Subscriber interface {
+	// Events returns the kinds of events the backend or hook needs to be
+	// applied again for, with the mode unchanged.
+	Events() []EventKind
+}
+
+// InstanceWatcher is implemented by backends switching the running instances
+// of an application, which instances started later don't pick up from its
+// configuration. They're applied again for InstancesStarted.
+type InstanceWatcher interface {
+	// WatchInstances reports new instances on the returned channel, until
+	// ctx is done.
+	WatchInstances(ctx context.Context) (<-chan struct{}, error)
+}
+
+// subscribes returns true if v, a Backend or Hook, is subscribed to any of kinds.
+func subscribes(v interface{}, kinds []EventKind) bool {
+	subscriber, ok := v.(Subscriber)
+	if !ok {
+		return false
+	}
+	for _, kind := range subscriber.Events() {
+		for _, k := range kinds {
+			if kind == k {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// busBuffer is how many events a subscriber can lag behind, before the
+// oldest ones are dropped.
+const busBuffer = 16
+
+// Bus distributes events to subscribers. The zero value is ready to use.
+type Bus struct {
+	mu          sync.Mutex
+	subscribers map[chan Event][]EventKind
+}
+
+// Subscribe returns a channel receiving all events of the given kinds, or all
+// events if none are given, and a function to unsubscribe.
+func (b *Bus) Subscribe(kinds ...EventKind) (<-chan Event, func()) {
+	ch := make(chan Event, busBuffer)
+
+	b.mu.Lock()
+	if b.subscribers == nil {
+		b.subscribers = make(map[chan Event][]EventKind)
+	}
+	b.subscribers[ch] = kinds
+	b.mu.Unlock()
+
+	return ch, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		delete(b.subscribers, ch)
+	}
+}
+
+// Publish sends e to all subscribers of its kind.
+// It doesn't block on slow subscribers, but drops their oldest event instead.
+func (b *Bus) Publish(e Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for ch, kinds := range b.subscribers {
+		if !wants(kinds, e.Kind) {
+			continue
+		}
+		select {
+		case ch <- e:
+		default:
+			// we're the only sender, so there's room after receiving one.
+			select {
+			case <-ch:
+			default:
+			}
+			ch <- e
+		}
+	}
+}
+
+// wants returns true if a subscription to kinds includes kind.
+func wants(kinds []EventKind, kind EventKind) bool {
+	if len(kinds) == 0 {
+		return true
+	}
+	for _, k := range kinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// changes returns the kinds of events describing the differences from a to b.
+func (a Appearance) changes(b Appearance) []EventKind {
+	var kinds []EventKind
+	if a.AccentColor != b.AccentColor {
+		kinds = append(kinds, AccentColorChanged)
+	}
+	if a.HighContrast != b.HighContrast {
+		kinds = append(kinds, ContrastChanged)
+	}
+	if a.Wallpaper != b.Wallpaper {
+		kinds = append(kinds, WallpaperChanged)
+	}
+	return kinds
+}
+
+// events returns the events describing the differences from a to b.
+func (a Appearance) events(b Appearance) []Event {
+	var events []Event
+	for _, kind := range a.changes(b) {
+		switch kind {
+		case AccentColorChanged:
+			events = append(events, Event{Kind: kind, AccentColor: b.AccentColor})
+		case ContrastChanged:
+			events = append(events, Event{Kind: kind, HighContrast: b.HighContrast})
+		case WallpaperChanged:
+			events = append(events, Event{Kind: kind, Wallpaper: b.Wallpaper})
+		}
+	}
+	return events
+}
+
+// coalesce forwards the events of in, keeping only the latest of each kind
+// while the receiver is busy, like applying a mode to a slow backend. So the
+// source is never blocked, and the receiver doesn't work through stale
+// events, like the modes of flip-flops in the meantime, once it's ready.
+// The returned channel is closed once ctx is done, or in is closed and the
+// pending events were received.
+func coalesce(ctx context.Context, in <-chan Event) <-chan Event {
+	out := make(chan Event)
+	go func() {
+		defer close(out)
+		var pending []Event
+		for in != nil || len(pending) > 0 {
+			// only try to send if there's something to.
+			var send chan<- Event
+			var next Event
+			if len(pending) > 0 {
+				send, next = out, pending[0]
+			}
+			select {
+			case event, ok := <-in:
+				if !ok {
+					in = nil
+					continue
+				}
+				pending = replaceEvent(pending, event)
+			case send <- next:
+				pending = pending[1:]
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// replaceEvent replaces the event of the same kind as event in pending, or
+// appends it if there's none.
+func replaceEvent(pending []Event, event Event) []Event {
+	for i, p := range pending {
+		if p.Kind == event.Kind {
+			log.WithField("kind", event.Kind).Debug("dropping stale event")
+			pending[i] = event
+			return pending
+		}
+	}
+	return append(pending, event)
+}
@@ -0,0 +1,142 @@
+package switcher
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// receiveAll reads n events of events, failing the test if they don't arrive
+// within a second.
+func receiveAll(t *testing.T, events <-chan Event, n int) []Event {
+	t.Helper()
+	var got []Event
+	for len(got) < n {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				t.Fatalf("events closed after %v", got)
+			}
+			got = append(got, event)
+		case <-time.After(time.Second):
+			t.Fatalf("got %v, want %d events", got, n)
+		}
+	}
+	return got
+}
+
+func equalEvents(a, b []Event) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestCoalesce(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		events []Event
+		want   []Event
+	}{
+		{
+			name: "replaces events of the same kind",
+			events: []Event{
+				{Kind: ColorSchemeChanged, Mode: Dark},
+				{Kind: AccentColorChanged, AccentColor: "#3584e4"},
+				{Kind: ColorSchemeChanged, Mode: Light},
+				{Kind: ColorSchemeChanged, Mode: Dark},
+			},
+			want: []Event{
+				{Kind: ColorSchemeChanged, Mode: Dark},
+				{Kind: AccentColorChanged, AccentColor: "#3584e4"},
+			},
+		},
+		{
+			name: "keeps the order of distinct kinds",
+			events: []Event{
+				{Kind: WallpaperChanged, Wallpaper: "/tmp/wallpaper.jpg"},
+				{Kind: ContrastChanged, HighContrast: true},
+				{Kind: ColorSchemeChanged, Mode: Light},
+			},
+			want: []Event{
+				{Kind: WallpaperChanged, Wallpaper: "/tmp/wallpaper.jpg"},
+				{Kind: ContrastChanged, HighContrast: true},
+				{Kind: ColorSchemeChanged, Mode: Light},
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			in := make(chan Event)
+			out := coalesce(ctx, in)
+			// nothing is received until all are sent, as if the daemon
+			// was busy switching.
+			for _, event := range tt.events {
+				in <- event
+			}
+			if got := receiveAll(t, out, len(tt.want)); !equalEvents(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+
+			// later events aren't held back.
+			in <- Event{Kind: ColorSchemeChanged, Mode: NoPreference}
+			if got := receiveAll(t, out, 1); got[0].Mode != NoPreference {
+				t.Errorf("got %v, want the last mode", got)
+			}
+		})
+	}
+}
+
+func TestCoalesceDrainsAfterClose(t *testing.T) {
+	in := make(chan Event)
+	out := coalesce(context.Background(), in)
+	want := []Event{
+		{Kind: ColorSchemeChanged, Mode: Dark},
+		{Kind: AccentColorChanged, AccentColor: "#e62d42"},
+	}
+	for _, event := range want {
+		in <- event
+	}
+	close(in)
+
+	if got := receiveAll(t, out, len(want)); !equalEvents(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	select {
+	case event, ok := <-out:
+		if ok {
+			t.Errorf("got %v after all pending events", event)
+		}
+	case <-time.After(time.Second):
+		t.Error("not closed once in is closed and drained")
+	}
+}
+
+func TestCoalesceStopsOnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	in := make(chan Event)
+	out := coalesce(ctx, in)
+	in <- Event{Kind: ColorSchemeChanged, Mode: Dark}
+	cancel()
+
+	// the pending event may still be sent, but then out is closed, although
+	// in isn't.
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case _, ok := <-out:
+			if !ok {
+				return
+			}
+		case <-timeout:
+			t.Fatal("not closed once ctx is done")
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package switcher
+
+import "context"
+
+// Stage describes when a hook is run.
+type Stage string
+
+const (
+	// Pre is before any backend is applied.
+	Pre Stage = "pre"
+	// Post is after all backends have been applied.
+	Post Stage = "post"
+)
+
+// Hook is run before and after a mode is applied to the backends.
+type Hook interface {
+	// Name returns a short, human-readable description of the hook.
+	Name() string
+
+	// Run runs the hook for the given stage and mode.
+	Run(ctx context.Context, stage Stage, mode Mode) error
+}
+
+// Guard is implemented by hooks deciding whether a backend is switched.
+type Guard interface {
+	// Allow returns whether the backend of the given name may be switched
+	// to mode this time.
+	Allow(ctx context.Context, backend string, mode Mode) (bool, error)
+}
@@ -0,0 +1,102 @@
+package switcher
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Mode is the color mode applications should be switched to.
+type Mode string
+
+const (
+	Light Mode = "light"
+	Dark  Mode = "dark"
+	// NoPreference is used if the user didn't choose between light and dark.
+	// Most applications treat it like light.
+	NoPreference Mode = "no-preference"
+)
+
+var (
+	customModesMu sync.RWMutex
+	// customModes maps the modes defined with DefineModes to the light or
+	// dark mode they're based on.
+	customModes map[Mode]Mode
+)
+
+// DefineModes replaces the modes available in addition to light, dark and no
+// preference, like "oled" or "high-contrast", mapped to the light or dark
+// mode each is based on. Backends without a theme for one use the theme of
+// the mode it's based on, and sources that only know light and dark get
+// that one.
+func DefineModes(modes map[Mode]Mode) error {
+	defined := make(map[Mode]Mode, len(modes))
+	for mode, base := range modes {
+		switch {
+		case mode == Light || mode == Dark || mode == NoPreference:
+			return fmt.Errorf("mode %s is built in", mode)
+		case mode == "" || mode == "auto":
+			return fmt.Errorf("invalid mode name: %q", mode)
+		case base != Light && base != Dark:
+			return fmt.Errorf("mode %s needs to be based on light or dark, not %s", mode, base)
+		}
+		defined[mode] = base
+	}
+	customModesMu.Lock()
+	defer customModesMu.Unlock()
+	customModes = defined
+	return nil
+}
+
+// CustomModes returns the modes defined with DefineModes, mapped to the mode
+// each is based on.
+func CustomModes() map[Mode]Mode {
+	customModesMu.RLock()
+	defer customModesMu.RUnlock()
+	modes := make(map[Mode]Mode, len(customModes))
+	for mode, base := range customModes {
+		modes[mode] = base
+	}
+	return modes
+}
+
+// ParseMode parses the name of a mode.
+func ParseMode(s string) (Mode, error) {
+	switch m := Mode(s); m {
+	case Light, Dark, NoPreference:
+		return m, nil
+	default:
+		customModesMu.RLock()
+		defer customModesMu.RUnlock()
+		if _, ok := customModes[m]; ok {
+			return m, nil
+		}
+		return "", fmt.Errorf("unknown mode: %s", s)
+	}
+}
+
+// Base returns the built-in mode m is based on: m itself for light, dark and
+// no preference, or the one a mode defined with DefineModes is based on.
+func (m Mode) Base() Mode {
+	customModesMu.RLock()
+	defer customModesMu.RUnlock()
+	if base, ok := customModes[m]; ok {
+		return base
+	}
+	return m
+}
+
+// Appearance returns Light or Dark, treating NoPreference like Light.
+func (m Mode) Appearance() Mode {
+	if m.Base() == Dark {
+		return Dark
+	}
+	return Light
+}
+
+// Toggled returns the opposite mode, treating NoPreference like Light.
+func (m Mode) Toggled() Mode {
+	if m.Appearance() == Dark {
+		return Light
+	}
+	return Dark
+}
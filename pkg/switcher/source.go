@@ -0,0 +1,42 @@
+package switcher
+
+import "context"
+
+// Source determines the mode applications should be in, like the desktop-wide color scheme.
+type Source interface {
+	// Name returns a short, unique, lowercase name of the source, like "gsettings".
+	Name() string
+
+	// Get returns the current mode.
+	Get(ctx context.Context) (Mode, error)
+
+	// Watch starts watching for changes, and writes the new mode to the
+	// returned channel whenever it changes.
+	// The channel is closed once ctx is done, or watching failed,
+	// in which case Watch can be called again.
+	Watch(ctx context.Context) (<-chan Mode, error)
+}
+
+// Setter is implemented by sources that can also be written to,
+// like the desktop-wide color scheme setting.
+type Setter interface {
+	Set(ctx context.Context, mode Mode) error
+}
+
+// Clearer is implemented by sources remembering modes set through them,
+// which they forget on Clear.
+type Clearer interface {
+	Clear(ctx context.Context) error
+}
+
+// Pauser tells when switching should be paused, like while presenting, so
+// applications don't change their theme in front of an audience.
+type Pauser interface {
+	// Name returns a short, lowercase name of the pauser, like "presenting".
+	Name() string
+
+	// WatchPaused starts watching, and writes whether switching should be
+	// paused to the returned channel whenever it changes.
+	// The channel is closed once ctx is done, or watching failed.
+	WatchPaused(ctx context.Context) (<-chan bool, error)
+}
@@ -0,0 +1,84 @@
+package switcher
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// State records the mode applied last, and how it went for each backend.
+type State struct {
+	Mode      Mode                    `json:"mode"`
+	AppliedAt time.Time               `json:"applied_at"`
+	Backends  map[string]BackendState `json:"backends"`
+	// Appearance is the further appearance settings applied along with Mode.
+	Appearance Appearance `json:"appearance"`
+	// RolledBack is set if applying another mode failed, and Mode was
+	// applied again instead.
+	RolledBack bool `json:"rolled_back,omitempty"`
+}
+
+// BackendState records the result of applying a mode to a single backend.
+type BackendState struct {
+	// Theme is the theme applied, if the backend reports it.
+	Theme string `json:"theme,omitempty"`
+	// Error is the error applying the mode, if any.
+	Error string `json:"error,omitempty"`
+	// Missing is why the backend was skipped, as its application isn't
+	// present, if it was.
+	Missing string `json:"missing,omitempty"`
+	// Skipped is the hook that decided not to switch the backend, if one
+	// did.
+	Skipped string `json:"skipped,omitempty"`
+}
+
+// DefaultStatePath returns the default path of the state file,
+// $XDG_STATE_HOME/theme-switcher/state.json.
+func DefaultStatePath() (string, error) {
+	stateDir := os.Getenv("XDG_STATE_HOME")
+	if stateDir == "" {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("unable to determine home dir: %w", err)
+		}
+		stateDir = filepath.Join(homeDir, ".local", "state")
+	}
+	return filepath.Join(stateDir, "theme-switcher", "state.json"), nil
+}
+
+// LoadState reads the state file at path.
+// It returns nil if there is none yet.
+func LoadState(path string) (*State, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("unable to read state file: %w", err)
+	}
+
+	var state State
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("unable to parse state file %s: %w", path, err)
+	}
+	return &state, nil
+}
+
+// Save writes the state file to path.
+func (s *State) Save(path string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("unable to create state dir: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return fmt.Errorf("unable to write state file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,506 @@
+package switcher
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/sync/errgroup"
+)
+
+// DefaultTimeout is the default time a single backend may take to apply a mode.
+const DefaultTimeout = 30 * time.Second
+
+// DefaultRetryDelay is the default time before retrying to apply a mode to a
+// backend the first time. It doubles with every further attempt.
+const DefaultRetryDelay = time.Second
+
+// MissingPolicy is what to do with backends whose application isn't present,
+// according to their Detect.
+type MissingPolicy string
+
+const (
+	// SkipMissing skips them, only logging it at debug level.
+	SkipMissing MissingPolicy = "skip"
+	// WarnMissing skips them with a warning.
+	WarnMissing MissingPolicy = "warn"
+	// FailMissing counts them as failed, without trying to apply the mode.
+	FailMissing MissingPolicy = "error"
+)
+
+// Switcher applies a mode to a list of backends.
+type Switcher struct {
+	Backends []Backend
+	Hooks    []Hook
+
+	// Timeout limits how long each backend may take to apply a mode,
+	// per attempt. Zero means no limit.
+	Timeout time.Duration
+
+	// CommandTimeout limits how long each command run by a backend may take,
+	// see CommandContext. Zero means no limit, besides Timeout.
+	CommandTimeout time.Duration
+
+	// Retries is how often applying a mode to a backend is retried after it
+	// failed, waiting RetryDelay before the first retry, and twice as long
+	// before every further one.
+	Retries    int
+	RetryDelay time.Duration
+
+	// MaxParallel limits how many backends are applied at the same time.
+	// Zero means no limit.
+	MaxParallel int
+
+	// Rollback switches all backends back to the previously applied mode if
+	// any of them failed, so they don't end up with mixed modes.
+	Rollback bool
+
+	// After maps backend names to the names of backends that need to be
+	// applied before them. Backends not depending on each other are still
+	// applied concurrently.
+	After map[string][]string
+
+	// Barriers are the names of backends all others are applied after,
+	// except the ones they depend on according to After.
+	Barriers []string
+
+	// Delay maps backend names to how long to wait after applying them,
+	// before the backends after them are applied and the hooks run, for
+	// applications that take a moment until others see their change.
+	Delay map[string]time.Duration
+
+	// Missing is what to do with backends whose application isn't present.
+	// The zero value skips them, like SkipMissing.
+	Missing MissingPolicy
+
+	// StatePath, if set, is where the State is saved after applying a mode.
+	StatePath string
+}
+
+// New returns a Switcher applying modes to the passed backends.
+func New(backends ...Backend) *Switcher {
+	return &Switcher{Backends: backends, Timeout: DefaultTimeout, CommandTimeout: DefaultCommandTimeout}
+}
+
+// Apply switches all backends to the given mode, running all hooks before and after.
+// Backends are applied concurrently, up to MaxParallel at a time, so a hanging
+// one doesn't block the others.
+// Failures of individual backends or hooks are logged, and don't prevent the
+// remaining ones from being applied. With Rollback set, the backends that
+// were switched are switched back to the previously applied mode afterwards.
+func (s *Switcher) Apply(ctx context.Context, mode Mode) *State {
+	s.runHooks(ctx, s.Hooks, Pre, mode)
+
+	after := s.order()
+	if err := s.CheckOrder(); err != nil {
+		log.WithError(err).Warn("ignoring backend order")
+		after = nil
+	}
+
+	state := &State{
+		Mode:       mode,
+		AppliedAt:  time.Now(),
+		Backends:   s.applyAll(ctx, s.Backends, mode, after),
+		Appearance: AppearanceFrom(ctx),
+	}
+
+	if s.Rollback {
+		s.rollback(ctx, state, after)
+	}
+
+	s.runHooks(ctx, s.Hooks, Post, state.Mode)
+	s.saveState(ctx, state)
+
+	return state
+}
+
+// Refresh applies mode again to the backends and hooks subscribed to any of
+// kinds, after other settings than the color scheme changed. The saved state
+// of all other backends is kept.
+func (s *Switcher) Refresh(ctx context.Context, mode Mode, kinds ...EventKind) *State {
+	var backends []Backend
+	for _, b := range s.Backends {
+		if subscribes(b, kinds) {
+			backends = append(backends, b)
+		}
+	}
+	var hooks []Hook
+	for _, h := range s.Hooks {
+		if subscribes(h, kinds) {
+			hooks = append(hooks, h)
+		}
+	}
+
+	after := s.order()
+	if err := s.CheckOrder(); err != nil {
+		log.WithError(err).Warn("ignoring backend order")
+		after = nil
+	}
+
+	state := &State{Mode: mode}
+	if s.StatePath != "" {
+		if previous, err := LoadState(s.StatePath); err != nil {
+			log.WithError(err).Warn("unable to load state")
+		} else if previous != nil && previous.Mode == mode {
+			state = previous
+		}
+	}
+	if state.Backends == nil {
+		state.Backends = make(map[string]BackendState)
+	}
+	state.AppliedAt = time.Now()
+	state.Appearance = AppearanceFrom(ctx)
+
+	s.runHooks(ctx, hooks, Pre, mode)
+	for name, backendState := range s.applyAll(ctx, backends, mode, after) {
+		state.Backends[name] = backendState
+	}
+	s.runHooks(ctx, hooks, Post, mode)
+	s.saveState(ctx, state)
+
+	return state
+}
+
+// saveState saves state to StatePath, if set, unless this is a dry run.
+func (s *Switcher) saveState(ctx context.Context, state *State) {
+	if s.StatePath == "" || IsDryRun(ctx) {
+		return
+	}
+	if err := state.Save(s.StatePath); err != nil {
+		log.WithError(err).Warn("unable to save state")
+	}
+}
+
+// rollback switches the backends successfully switched to state.Mode back to
+// the previously applied mode, if any backend failed.
+func (s *Switcher) rollback(ctx context.Context, state *State, after map[string][]string) {
+	var failed, switched []Backend
+	for _, b := range s.Backends {
+		if state.Backends[b.Name()].Error != "" {
+			failed = append(failed, b)
+		} else {
+			switched = append(switched, b)
+		}
+	}
+	if len(failed) == 0 || len(switched) == 0 {
+		return
+	}
+
+	var previous *State
+	if s.StatePath != "" {
+		var err error
+		if previous, err = LoadState(s.StatePath); err != nil {
+			log.WithError(err).Warn("unable to load state")
+		}
+	}
+	if previous == nil || previous.Mode == state.Mode {
+		log.Warn("not rolling back, as the previously applied mode is unknown")
+		return
+	}
+
+	log.WithField("mode", previous.Mode).Warnf("%d backends failed, rolling back", len(failed))
+	state.Mode = previous.Mode
+	state.RolledBack = true
+	for name, backendState := range s.applyAll(ctx, switched, previous.Mode, after) {
+		state.Backends[name] = backendState
+	}
+}
+
+// applyAll switches backends to mode concurrently, and returns their states.
+// Backends are applied after the ones they depend on according to after,
+// as far as those are part of backends.
+func (s *Switcher) applyAll(ctx context.Context, backends []Backend, mode Mode, after map[string][]string) map[string]BackendState {
+	ctx = WithCommandTimeout(ctx, s.CommandTimeout)
+	states := make(map[string]BackendState, len(backends))
+	var mu sync.Mutex
+
+	// done is waited for until all backends of the same name were applied.
+	done := make(map[string]*sync.WaitGroup, len(backends))
+	for _, b := range backends {
+		if done[b.Name()] == nil {
+			done[b.Name()] = &sync.WaitGroup{}
+		}
+		done[b.Name()].Add(1)
+	}
+
+	// sem limits how many backends are applied at once.
+	var sem chan struct{}
+	if s.MaxParallel > 0 {
+		sem = make(chan struct{}, s.MaxParallel)
+	}
+
+	var g errgroup.Group
+	for _, b := range backends {
+		b := b
+		g.Go(func() error {
+			defer done[b.Name()].Done()
+			// the delay is waited for after giving up the slot, so it
+			// doesn't hold up other backends.
+			var delay time.Duration
+			defer func() { sleep(ctx, delay) }()
+
+			// wait for dependencies, which are applied even if one of them failed.
+			for _, dep := range after[b.Name()] {
+				if wg, ok := done[dep]; ok {
+					wg.Wait()
+				}
+			}
+
+			// only take a slot once dependencies are done, so they can't be starved.
+			if sem != nil {
+				sem <- struct{}{}
+				defer func() { <-sem }()
+			}
+
+			var backendState BackendState
+			if themed, ok := b.(Themed); ok {
+				backendState.Theme = themed.Theme(mode)
+			}
+
+			if err := b.Detect(ctx); err != nil {
+				s.missing(b, err, &backendState)
+			} else if guard := s.guard(ctx, b, mode); guard != "" {
+				log.WithField("backend", b.Name()).WithField("hook", guard).Info("skipping backend, as the hook decided")
+				backendState.Skipped = guard
+			} else {
+				if err := s.applyBackend(ctx, b, mode); err != nil {
+					log.WithError(err).WithField("backend", b.Name()).Warn("unable to apply mode")
+					backendState.Error = err.Error()
+				}
+				if !IsDryRun(ctx) {
+					delay = s.Delay[b.Name()]
+				}
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			states[b.Name()] = backendState
+			return nil
+		})
+	}
+	_ = g.Wait()
+
+	return states
+}
+
+// guard returns the name of the first hook not allowing b to be switched to
+// mode, or an empty string if all do. Hooks failing to decide allow it.
+func (s *Switcher) guard(ctx context.Context, b Backend, mode Mode) string {
+	for _, h := range s.Hooks {
+		guard, ok := h.(Guard)
+		if !ok {
+			continue
+		}
+		allowed, err := guard.Allow(ctx, b.Name(), mode)
+		if err != nil {
+			log.WithError(err).WithField("hook", h.Name()).WithField("backend", b.Name()).Warn("unable to decide whether to switch backend, switching it")
+			continue
+		}
+		if !allowed {
+			return h.Name()
+		}
+	}
+	return ""
+}
+
+// missing records in state that b wasn't applied, as Detect returned err,
+// according to the Missing policy.
+func (s *Switcher) missing(b Backend, err error, state *BackendState) {
+	logger := log.WithError(err).WithField("backend", b.Name())
+	switch s.Missing {
+	case FailMissing:
+		logger.Warn("backend not available")
+		state.Error = err.Error()
+	case WarnMissing:
+		logger.Warn("backend not available, skipping it")
+		state.Missing = err.Error()
+	default:
+		logger.Debug("backend not available, skipping it")
+		state.Missing = err.Error()
+	}
+}
+
+// applyBackend applies mode to a single backend, retrying failed attempts.
+func (s *Switcher) applyBackend(ctx context.Context, b Backend, mode Mode) error {
+	delay := s.RetryDelay
+	if delay <= 0 {
+		delay = DefaultRetryDelay
+	}
+
+	for attempt := 0; ; attempt++ {
+		err := s.applyOnce(ctx, b, mode)
+		if err == nil || attempt >= s.Retries || ctx.Err() != nil {
+			return err
+		}
+
+		log.WithError(err).WithField("backend", b.Name()).Infof("unable to apply mode, retrying in %s", delay)
+		t := time.NewTimer(delay)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return err
+		}
+		delay *= 2
+	}
+}
+
+// applyOnce applies mode to a single backend, within Timeout.
+func (s *Switcher) applyOnce(ctx context.Context, b Backend, mode Mode) error {
+	if s.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.Timeout)
+		defer cancel()
+	}
+
+	log.WithField("backend", b.Name()).WithField("mode", mode).Debug("applying mode")
+	return b.Apply(ctx, mode)
+}
+
+// sleep waits for d, or until ctx is done.
+func sleep(ctx context.Context, d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+	case <-ctx.Done():
+	}
+}
+
+// order returns After, with all backends but the Barriers, and the ones they
+// depend on, also depending on the Barriers.
+func (s *Switcher) order() map[string][]string {
+	if len(s.Barriers) == 0 {
+		return s.After
+	}
+	// exempt are the barriers, and the backends they depend on, directly
+	// or not, which can't wait for them.
+	exempt := make(map[string]bool)
+	var mark func(name string)
+	mark = func(name string) {
+		if exempt[name] {
+			return
+		}
+		exempt[name] = true
+		for _, dep := range s.After[name] {
+			mark(dep)
+		}
+	}
+	for _, name := range s.Barriers {
+		mark(name)
+	}
+
+	order := make(map[string][]string, len(s.Backends))
+	for name, deps := range s.After {
+		order[name] = deps
+	}
+	for _, b := range s.Backends {
+		if !exempt[b.Name()] {
+			order[b.Name()] = append(append([]string(nil), order[b.Name()]...), s.Barriers...)
+		}
+	}
+	return order
+}
+
+// CheckOrder returns an error if After, Barriers or Delay refer to unknown
+// backends, or After contains a cycle.
+func (s *Switcher) CheckOrder() error {
+	known := make(map[string]bool, len(s.Backends))
+	for _, b := range s.Backends {
+		known[b.Name()] = true
+	}
+	for _, name := range s.Barriers {
+		if !known[name] {
+			return fmt.Errorf("unknown barrier %s", name)
+		}
+	}
+	for name := range s.Delay {
+		if !known[name] {
+			return fmt.Errorf("delay set for unknown backend %s", name)
+		}
+	}
+	for name, deps := range s.After {
+		if !known[name] {
+			return fmt.Errorf("unknown backend %s", name)
+		}
+		for _, dep := range deps {
+			if !known[dep] {
+				return fmt.Errorf("%s depends on unknown backend %s", name, dep)
+			}
+		}
+	}
+
+	// depth-first search, visiting is set for backends on the current path.
+	visiting := make(map[string]bool)
+	visited := make(map[string]bool)
+	var visit func(name string) error
+	visit = func(name string) error {
+		if visiting[name] {
+			return fmt.Errorf("cyclic dependency on %s", name)
+		}
+		if visited[name] {
+			return nil
+		}
+		visiting[name] = true
+		for _, dep := range s.After[name] {
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		visiting[name] = false
+		visited[name] = true
+		return nil
+	}
+	for name := range s.After {
+		if err := visit(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UpToDate returns true if the saved state shows mode was applied last, with
+// the same themes and appearance, and without errors, so applying it again is
+// not needed.
+func (s *Switcher) UpToDate(mode Mode, appearance Appearance) bool {
+	if s.StatePath == "" {
+		return false
+	}
+
+	state, err := LoadState(s.StatePath)
+	if err != nil {
+		log.WithError(err).Warn("unable to load state")
+		return false
+	}
+	if state == nil || state.Mode != mode || state.Appearance != appearance || len(state.Backends) != len(s.Backends) {
+		return false
+	}
+
+	for _, b := range s.Backends {
+		backendState, ok := state.Backends[b.Name()]
+		// skipped backends are detected and decided on again, in case they
+		// were installed since, or would be switched now.
+		if !ok || backendState.Error != "" || backendState.Missing != "" || backendState.Skipped != "" {
+			return false
+		}
+		if themed, ok := b.(Themed); ok && themed.Theme(mode) != backendState.Theme {
+			return false
+		}
+	}
+	return true
+}
+
+// runHooks runs hooks for the given stage.
+func (s *Switcher) runHooks(ctx context.Context, hooks []Hook, stage Stage, mode Mode) {
+	for _, h := range hooks {
+		log.WithField("hook", h.Name()).WithField("stage", stage).Debug("running hook")
+		if err := h.Run(ctx, stage, mode); err != nil {
+			log.WithError(err).WithField("hook", h.Name()).Warn("unable to run hook")
+		}
+	}
+}